@@ -1,30 +1,114 @@
 package main
 
 import (
+	"context"
 	"expense-tracker/internal/api"
+	"expense-tracker/internal/auth"
+	"expense-tracker/internal/budgets"
 	"expense-tracker/internal/config"
+	"expense-tracker/internal/currency"
 	"expense-tracker/internal/database"
 	"expense-tracker/internal/handlers"
+	"expense-tracker/internal/mail"
+	"expense-tracker/internal/recurring"
+	"expense-tracker/internal/storage"
 	"log"
+	"os"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	// Initialize database
 	db, err := database.InitDB()
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
 
+	cfg := config.Load()
+
+	// Servers either migrate the database themselves or expect it to be
+	// migrated by "server migrate up" before they start
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
+	}
+	if cfg.AutoMigrate {
+		applied, err := migrator.Up()
+		for _, m := range applied {
+			log.Printf("Applied migration %04d_%s", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+	} else {
+		pending, err := migrator.Pending()
+		if err != nil {
+			log.Fatalf("Failed to check migrations: %v", err)
+		}
+		if len(pending) > 0 {
+			log.Fatalf("Database has %d pending migrations, run \"server migrate up\"", len(pending))
+		}
+	}
+
+	// Tokens are signed with the configured keys, the public default secret
+	// would let anyone sign tokens
+	keyring, err := auth.NewKeyring(cfg.JWTSecret, cfg.JWTKeys)
+	if err != nil {
+		log.Fatalf("Failed to load JWT keys: %v", err)
+	}
+	if keyring.Insecure() && !cfg.Development() {
+		log.Fatalf("Refusing to start with the default JWT secret in %s, set JWT_SECRET or JWT_KEYS", cfg.AppEnv)
+	}
+	auth.SetKeyring(keyring)
+
+	// Load exchange rates shipped as an ECB XML or CSV file
+	if cfg.ExchangeRatesFile != "" {
+		count, err := currency.LoadFile(db, cfg.ExchangeRatesFile)
+		if err != nil {
+			log.Fatalf("Failed to load exchange rates: %v", err)
+		}
+		log.Printf("Loaded %d exchange rates from %s", count, cfg.ExchangeRatesFile)
+	}
+
+	mailer, err := mail.New(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to configure mail: %v", err)
+	}
+
+	store, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatalf("Failed to configure storage: %v", err)
+	}
+
+	// Roll budgets over into each new month in the background
+	go budgets.RunScheduler(context.Background(), db, cfg.RolloverInterval)
+
+	// Create the due occurrences of recurring expenses in the background
+	go recurring.RunScheduler(context.Background(), db, cfg.RecurringInterval)
+
 	// Initialize router
 	router := gin.Default()
 
+	// Rate limits go by client IP, which is only taken from X-Forwarded-For
+	// of the configured proxies. Gin trusts every proxy by default, so
+	// without any the header is ignored and the peer address is used.
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		log.Fatalf("Failed to set trusted proxies: %v", err)
+	}
+
 	// CORS middleware
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Workspace-ID")
 
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
@@ -38,10 +122,12 @@ func main() {
 	router.GET("/health", handlers.HealthCheck)
 
 	// Initialize API routes
-	api.SetupRoutes(router, db)
+	if err := api.SetupRoutes(router, db, cfg, mailer, store); err != nil {
+		log.Fatalf("Failed to set up routes: %v", err)
+	}
 
 	// Start server
-	if err := router.Run(":" + config.Load().Port); err != nil {
+	if err := router.Run(":" + cfg.Port); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
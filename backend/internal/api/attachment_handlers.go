@@ -0,0 +1,218 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"expense-tracker/internal/attachments"
+	"expense-tracker/internal/auth"
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// multipartOverhead is allowed on top of the attachment size for the rest
+// of the multipart form.
+const multipartOverhead = 64 << 10
+
+// GetAttachments lists the attachments of an expense with download URLs.
+func (h *Handler) GetAttachments(c *gin.Context) {
+	var expense models.Expense
+	if err := h.db.Scopes(inWorkspace(c)).Where("id = ?", c.Param("id")).First(&expense).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
+		return
+	}
+
+	list := []models.Attachment{}
+	if err := h.db.Where("expense_id = ?", expense.ID).Order("created_at, id").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachments"})
+		return
+	}
+	for i := range list {
+		if err := signAttachment(&list[i]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch attachments"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// UploadAttachment attaches the image or PDF in the "file" field of a
+// multipart form to an expense. Uploading a file the expense already has
+// returns its attachment.
+func (h *Handler) UploadAttachment(c *gin.Context) {
+	maxSize := h.cfg.MaxAttachmentSize
+	if maxSize <= 0 {
+		maxSize = 10 << 20
+	}
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+
+	var expense models.Expense
+	if err := h.db.Scopes(inWorkspace(c)).Where("id = ?", c.Param("id")).First(&expense).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
+		return
+	}
+
+	header, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) || err == nil && header.Size > maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": fmt.Sprintf("Files can have at most %d bytes", maxSize)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required"})
+		return
+	}
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	attachment, created, err := attachments.Add(c.Request.Context(), h.db, h.storage, &expense, c.GetUint("user_id"), header.Filename, data)
+	if errors.Is(err, attachments.ErrUnsupportedType) || errors.Is(err, attachments.ErrEmpty) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+	if err == nil {
+		err = signAttachment(attachment)
+	}
+	if err != nil {
+		log.Printf("Failed to attach file to expense %d: %v", expense.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload attachment"})
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	c.JSON(status, attachment)
+}
+
+// DeleteAttachment removes an attachment from an expense, and its file
+// unless other attachments share it.
+func (h *Handler) DeleteAttachment(c *gin.Context) {
+	var attachment models.Attachment
+	if err := h.db.Scopes(inWorkspace(c)).
+		Where("id = ? AND expense_id = ?", c.Param("attachment_id"), c.Param("id")).
+		First(&attachment).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+
+	if err := h.db.Delete(&attachment).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+	h.purgeAttachments(c, []models.Attachment{attachment})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
+
+// DownloadAttachment sends the file, or the thumbnail, of an attachment. It
+// is authorized by the token of the download URL instead of the
+// Authorization header, so the URLs work in links and image tags.
+func (h *Handler) DownloadAttachment(c *gin.Context) {
+	id, thumbnail, err := auth.ParseDownloadToken(c.Query("token"))
+	if err != nil || fmt.Sprint(id) != c.Param("id") {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": auth.ErrInvalidDownloadToken.Error()})
+		return
+	}
+
+	var attachment models.Attachment
+	if err := h.db.First(&attachment, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	key, contentType, size := attachment.StorageKey, attachment.ContentType, attachment.Size
+	if thumbnail {
+		key, contentType, size = attachment.ThumbnailKey, "image/jpeg", -1
+	}
+	if key == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment has no thumbnail"})
+		return
+	}
+
+	file, err := h.storage.Get(c.Request.Context(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read attachment %d: %v", attachment.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read attachment"})
+		return
+	}
+	defer file.Close()
+
+	// Only images and PDFs are stored, by their sniffed type, so browsers
+	// may show them inline but must not guess another type
+	c.DataFromReader(http.StatusOK, size, contentType, file, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("inline", map[string]string{"filename": attachment.FileName}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=900",
+	})
+}
+
+// purgeAttachments deletes the files of deleted attachments. The attachments
+// are gone already, so failures only leave unused files behind and are
+// logged.
+func (h *Handler) purgeAttachments(c *gin.Context, deleted []models.Attachment) {
+	if len(deleted) == 0 {
+		return
+	}
+	if err := attachments.Purge(c.Request.Context(), h.db, h.storage, deleted); err != nil {
+		log.Printf("Failed to delete attachment files: %v", err)
+	}
+}
+
+// deleteAttachments deletes the attachments of an expense and returns them,
+// for purgeAttachments once the transaction is committed.
+func deleteAttachments(tx *gorm.DB, expenseID uint) ([]models.Attachment, error) {
+	var deleted []models.Attachment
+	if err := tx.Where("expense_id = ?", expenseID).Find(&deleted).Error; err != nil {
+		return nil, err
+	}
+	if len(deleted) == 0 {
+		return nil, nil
+	}
+	return deleted, tx.Delete(&deleted).Error
+}
+
+// signAttachment sets the download URLs of the attachment, relative to the
+// API.
+func signAttachment(attachment *models.Attachment) error {
+	token, err := auth.IssueDownloadToken(attachment.ID, false)
+	if err != nil {
+		return err
+	}
+	attachment.URL = downloadURL(attachment.ID, token)
+
+	attachment.ThumbnailURL = ""
+	if attachment.ThumbnailKey != "" {
+		token, err := auth.IssueDownloadToken(attachment.ID, true)
+		if err != nil {
+			return err
+		}
+		attachment.ThumbnailURL = downloadURL(attachment.ID, token)
+	}
+	return nil
+}
+
+func downloadURL(id uint, token string) string {
+	return fmt.Sprintf("/api/attachments/%d/download?token=%s", id, token)
+}
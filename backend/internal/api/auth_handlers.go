@@ -1,9 +1,17 @@
 package api
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"time"
 
 	"expense-tracker/internal/auth"
+	"expense-tracker/internal/mail"
+	"expense-tracker/internal/models"
 
 	"github.com/gin-gonic/gin"
 )
@@ -25,13 +33,23 @@ func (h *Handler) SignUp(c *gin.Context) {
 		return
 	}
 
-	token, err := auth.GenerateToken(user.ID)
+	// The account is created either way, the mail can be sent again
+	if err := h.sendVerification(user); err != nil {
+		log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+	}
+
+	if h.cfg.RequireActivation {
+		c.JSON(http.StatusCreated, gin.H{"message": "Check your email to activate your account"})
+		return
+	}
+
+	session, err := auth.StartSession(h.db, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"token": token})
+	c.JSON(http.StatusCreated, session)
 }
 
 func (h *Handler) Login(c *gin.Context) {
@@ -51,16 +69,266 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
-	token, err := auth.GenerateToken(user.ID)
+	if h.cfg.RequireActivation && user.ActivatedAt == nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email address not verified"})
+		return
+	}
+
+	h.completeFirstFactor(c, user)
+}
+
+// completeFirstFactor starts a session for a user who proved their identity,
+// or asks for the second factor first. Accounts with two-factor
+// authentication continue with LoginMFA.
+func (h *Handler) completeFirstFactor(c *gin.Context, user *models.User) {
+	if user.TOTPEnabledAt != nil {
+		mfaToken, err := auth.IssueMFAToken(user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"mfa_required": true, "mfa_token": mfaToken})
+		return
+	}
+
+	session, err := auth.StartSession(h.db, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// LoginMFA is the second step of logging into an account with two-factor
+// authentication. It takes the mfa_token of the first step and a TOTP or
+// recovery code.
+func (h *Handler) LoginMFA(c *gin.Context) {
+	var input struct {
+		MFAToken string `json:"mfa_token" binding:"required"`
+		Code     string `json:"code" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := auth.CompleteLogin(h.db, input.MFAToken, input.Code)
+	var locked *auth.AccountLockedError
+	if errors.As(err, &locked) {
+		tooManyRequests(c, time.Until(locked.Until))
+		return
+	}
+	if errors.Is(err, auth.ErrInvalidMFAToken) || errors.Is(err, auth.ErrInvalidCode) || errors.Is(err, auth.ErrTOTPNotEnabled) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		return
+	}
+
+	session, err := auth.StartSession(h.db, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, session)
 }
 
 func (h *Handler) ValidateToken(c *gin.Context) {
 	// If the request reaches here, it means the auth middleware validated the token
 	c.JSON(http.StatusOK, gin.H{"valid": true})
 }
+
+// GetJWKS returns the public keys of the keyring as a JSON Web Key Set.
+func (h *Handler) GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, auth.CurrentKeyring().JWKS())
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token.
+func (h *Handler) Refresh(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, err := auth.Refresh(h.db, input.RefreshToken)
+	if errors.Is(err, auth.ErrInvalidRefreshToken) || errors.Is(err, auth.ErrRefreshTokenReused) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// Logout revokes the access token of the request and the refresh token, if
+// one is given.
+func (h *Handler) Logout(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	// The body is optional
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	claims := c.MustGet("claims").(*auth.Claims)
+	if err := auth.EndSession(h.db, claims, input.RefreshToken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// LogoutAll revokes all access and refresh tokens of the user.
+func (h *Handler) LogoutAll(c *gin.Context) {
+	if err := auth.EndAllSessions(h.db, c.GetUint("user_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out on all devices"})
+}
+
+// VerifyEmail activates an account with the token of a verification email.
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var input struct {
+		Token string `json:"token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := auth.VerifyEmail(h.db, input.Token)
+	if errors.Is(err, auth.ErrInvalidOneTimeToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification sends another verification email to an account that
+// isn't activated yet. It responds the same whether or not the account
+// exists.
+func (h *Handler) ResendVerification(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.Where("email = ? AND activated_at IS NULL", input.Email).First(&user).Error; err == nil {
+		if err := h.sendVerification(&user); err != nil {
+			log.Printf("Failed to send verification email to %s: %v", user.Email, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists and isn't verified yet, an email is on its way"})
+}
+
+// ForgotPassword mails a password reset link. It responds the same whether
+// or not the account exists.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.Where("email = ?", input.Email).First(&user).Error; err == nil {
+		if err := h.sendPasswordReset(&user); err != nil {
+			log.Printf("Failed to send password reset email to %s: %v", user.Email, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If the account exists, an email is on its way"})
+}
+
+// ResetPassword sets a new password with the token of a password reset
+// email. All sessions of the user end.
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var input struct {
+		Token    string `json:"token" binding:"required"`
+		Password string `json:"password" binding:"required,min=6"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := auth.ResetPassword(h.db, input.Token, input.Password)
+	if errors.Is(err, auth.ErrInvalidOneTimeToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+func (h *Handler) sendVerification(user *models.User) error {
+	token, err := auth.IssueOneTimeToken(h.db, user.ID, models.TokenVerifyEmail, auth.VerifyEmailTTL)
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Welcome to Expense Tracker!\n\nOpen this link to verify your email address:\n%s\n\nThe link is valid for %d hours.\n",
+			h.appLink("/verify", token), int(auth.VerifyEmailTTL.Hours())),
+	})
+}
+
+func (h *Handler) sendPasswordReset(user *models.User) error {
+	token, err := auth.IssueOneTimeToken(h.db, user.ID, models.TokenResetPassword, auth.ResetPasswordTTL)
+	if err != nil {
+		return err
+	}
+	return h.mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Open this link to choose a new password:\n%s\n\nThe link is valid for %d minutes. If you didn't ask to reset your password, ignore this email.\n",
+			h.appLink("/reset-password", token), int(auth.ResetPasswordTTL.Minutes())),
+	})
+}
+
+// appLink returns a link to the path of the frontend carrying the token.
+func (h *Handler) appLink(path, token string) string {
+	return strings.TrimRight(h.cfg.AppURL, "/") + path + "?token=" + url.QueryEscape(token)
+}
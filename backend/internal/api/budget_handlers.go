@@ -1,20 +1,22 @@
 package api
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
+	"expense-tracker/internal/budgets"
 	"expense-tracker/internal/models"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 func (h *Handler) GetBudgets(c *gin.Context) {
-	userID := c.GetUint("user_id")
 	month := c.Query("month") // Get month query parameter
 	var budgets []models.Budget
 
-	query := h.db.Where("user_id = ?", userID)
+	query := h.db.Scopes(inWorkspace(c))
 	if month != "" {
 		query = query.Where("month = ?", month)
 	}
@@ -29,8 +31,9 @@ func (h *Handler) GetBudgets(c *gin.Context) {
 
 func (h *Handler) CreateBudget(c *gin.Context) {
 	var input struct {
-		Name   string  `json:"name" binding:"required"`
-		Amount float64 `json:"amount" binding:"required"`
+		Name         string       `json:"name" binding:"required"`
+		Amount       models.Money `json:"amount" binding:"required"`
+		RolloverMode string       `json:"rollover_mode" binding:"omitempty,oneof=reset carry"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -40,16 +43,29 @@ func (h *Handler) CreateBudget(c *gin.Context) {
 
 	currentMonth := time.Now().Format("2006-01")
 
+	rolloverMode := input.RolloverMode
+	if rolloverMode == "" {
+		rolloverMode = models.RolloverReset
+	}
+
 	budget := models.Budget{
 		UserID:         c.GetUint("user_id"),
+		WorkspaceID:    c.GetUint("workspace_id"),
 		Name:           input.Name,
 		Amount:         input.Amount,
 		Month:          currentMonth,
 		RollOverAmount: 0,
+		RolloverMode:   rolloverMode,
 	}
 
-	if err := h.db.Create(&budget).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create budget"})
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&budget).Error; err != nil {
+			return err
+		}
+		return checkAssigned(tx, &budget, budget.Amount)
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create budget")
 		return
 	}
 
@@ -57,12 +73,12 @@ func (h *Handler) CreateBudget(c *gin.Context) {
 }
 
 func (h *Handler) UpdateBudget(c *gin.Context) {
-	userID := c.GetUint("user_id")
 	budgetID := c.Param("id")
 
 	var input struct {
-		Amount         float64 `json:"amount"`
-		RollOverAmount float64 `json:"roll_over_amount"`
+		Amount         models.Money `json:"amount"`
+		RollOverAmount models.Money `json:"roll_over_amount"`
+		RolloverMode   *string      `json:"rollover_mode" binding:"omitempty,oneof=reset carry"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -71,16 +87,26 @@ func (h *Handler) UpdateBudget(c *gin.Context) {
 	}
 
 	var budget models.Budget
-	if err := h.db.Where("id = ? AND user_id = ?", budgetID, userID).First(&budget).Error; err != nil {
+	if err := h.db.Scopes(inWorkspace(c)).Where("id = ?", budgetID).First(&budget).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
 		return
 	}
 
+	increase := input.Amount - budget.Amount
 	budget.Amount = input.Amount
 	budget.RollOverAmount = input.RollOverAmount
+	if input.RolloverMode != nil {
+		budget.RolloverMode = *input.RolloverMode
+	}
 
-	if err := h.db.Save(&budget).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update budget"})
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&budget).Error; err != nil {
+			return err
+		}
+		return checkAssigned(tx, &budget, increase)
+	})
+	if err != nil {
+		respondError(c, err, "Failed to update budget")
 		return
 	}
 
@@ -88,10 +114,9 @@ func (h *Handler) UpdateBudget(c *gin.Context) {
 }
 
 func (h *Handler) DeleteBudget(c *gin.Context) {
-	userID := c.GetUint("user_id")
 	budgetID := c.Param("id")
 
-	result := h.db.Where("id = ? AND user_id = ?", budgetID, userID).Delete(&models.Budget{})
+	result := h.db.Scopes(inWorkspace(c)).Where("id = ?", budgetID).Delete(&models.Budget{})
 	if result.Error != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete budget"})
 		return
@@ -104,3 +129,109 @@ func (h *Handler) DeleteBudget(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Budget deleted successfully"})
 }
+
+func (h *Handler) RolloverBudgets(c *gin.Context) {
+	var input struct {
+		Month string `json:"month"` // Roll over up to and including this month, defaults to the current month
+	}
+
+	// The body is optional, an empty request catches up to the current month
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	month := input.Month
+	if month == "" {
+		month = budgets.CurrentMonth()
+	}
+	if _, err := time.Parse("2006-01", month); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month format"})
+		return
+	}
+
+	created, err := budgets.CatchUp(h.db, c.GetUint("workspace_id"), month)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to roll over budgets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"created": created, "month": month})
+}
+
+func (h *Handler) ReconcileBudgets(c *gin.Context) {
+	corrections, err := budgets.Reconcile(h.db, c.GetUint("workspace_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reconcile budgets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"corrections": corrections})
+}
+
+// GetAssignments shows how the income of a month, the current one by
+// default, is assigned to its budgets.
+func (h *Handler) GetAssignments(c *gin.Context) {
+	month, ok := reportMonth(c)
+	if !ok {
+		return
+	}
+
+	plan, err := budgets.GetPlan(h.db, c.GetUint("workspace_id"), month)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch assignments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// AssignBudgets sets the amounts of budgets of a month at once, e.g. to
+// assign the month's income in a zero-based workspace.
+func (h *Handler) AssignBudgets(c *gin.Context) {
+	var input struct {
+		Month   string `json:"month" binding:"required"`
+		Budgets []struct {
+			BudgetID uint         `json:"budget_id" binding:"required"`
+			Amount   models.Money `json:"amount" binding:"gte=0"`
+		} `json:"budgets" binding:"required,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := time.Parse("2006-01", input.Month); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month format"})
+		return
+	}
+
+	amounts := make(map[uint]models.Money, len(input.Budgets))
+	for _, budget := range input.Budgets {
+		amounts[budget.BudgetID] = budget.Amount
+	}
+	plan, err := budgets.Assign(h.db, c.GetUint("workspace_id"), input.Month, amounts)
+	if errors.Is(err, budgets.ErrOverAssigned) || errors.Is(err, budgets.ErrUnknownBudget) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign budgets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, plan)
+}
+
+// checkAssigned keeps budgets of zero-based workspaces from being assigned
+// more than the income of their month, by a change that assigned increase
+// more to the budget.
+func checkAssigned(tx *gorm.DB, budget *models.Budget, increase models.Money) error {
+	err := budgets.CheckAssigned(tx, budget.WorkspaceID, budget.Month, increase)
+	if errors.Is(err, budgets.ErrOverAssigned) {
+		return &httpError{http.StatusBadRequest, err.Error()}
+	}
+	return err
+}
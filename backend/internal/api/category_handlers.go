@@ -0,0 +1,237 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"expense-tracker/internal/categories"
+	"expense-tracker/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func (h *Handler) GetCategories(c *gin.Context) {
+	var list []models.Category
+
+	if err := h.db.Scopes(inWorkspace(c)).Order("name").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+
+	// Return the categories nested below their parents if requested
+	if c.Query("tree") == "true" {
+		c.JSON(http.StatusOK, categories.Tree(list))
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) CreateCategory(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	var input struct {
+		Name     string `json:"name" binding:"required"`
+		ParentID *uint  `json:"parent_id"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := categories.CheckParent(h.db, workspaceID, 0, input.ParentID); err != nil {
+		respondCategoryError(c, err, "Failed to create category")
+		return
+	}
+
+	category := models.Category{
+		UserID:      c.GetUint("user_id"),
+		WorkspaceID: workspaceID,
+		ParentID:    input.ParentID,
+		Name:        input.Name,
+	}
+
+	if err := h.db.Create(&category).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+func (h *Handler) UpdateCategory(c *gin.Context) {
+	categoryID := c.Param("id")
+
+	var input struct {
+		Name     string `json:"name"`
+		ParentID *uint  `json:"parent_id"`
+		IsRoot   bool   `json:"is_root"` // Move the category to the top level
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var category models.Category
+	if err := h.db.Scopes(inWorkspace(c)).Where("id = ?", categoryID).First(&category).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	if input.Name != "" {
+		category.Name = input.Name
+	}
+	if input.IsRoot {
+		category.ParentID = nil
+	} else if input.ParentID != nil {
+		if err := categories.CheckParent(h.db, category.WorkspaceID, category.ID, input.ParentID); err != nil {
+			respondCategoryError(c, err, "Failed to update category")
+			return
+		}
+		category.ParentID = input.ParentID
+	}
+
+	if err := h.db.Save(&category).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update category"})
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// DeleteCategory deletes a category. Its children and expenses move up to
+// the deleted category's parent.
+func (h *Handler) DeleteCategory(c *gin.Context) {
+	categoryID := c.Param("id")
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var category models.Category
+		if err := tx.Scopes(inWorkspace(c)).Where("id = ?", categoryID).First(&category).Error; err != nil {
+			return &httpError{http.StatusNotFound, "Category not found"}
+		}
+
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", category.ID).
+			Update("parent_id", category.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Expense{}).Where("category_id = ?", category.ID).
+			Update("category_id", category.ParentID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Rule{}).Where("category_id = ?", category.ID).
+			Update("category_id", category.ParentID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&category).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to delete category")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+func (h *Handler) GetTags(c *gin.Context) {
+	var tags []models.Tag
+
+	if err := h.db.Scopes(inWorkspace(c)).Order("name").Find(&tags).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tags"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tags)
+}
+
+func (h *Handler) CreateTag(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tags, err := categories.ResolveTags(h.db, c.GetUint("workspace_id"), c.GetUint("user_id"), []string{input.Name})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tag"})
+		return
+	}
+	// Names are trimmed, one of only spaces is no name
+	if len(tags) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tag name can't be blank"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tags[0])
+}
+
+func (h *Handler) UpdateTag(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var tag models.Tag
+	if err := h.db.Scopes(inWorkspace(c)).Where("id = ?", c.Param("id")).First(&tag).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tag not found"})
+		return
+	}
+
+	var count int64
+	h.db.Model(&models.Tag{}).Scopes(inWorkspace(c)).Where("name = ? AND id <> ?", input.Name, tag.ID).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Tag already exists"})
+		return
+	}
+
+	tag.Name = input.Name
+	if err := h.db.Save(&tag).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tag"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tag)
+}
+
+func (h *Handler) DeleteTag(c *gin.Context) {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var tag models.Tag
+		if err := tx.Scopes(inWorkspace(c)).Where("id = ?", c.Param("id")).First(&tag).Error; err != nil {
+			return &httpError{http.StatusNotFound, "Tag not found"}
+		}
+
+		if err := tx.Exec("DELETE FROM expense_tags WHERE tag_id = ?", tag.ID).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM rule_tags WHERE tag_id = ?", tag.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&tag).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to delete tag")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tag deleted successfully"})
+}
+
+func respondCategoryError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, categories.ErrNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Parent category not found"})
+	case errors.Is(err, categories.ErrCycle):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,42 +1,150 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"expense-tracker/internal/budgets"
+	"expense-tracker/internal/categories"
+	"expense-tracker/internal/currency"
+	"expense-tracker/internal/expenses"
+	"expense-tracker/internal/ledger"
 	"expense-tracker/internal/models"
+	"expense-tracker/internal/reports"
+	"expense-tracker/internal/rules"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// expenseFilter reads the filter of an expense listing from the query. It
+// responds with a bad request and returns false if it is invalid.
+func (h *Handler) expenseFilter(c *gin.Context) (expenses.Filter, bool) {
+	var filter expenses.Filter
+	badRequest := func(message string) (expenses.Filter, bool) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return expenses.Filter{}, false
+	}
+
+	// A month is a shorthand for the range of its days
+	if month := c.Query("month"); month != "" {
+		start, end, err := reports.MonthRange(month, month)
+		if err != nil {
+			return badRequest("Invalid month format")
+		}
+		filter.From, filter.To = start, end.AddDate(0, 0, -1)
+	}
+	for key, day := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(key); value != "" {
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return badRequest("Invalid " + key + " date, use YYYY-MM-DD")
+			}
+			*day = date
+		}
+	}
+
+	for key, amount := range map[string]**models.Money{"min_amount": &filter.MinAmount, "max_amount": &filter.MaxAmount} {
+		if value := c.Query(key); value != "" {
+			money, err := models.ParseMoney(value)
+			if err != nil {
+				return badRequest("Invalid " + key)
+			}
+			*amount = &money
+		}
+	}
+
+	// Expenses without a budget are selected with budget_id=unbudgeted
+	if budgetID := c.Query("budget_id"); budgetID == "unbudgeted" {
+		filter.Unbudgeted = true
+	} else if budgetID != "" {
+		id, err := strconv.ParseUint(budgetID, 10, 64)
+		if err != nil {
+			return badRequest("Invalid budget_id")
+		}
+		budget := uint(id)
+		filter.BudgetID = &budget
+	}
+
+	// Filter by category, including all categories below it
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		id, err := strconv.ParseUint(categoryID, 10, 64)
+		if err != nil {
+			return badRequest("Invalid category_id")
+		}
+		ids, err := categories.Descendants(h.db, c.GetUint("workspace_id"), uint(id))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return expenses.Filter{}, false
+		}
+		filter.CategoryIDs = ids
+	}
+
+	filter.Description = c.Query("description")
+	// An expense has to carry all of the given tags
+	filter.Tags = c.QueryArray("tag")
+	return filter, true
+}
+
+// GetExpenses lists the expenses that match the filter. With a limit or a
+// cursor the expenses are returned page by page, along with the total count
+// and the cursor of the next page. Without either, all of them are returned
+// as a plain array like before pagination existed.
 func (h *Handler) GetExpenses(c *gin.Context) {
-	userID := c.GetUint("user_id")
-	month := c.Query("month") // Get month query parameter
-	var expenses []models.Expense
+	workspaceID := c.GetUint("workspace_id")
+	filter, ok := h.expenseFilter(c)
+	if !ok {
+		return
+	}
+	sort, err := expenses.ParseSort(c.Query("sort"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	query := h.db.Where("user_id = ?", userID)
-	if month != "" {
-		// If month is provided, filter expenses for that month
-		query = query.Where("DATE_TRUNC('month', date)::date = ?", month+"-01")
+	cursor := c.Query("cursor")
+	if c.Query("limit") == "" && cursor == "" {
+		result, err := expenses.All(h.db, workspaceID, filter, sort)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch expenses"})
+			return
+		}
+		c.JSON(http.StatusOK, result)
+		return
 	}
 
-	if err := query.
-		Preload("Budget").
-		Order("date DESC").
-		Find(&expenses).Error; err != nil {
+	limit, ok := intQuery(c, "limit", 50, 500)
+	if !ok {
+		return
+	}
+	page, err := expenses.List(h.db, workspaceID, filter, sort, cursor, limit)
+	if errors.Is(err, expenses.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch expenses"})
 		return
 	}
 
-	c.JSON(http.StatusOK, expenses)
+	c.JSON(http.StatusOK, page)
 }
 
 func (h *Handler) CreateExpense(c *gin.Context) {
 	var input struct {
-		Amount      float64 `json:"amount" binding:"required"`
-		BudgetID    *uint   `json:"budget_id"`
-		Description string  `json:"description" binding:"required"`
-		Date        string  `json:"date" binding:"required"`
+		Amount      models.Money  `json:"amount" binding:"required"`
+		Currency    string        `json:"currency" binding:"omitempty,len=3"` // Defaults to the workspace's base currency
+		BudgetID    *uint         `json:"budget_id"`
+		CategoryID  *uint         `json:"category_id"`
+		Tags        []string      `json:"tags"`
+		Description string        `json:"description" binding:"required"`
+		Notes       string        `json:"notes"`
+		Date        string        `json:"date" binding:"required"`
+		Split       *ledger.Split `json:"split"` // Splits the expense between members of the workspace
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -51,51 +159,40 @@ func (h *Handler) CreateExpense(c *gin.Context) {
 		return
 	}
 
-	// Get the user ID from the context
-	userID := c.GetUint("user_id")
-
-	var budget *models.Budget
-	if input.BudgetID != nil {
-		budget = &models.Budget{}
-		if err := h.db.Where("id = ? AND user_id = ?", input.BudgetID, userID).First(budget).Error; err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Budget not found"})
-			return
-		}
-
-		// Verify the expense date matches the budget month
-		expenseMonth := date.Format("2006-01")
-		if expenseMonth != budget.Month {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Expense date must be in the same month as the budget"})
-			return
-		}
-	}
-
-	// Create the expense
 	expense := models.Expense{
-		UserID:      userID,
+		UserID:      c.GetUint("user_id"),
+		WorkspaceID: c.GetUint("workspace_id"),
 		BudgetID:    input.BudgetID,
+		CategoryID:  input.CategoryID,
 		Amount:      input.Amount,
+		Currency:    strings.ToUpper(input.Currency),
 		Description: input.Description,
+		Notes:       input.Notes,
 		Date:        date,
 	}
 
-	if err := h.db.Create(&expense).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create expense"})
-		return
-	}
-
-	if budget != nil {
-		// Update the budget's roll-over amount
-		budget.RollOverAmount += input.Amount
-		if err := h.db.Save(budget).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update budget"})
-			return
+	// Store the expense and book it against its budget in one transaction
+	err = h.db.Transaction(func(tx *gorm.DB) error {
+		engine, err := rules.Load(tx, expense.WorkspaceID)
+		if err != nil {
+			return err
+		}
+		if err := createExpense(tx, &expense, input.Tags, engine); err != nil {
+			return err
+		}
+		if input.Split != nil {
+			return assignSplit(tx, &expense, *input.Split)
 		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create expense")
+		return
 	}
 
-	// Load the budget relationship for the response
-	if err := h.db.Model(&expense).Association("Budget").Find(&expense.Budget); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load budget association"})
+	// Load the relationships for the response
+	if err := h.loadExpenseAssociations(&expense); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load expense associations"})
 		return
 	}
 
@@ -103,14 +200,18 @@ func (h *Handler) CreateExpense(c *gin.Context) {
 }
 
 func (h *Handler) UpdateExpense(c *gin.Context) {
-	userID := c.GetUint("user_id")
 	expenseID := c.Param("id")
 
 	var input struct {
-		Amount      float64 `json:"amount"`
-		BudgetID    *uint   `json:"budget_id"`
-		Description string  `json:"description"`
-		Date        string  `json:"date"`
+		Amount      models.Money  `json:"amount"`
+		Currency    string        `json:"currency" binding:"omitempty,len=3"`
+		BudgetID    *uint         `json:"budget_id"`
+		CategoryID  *uint         `json:"category_id"`
+		Tags        *[]string     `json:"tags"` // Replaces all tags of the expense if set
+		Description string        `json:"description"`
+		Notes       *string       `json:"notes"` // Replaces the notes if set, an empty string clears them
+		Date        string        `json:"date"`
+		Split       *ledger.Split `json:"split"` // Replaces the split of the expense if set
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -118,79 +219,101 @@ func (h *Handler) UpdateExpense(c *gin.Context) {
 		return
 	}
 
-	var expense models.Expense
-	if err := h.db.Where("id = ? AND user_id = ?", expenseID, userID).First(&expense).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
-		return
+	var date time.Time
+	if input.Date != "" {
+		var err error
+		if date, err = time.Parse("2006-01-02", input.Date); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+			return
+		}
 	}
 
-	// If budget is being changed, update both old and new budgets
-	if input.BudgetID != nil && (expense.BudgetID == nil || *input.BudgetID != *expense.BudgetID) {
-		// Update old budget
-		if expense.BudgetID != nil {
-			var oldBudget models.Budget
-			if err := h.db.First(&oldBudget, expense.BudgetID).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find old budget"})
-				return
-			}
-			oldBudget.RollOverAmount -= expense.Amount
-			if err := h.db.Save(&oldBudget).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update old budget"})
-				return
-			}
+	var expense models.Expense
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Scopes(inWorkspace(c)).
+			Where("id = ?", expenseID).
+			First(&expense).Error; err != nil {
+			return &httpError{http.StatusNotFound, "Expense not found"}
 		}
 
-		// Update new budget
-		var newBudget models.Budget
-		if err := h.db.First(&newBudget, input.BudgetID).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find new budget"})
-			return
-		}
-		newBudget.RollOverAmount += input.Amount
-		if err := h.db.Save(&newBudget).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update new budget"})
-			return
+		// Take the old amount off its budget and book the updated expense
+		// afterwards, this handles changes of budget and amount alike.
+		if err := budgets.Unbook(tx, &expense); err != nil {
+			return err
 		}
 
-		expense.BudgetID = input.BudgetID
-	}
-
-	if input.Amount != 0 {
-		// Update budget amount
-		var budget models.Budget
-		if err := h.db.First(&budget, expense.BudgetID).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find budget"})
-			return
+		if input.BudgetID != nil {
+			expense.BudgetID = input.BudgetID
 		}
-		budget.RollOverAmount = budget.RollOverAmount - expense.Amount + input.Amount
-		if err := h.db.Save(&budget).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update budget"})
-			return
+		if input.CategoryID != nil {
+			expense.CategoryID = input.CategoryID
+		}
+		if input.Amount != 0 {
+			expense.Amount = input.Amount
+		}
+		if input.Currency != "" {
+			expense.Currency = strings.ToUpper(input.Currency)
+		}
+		if input.Description != "" {
+			expense.Description = input.Description
+		}
+		if input.Notes != nil {
+			expense.Notes = *input.Notes
+		}
+		if input.Date != "" {
+			expense.Date = date
 		}
-		expense.Amount = input.Amount
-	}
-
-	if input.Description != "" {
-		expense.Description = input.Description
-	}
 
-	if input.Date != "" {
-		date, err := time.Parse("2006-01-02", input.Date)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
-			return
+		// Convert again, amount, currency or date may have changed
+		if err := applyBaseAmount(tx, &expense); err != nil {
+			return err
+		}
+		if err := lockBudgetForExpense(tx, &expense); err != nil {
+			return err
+		}
+		if err := checkCategory(tx, &expense); err != nil {
+			return err
+		}
+		if err := tx.Save(&expense).Error; err != nil {
+			return err
+		}
+		if input.Tags != nil {
+			tags, err := categories.ResolveTags(tx, expense.WorkspaceID, c.GetUint("user_id"), *input.Tags)
+			if err != nil {
+				return err
+			}
+			if err := tx.Model(&expense).Association("Tags").Replace(tags); err != nil {
+				return err
+			}
 		}
-		expense.Date = date
-	}
 
-	if err := h.db.Save(&expense).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update expense"})
+		// Without a new split the existing one is divided again, the base
+		// amount may have changed
+		switch {
+		case input.Split == nil:
+			if err := ledger.Reapportion(tx, &expense); err != nil {
+				return err
+			}
+		case len(input.Split.Shares) == 0:
+			if err := ledger.Unassign(tx, &expense); err != nil {
+				return err
+			}
+		default:
+			if err := assignSplit(tx, &expense, *input.Split); err != nil {
+				return err
+			}
+		}
+		return budgets.Book(tx, &expense)
+	})
+	if err != nil {
+		respondError(c, err, "Failed to update expense")
 		return
 	}
 
-	// Load the budget relationship for the response
-	if err := h.db.Model(&expense).Association("Budget").Find(&expense.Budget); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load budget association"})
+	// Load the relationships for the response
+	if err := h.loadExpenseAssociations(&expense); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load expense associations"})
 		return
 	}
 
@@ -198,32 +321,137 @@ func (h *Handler) UpdateExpense(c *gin.Context) {
 }
 
 func (h *Handler) DeleteExpense(c *gin.Context) {
-	userID := c.GetUint("user_id")
 	expenseID := c.Param("id")
 
-	var expense models.Expense
-	if err := h.db.Where("id = ? AND user_id = ?", expenseID, userID).First(&expense).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
+	var deleted []models.Attachment
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var expense models.Expense
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Scopes(inWorkspace(c)).
+			Where("id = ?", expenseID).
+			First(&expense).Error; err != nil {
+			return &httpError{http.StatusNotFound, "Expense not found"}
+		}
+
+		if err := budgets.Unbook(tx, &expense); err != nil {
+			return err
+		}
+		var err error
+		if deleted, err = deleteAttachments(tx, expense.ID); err != nil {
+			return err
+		}
+		return tx.Delete(&expense).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to delete expense")
 		return
 	}
+	// Files are only deleted once the transaction can't roll back anymore
+	h.purgeAttachments(c, deleted)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Expense deleted successfully"})
+}
+
+// createExpense converts the expense, lets the workspace's rules fill in budget,
+// category and tags, validates and stores it with the given tags and books it
+// against its budget. It has to run in a transaction.
+func createExpense(tx *gorm.DB, expense *models.Expense, tagNames []string, engine *rules.Engine) error {
+	if err := applyBaseAmount(tx, expense); err != nil {
+		return err
+	}
+
+	// Rules compare amounts in the base currency, so they run after the conversion
+	tagNames, err := engine.Apply(tx, expense, tagNames)
+	if err != nil {
+		return err
+	}
+	if err := lockBudgetForExpense(tx, expense); err != nil {
+		return err
+	}
+	if err := checkCategory(tx, expense); err != nil {
+		return err
+	}
+
+	tags, err := categories.ResolveTags(tx, expense.WorkspaceID, expense.UserID, tagNames)
+	if err != nil {
+		return err
+	}
+	expense.Tags = tags
+
+	if err := tx.Create(expense).Error; err != nil {
+		return err
+	}
+	return budgets.Book(tx, expense)
+}
+
+// lockBudgetForExpense locks the budget the expense is booked against, if
+// any, and verifies that it belongs to the expense's workspace and month.
+func lockBudgetForExpense(tx *gorm.DB, expense *models.Expense) error {
+	if expense.BudgetID == nil {
+		return nil
+	}
 
-	// Update the budget's roll-over amount
 	var budget models.Budget
-	if err := h.db.First(&budget, expense.BudgetID).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to find budget"})
-		return
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND workspace_id = ?", *expense.BudgetID, expense.WorkspaceID).
+		First(&budget).Error; err != nil {
+		return &httpError{http.StatusBadRequest, "Budget not found"}
 	}
 
-	budget.RollOverAmount -= expense.Amount
-	if err := h.db.Save(&budget).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update budget"})
-		return
+	// Verify the expense date matches the budget month
+	if expense.Date.Format("2006-01") != budget.Month {
+		return &httpError{http.StatusBadRequest, "Expense date must be in the same month as the budget"}
 	}
 
-	if err := h.db.Delete(&expense).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete expense"})
-		return
+	return nil
+}
+
+// checkCategory verifies that the expense's category belongs to its
+// workspace.
+func checkCategory(tx *gorm.DB, expense *models.Expense) error {
+	if expense.CategoryID == nil {
+		return nil
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Expense deleted successfully"})
+	var count int64
+	if err := tx.Model(&models.Category{}).
+		Where("id = ? AND workspace_id = ?", *expense.CategoryID, expense.WorkspaceID).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return &httpError{http.StatusBadRequest, "Category not found"}
+	}
+	return nil
+}
+
+// assignSplit splits the expense between users. An invalid split is
+// reported as a bad request.
+func assignSplit(tx *gorm.DB, expense *models.Expense, split ledger.Split) error {
+	err := ledger.Assign(tx, expense, split)
+	if errors.Is(err, ledger.ErrInvalidSplit) {
+		return &httpError{http.StatusBadRequest, err.Error()}
+	}
+	return err
+}
+
+// loadExpenseAssociations loads the budget, category, tags, splits and
+// attachments of the expense.
+func (h *Handler) loadExpenseAssociations(expense *models.Expense) error {
+	return expenses.Preload(h.db).First(expense, expense.ID).Error
+}
+
+// applyBaseAmount converts the expense into its workspace's base currency. A
+// missing exchange rate is reported as a bad request.
+func applyBaseAmount(tx *gorm.DB, expense *models.Expense) error {
+	if _, err := currency.Normalize(expense.Currency); expense.Currency != "" && err != nil {
+		return &httpError{http.StatusBadRequest, err.Error()}
+	}
+
+	err := currency.ApplyBaseAmount(tx, expense)
+	var noRate *currency.NoRateError
+	if errors.As(err, &noRate) {
+		return &httpError{http.StatusBadRequest, "No exchange rate for " + noRate.Currency + " on " + noRate.Date.Format("2006-01-02")}
+	}
+	return err
 }
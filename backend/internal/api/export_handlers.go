@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"expense-tracker/internal/export"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Export streams the workspace's expenses or budgets as CSV or NDJSON. The
+// X-Export-Version header names the version of the column schema.
+func (h *Handler) Export(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	format := c.DefaultQuery("format", export.FormatCSV)
+	if format != export.FormatCSV && format != export.FormatNDJSON {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, expected csv or ndjson"})
+		return
+	}
+
+	var r export.Range
+	for param, target := range map[string]*time.Time{"from": &r.From, "to": &r.To} {
+		if value := c.Query(param); value != "" {
+			date, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+				return
+			}
+			*target = date
+		}
+	}
+
+	kind := c.DefaultQuery("type", "expenses")
+	columns, run := export.ExpenseColumns, export.Expenses
+	switch kind {
+	case "expenses":
+	case "budgets":
+		columns, run = export.BudgetColumns, export.Budgets
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid type, expected expenses or budgets"})
+		return
+	}
+
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, kind, format))
+	c.Header("X-Export-Version", export.Version)
+	c.Status(http.StatusOK)
+
+	writer, err := export.NewWriter(c.Writer, format, columns)
+	if err == nil {
+		err = run(h.db, workspaceID, r, writer)
+	}
+	if err != nil {
+		// The status is already sent, all we can do is to cut the stream short
+		log.Printf("Export for workspace %d failed: %v", workspaceID, err)
+		c.Abort()
+	}
+}
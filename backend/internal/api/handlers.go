@@ -1,13 +1,61 @@
 package api
 
 import (
+	"errors"
+	"net/http"
+
+	"expense-tracker/internal/auth"
+	"expense-tracker/internal/config"
+	"expense-tracker/internal/mail"
+	"expense-tracker/internal/ratelimit"
+	"expense-tracker/internal/storage"
+	"expense-tracker/internal/workspaces"
+
+	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
 type Handler struct {
-	db *gorm.DB
+	db      *gorm.DB
+	cfg     config.Config
+	mailer  mail.Mailer
+	oidc    *auth.OIDC
+	limiter ratelimit.Store
+	storage storage.Store
+}
+
+func NewHandler(db *gorm.DB, cfg config.Config, mailer mail.Mailer, store storage.Store) (*Handler, error) {
+	limiter, err := ratelimit.New(cfg.RateLimitStore, db)
+	if err != nil {
+		return nil, err
+	}
+	return &Handler{db: db, cfg: cfg, mailer: mailer, oidc: auth.NewOIDC(cfg.OIDC, nil), limiter: limiter, storage: store}, nil
+}
+
+// httpError is returned from within transactions to roll them back and
+// respond with a specific status and message.
+type httpError struct {
+	status  int
+	message string
+}
+
+func (e *httpError) Error() string {
+	return e.message
+}
+
+// respondError responds with the status of an httpError, or with an internal
+// server error and fallback as message for any other error.
+func respondError(c *gin.Context, err error, fallback string) {
+	var httpErr *httpError
+	if errors.As(err, &httpErr) {
+		c.JSON(httpErr.status, gin.H{"error": httpErr.message})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
 }
 
-func NewHandler(db *gorm.DB) *Handler {
-	return &Handler{db: db}
+// inWorkspace limits a query to the records of the workspace the request was
+// authorized for by WorkspaceMiddleware.
+func inWorkspace(c *gin.Context) func(*gorm.DB) *gorm.DB {
+	return workspaces.Scope(c.GetUint("workspace_id"))
 }
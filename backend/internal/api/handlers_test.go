@@ -2,29 +2,61 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
 	"testing"
 	"time"
 
 	"expense-tracker/internal/auth"
+	"expense-tracker/internal/auth/oidctest"
+	"expense-tracker/internal/budgets"
+	"expense-tracker/internal/config"
+	"expense-tracker/internal/database"
+	"expense-tracker/internal/ledger"
+	"expense-tracker/internal/mail"
 	"expense-tracker/internal/models"
+	"expense-tracker/internal/ratelimit"
+	"expense-tracker/internal/reports"
+	"expense-tracker/internal/storage"
+	"expense-tracker/internal/totp"
+	"expense-tracker/internal/workspaces"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
-	"gorm.io/driver/sqlite"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// setupTestDB returns a database migrated like production ones. The tests
+// run against SQLite by default, or against PostgreSQL with
+// TEST_DB_DRIVER=postgres and the connection in TEST_DATABASE_DSN.
 func setupTestDB(t *testing.T) *gorm.DB {
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	if err != nil {
-		t.Fatalf("Failed to connect to test database: %v", err)
+	var db *gorm.DB
+	var err error
+	if os.Getenv("TEST_DB_DRIVER") == "postgres" {
+		db = setupPostgresTestDB(t)
+	} else {
+		db, err = database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+		if err != nil {
+			t.Fatalf("Failed to connect to test database: %v", err)
+		}
 	}
 
-	// Auto-migrate the test database
-	err = db.AutoMigrate(&models.User{}, &models.Budget{}, &models.Expense{})
+	migrator, err := database.NewMigrator(db)
+	if err == nil {
+		_, err = migrator.Up()
+	}
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
 	}
@@ -32,10 +64,41 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	return db
 }
 
-func setupTestRouter(db *gorm.DB) *gin.Engine {
+// setupPostgresTestDB connects to a schema of its own, which is dropped
+// after the test.
+func setupPostgresTestDB(t *testing.T) *gorm.DB {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("Failed to create test schema: %v", err)
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn+" search_path="+schema), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func setupTestRouter(t *testing.T, db *gorm.DB) *gin.Engine {
 	gin.SetMode(gin.TestMode)
+	auth.PasswordCost = bcrypt.MinCost
 	router := gin.New()
-	SetupRoutes(router, db)
+	assert.NoError(t, SetupRoutes(router, db, config.Config{AppURL: "http://localhost:3000"}, &mail.LogMailer{}, &storage.LocalStore{Dir: t.TempDir()}))
 	return router
 }
 
@@ -50,10 +113,18 @@ func setupTestUser(t *testing.T, db *gorm.DB) *models.User {
 	return user
 }
 
+// personalWorkspace returns the ID of the user's personal workspace, which
+// requests without an X-Workspace-ID header act on.
+func personalWorkspace(t *testing.T, db *gorm.DB, user *models.User) uint {
+	workspace, err := workspaces.Personal(db, user.ID)
+	assert.NoError(t, err)
+	return workspace.ID
+}
+
 // Auth Handler Tests
 func TestSignUp(t *testing.T) {
 	db := setupTestDB(t)
-	router := setupTestRouter(db)
+	router := setupTestRouter(t, db)
 
 	tests := []struct {
 		name       string
@@ -88,25 +159,488 @@ func TestSignUp(t *testing.T) {
 
 			assert.Equal(t, tt.wantStatus, w.Code)
 			if tt.wantStatus == http.StatusCreated {
-				var response map[string]string
+				var response map[string]interface{}
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				assert.NoError(t, err)
 				assert.Contains(t, response, "token")
+				assert.Contains(t, response, "refresh_token")
 			}
 		})
 	}
 }
 
+func TestLoginRateLimit(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupTestRouter(t, db)
+
+	login := func(email string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]string{"email": email, "password": "wrong"})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/auth/login", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Per account
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusUnauthorized, login("nobody@example.com").Code)
+	}
+	w := login("Nobody@Example.com")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// and per IP, which the rejected attempt counted against as well
+	for i := 0; i < 4; i++ {
+		assert.Equal(t, http.StatusUnauthorized, login(fmt.Sprintf("user%d@example.com", i)).Code)
+	}
+	w = login("another@example.com")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "6", w.Header().Get("Retry-After"))
+}
+
+// failingStore is a rate limit store that is unreachable.
+type failingStore struct{}
+
+func (failingStore) Take(context.Context, string, ratelimit.Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func TestRateLimitStoreFailure(t *testing.T) {
+	handler := &Handler{limiter: failingStore{}}
+	router := gin.New()
+	router.POST("/auth/login", handler.RateLimit("login-ip", loginIPLimit, byIP), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	// Attempts aren't let through unlimited
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("POST", "/auth/login", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestUnknownRateLimitStore(t *testing.T) {
+	db := setupTestDB(t)
+	err := SetupRoutes(gin.New(), db, config.Config{RateLimitStore: "redis"}, &mail.LogMailer{}, &storage.LocalStore{Dir: t.TempDir()})
+	assert.ErrorContains(t, err, `unknown rate limit store "redis"`)
+}
+
+func TestJWKS(t *testing.T) {
+	db := setupTestDB(t)
+	router := setupTestRouter(t, db)
+
+	// The development secret is never published
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/.well-known/jwks.json", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"keys":[]}`, w.Body.String())
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	db := setupTestDB(t)
+	setupTestUser(t, db)
+	router := setupTestRouter(t, db)
+
+	post := func(path, token string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	validate := func(token string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/auth/validate", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	var login auth.Session
+	w := post("/auth/login", "", map[string]string{"email": "test@example.com", "password": "password123"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+
+	var refreshed auth.Session
+	w = post("/auth/refresh", "", map[string]string{"refresh_token": login.RefreshToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &refreshed))
+	assert.Equal(t, http.StatusOK, validate(refreshed.AccessToken))
+
+	// A refresh token is used once, apart from a short grace period
+	w = post("/auth/refresh", "", map[string]string{"refresh_token": login.RefreshToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+	db.Model(&models.RefreshToken{}).Where("used_at IS NOT NULL").Update("used_at", time.Now().Add(-time.Minute))
+	w = post("/auth/refresh", "", map[string]string{"refresh_token": login.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = post("/auth/login", "", map[string]string{"email": "test@example.com", "password": "password123"})
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+
+	w = post("/auth/logout", login.AccessToken, map[string]string{"refresh_token": login.RefreshToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, validate(login.AccessToken))
+	w = post("/auth/refresh", "", map[string]string{"refresh_token": login.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Logging out everywhere ends the other sessions too
+	w = post("/auth/login", "", map[string]string{"email": "test@example.com", "password": "password123"})
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &login))
+	assert.Equal(t, http.StatusOK, validate(login.AccessToken))
+
+	w = post("/auth/logout-all", login.AccessToken, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, validate(login.AccessToken))
+	assert.Equal(t, http.StatusUnauthorized, validate(refreshed.AccessToken))
+}
+
+func TestVerifyEmailAndResetPassword(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	assert.NoError(t, SetupRoutes(router, db, config.Config{AppURL: "http://app.example.com", RequireActivation: true}, &mail.FileMailer{Dir: dir}, &storage.LocalStore{Dir: t.TempDir()}))
+
+	post := func(path string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	// lastToken returns the token of the link in the latest email
+	lastToken := func() string {
+		files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+		if !assert.NotEmpty(t, files) {
+			return ""
+		}
+		data, err := os.ReadFile(files[len(files)-1])
+		assert.NoError(t, err)
+		match := regexp.MustCompile(`http://app\.example\.com/[a-z-]+\?token=([\w.-]+)`).FindStringSubmatch(string(data))
+		if !assert.Len(t, match, 2) {
+			return ""
+		}
+		return match[1]
+	}
+	credentials := map[string]string{"email": "test@example.com", "password": "password123"}
+
+	w := post("/auth/signup", credentials)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NotContains(t, w.Body.String(), "refresh_token")
+
+	// Logins wait for the email address to be verified
+	w = post("/auth/login", credentials)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	verification := lastToken()
+	w = post("/auth/verify", map[string]string{"token": verification})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = post("/auth/verify", map[string]string{"token": verification})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = post("/auth/login", credentials)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var user models.User
+	assert.NoError(t, db.Where("email = ?", "test@example.com").First(&user).Error)
+	pat, _, err := auth.CreatePersonalToken(db, user.ID, "script", []string{"expenses:read"}, nil)
+	assert.NoError(t, err)
+
+	// Unknown addresses get the same answer
+	w = post("/auth/forgot", map[string]string{"email": "nobody@example.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = post("/auth/forgot", map[string]string{"email": "test@example.com"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	reset := lastToken()
+
+	// Tokens mailed to users aren't access tokens
+	for _, token := range []string{verification, reset} {
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/expenses", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	}
+
+	// A verification token doesn't reset passwords
+	w = post("/auth/reset", map[string]string{"token": verification, "password": "new-password"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = post("/auth/reset", map[string]string{"token": reset, "password": "new-password"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = post("/auth/reset", map[string]string{"token": reset, "password": "other-password"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The reset revoked the tokens created with the old password
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/expenses", nil)
+	req.Header.Set("Authorization", "Bearer "+pat)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = post("/auth/login", credentials)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = post("/auth/login", map[string]string{"email": "test@example.com", "password": "new-password"})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestTwoFactorLogin(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	router := setupTestRouter(t, db)
+
+	post := func(path, token string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	var setup struct {
+		Secret string `json:"secret"`
+		URI    string `json:"uri"`
+	}
+	w := post("/auth/totp/setup", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &setup))
+	assert.Contains(t, setup.URI, "otpauth://totp/")
+
+	step := totp.Step(time.Now())
+	code, _ := totp.Code(setup.Secret, step)
+	var enabled struct {
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	w = post("/auth/totp/enable", token, map[string]string{"code": code})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &enabled))
+	assert.Len(t, enabled.RecoveryCodes, auth.RecoveryCodeCount)
+
+	// The password alone no longer logs in
+	var first struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		Token       string `json:"token"`
+	}
+	credentials := map[string]string{"email": "test@example.com", "password": "password123"}
+	w = post("/auth/login", "", credentials)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &first))
+	assert.True(t, first.MFARequired)
+	assert.Empty(t, first.Token)
+
+	// The MFA token isn't an access token
+	w = post("/auth/totp/setup", first.MFAToken, nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = post("/auth/login/mfa", "", map[string]string{"mfa_token": first.MFAToken, "code": code})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	next, _ := totp.Code(setup.Secret, step+1)
+	w = post("/auth/login/mfa", "", map[string]string{"mfa_token": first.MFAToken, "code": next})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "refresh_token")
+
+	// A recovery code works in place of a TOTP code
+	w = post("/auth/login/mfa", "", map[string]string{"mfa_token": first.MFAToken, "code": enabled.RecoveryCodes[0]})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Codes can't be guessed from many IPs, the attempts per account are limited
+	guess := func(ip string) int {
+		body, _ := json.Marshal(map[string]string{"mfa_token": first.MFAToken, "code": "000000"})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/auth/login/mfa", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = ip + ":1234"
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnauthorized, guess("10.0.0.1"))
+	assert.Equal(t, http.StatusUnauthorized, guess("10.0.0.2"))
+	assert.Equal(t, http.StatusTooManyRequests, guess("10.0.0.3"))
+
+	w = post("/auth/totp/disable", token, map[string]string{"password": "wrong", "code": enabled.RecoveryCodes[1]})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = post("/auth/totp/disable", token, map[string]string{"password": "password123", "code": enabled.RecoveryCodes[1]})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = post("/auth/login", "", credentials)
+	assert.Contains(t, w.Body.String(), "refresh_token")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	server := oidctest.NewServer("expense-tracker", "secret")
+	defer server.Close()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	assert.NoError(t, SetupRoutes(router, db, config.Config{OIDC: []auth.OIDCProvider{{
+		Name:         "company",
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		RedirectURL:  "http://localhost:3000/auth/oidc/company/callback",
+	}}}, &mail.LogMailer{}, &storage.LocalStore{Dir: t.TempDir()}))
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/providers", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"providers":["company"]}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/unknown/login", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// The callback is answered in the browser that started the login, which
+	// holds the login cookie unless sameBrowser is false
+	loginIn := func(oidcUser oidctest.User, sameBrowser bool) *httptest.ResponseRecorder {
+		server.SetUser(oidcUser)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("GET", "/auth/oidc/company/login", nil))
+		assert.Equal(t, http.StatusOK, w.Code)
+		var start struct {
+			URL string `json:"url"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &start))
+		cookies := w.Result().Cookies()
+		assert.Len(t, cookies, 1)
+		assert.True(t, cookies[0].HttpOnly)
+
+		code, state, err := server.Authorize(start.URL)
+		assert.NoError(t, err)
+		body, _ := json.Marshal(map[string]string{"code": code, "state": state})
+		w = httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/auth/oidc/company/callback", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		if sameBrowser {
+			req.AddCookie(cookies[0])
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+	login := func(oidcUser oidctest.User) *httptest.ResponseRecorder {
+		return loginIn(oidcUser, true)
+	}
+
+	// A login can't be finished in another browser, e.g. one the code and
+	// state were passed to
+	w = loginIn(oidctest.User{Subject: "42", Email: user.Email, EmailVerified: true}, false)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Unverified addresses can't take over the existing account
+	w = login(oidctest.User{Subject: "42", Email: user.Email})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = login(oidctest.User{Subject: "42", Email: user.Email, EmailVerified: true})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var session struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &session))
+	assert.NotEmpty(t, session.RefreshToken)
+
+	// The session belongs to the existing user
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/auth/validate", nil)
+	req.Header.Set("Authorization", "Bearer "+session.Token)
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	claims, err := auth.ParseToken(session.Token)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, claims.UserID)
+
+	// Accounts with two-factor authentication still need their code
+	assert.NoError(t, db.Model(user).Update("totp_enabled_at", time.Now()).Error)
+	w = login(oidctest.User{Subject: "42", Email: user.Email, EmailVerified: true})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"mfa_required":true`)
+	assert.NotContains(t, w.Body.String(), "refresh_token")
+}
+
+func TestPersonalAccessTokens(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	personalWorkspace(t, db, user)
+	router := setupTestRouter(t, db)
+
+	request := func(method, path, token string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+	session, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	w := request("POST", "/auth/tokens", session, map[string]interface{}{"name": "script", "scopes": []string{"expenses:read"}})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Token  string                     `json:"token"`
+		Record models.PersonalAccessToken `json:"personal_access_token"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, models.Scopes{"expenses:read"}, created.Record.Scopes)
+
+	w = request("POST", "/auth/tokens", session, map[string]interface{}{"name": "script", "scopes": []string{"expenses:delete"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The token works within its scopes only
+	assert.Equal(t, http.StatusOK, request("GET", "/api/expenses", created.Token, nil).Code)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/api/expenses", created.Token, map[string]string{}).Code)
+	assert.Equal(t, http.StatusForbidden, request("GET", "/api/budgets", created.Token, nil).Code)
+
+	// and can't manage the account
+	assert.Equal(t, http.StatusForbidden, request("POST", "/auth/tokens", created.Token, map[string]interface{}{"name": "more", "scopes": []string{"budgets:*"}}).Code)
+	assert.Equal(t, http.StatusForbidden, request("POST", "/auth/logout-all", created.Token, nil).Code)
+
+	w = request("GET", "/auth/tokens", session, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Token)
+	assert.Contains(t, w.Body.String(), created.Record.Prefix)
+
+	w = request("DELETE", fmt.Sprintf("/auth/tokens/%d", created.Record.ID), session, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/api/expenses", created.Token, nil).Code)
+
+	// All tokens can be revoked at once
+	for i := 0; i < 2; i++ {
+		w = request("POST", "/auth/tokens", session, map[string]interface{}{"name": "script", "scopes": []string{"expenses:read"}})
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	w = request("DELETE", "/auth/tokens", session, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"revoked": 2}`, w.Body.String())
+	assert.Equal(t, http.StatusUnauthorized, request("GET", "/api/expenses", created.Token, nil).Code)
+}
+
 // Budget Handler Tests
 func TestCreateBudget(t *testing.T) {
 	db := setupTestDB(t)
 	user := setupTestUser(t, db)
 
 	// Create auth token
-	token, err := auth.GenerateToken(user.ID)
+	token, err := auth.GenerateToken(user)
 	assert.NoError(t, err)
 
-	router := setupTestRouter(db)
+	router := setupTestRouter(t, db)
 
 	tests := []struct {
 		name       string
@@ -149,18 +683,19 @@ func TestCreateBudget(t *testing.T) {
 func TestCreateExpense(t *testing.T) {
 	db := setupTestDB(t)
 	user := setupTestUser(t, db)
+	workspaceID := personalWorkspace(t, db, user)
 
 	// Create auth token
-	token, err := auth.GenerateToken(user.ID)
+	token, err := auth.GenerateToken(user)
 	assert.NoError(t, err)
 
-	router := setupTestRouter(db)
+	router := setupTestRouter(t, db)
 
 	// Create a test budget
 	budget := &models.Budget{
-		UserID: user.ID,
+		UserID: user.ID, WorkspaceID: workspaceID,
 		Name:   "Groceries",
-		Amount: 500.00,
+		Amount: models.MustParseMoney("500.00"),
 		Month:  time.Now().Format("2006-01"),
 	}
 	db.Create(budget)
@@ -205,3 +740,1257 @@ func TestCreateExpense(t *testing.T) {
 		})
 	}
 }
+
+func TestRolloverBudgets(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	workspaceID := personalWorkspace(t, db, user)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	budget := &models.Budget{
+		UserID: user.ID, WorkspaceID: workspaceID,
+		Name:           "Groceries",
+		Amount:         models.MustParseMoney("500.00"),
+		Month:          "2024-01",
+		RollOverAmount: models.MustParseMoney("450.00"),
+		RolloverMode:   models.RolloverCarry,
+	}
+	db.Create(budget)
+
+	body, _ := json.Marshal(map[string]string{"month": "2024-03"})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/budgets/rollover", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, float64(2), response["created"])
+
+	var march models.Budget
+	assert.NoError(t, db.Where("workspace_id = ? AND month = ?", workspaceID, "2024-03").First(&march).Error)
+	assert.Equal(t, models.MustParseMoney("550.00"), march.CarriedAmount)
+}
+
+func TestExpenseAmountsAreExact(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	workspaceID := personalWorkspace(t, db, user)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	budget := &models.Budget{
+		UserID: user.ID, WorkspaceID: workspaceID,
+		Name:   "Groceries",
+		Amount: models.MustParseMoney("500.00"),
+		Month:  time.Now().Format("2006-01"),
+	}
+	db.Create(budget)
+
+	for i := 0; i < 3; i++ {
+		body, _ := json.Marshal(map[string]interface{}{
+			"amount":      json.Number("0.1"),
+			"budget_id":   budget.ID,
+			"description": "Gum",
+			"date":        time.Now().Format("2006-01-02"),
+		})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/expenses", bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Contains(t, w.Body.String(), `"amount":0.10`)
+	}
+
+	var updated models.Budget
+	assert.NoError(t, db.First(&updated, budget.ID).Error)
+	assert.Equal(t, models.MustParseMoney("0.30"), updated.RollOverAmount)
+}
+
+func TestUpdateExpenseMovesAmountBetweenBudgets(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	workspaceID := personalWorkspace(t, db, user)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	month := time.Now().Format("2006-01")
+	groceries := &models.Budget{UserID: user.ID, WorkspaceID: workspaceID, Name: "Groceries", Amount: models.MustParseMoney("500.00"), Month: month, RollOverAmount: models.MustParseMoney("50.00")}
+	fun := &models.Budget{UserID: user.ID, WorkspaceID: workspaceID, Name: "Fun", Amount: models.MustParseMoney("100.00"), Month: month}
+	db.Create(groceries)
+	db.Create(fun)
+
+	expense := &models.Expense{UserID: user.ID, WorkspaceID: workspaceID, BudgetID: &groceries.ID, Amount: models.MustParseMoney("50.00"), BaseAmount: models.MustParseMoney("50.00"), Description: "Concert", Date: time.Now()}
+	db.Create(expense)
+
+	// Change budget and amount at the same time
+	body, _ := json.Marshal(map[string]interface{}{
+		"amount":    70.00,
+		"budget_id": fun.ID,
+	})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/expenses/%d", expense.ID), bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	db.First(groceries, groceries.ID)
+	db.First(fun, fun.ID)
+	assert.Equal(t, models.Money(0), groceries.RollOverAmount)
+	assert.Equal(t, models.MustParseMoney("70.00"), fun.RollOverAmount)
+
+	// Deleting the expense takes it off the budget again
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest("DELETE", fmt.Sprintf("/api/expenses/%d", expense.ID), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	db.First(fun, fun.ID)
+	assert.Equal(t, models.Money(0), fun.RollOverAmount)
+}
+
+func TestUpdateExpenseRejectsOtherUsersBudget(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	workspaceID := personalWorkspace(t, db, user)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	month := time.Now().Format("2006-01")
+	foreign := &models.Budget{UserID: user.ID + 1, WorkspaceID: workspaceID + 1, Name: "Foreign", Amount: models.MustParseMoney("100.00"), Month: month}
+	db.Create(foreign)
+
+	expense := &models.Expense{UserID: user.ID, WorkspaceID: workspaceID, Amount: models.MustParseMoney("5.00"), Description: "Coffee", Date: time.Now()}
+	db.Create(expense)
+
+	body, _ := json.Marshal(map[string]interface{}{"budget_id": foreign.ID})
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", fmt.Sprintf("/api/expenses/%d", expense.ID), bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	db.First(foreign, foreign.ID)
+	assert.Equal(t, models.Money(0), foreign.RollOverAmount)
+}
+
+func TestReconcileBudgets(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	workspaceID := personalWorkspace(t, db, user)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	budget := &models.Budget{UserID: user.ID, WorkspaceID: workspaceID, Name: "Groceries", Amount: models.MustParseMoney("500.00"), Month: time.Now().Format("2006-01"), RollOverAmount: models.MustParseMoney("499.99")}
+	db.Create(budget)
+	db.Create(&models.Expense{UserID: user.ID, WorkspaceID: workspaceID, BudgetID: &budget.ID, Amount: models.MustParseMoney("42.00"), BaseAmount: models.MustParseMoney("42.00"), Description: "Market", Date: time.Now()})
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/budgets/reconcile", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Corrections []map[string]interface{} `json:"corrections"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Corrections, 1)
+	assert.Equal(t, 499.99, response.Corrections[0]["stored"])
+	assert.Equal(t, 42.0, response.Corrections[0]["actual"])
+
+	db.First(budget, budget.ID)
+	assert.Equal(t, models.MustParseMoney("42.00"), budget.RollOverAmount)
+}
+
+func TestCreateExpenseInForeignCurrency(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	workspaceID := personalWorkspace(t, db, user)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+	importRates := func(router *gin.Engine) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/rates/import", bytes.NewBufferString("Date,USD,\n2024-01-02,1.25,\n"))
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Rates are shared, only verified admins change them
+	assert.Equal(t, http.StatusForbidden, importRates(router).Code)
+	admin := gin.New()
+	assert.NoError(t, SetupRoutes(admin, db, config.Config{AdminEmails: []string{"Test@Example.com"}}, &mail.LogMailer{}, &storage.LocalStore{Dir: t.TempDir()}))
+	assert.Equal(t, http.StatusForbidden, importRates(admin).Code)
+	assert.NoError(t, db.Model(user).Update("activated_at", time.Now()).Error)
+
+	w := importRates(admin)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"imported": 1}`, w.Body.String())
+
+	budget := &models.Budget{UserID: user.ID, WorkspaceID: workspaceID, Name: "Travel", Amount: models.MustParseMoney("500.00"), CarriedAmount: models.MustParseMoney("10.00"), Month: "2024-01"}
+	db.Create(budget)
+
+	tests := []struct {
+		name       string
+		date       string
+		wantStatus int
+	}{
+		{name: "rate known", date: "2024-01-05", wantStatus: http.StatusCreated},
+		{name: "no rate yet", date: "2024-01-01", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, _ := json.Marshal(map[string]interface{}{
+				"amount":      25.00,
+				"currency":    "usd",
+				"budget_id":   budget.ID,
+				"description": "Museum",
+				"date":        tt.date,
+			})
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/api/expenses", bytes.NewBuffer(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", "application/json")
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusCreated {
+				var expense map[string]interface{}
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &expense))
+				assert.Equal(t, 25.0, expense["amount"])
+				assert.Equal(t, "USD", expense["currency"])
+				assert.Equal(t, 20.0, expense["base_amount"])
+				assert.Equal(t, "EUR", expense["base_currency"])
+			}
+		})
+	}
+
+	// Only the converted amount of the successful request is booked
+	db.First(budget, budget.ID)
+	assert.Equal(t, models.MustParseMoney("20.00"), budget.RollOverAmount)
+
+	// Switching the base currency converts the budget totals as well
+	body, _ := json.Marshal(map[string]string{"base_currency": "USD"})
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest("PUT", "/api/settings", bytes.NewBuffer(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	db.First(budget, budget.ID)
+	assert.Equal(t, models.MustParseMoney("25.00"), budget.RollOverAmount)
+	assert.Equal(t, models.MustParseMoney("625.00"), budget.Amount)
+	assert.Equal(t, models.MustParseMoney("12.50"), budget.CarriedAmount)
+}
+
+func TestFilterExpensesByCategoryAndTag(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	request := func(method, path string, input interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(input)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var travel, flights, food models.Category
+	w := request("POST", "/api/categories", map[string]interface{}{"name": "Travel"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &travel))
+	w = request("POST", "/api/categories", map[string]interface{}{"name": "Flights", "parent_id": travel.ID})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &flights))
+	w = request("POST", "/api/categories", map[string]interface{}{"name": "Food"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &food))
+
+	// Blank tag names are rejected, others are trimmed
+	w = request("POST", "/api/tags", map[string]interface{}{"name": "  "})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"Tag name can't be blank"}`, w.Body.String())
+	w = request("POST", "/api/tags", map[string]interface{}{"name": " vacation "})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"vacation"`)
+
+	// Moving a category below its own child is rejected
+	w = request("PUT", fmt.Sprintf("/api/categories/%d", travel.ID), map[string]interface{}{"parent_id": flights.ID})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	date := time.Now().Format("2006-01-02")
+	expenses := []map[string]interface{}{
+		{"amount": 300, "description": "Flight", "date": date, "category_id": flights.ID, "tags": []string{"vacation"}},
+		{"amount": 80, "description": "Hotel", "date": date, "category_id": travel.ID, "tags": []string{"vacation", "reimbursable"}},
+		{"amount": 20, "description": "Lunch", "date": date, "category_id": food.ID, "tags": []string{"reimbursable"}},
+	}
+	for _, expense := range expenses {
+		w := request("POST", "/api/expenses", expense)
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{name: "category with children", query: fmt.Sprintf("category_id=%d", travel.ID), want: []string{"Flight", "Hotel"}},
+		{name: "leaf category", query: fmt.Sprintf("category_id=%d", flights.ID), want: []string{"Flight"}},
+		{name: "tag", query: "tag=reimbursable", want: []string{"Hotel", "Lunch"}},
+		{name: "all tags", query: "tag=reimbursable&tag=vacation", want: []string{"Hotel"}},
+		{name: "category and tag", query: fmt.Sprintf("category_id=%d&tag=reimbursable", food.ID), want: []string{"Lunch"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := request("GET", "/api/expenses?"+tt.query, nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var result []models.Expense
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+			var descriptions []string
+			for _, expense := range result {
+				descriptions = append(descriptions, expense.Description)
+			}
+			assert.ElementsMatch(t, tt.want, descriptions)
+		})
+	}
+
+	// Deleting a category moves its expenses to the parent
+	w = request("DELETE", fmt.Sprintf("/api/categories/%d", flights.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var flight models.Expense
+	assert.NoError(t, db.Where("description = ?", "Flight").First(&flight).Error)
+	assert.Equal(t, travel.ID, *flight.CategoryID)
+}
+
+func TestFilterExpensesByMonth(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	request := func(method, path string, input interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(input)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The first and last day of a month belong to it, the days around it don't
+	for _, date := range []string{"2023-12-31", "2024-01-01", "2024-01-31", "2024-02-01"} {
+		w := request("POST", "/api/expenses", map[string]interface{}{"amount": 10, "description": date, "date": date})
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	w := request("GET", "/api/expenses?month=2024-01", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result []models.Expense
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	var descriptions []string
+	for _, expense := range result {
+		descriptions = append(descriptions, expense.Description)
+	}
+	assert.Equal(t, []string{"2024-01-31", "2024-01-01"}, descriptions)
+
+	w = request("GET", "/api/expenses?month=January", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestPaginateExpenses(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	request := func(method, path string, input interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(input)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i, description := range []string{"Bakery", "Bookstore", "Bus ticket"} {
+		w := request("POST", "/api/expenses", map[string]interface{}{
+			"amount": 10 * (i + 1), "description": description, "date": fmt.Sprintf("2024-03-0%d", i+1),
+		})
+		assert.Equal(t, http.StatusCreated, w.Code)
+	}
+
+	// Without a limit or cursor all expenses are returned as an array
+	w := request("GET", "/api/expenses?description=b&min_amount=15", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var all []models.Expense
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &all))
+	assert.Len(t, all, 2)
+
+	var descriptions []string
+	path := "/api/expenses?limit=2&sort=date&budget_id=unbudgeted"
+	for path != "" {
+		w := request("GET", path, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var page struct {
+			Expenses   []models.Expense `json:"expenses"`
+			Total      int64            `json:"total"`
+			NextCursor string           `json:"next_cursor"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		assert.Equal(t, int64(3), page.Total)
+		for _, expense := range page.Expenses {
+			descriptions = append(descriptions, expense.Description)
+		}
+
+		path = ""
+		if page.NextCursor != "" {
+			path = "/api/expenses?limit=2&sort=date&budget_id=unbudgeted&cursor=" + page.NextCursor
+		}
+	}
+	assert.Equal(t, []string{"Bakery", "Bookstore", "Bus ticket"}, descriptions)
+
+	for _, query := range []string{"cursor=invalid", "sort=name", "limit=0", "min_amount=ten", "from=March", "budget_id=none"} {
+		w := request("GET", "/api/expenses?"+query, nil)
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
+
+func TestSearchExpenses(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	request := func(method, path string, input interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(input)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	var dentist models.Expense
+	w := request("POST", "/api/expenses", map[string]interface{}{"amount": 120, "description": "Dentist", "notes": "Check-up", "date": "2024-04-12"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &dentist))
+	assert.Equal(t, "Check-up", dentist.Notes)
+	w = request("POST", "/api/expenses", map[string]interface{}{"amount": 15, "description": "Pharmacy", "date": "2024-05-02"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	search := func(query string) []string {
+		w := request("GET", "/api/search?"+query, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var results []struct {
+			Expense models.Expense `json:"expense"`
+			Rank    float64        `json:"rank"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &results))
+		descriptions := []string{}
+		for _, result := range results {
+			descriptions = append(descriptions, result.Expense.Description)
+		}
+		return descriptions
+	}
+
+	assert.Equal(t, []string{"Dentist"}, search("q=check"))
+	assert.ElementsMatch(t, []string{"Dentist", "Pharmacy"}, search("q=dentist+pharmacy"))
+	assert.Equal(t, []string{"Pharmacy"}, search("q=dentist+pharmacy&month=2024-05"))
+
+	// Updated notes are found, cleared ones aren't
+	w = request("PUT", fmt.Sprintf("/api/expenses/%d", dentist.ID), map[string]interface{}{"notes": ""})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, search("q=check"))
+
+	w = request("GET", "/api/search?q=", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAttachments(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	upload := func(path, name string, data []byte) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		file, _ := form.CreateFormFile("file", name)
+		file.Write(data)
+		form.Close()
+
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", path, &body)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		router.ServeHTTP(w, req)
+		return w
+	}
+	request := func(method, path string, authorized bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		if authorized {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	expense := models.Expense{UserID: user.ID, WorkspaceID: personalWorkspace(t, db, user), Amount: 4250, Description: "Dinner", Date: time.Now()}
+	assert.NoError(t, db.Create(&expense).Error)
+	path := fmt.Sprintf("/api/expenses/%d/attachments", expense.ID)
+
+	pdf := []byte("%PDF-1.4\n%receipt\n")
+	w := upload(path, "receipt.pdf", pdf)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var receipt models.Attachment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &receipt))
+	assert.Equal(t, "application/pdf", receipt.ContentType)
+	assert.NotEmpty(t, receipt.URL)
+	assert.Empty(t, receipt.ThumbnailURL)
+
+	// Uploading the same file again returns the existing attachment
+	w = upload(path, "copy.pdf", pdf)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var again models.Attachment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &again))
+	assert.Equal(t, receipt.ID, again.ID)
+
+	// Images get a thumbnail
+	var picture bytes.Buffer
+	assert.NoError(t, png.Encode(&picture, image.NewGray(image.Rect(0, 0, 640, 480))))
+	w = upload(path, "photo.png", picture.Bytes())
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var photo models.Attachment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &photo))
+	assert.NotEmpty(t, photo.ThumbnailURL)
+
+	// Files are checked by their content and size
+	w = upload(path, "invoice.pdf", []byte("<html><script>alert(1)</script></html>"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+	w = upload(path, "large.pdf", append([]byte("%PDF-1.4\n"), make([]byte, 11<<20)...))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	w = upload("/api/expenses/999/attachments", "receipt.pdf", pdf)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Download URLs work without the Authorization header, but only with
+	// their token
+	w = request("GET", receipt.URL, false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, pdf, w.Body.Bytes())
+	assert.Equal(t, "application/pdf", w.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Contains(t, w.Header().Get("Content-Disposition"), `filename=receipt.pdf`)
+
+	w = request("GET", photo.ThumbnailURL, false)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+
+	w = request("GET", fmt.Sprintf("/api/attachments/%d/download", receipt.ID), true)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = request("GET", fmt.Sprintf("/api/attachments/%d/download?token=%s", receipt.ID, token), false)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	downloadToken, _ := auth.IssueDownloadToken(receipt.ID, false)
+	w = request("GET", fmt.Sprintf("/api/attachments/%d/download?token=%s", photo.ID, downloadToken), false)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = request("GET", path, true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var list []models.Attachment
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list, 2)
+
+	w = request("DELETE", fmt.Sprintf("%s/%d", path, photo.ID), true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = request("GET", photo.URL, false)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Deleting the expense deletes its attachments
+	w = request("DELETE", fmt.Sprintf("/api/expenses/%d", expense.ID), true)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var count int64
+	db.Model(&models.Attachment{}).Where("expense_id = ?", expense.ID).Count(&count)
+	assert.Equal(t, int64(0), count)
+	w = request("GET", receipt.URL, false)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestExport(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	workspaceID := personalWorkspace(t, db, user)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	db.Create(&models.Expense{UserID: user.ID, WorkspaceID: workspaceID, Amount: models.MustParseMoney("4.20"), Currency: "EUR", BaseAmount: models.MustParseMoney("4.20"), BaseCurrency: "EUR", Description: "Coffee", Date: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)})
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantType   string
+	}{
+		{name: "csv", query: "format=csv&from=2024-03-01&to=2024-03-31", wantStatus: http.StatusOK, wantType: "text/csv; charset=utf-8"},
+		{name: "ndjson budgets", query: "format=ndjson&type=budgets", wantStatus: http.StatusOK, wantType: "application/x-ndjson"},
+		{name: "invalid format", query: "format=xml", wantStatus: http.StatusBadRequest},
+		{name: "invalid date", query: "from=March", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/api/export?"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantType, w.Header().Get("Content-Type"))
+				assert.Equal(t, "1", w.Header().Get("X-Export-Version"))
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/api/export", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	router.ServeHTTP(w, req)
+	assert.Contains(t, w.Body.String(), ",Coffee,4.20,EUR,4.20,EUR,,,,,\n")
+}
+
+func TestImport(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	workspaceID := personalWorkspace(t, db, user)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	budget := &models.Budget{UserID: user.ID, WorkspaceID: workspaceID, Name: "Groceries", Amount: models.MustParseMoney("500.00"), Month: "2024-01"}
+	db.Create(budget)
+	db.Create(&models.Expense{UserID: user.ID, WorkspaceID: workspaceID, Amount: models.MustParseMoney("12.50"), Currency: "EUR", BaseAmount: models.MustParseMoney("12.50"), BaseCurrency: "EUR", Description: "Bakery", Date: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)})
+
+	// Preview a CSV file
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, _ := form.CreateFormFile("file", "statement.csv")
+	file.Write([]byte("date,text,amount\n2024-01-05,BAKERY 12,-12.50\n2024-01-06,SUPERMARKET,-30.10\n2024-01-07,SALARY,3000\n"))
+	form.WriteField("mapping", `{"date": "date", "amount": "amount", "description": "text"}`)
+	form.Close()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/api/imports/preview", &body)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var preview struct {
+		Format     string `json:"format"`
+		Candidates []struct {
+			Description string `json:"description"`
+			Duplicate   bool   `json:"duplicate"`
+		} `json:"candidates"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &preview))
+	assert.Equal(t, "csv", preview.Format)
+	assert.Len(t, preview.Candidates, 2)
+	assert.True(t, preview.Candidates[0].Duplicate)
+	assert.False(t, preview.Candidates[1].Duplicate)
+
+	commit := func(rows []map[string]interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(map[string]interface{}{"rows": rows})
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/imports/commit", bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A single invalid row rolls back the whole import
+	w = commit([]map[string]interface{}{
+		{"date": "2024-01-06", "amount": 30.10, "description": "SUPERMARKET", "budget_id": budget.ID},
+		{"date": "2024-02-01", "amount": 5, "description": "Wrong month", "budget_id": budget.ID},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Row 1")
+
+	var count int64
+	db.Model(&models.Expense{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	w = commit([]map[string]interface{}{
+		{"date": "2024-01-06", "amount": 30.10, "description": "SUPERMARKET", "budget_id": budget.ID, "external_id": "X1"},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	db.Model(&models.Expense{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+	db.First(budget, budget.ID)
+	assert.Equal(t, models.MustParseMoney("30.10"), budget.RollOverAmount)
+}
+
+func TestRules(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	workspaceID := personalWorkspace(t, db, user)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	budget := &models.Budget{UserID: user.ID, WorkspaceID: workspaceID, Name: "Groceries", Amount: models.MustParseMoney("500.00"), Month: "2024-01"}
+	db.Create(budget)
+	existing := &models.Expense{UserID: user.ID, WorkspaceID: workspaceID, Amount: 1250, Currency: "EUR", BaseAmount: 1250, BaseCurrency: "EUR", Description: "ALDI Nord", Date: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)}
+	db.Create(existing)
+
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(data))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/api/rules", map[string]interface{}{"name": "Broken", "description_pattern": "REWE(", "budget_name": "Groceries"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("POST", "/api/rules", map[string]interface{}{
+		"name":                "Supermarkets",
+		"description_pattern": "REWE|ALDI",
+		"budget_name":         "Groceries",
+		"tags":                []string{"supermarket"},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var rule models.Rule
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rule))
+	assert.True(t, rule.Enabled)
+
+	// New expenses are assigned by the rule
+	w = request("POST", "/api/expenses", map[string]interface{}{"amount": 20, "description": "REWE Markt", "date": "2024-01-05"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var expense models.Expense
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &expense))
+	assert.Equal(t, budget.ID, *expense.BudgetID)
+	assert.Len(t, expense.Tags, 1)
+
+	// The existing expense is only changed when the rule is applied
+	w = request("POST", fmt.Sprintf("/api/rules/%d/dry-run", rule.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"expense_id":`+fmt.Sprint(existing.ID))
+
+	db.First(existing, existing.ID)
+	assert.Nil(t, existing.BudgetID)
+
+	w = request("POST", fmt.Sprintf("/api/rules/%d/apply", rule.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	db.First(existing, existing.ID)
+	assert.Equal(t, budget.ID, *existing.BudgetID)
+	db.First(budget, budget.ID)
+	assert.Equal(t, models.MustParseMoney("32.50"), budget.RollOverAmount)
+}
+
+func TestRecurringExpenses(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(data))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/api/recurring", map[string]interface{}{
+		"description": "Streaming", "amount": 9.99, "rrule": "FREQ=DAILY", "start_date": "2024-01-01",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Occurrences in the past are created right away
+	w = request("POST", "/api/recurring", map[string]interface{}{
+		"description": "Streaming", "amount": 9.99, "rrule": "FREQ=MONTHLY;BYMONTHDAY=15;UNTIL=20240331",
+		"start_date": "2024-01-01",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var r models.RecurringExpense
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &r))
+	assert.Equal(t, "EUR", r.Currency)
+	assert.Equal(t, "2024-04-15", r.NextDate.Format("2006-01-02"))
+
+	var expenses []models.Expense
+	db.Where("recurring_expense_id = ?", r.ID).Order("date").Find(&expenses)
+	assert.Len(t, expenses, 3)
+	assert.Equal(t, models.MustParseMoney("9.99"), expenses[2].Amount)
+
+	w = request("POST", fmt.Sprintf("/api/recurring/%d/pause", r.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"paused":true`)
+
+	w = request("POST", fmt.Sprintf("/api/recurring/%d/skip", r.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"next_date":"2024-05-15T00:00:00Z"`)
+
+	w = request("DELETE", fmt.Sprintf("/api/recurring/%d", r.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The created expenses are kept
+	var count int64
+	db.Model(&models.Expense{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestReports(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	workspaceID := personalWorkspace(t, db, user)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	budget := &models.Budget{UserID: user.ID, WorkspaceID: workspaceID, Name: "Groceries", Amount: models.MustParseMoney("100.00"), Month: "2024-01"}
+	db.Create(budget)
+	db.Create(&models.Expense{UserID: user.ID, WorkspaceID: workspaceID, BudgetID: &budget.ID, Amount: 12000, Currency: "EUR", BaseAmount: 12000, BaseCurrency: "EUR", Description: "REWE", Date: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/api/reports/budget-vs-actual?month=2024-01")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var variances []struct {
+		BudgetName string       `json:"budget_name"`
+		Variance   models.Money `json:"variance"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &variances))
+	assert.Len(t, variances, 1)
+	assert.Equal(t, models.MustParseMoney("-20.00"), variances[0].Variance)
+
+	for _, path := range []string{
+		"/api/reports/spend-by-budget?from=2024-01&to=2024-03",
+		"/api/reports/trend?month=2024-03&months=3",
+		"/api/reports/top-descriptions?from=2024-01&to=2024-01&limit=5",
+		"/api/reports/burn-rate?month=2024-01",
+	} {
+		assert.Equal(t, http.StatusOK, get(path).Code, path)
+	}
+
+	for _, path := range []string{
+		"/api/reports/spend-by-budget?from=2024-03&to=2024-01",
+		"/api/reports/trend?months=0",
+		"/api/reports/burn-rate?month=January",
+	} {
+		assert.Equal(t, http.StatusBadRequest, get(path).Code, path)
+	}
+}
+
+func TestIncomeAndCashFlow(t *testing.T) {
+	db := setupTestDB(t)
+	user := setupTestUser(t, db)
+	workspaceID := personalWorkspace(t, db, user)
+
+	token, err := auth.GenerateToken(user)
+	assert.NoError(t, err)
+
+	router := setupTestRouter(t, db)
+
+	request := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(data))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/api/income", map[string]interface{}{"description": "Bonus", "amount": 500, "date": "2024-01-31"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var bonus models.Income
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &bonus))
+	assert.Equal(t, "EUR", bonus.Currency)
+	assert.Equal(t, models.MustParseMoney("500.00"), bonus.BaseAmount)
+
+	w = request("POST", "/api/income", map[string]interface{}{"description": "Bonus", "amount": 500, "currency": "USD", "date": "2024-01-31"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("PUT", "/api/income/999", map[string]interface{}{"description": "Bonus", "amount": 500, "date": "2024-01-31"})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// A salary is recurring income, it has no budget
+	w = request("POST", "/api/recurring", map[string]interface{}{
+		"type": "income", "description": "Salary", "amount": 2000, "budget_name": "Groceries",
+		"rrule": "FREQ=MONTHLY;BYMONTHDAY=25;UNTIL=20240229", "start_date": "2024-01-01",
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request("POST", "/api/recurring", map[string]interface{}{
+		"type": "income", "description": "Salary", "amount": 2000,
+		"rrule": "FREQ=MONTHLY;BYMONTHDAY=25;UNTIL=20240229", "start_date": "2024-01-01",
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Contains(t, w.Body.String(), `"type":"income"`)
+	var salary models.RecurringExpense
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &salary))
+
+	// Updates keep the type, it can't be changed
+	update := map[string]interface{}{
+		"description": "Salary", "amount": 2100,
+		"rrule": "FREQ=MONTHLY;BYMONTHDAY=25;UNTIL=20240229", "start_date": "2024-01-01",
+	}
+	w = request("PUT", fmt.Sprintf("/api/recurring/%d", salary.ID), update)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"type":"income"`)
+	update["type"] = "expense"
+	w = request("PUT", fmt.Sprintf("/api/recurring/%d", salary.ID), update)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("GET", "/api/income?month=2024-01", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var income []models.Income
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &income))
+	assert.Len(t, income, 2)
+	w = request("GET", "/api/recurring?type=expense", nil)
+	assert.Equal(t, "[]", w.Body.String())
+
+	db.Create(&models.Expense{UserID: user.ID, WorkspaceID: workspaceID, Amount: 150000, Currency: "EUR", BaseAmount: 150000,
+		BaseCurrency: "EUR", Description: "Rent", Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)})
+
+	w = request("GET", "/api/reports/cash-flow?from=2024-01&to=2024-02", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var flow reports.CashFlow
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &flow))
+	assert.Len(t, flow.Months, 2)
+	assert.Equal(t, models.MustParseMoney("2500.00"), flow.Months[0].Income)
+	assert.Equal(t, models.MustParseMoney("1000.00"), flow.Months[0].Net)
+	assert.Equal(t, 40.0, *flow.Months[0].SavingsRate)
+	assert.Equal(t, models.MustParseMoney("3000.00"), flow.Net)
+
+	// Zero-based budgets can only be assigned the month's income
+	w = request("PUT", "/api/settings", map[string]interface{}{"zero_based": true})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"base_currency":"EUR"`)
+	assert.Contains(t, w.Body.String(), `"zero_based":true`)
+
+	rent := models.Budget{UserID: user.ID, WorkspaceID: workspaceID, Name: "Rent", Amount: 150000, Month: "2024-01"}
+	db.Create(&rent)
+	assign := func(amount float64) *httptest.ResponseRecorder {
+		return request("PUT", "/api/budgets/assignments", map[string]interface{}{
+			"month": "2024-01", "budgets": []map[string]interface{}{{"budget_id": rent.ID, "amount": amount}},
+		})
+	}
+	assert.Equal(t, http.StatusBadRequest, assign(2500.01).Code)
+	assert.Equal(t, http.StatusOK, assign(2500).Code)
+
+	w = request("GET", "/api/budgets/assignments?month=2024-01", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var plan budgets.Plan
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &plan))
+	assert.True(t, plan.ZeroBased)
+	assert.Equal(t, models.Money(0), plan.ToAssign)
+
+	w = request("PUT", fmt.Sprintf("/api/budgets/%d", rent.ID), map[string]interface{}{"amount": 3000})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("DELETE", fmt.Sprintf("/api/income/%d", bonus.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = request("GET", "/api/income?month=2024-01", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &income))
+	assert.Len(t, income, 1)
+
+	// The budget is over-assigned now, it can still be changed without
+	// assigning it more
+	w = request("PUT", fmt.Sprintf("/api/budgets/%d", rent.ID), map[string]interface{}{"amount": 2500, "rollover_mode": "carry"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusOK, assign(2400).Code)
+	assert.Equal(t, http.StatusBadRequest, assign(2400.01).Code)
+}
+
+func TestWorkspaces(t *testing.T) {
+	db := setupTestDB(t)
+	owner := setupTestUser(t, db)
+	hashedPassword, _ := auth.HashPassword("password123")
+	member := &models.User{Email: "partner@example.com", PasswordHash: hashedPassword}
+	assert.NoError(t, db.Create(member).Error)
+
+	router := setupTestRouter(t, db)
+
+	request := func(user *models.User, workspaceID uint, method, path string, body interface{}) *httptest.ResponseRecorder {
+		token, err := auth.GenerateToken(user)
+		assert.NoError(t, err)
+
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(data))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		if workspaceID != 0 {
+			req.Header.Set("X-Workspace-ID", fmt.Sprint(workspaceID))
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(owner, 0, "POST", "/api/workspaces", map[string]string{"name": "Household"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var household models.Workspace
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &household))
+
+	w = request(owner, household.ID, "POST", "/api/budgets", map[string]interface{}{"name": "Groceries", "amount": 400})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	// The budget lives in the household, not in the personal workspace
+	w = request(owner, 0, "GET", "/api/budgets", nil)
+	assert.Equal(t, "[]", w.Body.String())
+
+	// Non-members can't tell the workspace exists
+	w = request(member, household.ID, "GET", "/api/budgets", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Only owners invite, invitations are accepted by the invited address
+	assert.NoError(t, db.Model(owner).Update("activated_at", time.Now()).Error)
+	w = request(owner, household.ID, "POST", "/api/workspace/invitations", map[string]string{"email": "Partner@example.com", "role": "viewer"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var invitation models.WorkspaceInvitation
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &invitation))
+
+	w = request(owner, 0, "POST", fmt.Sprintf("/api/invitations/%d/accept", invitation.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = request(member, 0, "GET", "/api/invitations", nil)
+	assert.Contains(t, w.Body.String(), `"name":"Household"`)
+
+	// once the address is verified
+	w = request(member, 0, "POST", fmt.Sprintf("/api/invitations/%d/accept", invitation.ID), nil)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.NoError(t, db.Model(member).Update("activated_at", time.Now()).Error)
+
+	w = request(member, 0, "POST", fmt.Sprintf("/api/invitations/%d/accept", invitation.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Viewers read the shared data but can't change it
+	w = request(member, household.ID, "GET", "/api/budgets", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"Groceries"`)
+
+	w = request(member, household.ID, "POST", "/api/expenses", map[string]interface{}{"amount": 20, "description": "Market", "date": "2024-01-05"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = request(member, household.ID, "PUT", fmt.Sprintf("/api/workspace/members/%d", member.ID), map[string]string{"role": "owner"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// Editors can
+	w = request(owner, household.ID, "PUT", fmt.Sprintf("/api/workspace/members/%d", member.ID), map[string]string{"role": "editor"})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = request(member, household.ID, "POST", "/api/expenses", map[string]interface{}{"amount": 20, "description": "Market", "date": "2024-01-05"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = request(owner, household.ID, "GET", "/api/expenses", nil)
+	assert.Contains(t, w.Body.String(), `"description":"Market"`)
+
+	w = request(owner, household.ID, "GET", "/api/workspace/members", nil)
+	assert.Contains(t, w.Body.String(), `"email":"partner@example.com"`)
+
+	// The last owner can neither leave nor be demoted
+	w = request(owner, 0, "POST", fmt.Sprintf("/api/workspaces/%d/leave", household.ID), nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(member, 0, "POST", fmt.Sprintf("/api/workspaces/%d/leave", household.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = request(member, household.ID, "GET", "/api/budgets", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// Personal workspaces can't be deleted, shared ones can
+	w = request(owner, 0, "DELETE", "/api/workspace", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(owner, household.ID, "DELETE", "/api/workspace", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = request(owner, household.ID, "GET", "/api/budgets", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSplitExpenses(t *testing.T) {
+	db := setupTestDB(t)
+	owner := setupTestUser(t, db)
+	partner := &models.User{Email: "partner@example.com", PasswordHash: "x"}
+	assert.NoError(t, db.Create(partner).Error)
+
+	household, err := workspaces.Create(db, owner.ID, "Household", "USD")
+	assert.NoError(t, err)
+	assert.NoError(t, db.Create(&models.WorkspaceMember{WorkspaceID: household.ID, UserID: partner.ID, Role: models.RoleEditor}).Error)
+
+	router := setupTestRouter(t, db)
+
+	request := func(user *models.User, method, path string, body interface{}) *httptest.ResponseRecorder {
+		token, err := auth.GenerateToken(user)
+		assert.NoError(t, err)
+
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBuffer(data))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Workspace-ID", fmt.Sprint(household.ID))
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The owner pays 100, split equally
+	w := request(owner, "POST", "/api/expenses", map[string]interface{}{
+		"amount": 100, "description": "Dinner", "date": "2024-01-05",
+		"split": map[string]interface{}{"method": "equal", "shares": []map[string]interface{}{{"user_id": owner.ID}, {"user_id": partner.ID}}},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var dinner models.Expense
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &dinner))
+	assert.Equal(t, models.SplitEqual, dinner.SplitMethod)
+	assert.Len(t, dinner.Splits, 2)
+
+	// Exact shares have to add up to the amount
+	w = request(partner, "POST", "/api/expenses", map[string]interface{}{
+		"amount": 30, "description": "Taxi", "date": "2024-01-06",
+		"split": map[string]interface{}{"method": "exact", "shares": []map[string]interface{}{{"user_id": owner.ID, "amount": 10}, {"user_id": partner.ID, "amount": 10}}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Only members share expenses
+	w = request(partner, "POST", "/api/expenses", map[string]interface{}{
+		"amount": 30, "description": "Taxi", "date": "2024-01-06",
+		"split": map[string]interface{}{"method": "equal", "shares": []map[string]interface{}{{"user_id": owner.ID}, {"user_id": 999}}},
+	})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// The partner pays 30, the owner's share is 25 percent
+	w = request(partner, "POST", "/api/expenses", map[string]interface{}{
+		"amount": 30, "description": "Taxi", "date": "2024-01-06",
+		"split": map[string]interface{}{"method": "percent", "shares": []map[string]interface{}{{"user_id": owner.ID, "percent": 25}, {"user_id": partner.ID, "percent": 75}}},
+	})
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var result struct {
+		Balances  []ledger.Balance  `json:"balances"`
+		Transfers []ledger.Transfer `json:"transfers"`
+	}
+	w = request(owner, "GET", "/api/ledger", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, []ledger.Transfer{{FromUserID: partner.ID, ToUserID: owner.ID, Amount: models.MustParseMoney("42.50")}}, result.Transfers)
+
+	// Doubling the dinner divides it again
+	w = request(owner, "PUT", fmt.Sprintf("/api/expenses/%d", dinner.ID), map[string]interface{}{"amount": 200})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = request(owner, "GET", "/api/ledger", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, models.MustParseMoney("92.50"), result.Transfers[0].Amount)
+
+	// A settlement pays the debt off
+	w = request(partner, "POST", "/api/settlements", map[string]interface{}{"to_user_id": owner.ID, "amount": 92.5, "date": "2024-01-10"})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var settlement models.Settlement
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &settlement))
+	assert.Equal(t, partner.ID, settlement.FromUserID)
+
+	w = request(owner, "GET", "/api/ledger", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Empty(t, result.Balances)
+	assert.Empty(t, result.Transfers)
+
+	// Removing the split of the dinner leaves the owner owing for the taxi
+	w = request(owner, "PUT", fmt.Sprintf("/api/expenses/%d", dinner.ID), map[string]interface{}{"split": map[string]interface{}{"shares": []interface{}{}}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = request(owner, "DELETE", fmt.Sprintf("/api/settlements/%d", settlement.ID), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = request(owner, "GET", "/api/ledger", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, []ledger.Transfer{{FromUserID: owner.ID, ToUserID: partner.ID, Amount: models.MustParseMoney("7.50")}}, result.Transfers)
+}
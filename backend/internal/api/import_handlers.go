@@ -0,0 +1,131 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/importer"
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/rules"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// maxImportSize limits the size of uploaded bank files.
+const maxImportSize = 10 << 20
+
+// PreviewImport parses an uploaded bank file and returns its outgoing
+// payments as candidates, flagging likely duplicates. Nothing is stored.
+//
+// The multipart form carries the "file", an optional "format" (csv, ofx,
+// qfx or camt053, detected if empty) and for CSV files the column "mapping"
+// as JSON.
+func (h *Handler) PreviewImport(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required"})
+		return
+	}
+
+	var mapping importer.CSVMapping
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping"})
+			return
+		}
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer file.Close()
+
+	transactions, format, err := importer.Parse(file, c.PostForm("format"), mapping)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	candidates, err := importer.Preview(h.db, c.GetUint("workspace_id"), transactions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check for duplicates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"format": format, "candidates": candidates})
+}
+
+// CommitImport stores the rows the user confirmed from a preview as expenses.
+// Either all rows are stored or, if any of them is invalid, none.
+func (h *Handler) CommitImport(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	workspaceID := c.GetUint("workspace_id")
+
+	var input struct {
+		Rows []struct {
+			Date        string       `json:"date" binding:"required"`
+			Amount      models.Money `json:"amount" binding:"required"`
+			Currency    string       `json:"currency" binding:"omitempty,len=3"`
+			Description string       `json:"description" binding:"required"`
+			ExternalID  string       `json:"external_id"`
+			BudgetID    *uint        `json:"budget_id"`
+			CategoryID  *uint        `json:"category_id"`
+			Tags        []string     `json:"tags"`
+		} `json:"rows" binding:"required,min=1,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	expenses := make([]models.Expense, len(input.Rows))
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		engine, err := rules.Load(tx, workspaceID)
+		if err != nil {
+			return err
+		}
+
+		for i, row := range input.Rows {
+			date, err := time.Parse("2006-01-02", row.Date)
+			if err != nil {
+				return &httpError{http.StatusBadRequest, fmt.Sprintf("Row %d: Invalid date format", i)}
+			}
+
+			expenses[i] = models.Expense{
+				UserID:      userID,
+				WorkspaceID: workspaceID,
+				BudgetID:    row.BudgetID,
+				CategoryID:  row.CategoryID,
+				Amount:      row.Amount,
+				Currency:    strings.ToUpper(row.Currency),
+				Description: row.Description,
+				Date:        date,
+				ExternalID:  row.ExternalID,
+			}
+			if err := createExpense(tx, &expenses[i], row.Tags, engine); err != nil {
+				var httpErr *httpError
+				if errors.As(err, &httpErr) {
+					return &httpError{httpErr.status, fmt.Sprintf("Row %d: %s", i, httpErr.message)}
+				}
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		respondError(c, err, "Failed to import expenses")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"imported": len(expenses), "expenses": expenses})
+}
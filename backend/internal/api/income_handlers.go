@@ -0,0 +1,135 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/currency"
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/reports"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// incomeInput is the body of requests recording or replacing income.
+type incomeInput struct {
+	Amount      models.Money `json:"amount" binding:"required,gt=0"`
+	Currency    string       `json:"currency" binding:"omitempty,len=3"` // Defaults to the workspace's base currency
+	Description string       `json:"description" binding:"required"`
+	Date        string       `json:"date" binding:"required"`
+}
+
+// GetIncome lists the income of the workspace, of a single month if the
+// "month" query parameter is given.
+func (h *Handler) GetIncome(c *gin.Context) {
+	query := h.db.Scopes(inWorkspace(c))
+	if month := c.Query("month"); month != "" {
+		start, end, err := reports.MonthRange(month, month)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month format"})
+			return
+		}
+		query = query.Where("date >= ? AND date < ?", start, end)
+	}
+
+	list := []models.Income{}
+	if err := query.Order("date DESC, id DESC").Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch income"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) CreateIncome(c *gin.Context) {
+	var input incomeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	income := models.Income{UserID: c.GetUint("user_id"), WorkspaceID: c.GetUint("workspace_id")}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := applyIncomeInput(tx, &income, input); err != nil {
+			return err
+		}
+		return tx.Create(&income).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create income")
+		return
+	}
+
+	c.JSON(http.StatusCreated, income)
+}
+
+func (h *Handler) UpdateIncome(c *gin.Context) {
+	var input incomeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var income models.Income
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(inWorkspace(c)).Where("id = ?", c.Param("id")).First(&income).Error; err != nil {
+			return &httpError{http.StatusNotFound, "Income not found"}
+		}
+		if err := applyIncomeInput(tx, &income, input); err != nil {
+			return err
+		}
+		return tx.Save(&income).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to update income")
+		return
+	}
+
+	c.JSON(http.StatusOK, income)
+}
+
+// DeleteIncome deletes income. Deleting an occurrence of a recurring income
+// doesn't create it again.
+func (h *Handler) DeleteIncome(c *gin.Context) {
+	var income models.Income
+	if err := h.db.Scopes(inWorkspace(c)).Where("id = ?", c.Param("id")).First(&income).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Income not found"})
+		return
+	}
+
+	if err := h.db.Delete(&income).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete income"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Income deleted successfully"})
+}
+
+// applyIncomeInput sets the fields of the income from the input and converts
+// it into the workspace's base currency.
+func applyIncomeInput(tx *gorm.DB, income *models.Income, input incomeInput) error {
+	date, err := time.Parse("2006-01-02", input.Date)
+	if err != nil {
+		return &httpError{http.StatusBadRequest, "Invalid date format"}
+	}
+	if input.Currency != "" {
+		if _, err := currency.Normalize(input.Currency); err != nil {
+			return &httpError{http.StatusBadRequest, err.Error()}
+		}
+	}
+
+	income.Amount = input.Amount
+	income.Currency = strings.ToUpper(input.Currency)
+	income.Description = input.Description
+	income.Date = date
+
+	err = currency.ApplyIncomeBaseAmount(tx, income)
+	var noRate *currency.NoRateError
+	if errors.As(err, &noRate) {
+		return &httpError{http.StatusBadRequest, "No exchange rate for " + noRate.Currency + " on " + noRate.Date.Format("2006-01-02")}
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"expense-tracker/internal/currency"
+	"expense-tracker/internal/ledger"
+	"expense-tracker/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetLedger returns the balances of the workspace's members and the
+// transfers that settle them. The transfers are simplified to as few as
+// possible unless simplify=false asks for the debts between each pair of
+// members.
+func (h *Handler) GetLedger(c *gin.Context) {
+	debts, err := ledger.Debts(h.db, c.GetUint("workspace_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to compute balances"})
+		return
+	}
+
+	balances := ledger.Balances(debts)
+	transfers := debts
+	if c.Query("simplify") != "false" {
+		transfers = ledger.Simplify(balances)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"balances": balances, "transfers": transfers})
+}
+
+// GetSettlements lists the workspace's settlements, the latest first.
+func (h *Handler) GetSettlements(c *gin.Context) {
+	settlements := []models.Settlement{}
+	if err := h.db.Scopes(inWorkspace(c)).Order("date DESC, id DESC").Find(&settlements).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch settlements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, settlements)
+}
+
+// CreateSettlement records a payment between two members of the workspace.
+func (h *Handler) CreateSettlement(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	var input struct {
+		FromUserID *uint        `json:"from_user_id"` // Defaults to the current user
+		ToUserID   uint         `json:"to_user_id" binding:"required"`
+		Amount     models.Money `json:"amount" binding:"required,gt=0"`
+		Currency   string       `json:"currency" binding:"omitempty,len=3"` // Defaults to the workspace's base currency
+		Date       string       `json:"date"`                               // Defaults to today
+		Note       string       `json:"note"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settlement := models.Settlement{
+		WorkspaceID: workspaceID,
+		FromUserID:  c.GetUint("user_id"),
+		ToUserID:    input.ToUserID,
+		Amount:      input.Amount,
+		Note:        input.Note,
+		CreatedByID: c.GetUint("user_id"),
+		Date:        time.Now().Truncate(24 * time.Hour),
+	}
+	if input.FromUserID != nil {
+		settlement.FromUserID = *input.FromUserID
+	}
+	if settlement.FromUserID == settlement.ToUserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A settlement needs two different users"})
+		return
+	}
+	if input.Date != "" {
+		date, err := time.Parse("2006-01-02", input.Date)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+			return
+		}
+		settlement.Date = date
+	}
+
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.WorkspaceMember{}).
+			Where("workspace_id = ? AND user_id IN ?", workspaceID, []uint{settlement.FromUserID, settlement.ToUserID}).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count != 2 {
+			return &httpError{http.StatusBadRequest, "Both users have to be members of the workspace"}
+		}
+
+		var workspace models.Workspace
+		if err := tx.Select("id", "base_currency").First(&workspace, workspaceID).Error; err != nil {
+			return err
+		}
+		settlement.Currency = workspace.BaseCurrency
+		if input.Currency != "" {
+			code, err := currency.Normalize(input.Currency)
+			if err != nil {
+				return &httpError{http.StatusBadRequest, err.Error()}
+			}
+			settlement.Currency = code
+		}
+
+		baseAmount, err := currency.Convert(tx, settlement.Amount, settlement.Currency, workspace.BaseCurrency, settlement.Date)
+		var noRate *currency.NoRateError
+		if errors.As(err, &noRate) {
+			return &httpError{http.StatusBadRequest, noRate.Error()}
+		}
+		if err != nil {
+			return err
+		}
+		settlement.BaseAmount = baseAmount
+		settlement.BaseCurrency = workspace.BaseCurrency
+
+		return tx.Create(&settlement).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create settlement")
+		return
+	}
+
+	c.JSON(http.StatusCreated, settlement)
+}
+
+// DeleteSettlement deletes a settlement of the workspace.
+func (h *Handler) DeleteSettlement(c *gin.Context) {
+	result := h.db.Scopes(inWorkspace(c)).Where("id = ?", c.Param("id")).Delete(&models.Settlement{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete settlement"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Settlement not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Settlement deleted successfully"})
+}
@@ -1,21 +1,155 @@
 package api
 
 import (
+	"errors"
 	"expense-tracker/internal/auth"
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/workspaces"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// AuthMiddleware accepts JWTs of a session and personal access tokens. The
+// scopes of personal access tokens are checked by RequireScope.
 func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID, err := auth.ValidateToken(c)
+		if token, err := auth.BearerToken(c); err == nil && strings.HasPrefix(token, auth.PersonalTokenPrefix) {
+			record, err := auth.ValidatePersonalToken(h.db, token)
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				c.Abort()
+				return
+			}
+			c.Set("user_id", record.UserID)
+			c.Set("token_scopes", []string(record.Scopes))
+			c.Next()
+			return
+		}
+
+		claims, err := auth.ValidateToken(h.db, c)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
-		c.Set("user_id", userID)
+		c.Set("user_id", claims.UserID)
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// WorkspaceMiddleware authorizes the request for the workspace named by the
+// X-Workspace-ID header, or the user's personal workspace without it. Reading
+// requires the viewer role, anything else the editor role. Workspaces the
+// user isn't a member of are reported as not found.
+func (h *Handler) WorkspaceMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var workspaceID uint64
+		if header := c.GetHeader("X-Workspace-ID"); header != "" {
+			var err error
+			if workspaceID, err = strconv.ParseUint(header, 10, 32); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+				c.Abort()
+				return
+			}
+		}
+
+		member, err := workspaces.Resolve(h.db, c.GetUint("user_id"), uint(workspaceID))
+		if errors.Is(err, workspaces.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve workspace"})
+			c.Abort()
+			return
+		}
+
+		required := models.RoleEditor
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			required = models.RoleViewer
+		}
+		if !workspaces.Allows(member.Role, required) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your role in the workspace doesn't allow this"})
+			c.Abort()
+			return
+		}
+
+		c.Set("workspace_id", member.WorkspaceID)
+		c.Set("workspace_role", member.Role)
+		c.Next()
+	}
+}
+
+// RequireRole only lets requests pass whose user has at least the role in the
+// workspace. It has to run after WorkspaceMiddleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !workspaces.Allows(c.GetString("workspace_role"), role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Your role in the workspace doesn't allow this"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope checks the scopes of personal access tokens for the resource,
+// reading for GET and HEAD requests and writing for any other. Sessions of a
+// login aren't limited by scopes.
+func RequireScope(resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, ok := c.Get("token_scopes")
+		if !ok {
+			c.Next()
+			return
+		}
+		write := c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead
+		if !auth.AllowsScope(scopes.([]string), resource, write) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "The token's scopes don't allow this"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireAdmin only lets verified accounts of the configured admin addresses
+// pass, for changes that affect all workspaces.
+func (h *Handler) RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var user models.User
+		if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil || user.ActivatedAt == nil || !h.isAdmin(user.Email) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can do this"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func (h *Handler) isAdmin(email string) bool {
+	for _, admin := range h.cfg.AdminEmails {
+		if strings.EqualFold(admin, email) {
+			return true
+		}
+	}
+	return false
+}
+
+// RequireSession only lets requests of a login pass, personal access tokens
+// can't manage the account.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("claims"); !ok {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Personal access tokens can't be used for this"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"expense-tracker/internal/auth"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) GetOIDCProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": h.oidc.Providers()})
+}
+
+// oidcLoginCookie keeps the state and nonce of a login at a provider, so
+// only the browser that started the login can finish it.
+const oidcLoginCookie = "oidc_login"
+
+// OIDCLogin returns the URL of the provider the frontend sends the user to.
+func (h *Handler) OIDCLogin(c *gin.Context) {
+	login, err := h.oidc.AuthCodeURL(c.Request.Context(), h.db, c.Param("provider"))
+	if errors.Is(err, auth.ErrUnknownProvider) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to start login at %s: %v", c.Param("provider"), err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider unavailable"})
+		return
+	}
+
+	h.setOIDCCookie(c, login.State+"."+login.Nonce, int(auth.OIDCStateTTL.Seconds()))
+	c.JSON(http.StatusOK, gin.H{"url": login.URL})
+}
+
+// OIDCCallback finishes the login with the code and state the provider
+// redirected back with, and starts a session like a password login,
+// including its second step for accounts with two-factor authentication.
+func (h *Handler) OIDCCallback(c *gin.Context) {
+	var input struct {
+		Code  string `json:"code" binding:"required"`
+		State string `json:"state" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The state is used up either way, so is the cookie
+	cookie, _ := c.Cookie(oidcLoginCookie)
+	h.setOIDCCookie(c, "", -1)
+	state, nonce, _ := strings.Cut(cookie, ".")
+	if subtle.ConstantTimeCompare([]byte(state), []byte(input.State)) != 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": auth.ErrInvalidOIDCState.Error()})
+		return
+	}
+
+	identity, err := h.oidc.Exchange(c.Request.Context(), h.db, c.Param("provider"), input.Code, input.State, nonce)
+	switch {
+	case errors.Is(err, auth.ErrUnknownProvider):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider not found"})
+		return
+	case errors.Is(err, auth.ErrInvalidOIDCState):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.Printf("Failed to finish login at %s: %v", c.Param("provider"), err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login at identity provider failed"})
+		return
+	}
+
+	user, err := auth.LinkIdentity(h.db, identity)
+	if errors.Is(err, auth.ErrEmailNotVerified) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to link account"})
+		return
+	}
+
+	// The provider replaces the password, not the second factor
+	h.completeFirstFactor(c, user)
+}
+
+// setOIDCCookie sets the login cookie for the provider's login and callback
+// routes, a negative maxAge deletes it. It is only sent over HTTPS when the
+// frontend is served over HTTPS.
+func (h *Handler) setOIDCCookie(c *gin.Context, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcLoginCookie,
+		Value:    value,
+		Path:     "/auth/oidc/" + c.Param("provider"),
+		MaxAge:   maxAge,
+		Secure:   strings.HasPrefix(h.cfg.AppURL, "https://"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
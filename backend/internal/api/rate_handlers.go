@@ -0,0 +1,129 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"expense-tracker/internal/currency"
+	"expense-tracker/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) GetRates(c *gin.Context) {
+	var rates []models.ExchangeRate
+
+	query := h.db.Order("date DESC, currency")
+	if code := c.Query("currency"); code != "" {
+		normalized, err := currency.Normalize(code)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		query = query.Where("currency = ?", normalized)
+	}
+	if from := c.Query("from"); from != "" {
+		date, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+			return
+		}
+		query = query.Where("date >= ?", date)
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+			return
+		}
+		query = query.Where("date <= ?", date)
+	}
+
+	if err := query.Find(&rates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch exchange rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
+
+func (h *Handler) CreateRate(c *gin.Context) {
+	var input struct {
+		Currency string  `json:"currency" binding:"required,len=3"`
+		Date     string  `json:"date" binding:"required"`
+		Rate     float64 `json:"rate" binding:"required,gt=0"` // Units of currency per 1 EUR
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	code, err := currency.Normalize(input.Currency)
+	if err != nil || code == models.ReferenceCurrency {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid currency"})
+		return
+	}
+
+	date, err := time.Parse("2006-01-02", input.Date)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date format"})
+		return
+	}
+
+	rate := models.ExchangeRate{Currency: code, Date: date, Rate: input.Rate}
+	if err := currency.Store(h.db, []models.ExchangeRate{rate}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store exchange rate"})
+		return
+	}
+
+	if err := h.db.Where("currency = ? AND date = ?", code, date).First(&rate).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load exchange rate"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rate)
+}
+
+// ImportRates stores the rates of an ECB XML or CSV file, sent either as the
+// "file" field of a multipart form or as the raw request body.
+func (h *Handler) ImportRates(c *gin.Context) {
+	body := c.Request.Body
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	rates, err := currency.ParseECB(body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := currency.Store(h.db, rates); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store exchange rates"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"imported": len(rates)})
+}
+
+func (h *Handler) DeleteRate(c *gin.Context) {
+	result := h.db.Delete(&models.ExchangeRate{}, c.Param("id"))
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete exchange rate"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Exchange rate not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Exchange rate deleted successfully"})
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/auth"
+	"expense-tracker/internal/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits of the unauthenticated auth routes. Each attempt costs a bcrypt
+// hash or sends an email, so they are limited per client IP and, where the
+// request names one, per account.
+var (
+	loginIPLimit      = ratelimit.Limit{Burst: 10, Every: 6 * time.Second}
+	loginAccountLimit = ratelimit.Limit{Burst: 5, Every: time.Minute}
+	mfaAccountLimit   = ratelimit.Limit{Burst: 5, Every: time.Minute}
+	signupIPLimit     = ratelimit.Limit{Burst: 5, Every: 12 * time.Minute}
+	emailIPLimit      = ratelimit.Limit{Burst: 5, Every: 2 * time.Minute}
+	emailAccountLimit = ratelimit.Limit{Burst: 3, Every: 10 * time.Minute}
+)
+
+// RateLimit takes a token from the bucket of the request's key and responds
+// with 429 and Retry-After once the bucket is empty. Requests without a key
+// aren't limited. If the store fails, requests are refused with 503 rather
+// than let through unlimited.
+func (h *Handler) RateLimit(name string, limit ratelimit.Limit, key func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		k := key(c)
+		if k == "" {
+			c.Next()
+			return
+		}
+
+		allowed, retryAfter, err := h.limiter.Take(c.Request.Context(), name+":"+k, limit)
+		if err != nil {
+			log.Printf("Failed to check rate limit %s: %v", name, err)
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Service unavailable, try again later"})
+			c.Abort()
+			return
+		}
+		if !allowed {
+			tooManyRequests(c, retryAfter)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// tooManyRequests responds with 429 and the seconds to wait as Retry-After.
+func tooManyRequests(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, try again later"})
+}
+
+// byIP keys rate limits by the client IP.
+func byIP(c *gin.Context) string {
+	return c.ClientIP()
+}
+
+// byMFAUser keys rate limits by the user of the mfa_token in the JSON body,
+// so the codes of an account can't be guessed from many IPs. The body is put
+// back for the handler.
+func byMFAUser(c *gin.Context) string {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var input struct {
+		MFAToken string `json:"mfa_token"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		return ""
+	}
+	if userID := auth.MFATokenUser(input.MFAToken); userID != 0 {
+		return strconv.FormatUint(uint64(userID), 10)
+	}
+	return ""
+}
+
+// byEmail keys rate limits by the email address in the JSON body. The body is
+// put back for the handler.
+func byEmail(c *gin.Context) string {
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, 1<<20))
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.Unmarshal(body, &input); err != nil {
+		return ""
+	}
+	return strings.ToLower(strings.TrimSpace(input.Email))
+}
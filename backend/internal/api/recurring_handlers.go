@@ -0,0 +1,252 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"expense-tracker/internal/currency"
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/recurring"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// recurringInput is the body of requests creating or replacing a recurring
+// expense. The schedule is given either through its fields or as an RRULE.
+// Recurring income, like a salary, has the type income.
+type recurringInput struct {
+	Type        string       `json:"type" binding:"omitempty,oneof=expense income"` // Defaults to expense, can't be changed
+	Description string       `json:"description" binding:"required"`
+	Amount      models.Money `json:"amount" binding:"required"`
+	Currency    string       `json:"currency" binding:"omitempty,len=3"` // Defaults to the workspace's base currency
+	BudgetName  string       `json:"budget_name"`
+	CategoryID  *uint        `json:"category_id"`
+	Frequency   string       `json:"frequency" binding:"omitempty,oneof=weekly monthly yearly"`
+	Interval    int          `json:"interval"`
+	DayOfMonth  int          `json:"day_of_month"`
+	Weekday     *int         `json:"weekday"`
+	Month       int          `json:"month"`
+	RRule       string       `json:"rrule"`
+	StartDate   string       `json:"start_date" binding:"required"`
+	EndDate     string       `json:"end_date"`
+}
+
+// GetRecurringExpenses lists the recurring expenses and income of the
+// workspace, or those of the type given in the "type" query parameter.
+func (h *Handler) GetRecurringExpenses(c *gin.Context) {
+	var list []models.RecurringExpense
+
+	query := h.db.Preload("Category").Scopes(inWorkspace(c))
+	if t := c.Query("type"); t != "" {
+		query = query.Where("type = ?", t)
+	}
+	if err := query.
+		Order("next_date, id").
+		Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch recurring expenses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// CreateRecurringExpense creates a recurring expense. Occurrences that are
+// already due are created right away.
+func (h *Handler) CreateRecurringExpense(c *gin.Context) {
+	var input recurringInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	r := models.RecurringExpense{UserID: c.GetUint("user_id"), WorkspaceID: c.GetUint("workspace_id")}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := applyRecurringInput(tx, &r, input); err != nil {
+			return err
+		}
+		return tx.Create(&r).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create recurring expense")
+		return
+	}
+
+	h.respondRecurring(c, http.StatusCreated, &r)
+}
+
+// UpdateRecurringExpense replaces all fields of a recurring expense.
+// Occurrences before its current next date are not created again. The row
+// is locked, so a concurrent run of the scheduler can't have its next date
+// overwritten.
+func (h *Handler) UpdateRecurringExpense(c *gin.Context) {
+	var input recurringInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var r models.RecurringExpense
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := h.findRecurring(tx.Clauses(clause.Locking{Strength: "UPDATE"}), c, &r); err != nil {
+			return err
+		}
+
+		next := r.NextDate
+		if err := applyRecurringInput(tx, &r, input); err != nil {
+			return err
+		}
+		if r.NextDate.Before(next) {
+			r.NextDate = recurring.NextOnOrAfter(&r, next)
+		}
+		return tx.Save(&r).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to update recurring expense")
+		return
+	}
+
+	h.respondRecurring(c, http.StatusOK, &r)
+}
+
+// DeleteRecurringExpense deletes a recurring expense. Expenses created from
+// it are kept.
+func (h *Handler) DeleteRecurringExpense(c *gin.Context) {
+	var r models.RecurringExpense
+	if err := h.findRecurring(h.db, c, &r); err != nil {
+		respondError(c, err, "Failed to delete recurring expense")
+		return
+	}
+
+	if err := h.db.Delete(&r).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete recurring expense"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recurring expense deleted successfully"})
+}
+
+// SkipRecurringExpense skips the next occurrence of a recurring expense.
+func (h *Handler) SkipRecurringExpense(c *gin.Context) {
+	h.changeRecurring(c, recurring.Skip)
+}
+
+// PauseRecurringExpense stops a recurring expense from creating expenses
+// until it is resumed.
+func (h *Handler) PauseRecurringExpense(c *gin.Context) {
+	h.changeRecurring(c, func(r *models.RecurringExpense) {
+		r.Paused = true
+	})
+}
+
+// ResumeRecurringExpense resumes a paused recurring expense. Occurrences
+// that fell into the pause are not created.
+func (h *Handler) ResumeRecurringExpense(c *gin.Context) {
+	h.changeRecurring(c, recurring.Resume)
+}
+
+// changeRecurring applies change to the recurring expense of the request
+// under a row lock.
+func (h *Handler) changeRecurring(c *gin.Context, change func(r *models.RecurringExpense)) {
+	var r models.RecurringExpense
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := h.findRecurring(tx.Clauses(clause.Locking{Strength: "UPDATE"}), c, &r); err != nil {
+			return err
+		}
+
+		change(&r)
+		return tx.Save(&r).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to update recurring expense")
+		return
+	}
+
+	h.respondRecurring(c, http.StatusOK, &r)
+}
+
+func (h *Handler) findRecurring(tx *gorm.DB, c *gin.Context, r *models.RecurringExpense) error {
+	if err := tx.Scopes(inWorkspace(c)).Where("id = ?", c.Param("id")).First(r).Error; err != nil {
+		return &httpError{http.StatusNotFound, "Recurring expense not found"}
+	}
+	return nil
+}
+
+// respondRecurring creates the occurrences of the recurring expense that
+// are due and responds with its current state. Occurrences that can't be
+// created yet, e.g. for a missing exchange rate, are left to the scheduler.
+func (h *Handler) respondRecurring(c *gin.Context, status int, r *models.RecurringExpense) {
+	if _, err := recurring.Materialize(h.db, r.ID, recurring.Today()); err != nil {
+		log.Printf("Failed to materialize recurring expense %d: %v", r.ID, err)
+	}
+
+	if err := h.db.Preload("Category").First(r, r.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load recurring expense"})
+		return
+	}
+
+	c.JSON(status, r)
+}
+
+// applyRecurringInput sets the fields of the recurring expense from the input
+// and validates them. Stored ones keep their type.
+func applyRecurringInput(tx *gorm.DB, r *models.RecurringExpense, input recurringInput) error {
+	switch {
+	case r.ID != 0 && input.Type != "" && input.Type != r.Type:
+		return &httpError{http.StatusBadRequest, "The type of a recurring expense can't be changed"}
+	case r.ID == 0 && input.Type != "":
+		r.Type = input.Type
+	case r.ID == 0:
+		r.Type = models.TypeExpense
+	}
+	if r.Type == models.TypeIncome && (input.BudgetName != "" || input.CategoryID != nil) {
+		return &httpError{http.StatusBadRequest, "Recurring income has no budget or category"}
+	}
+	r.Description = input.Description
+	r.Amount = input.Amount
+	r.BudgetName = input.BudgetName
+	r.CategoryID = input.CategoryID
+	r.Frequency = input.Frequency
+	r.Interval = input.Interval
+	r.DayOfMonth = input.DayOfMonth
+	r.Weekday = input.Weekday
+	r.Month = input.Month
+	r.EndDate = nil
+
+	var err error
+	if r.StartDate, err = time.Parse("2006-01-02", input.StartDate); err != nil {
+		return &httpError{http.StatusBadRequest, "Invalid start date format"}
+	}
+	if input.EndDate != "" {
+		end, err := time.Parse("2006-01-02", input.EndDate)
+		if err != nil {
+			return &httpError{http.StatusBadRequest, "Invalid end date format"}
+		}
+		r.EndDate = &end
+	}
+
+	if input.RRule != "" {
+		if err := recurring.ApplyRRule(r, input.RRule); err != nil {
+			return &httpError{http.StatusBadRequest, err.Error()}
+		}
+	}
+	if err := recurring.Normalize(r); err != nil {
+		return &httpError{http.StatusBadRequest, err.Error()}
+	}
+
+	if input.Currency != "" {
+		if r.Currency, err = currency.Normalize(input.Currency); err != nil {
+			return &httpError{http.StatusBadRequest, err.Error()}
+		}
+	} else {
+		var workspace models.Workspace
+		if err := tx.Select("id", "base_currency").First(&workspace, r.WorkspaceID).Error; err != nil {
+			return err
+		}
+		r.Currency = workspace.BaseCurrency
+	}
+
+	return checkCategory(tx, &models.Expense{WorkspaceID: r.WorkspaceID, CategoryID: r.CategoryID})
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"expense-tracker/internal/budgets"
+	"expense-tracker/internal/reports"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportMonths reads the from and to months of a report, defaulting to the
+// last twelve months. It responds with a bad request and returns false if
+// they are invalid.
+func reportMonths(c *gin.Context) (string, string, bool) {
+	to := c.DefaultQuery("to", budgets.CurrentMonth())
+	toMonth, err := time.Parse("2006-01", to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month format"})
+		return "", "", false
+	}
+	from := c.DefaultQuery("from", toMonth.AddDate(0, -11, 0).Format("2006-01"))
+
+	if _, _, err := reports.MonthRange(from, to); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", "", false
+	}
+	return from, to, true
+}
+
+// reportMonth reads the month of a report, defaulting to the current month.
+func reportMonth(c *gin.Context) (string, bool) {
+	month := c.DefaultQuery("month", budgets.CurrentMonth())
+	if _, err := time.Parse("2006-01", month); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid month format"})
+		return "", false
+	}
+	return month, true
+}
+
+// intQuery reads a positive integer query parameter between 1 and max.
+func intQuery(c *gin.Context, key string, defaultValue, max int) (int, bool) {
+	value, err := strconv.Atoi(c.DefaultQuery(key, strconv.Itoa(defaultValue)))
+	if err != nil || value < 1 || value > max {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + key + ", expected a number between 1 and " + strconv.Itoa(max)})
+		return 0, false
+	}
+	return value, true
+}
+
+// GetSpendByBudget reports the amount spent per budget and month.
+func (h *Handler) GetSpendByBudget(c *gin.Context) {
+	from, to, ok := reportMonths(c)
+	if !ok {
+		return
+	}
+
+	result, err := reports.SpendByBudget(h.db, c.GetUint("workspace_id"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetTrend reports the amount spent in each of the last months and its change
+// month over month.
+func (h *Handler) GetTrend(c *gin.Context) {
+	month, ok := reportMonth(c)
+	if !ok {
+		return
+	}
+	count, ok := intQuery(c, "months", 12, 120)
+	if !ok {
+		return
+	}
+
+	result, err := reports.Trend(h.db, c.GetUint("workspace_id"), month, count)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetBudgetVsActual reports the variance between the budgets of a month and
+// the expenses booked against them.
+func (h *Handler) GetBudgetVsActual(c *gin.Context) {
+	month, ok := reportMonth(c)
+	if !ok {
+		return
+	}
+
+	result, err := reports.BudgetVsActual(h.db, c.GetUint("workspace_id"), month)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetTopDescriptions reports the descriptions, e.g. merchants, the most was
+// spent on.
+func (h *Handler) GetTopDescriptions(c *gin.Context) {
+	from, to, ok := reportMonths(c)
+	if !ok {
+		return
+	}
+	limit, ok := intQuery(c, "limit", 10, 100)
+	if !ok {
+		return
+	}
+
+	result, err := reports.TopDescriptions(h.db, c.GetUint("workspace_id"), from, to, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetBurnRate reports the daily spending of a month and the projected total
+// by its end.
+func (h *Handler) GetBurnRate(c *gin.Context) {
+	month, ok := reportMonth(c)
+	if !ok {
+		return
+	}
+
+	result, err := reports.GetBurnRate(h.db, c.GetUint("workspace_id"), month, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetCashFlow reports the income, expenses and savings rate of each month.
+func (h *Handler) GetCashFlow(c *gin.Context) {
+	from, to, ok := reportMonths(c)
+	if !ok {
+		return
+	}
+
+	result, err := reports.GetCashFlow(h.db, c.GetUint("workspace_id"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
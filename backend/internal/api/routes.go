@@ -1,32 +1,224 @@
 package api
 
 import (
+	"expense-tracker/internal/config"
+	"expense-tracker/internal/mail"
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/storage"
+
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 )
 
-func SetupRoutes(router *gin.Engine, db *gorm.DB) {
-	handler := NewHandler(db)
+func SetupRoutes(router *gin.Engine, db *gorm.DB, cfg config.Config, mailer mail.Mailer, store storage.Store) error {
+	handler, err := NewHandler(db, cfg, mailer, store)
+	if err != nil {
+		return err
+	}
 
 	// Auth routes (no middleware)
-	router.POST("/auth/login", handler.Login)
-	router.POST("/auth/signup", handler.SignUp)
+	router.POST("/auth/login", handler.RateLimit("login-ip", loginIPLimit, byIP),
+		handler.RateLimit("login-account", loginAccountLimit, byEmail), handler.Login)
+	router.POST("/auth/login/mfa", handler.RateLimit("login-ip", loginIPLimit, byIP),
+		handler.RateLimit("mfa-account", mfaAccountLimit, byMFAUser), handler.LoginMFA)
+	router.POST("/auth/signup", handler.RateLimit("signup-ip", signupIPLimit, byIP), handler.SignUp)
+	router.POST("/auth/refresh", handler.Refresh)
+	router.POST("/auth/verify", handler.VerifyEmail)
+	router.POST("/auth/verify/resend", handler.RateLimit("email-ip", emailIPLimit, byIP),
+		handler.RateLimit("email-account", emailAccountLimit, byEmail), handler.ResendVerification)
+	router.POST("/auth/forgot", handler.RateLimit("email-ip", emailIPLimit, byIP),
+		handler.RateLimit("email-account", emailAccountLimit, byEmail), handler.ForgotPassword)
+	router.POST("/auth/reset", handler.RateLimit("login-ip", loginIPLimit, byIP), handler.ResetPassword)
 	router.GET("/auth/validate", handler.AuthMiddleware(), handler.ValidateToken)
+	router.POST("/auth/logout", handler.AuthMiddleware(), RequireSession(), handler.Logout)
+	router.POST("/auth/logout-all", handler.AuthMiddleware(), RequireSession(), handler.LogoutAll)
+
+	// Public keys that verify the tokens, for other services
+	router.GET("/.well-known/jwks.json", handler.GetJWKS)
+
+	// Downloads of attachments, authorized by the signed token of their URL
+	router.GET("/api/attachments/:id/download", handler.DownloadAttachment)
+
+	// Single sign-on through OpenID Connect providers
+	router.GET("/auth/oidc/providers", handler.GetOIDCProviders)
+	router.GET("/auth/oidc/:provider/login", handler.OIDCLogin)
+	router.POST("/auth/oidc/:provider/callback", handler.OIDCCallback)
+
+	// Two-factor authentication routes
+	totp := router.Group("/auth/totp")
+	totp.Use(handler.AuthMiddleware(), RequireSession())
+	{
+		totp.POST("/setup", handler.SetupTOTP)
+		totp.POST("/enable", handler.EnableTOTP)
+		totp.POST("/disable", handler.DisableTOTP)
+		totp.POST("/recovery-codes", handler.RegenerateRecoveryCodes)
+	}
+
+	// Personal access token routes, tokens can't create further tokens
+	tokens := router.Group("/auth/tokens")
+	tokens.Use(handler.AuthMiddleware(), RequireSession())
+	{
+		tokens.GET("", handler.GetPersonalTokens)
+		tokens.POST("", handler.CreatePersonalToken)
+		tokens.DELETE("", handler.RevokePersonalTokens)
+		tokens.DELETE("/:id", handler.DeletePersonalToken)
+	}
 
-	// Protected routes
+	// Protected routes, personal access tokens need the scope of each group
 	api := router.Group("/api")
 	api.Use(handler.AuthMiddleware())
+
+	// Workspace routes that don't act on a single workspace
+	memberships := api.Group("", RequireScope("workspaces"))
 	{
-		// Budget routes
-		api.GET("/budgets", handler.GetBudgets)
-		api.POST("/budgets", handler.CreateBudget)
-		api.PUT("/budgets/:id", handler.UpdateBudget)
-		api.DELETE("/budgets/:id", handler.DeleteBudget)
+		memberships.GET("/workspaces", handler.GetWorkspaces)
+		memberships.POST("/workspaces", handler.CreateWorkspace)
+		memberships.POST("/workspaces/:id/leave", handler.LeaveWorkspace)
+		memberships.GET("/invitations", handler.GetInvitations)
+		memberships.POST("/invitations/:id/accept", handler.AcceptInvitation)
+		memberships.POST("/invitations/:id/decline", handler.DeclineInvitation)
+	}
 
-		// Expense routes
-		api.GET("/expenses", handler.GetExpenses)
-		api.POST("/expenses", handler.CreateExpense)
-		api.PUT("/expenses/:id", handler.UpdateExpense)
-		api.DELETE("/expenses/:id", handler.DeleteExpense)
+	// Exchange rate routes, rates are shared by all workspaces so only
+	// administrators change them
+	rates := api.Group("/rates", RequireScope("rates"))
+	{
+		rates.GET("", handler.GetRates)
+		rates.POST("", handler.RequireAdmin(), handler.CreateRate)
+		rates.POST("/import", handler.RequireAdmin(), handler.ImportRates)
+		rates.DELETE("/:id", handler.RequireAdmin(), handler.DeleteRate)
 	}
+
+	// Routes acting on the workspace of the X-Workspace-ID header, the
+	// middleware authorizes them by the user's role
+	scoped := api.Group("")
+	scoped.Use(handler.WorkspaceMiddleware())
+
+	// Current workspace routes
+	workspace := scoped.Group("/workspace", RequireScope("workspaces"))
+	{
+		workspace.GET("", handler.GetWorkspace)
+		workspace.GET("/members", handler.GetMembers)
+	}
+
+	// Budget routes
+	budgets := scoped.Group("/budgets", RequireScope("budgets"))
+	{
+		budgets.GET("", handler.GetBudgets)
+		budgets.POST("", handler.CreateBudget)
+		budgets.PUT("/:id", handler.UpdateBudget)
+		budgets.DELETE("/:id", handler.DeleteBudget)
+		budgets.POST("/rollover", handler.RolloverBudgets)
+		budgets.POST("/reconcile", handler.ReconcileBudgets)
+		budgets.GET("/assignments", handler.GetAssignments)
+		budgets.PUT("/assignments", handler.AssignBudgets)
+	}
+
+	// Expense routes, including attachments, the ledger of split expenses,
+	// imports and exports
+	expenses := scoped.Group("", RequireScope("expenses"))
+	{
+		expenses.GET("/expenses", handler.GetExpenses)
+		expenses.POST("/expenses", handler.CreateExpense)
+		expenses.PUT("/expenses/:id", handler.UpdateExpense)
+		expenses.DELETE("/expenses/:id", handler.DeleteExpense)
+		expenses.GET("/search", handler.SearchExpenses)
+
+		expenses.GET("/expenses/:id/attachments", handler.GetAttachments)
+		expenses.POST("/expenses/:id/attachments", handler.UploadAttachment)
+		expenses.DELETE("/expenses/:id/attachments/:attachment_id", handler.DeleteAttachment)
+
+		expenses.GET("/ledger", handler.GetLedger)
+		expenses.GET("/settlements", handler.GetSettlements)
+		expenses.POST("/settlements", handler.CreateSettlement)
+		expenses.DELETE("/settlements/:id", handler.DeleteSettlement)
+
+		expenses.POST("/imports/preview", handler.PreviewImport)
+		expenses.POST("/imports/commit", handler.CommitImport)
+
+		expenses.GET("/export", handler.Export)
+	}
+
+	// Income routes
+	income := scoped.Group("/income", RequireScope("income"))
+	{
+		income.GET("", handler.GetIncome)
+		income.POST("", handler.CreateIncome)
+		income.PUT("/:id", handler.UpdateIncome)
+		income.DELETE("/:id", handler.DeleteIncome)
+	}
+
+	// Recurring expense and income routes
+	recurring := scoped.Group("/recurring", RequireScope("recurring"))
+	{
+		recurring.GET("", handler.GetRecurringExpenses)
+		recurring.POST("", handler.CreateRecurringExpense)
+		recurring.PUT("/:id", handler.UpdateRecurringExpense)
+		recurring.DELETE("/:id", handler.DeleteRecurringExpense)
+		recurring.POST("/:id/skip", handler.SkipRecurringExpense)
+		recurring.POST("/:id/pause", handler.PauseRecurringExpense)
+		recurring.POST("/:id/resume", handler.ResumeRecurringExpense)
+	}
+
+	// Rule routes
+	rules := scoped.Group("/rules", RequireScope("rules"))
+	{
+		rules.GET("", handler.GetRules)
+		rules.POST("", handler.CreateRule)
+		rules.PUT("/:id", handler.UpdateRule)
+		rules.DELETE("/:id", handler.DeleteRule)
+		rules.POST("/:id/dry-run", handler.DryRunRule)
+		rules.POST("/:id/apply", handler.ApplyRule)
+	}
+
+	// Category routes
+	categories := scoped.Group("/categories", RequireScope("categories"))
+	{
+		categories.GET("", handler.GetCategories)
+		categories.POST("", handler.CreateCategory)
+		categories.PUT("/:id", handler.UpdateCategory)
+		categories.DELETE("/:id", handler.DeleteCategory)
+	}
+
+	// Tag routes
+	tags := scoped.Group("/tags", RequireScope("tags"))
+	{
+		tags.GET("", handler.GetTags)
+		tags.POST("", handler.CreateTag)
+		tags.PUT("/:id", handler.UpdateTag)
+		tags.DELETE("/:id", handler.DeleteTag)
+	}
+
+	// Report routes
+	reports := scoped.Group("/reports", RequireScope("reports"))
+	{
+		reports.GET("/spend-by-budget", handler.GetSpendByBudget)
+		reports.GET("/trend", handler.GetTrend)
+		reports.GET("/budget-vs-actual", handler.GetBudgetVsActual)
+		reports.GET("/top-descriptions", handler.GetTopDescriptions)
+		reports.GET("/burn-rate", handler.GetBurnRate)
+		reports.GET("/cash-flow", handler.GetCashFlow)
+	}
+
+	// Settings routes
+	settings := scoped.Group("/settings", RequireScope("settings"))
+	{
+		settings.GET("", handler.GetSettings)
+		settings.PUT("", RequireRole(models.RoleOwner), handler.UpdateSettings)
+	}
+
+	// Routes only owners of the workspace may use
+	owner := workspace.Group("")
+	owner.Use(RequireRole(models.RoleOwner))
+	{
+		owner.PUT("", handler.UpdateWorkspace)
+		owner.DELETE("", handler.DeleteWorkspace)
+		owner.PUT("/members/:user_id", handler.UpdateMember)
+		owner.DELETE("/members/:user_id", handler.RemoveMember)
+		owner.GET("/invitations", handler.GetWorkspaceInvitations)
+		owner.POST("/invitations", handler.CreateInvitation)
+		owner.DELETE("/invitations/:id", handler.DeleteInvitation)
+	}
+
+	return nil
 }
@@ -0,0 +1,193 @@
+package api
+
+import (
+	"net/http"
+
+	"expense-tracker/internal/categories"
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/rules"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ruleInput is the body of requests creating or replacing a rule.
+type ruleInput struct {
+	Name               string        `json:"name" binding:"required"`
+	Priority           int           `json:"priority"`
+	Enabled            *bool         `json:"enabled"` // Defaults to true
+	DescriptionPattern string        `json:"description_pattern"`
+	MinAmount          *models.Money `json:"min_amount"`
+	MaxAmount          *models.Money `json:"max_amount"`
+	BudgetName         string        `json:"budget_name"`
+	CategoryID         *uint         `json:"category_id"`
+	Tags               []string      `json:"tags"`
+}
+
+func (h *Handler) GetRules(c *gin.Context) {
+	var list []models.Rule
+
+	if err := h.db.Preload("Tags").
+		Scopes(inWorkspace(c)).
+		Order("priority, id").
+		Find(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) CreateRule(c *gin.Context) {
+	var input ruleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := models.Rule{UserID: c.GetUint("user_id"), WorkspaceID: c.GetUint("workspace_id")}
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := applyRuleInput(tx, &rule, input); err != nil {
+			return err
+		}
+		return tx.Create(&rule).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to create rule")
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRule replaces all fields of a rule.
+func (h *Handler) UpdateRule(c *gin.Context) {
+	var input ruleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var rule models.Rule
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(inWorkspace(c)).Where("id = ?", c.Param("id")).First(&rule).Error; err != nil {
+			return &httpError{http.StatusNotFound, "Rule not found"}
+		}
+		if err := applyRuleInput(tx, &rule, input); err != nil {
+			return err
+		}
+		if err := tx.Omit("Tags").Save(&rule).Error; err != nil {
+			return err
+		}
+		return tx.Model(&rule).Association("Tags").Replace(rule.Tags)
+	})
+	if err != nil {
+		respondError(c, err, "Failed to update rule")
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) DeleteRule(c *gin.Context) {
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var rule models.Rule
+		if err := tx.Scopes(inWorkspace(c)).Where("id = ?", c.Param("id")).First(&rule).Error; err != nil {
+			return &httpError{http.StatusNotFound, "Rule not found"}
+		}
+
+		if err := tx.Model(&rule).Association("Tags").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(&rule).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to delete rule")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted successfully"})
+}
+
+// DryRunRule lists the changes applying the rule to the existing expenses
+// would make. With overwrite=true budgets and categories that are already set
+// are replaced as well.
+func (h *Handler) DryRunRule(c *gin.Context) {
+	var rule models.Rule
+	if err := h.db.Preload("Tags").
+		Scopes(inWorkspace(c)).
+		Where("id = ?", c.Param("id")).
+		First(&rule).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+
+	changes, err := rules.DryRun(h.db, rule, c.Query("overwrite") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to evaluate rule"})
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// ApplyRule applies the rule to the existing expenses and returns the changes
+// that were made, the same ones DryRunRule lists.
+func (h *Handler) ApplyRule(c *gin.Context) {
+	var changes []rules.Change
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		var rule models.Rule
+		if err := tx.Preload("Tags").
+			Scopes(inWorkspace(c)).
+			Where("id = ?", c.Param("id")).
+			First(&rule).Error; err != nil {
+			return &httpError{http.StatusNotFound, "Rule not found"}
+		}
+
+		var err error
+		changes, err = rules.ApplyToHistory(tx, rule, c.Query("overwrite") == "true")
+		return err
+	})
+	if err != nil {
+		respondError(c, err, "Failed to apply rule")
+		return
+	}
+
+	c.JSON(http.StatusOK, changes)
+}
+
+// applyRuleInput sets the fields of the rule from the input and validates
+// them.
+func applyRuleInput(tx *gorm.DB, rule *models.Rule, input ruleInput) error {
+	rule.Name = input.Name
+	rule.Priority = input.Priority
+	rule.Enabled = input.Enabled == nil || *input.Enabled
+	rule.DescriptionPattern = input.DescriptionPattern
+	rule.MinAmount = input.MinAmount
+	rule.MaxAmount = input.MaxAmount
+	rule.BudgetName = input.BudgetName
+	rule.CategoryID = input.CategoryID
+
+	if rule.CategoryID != nil {
+		var count int64
+		if err := tx.Model(&models.Category{}).
+			Where("id = ? AND workspace_id = ?", *rule.CategoryID, rule.WorkspaceID).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return &httpError{http.StatusBadRequest, "Category not found"}
+		}
+	}
+
+	tags, err := categories.ResolveTags(tx, rule.WorkspaceID, rule.UserID, input.Tags)
+	if err != nil {
+		return err
+	}
+	rule.Tags = tags
+
+	if _, err := rules.Compile(*rule); err != nil {
+		return &httpError{http.StatusBadRequest, err.Error()}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"expense-tracker/internal/search"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchExpenses finds expenses by the words of q in their description,
+// notes and budget name, the best matches first. The filters of the expense
+// listing, e.g. month and budget_id, narrow the search down.
+func (h *Handler) SearchExpenses(c *gin.Context) {
+	filter, ok := h.expenseFilter(c)
+	if !ok {
+		return
+	}
+	limit, ok := intQuery(c, "limit", 20, 100)
+	if !ok {
+		return
+	}
+
+	results, err := search.Expenses(h.db, c.GetUint("workspace_id"), c.Query("q"), filter, limit)
+	if errors.Is(err, search.ErrEmptyQuery) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search expenses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"expense-tracker/internal/budgets"
+	"expense-tracker/internal/currency"
+	"expense-tracker/internal/ledger"
+	"expense-tracker/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetSettings returns the settings of the current workspace.
+func (h *Handler) GetSettings(c *gin.Context) {
+	var workspace models.Workspace
+	if err := h.db.First(&workspace, c.GetUint("workspace_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"base_currency": workspace.BaseCurrency, "zero_based": workspace.ZeroBased})
+}
+
+// UpdateSettings changes the settings of the current workspace. Settings
+// missing from the request are kept.
+func (h *Handler) UpdateSettings(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	workspaceID := c.GetUint("workspace_id")
+
+	var input struct {
+		BaseCurrency string `json:"base_currency" binding:"omitempty,len=3"`
+		ZeroBased    *bool  `json:"zero_based"` // Budgets can only be assigned the income of their month
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var baseCurrency string
+	if input.BaseCurrency != "" {
+		var err error
+		if baseCurrency, err = currency.Normalize(input.BaseCurrency); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	var workspace models.Workspace
+	err := h.db.Transaction(func(tx *gorm.DB) error {
+		if input.ZeroBased != nil {
+			if err := tx.Model(&models.Workspace{}).Where("id = ?", workspaceID).Update("zero_based", *input.ZeroBased).Error; err != nil {
+				return err
+			}
+		}
+		if baseCurrency != "" {
+			if err := rebaseWorkspace(tx, userID, workspaceID, baseCurrency); err != nil {
+				return err
+			}
+		}
+		return tx.First(&workspace, workspaceID).Error
+	})
+	if err != nil {
+		respondError(c, err, "Failed to update settings")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"base_currency": workspace.BaseCurrency, "zero_based": workspace.ZeroBased})
+}
+
+// rebaseWorkspace changes the base currency of the workspace, converting all
+// expenses, income, settlements and budgets.
+func rebaseWorkspace(tx *gorm.DB, userID, workspaceID uint, baseCurrency string) error {
+	var previous models.Workspace
+	if err := tx.Select("id", "base_currency").First(&previous, workspaceID).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.Workspace{}).Where("id = ?", workspaceID).Update("base_currency", baseCurrency).Error; err != nil {
+		return err
+	}
+	// The personal workspace's currency is the user's preference
+	if err := tx.Model(&models.User{}).
+		Where("id = ? AND id IN (?)", userID, tx.Model(&models.Workspace{}).Select("personal_user_id").Where("id = ?", workspaceID)).
+		Update("base_currency", baseCurrency).Error; err != nil {
+		return err
+	}
+	// Expenses first, the ledger divides their converted amounts
+	err := currency.Rebase(tx, workspaceID)
+	if err == nil {
+		err = ledger.Rebase(tx, workspaceID)
+	}
+	if err == nil {
+		err = budgets.Rebase(tx, workspaceID, previous.BaseCurrency, baseCurrency)
+	}
+	if err != nil {
+		var noRate *currency.NoRateError
+		if errors.As(err, &noRate) {
+			return &httpError{http.StatusBadRequest, noRate.Error()}
+		}
+		return err
+	}
+	_, err = budgets.Reconcile(tx, workspaceID)
+	return err
+}
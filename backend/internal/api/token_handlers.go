@@ -0,0 +1,75 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"expense-tracker/internal/auth"
+	"expense-tracker/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func (h *Handler) GetPersonalTokens(c *gin.Context) {
+	var tokens []models.PersonalAccessToken
+	if err := h.db.Where("user_id = ?", c.GetUint("user_id")).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// CreatePersonalToken creates a token with the scopes. The token itself is
+// only part of this response.
+func (h *Handler) CreatePersonalToken(c *gin.Context) {
+	var input struct {
+		Name      string     `json:"name" binding:"required,max=100"`
+		Scopes    []string   `json:"scopes" binding:"required"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	token, record, err := auth.CreatePersonalToken(h.db, c.GetUint("user_id"), input.Name, input.Scopes, input.ExpiresAt)
+	if errors.Is(err, auth.ErrInvalidScope) || errors.Is(err, auth.ErrInvalidExpiry) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"token": token, "personal_access_token": record})
+}
+
+// DeletePersonalToken revokes a token, it stops working right away.
+func (h *Handler) DeletePersonalToken(c *gin.Context) {
+	result := h.db.Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).Delete(&models.PersonalAccessToken{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked successfully"})
+}
+
+// RevokePersonalTokens revokes all personal access tokens of the user.
+func (h *Handler) RevokePersonalTokens(c *gin.Context) {
+	revoked, err := auth.RevokePersonalTokens(h.db, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke tokens"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked": revoked})
+}
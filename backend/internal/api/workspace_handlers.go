@@ -0,0 +1,341 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"expense-tracker/internal/currency"
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/workspaces"
+
+	"github.com/gin-gonic/gin"
+)
+
+// workspaceMembership is a workspace along with the role of the user in it.
+type workspaceMembership struct {
+	models.Workspace
+	Role string `json:"role"`
+}
+
+// GetWorkspaces lists the workspaces the user is a member of, starting with
+// the personal one.
+func (h *Handler) GetWorkspaces(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	// Make sure the personal workspace shows up even before its first use
+	if _, err := workspaces.Personal(h.db, userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch workspaces"})
+		return
+	}
+
+	list := []workspaceMembership{}
+	if err := h.db.Model(&models.Workspace{}).
+		Select("workspaces.*, workspace_members.role").
+		Joins("JOIN workspace_members ON workspace_members.workspace_id = workspaces.id").
+		Where("workspace_members.user_id = ?", userID).
+		Order("workspaces.personal_user_id IS NULL, workspaces.name, workspaces.id").
+		Scan(&list).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch workspaces"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// CreateWorkspace creates a shared workspace with the user as its owner. The
+// base currency defaults to the user's.
+func (h *Handler) CreateWorkspace(c *gin.Context) {
+	var input struct {
+		Name         string `json:"name" binding:"required"`
+		BaseCurrency string `json:"base_currency" binding:"omitempty,len=3"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	baseCurrency := user.BaseCurrency
+	if input.BaseCurrency != "" {
+		var err error
+		if baseCurrency, err = currency.Normalize(input.BaseCurrency); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	workspace, err := workspaces.Create(h.db, user.ID, input.Name, baseCurrency)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create workspace"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, workspaceMembership{Workspace: *workspace, Role: models.RoleOwner})
+}
+
+// LeaveWorkspace removes the user from a workspace. The last owner can't
+// leave.
+func (h *Handler) LeaveWorkspace(c *gin.Context) {
+	workspaceID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	}
+
+	if err := workspaces.RemoveMember(h.db, uint(workspaceID), c.GetUint("user_id")); err != nil {
+		respondWorkspaceError(c, err, "Failed to leave workspace")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Left workspace successfully"})
+}
+
+// GetInvitations lists the open invitations addressed to the user.
+func (h *Handler) GetInvitations(c *gin.Context) {
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	invitations, err := workspaces.Pending(h.db, user.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// AcceptInvitation makes the user a member of the workspace the invitation
+// is for.
+func (h *Handler) AcceptInvitation(c *gin.Context) {
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	invitationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	member, err := workspaces.Accept(h.db, uint(invitationID), &user)
+	if errors.Is(err, workspaces.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+	if errors.Is(err, workspaces.ErrUnverified) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to accept invitation"})
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+// DeclineInvitation deletes an invitation addressed to the user.
+func (h *Handler) DeclineInvitation(c *gin.Context) {
+	var user models.User
+	if err := h.db.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	invitationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err == nil {
+		err = workspaces.Decline(h.db, uint(invitationID), &user)
+	}
+	if err != nil {
+		respondWorkspaceError(c, err, "Failed to decline invitation")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation declined successfully"})
+}
+
+// GetWorkspace returns the current workspace along with the user's role.
+func (h *Handler) GetWorkspace(c *gin.Context) {
+	var workspace models.Workspace
+	if err := h.db.First(&workspace, c.GetUint("workspace_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, workspaceMembership{Workspace: workspace, Role: c.GetString("workspace_role")})
+}
+
+// UpdateWorkspace renames the current workspace. The base currency is
+// changed through the settings, as it converts all expenses.
+func (h *Handler) UpdateWorkspace(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var workspace models.Workspace
+	if err := h.db.First(&workspace, c.GetUint("workspace_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	}
+
+	workspace.Name = input.Name
+	if err := h.db.Save(&workspace).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update workspace"})
+		return
+	}
+
+	c.JSON(http.StatusOK, workspaceMembership{Workspace: workspace, Role: c.GetString("workspace_role")})
+}
+
+// DeleteWorkspace deletes the current workspace. Personal workspaces can't
+// be deleted.
+func (h *Handler) DeleteWorkspace(c *gin.Context) {
+	var workspace models.Workspace
+	if err := h.db.First(&workspace, c.GetUint("workspace_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Workspace not found"})
+		return
+	}
+
+	if err := workspaces.Delete(h.db, &workspace); err != nil {
+		respondWorkspaceError(c, err, "Failed to delete workspace")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Workspace deleted successfully"})
+}
+
+// GetMembers lists the members of the current workspace.
+func (h *Handler) GetMembers(c *gin.Context) {
+	members := []models.WorkspaceMember{}
+	if err := h.db.Preload("User").
+		Scopes(inWorkspace(c)).
+		Order("created_at, user_id").
+		Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch members"})
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// UpdateMember changes the role of a member of the current workspace.
+func (h *Handler) UpdateMember(c *gin.Context) {
+	var input struct {
+		Role string `json:"role" binding:"required,oneof=owner editor viewer"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err == nil {
+		err = workspaces.SetRole(h.db, c.GetUint("workspace_id"), uint(userID), input.Role)
+	}
+	if err != nil {
+		respondWorkspaceError(c, err, "Failed to update member")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"workspace_id": c.GetUint("workspace_id"), "user_id": userID, "role": input.Role})
+}
+
+// RemoveMember removes a member from the current workspace.
+func (h *Handler) RemoveMember(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err == nil {
+		err = workspaces.RemoveMember(h.db, c.GetUint("workspace_id"), uint(userID))
+	}
+	if err != nil {
+		respondWorkspaceError(c, err, "Failed to remove member")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+// GetWorkspaceInvitations lists the open invitations of the current
+// workspace.
+func (h *Handler) GetWorkspaceInvitations(c *gin.Context) {
+	invitations := []models.WorkspaceInvitation{}
+	if err := h.db.Scopes(inWorkspace(c)).
+		Order("created_at").
+		Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, invitations)
+}
+
+// CreateInvitation invites a user by email address to the current workspace.
+// The invited user accepts once signed up with that address.
+func (h *Handler) CreateInvitation(c *gin.Context) {
+	var input struct {
+		Email string `json:"email" binding:"required,email"`
+		Role  string `json:"role" binding:"required,oneof=owner editor viewer"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := workspaces.Invite(h.db, c.GetUint("workspace_id"), c.GetUint("user_id"), input.Email, input.Role)
+	if err != nil {
+		respondWorkspaceError(c, err, "Failed to create invitation")
+		return
+	}
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+// DeleteInvitation withdraws an invitation to the current workspace.
+func (h *Handler) DeleteInvitation(c *gin.Context) {
+	result := h.db.Scopes(inWorkspace(c)).Where("id = ?", c.Param("id")).Delete(&models.WorkspaceInvitation{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete invitation"})
+		return
+	}
+
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation deleted successfully"})
+}
+
+func respondWorkspaceError(c *gin.Context, err error, fallback string) {
+	var numErr *strconv.NumError
+	switch {
+	case errors.Is(err, workspaces.ErrNotFound), errors.As(err, &numErr):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Not found"})
+	case errors.Is(err, workspaces.ErrLastOwner), errors.Is(err, workspaces.ErrPersonal):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, workspaces.ErrMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, workspaces.ErrUnverified):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,201 @@
+package attachments
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// maxFileNameLength limits the stored file names, in bytes.
+const maxFileNameLength = 255
+
+var (
+	ErrEmpty           = errors.New("file is empty")
+	ErrUnsupportedType = errors.New("only JPEG, PNG, GIF and WebP images and PDF documents can be attached")
+)
+
+// ContentTypes are the types of files that can be attached.
+var ContentTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp", "application/pdf"}
+
+// DetectType returns the content type of the file, sniffed from its content
+// rather than trusting the name or the type the client sent.
+func DetectType(data []byte) (string, error) {
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+	for _, allowed := range ContentTypes {
+		if contentType == allowed {
+			return contentType, nil
+		}
+	}
+	return "", ErrUnsupportedType
+}
+
+// Add attaches the file to the expense. A file the expense already has isn't
+// attached twice, the existing attachment is returned with created false.
+// Files that other attachments share are not stored again.
+func Add(ctx context.Context, db *gorm.DB, store storage.Store, expense *models.Expense, userID uint, fileName string, data []byte) (*models.Attachment, bool, error) {
+	if len(data) == 0 {
+		return nil, false, ErrEmpty
+	}
+	contentType, err := DetectType(data)
+	if err != nil {
+		return nil, false, err
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	var attachment *models.Attachment
+	created := false
+	err = withFileLock(db, hash, func(tx *gorm.DB) error {
+		var existing models.Attachment
+		err := tx.Where("expense_id = ? AND sha256 = ?", expense.ID, hash).First(&existing).Error
+		if err == nil {
+			attachment = &existing
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		attachment, err = create(ctx, tx, store, expense, userID, fileName, contentType, hash, data)
+		created = err == nil
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return attachment, created, nil
+}
+
+// create stores the file unless other attachments share it and attaches it
+// to the expense.
+func create(ctx context.Context, tx *gorm.DB, store storage.Store, expense *models.Expense, userID uint, fileName, contentType, hash string, data []byte) (*models.Attachment, error) {
+	attachment := &models.Attachment{
+		ExpenseID:   expense.ID,
+		WorkspaceID: expense.WorkspaceID,
+		UserID:      userID,
+		FileName:    cleanFileName(fileName),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		SHA256:      hash,
+	}
+
+	var shared models.Attachment
+	err := tx.Where("sha256 = ?", hash).First(&shared).Error
+	switch {
+	case err == nil:
+		attachment.StorageKey, attachment.ThumbnailKey = shared.StorageKey, shared.ThumbnailKey
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		attachment.StorageKey = objectKey(hash)
+		if err := store.Put(ctx, attachment.StorageKey, data, contentType); err != nil {
+			return nil, err
+		}
+		if thumbnail, err := Thumbnail(data); err == nil {
+			key := attachment.StorageKey + ".thumb.jpg"
+			if err := store.Put(ctx, key, thumbnail, "image/jpeg"); err != nil {
+				return nil, err
+			}
+			attachment.ThumbnailKey = key
+		}
+	default:
+		return nil, err
+	}
+
+	if err := tx.Create(attachment).Error; err != nil {
+		return nil, err
+	}
+	return attachment, nil
+}
+
+// Purge deletes the stored files of deleted attachments unless remaining
+// attachments share them.
+func Purge(ctx context.Context, db *gorm.DB, store storage.Store, deleted []models.Attachment) error {
+	var errs []error
+	purged := make(map[string]bool)
+	for _, attachment := range deleted {
+		if purged[attachment.SHA256] {
+			continue
+		}
+		purged[attachment.SHA256] = true
+
+		err := withFileLock(db, attachment.SHA256, func(tx *gorm.DB) error {
+			var remaining int64
+			if err := tx.Model(&models.Attachment{}).Where("sha256 = ?", attachment.SHA256).Count(&remaining).Error; err != nil {
+				return err
+			}
+			if remaining > 0 {
+				return nil
+			}
+			var errs []error
+			for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+				if key == "" {
+					continue
+				}
+				if err := store.Delete(ctx, key); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			return errors.Join(errs...)
+		})
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// fileLocks serializes the changes to files on SQLite, which only a single
+// server uses.
+var fileLocks sync.Mutex
+
+// withFileLock runs fn in a transaction that holds a lock on the stored file
+// of the hash, so a file can't be deleted while an attachment is added that
+// shares it. PostgreSQL takes an advisory lock that is released with the
+// transaction.
+func withFileLock(db *gorm.DB, hash string, fn func(tx *gorm.DB) error) error {
+	if db.Dialector.Name() != "postgres" {
+		fileLocks.Lock()
+		defer fileLocks.Unlock()
+		return db.Transaction(fn)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "attachment:"+hash).Error; err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// objectKey is the storage key of a file, spread over directories by the
+// first byte of its hash.
+func objectKey(hash string) string {
+	return "attachments/" + hash[:2] + "/" + hash
+}
+
+// cleanFileName drops the directories some browsers send along with the
+// file name and shortens long names.
+func cleanFileName(name string) string {
+	name = strings.TrimSpace(path.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "." || name == "/" {
+		name = ""
+	}
+	for len(name) > maxFileNameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || !utf8.ValidString(name) {
+		return "attachment"
+	}
+	return name
+}
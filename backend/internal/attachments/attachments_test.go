@@ -0,0 +1,210 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Expense{}, &models.Attachment{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+// testPNG returns a PNG of the size, left half red, right half transparent.
+func testPNG(t *testing.T, width, height int) []byte {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width/2; x++ {
+			img.Set(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestDetectType(t *testing.T) {
+	contentType, err := DetectType([]byte("%PDF-1.7\n..."))
+	assert.NoError(t, err)
+	assert.Equal(t, "application/pdf", contentType)
+
+	contentType, err = DetectType(testPNG(t, 2, 2))
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", contentType)
+
+	// The content counts, not the name
+	_, err = DetectType([]byte("<html><script>alert(1)</script></html>"))
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+	_, err = DetectType([]byte("MZ\x90\x00"))
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+}
+
+func TestThumbnail(t *testing.T) {
+	data, err := Thumbnail(testPNG(t, 1000, 500))
+	assert.NoError(t, err)
+	thumbnail, err := jpeg.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, ThumbnailSize, ThumbnailSize/2), thumbnail.Bounds())
+
+	// Transparent areas turn white
+	r, g, b, _ := thumbnail.At(10, 10).RGBA()
+	assert.Greater(t, r>>8, uint32(200))
+	assert.Less(t, g>>8, uint32(60))
+	assert.Less(t, b>>8, uint32(60))
+	r, g, b, _ = thumbnail.At(ThumbnailSize-10, 10).RGBA()
+	assert.Greater(t, r>>8, uint32(200))
+	assert.Greater(t, g>>8, uint32(200))
+	assert.Greater(t, b>>8, uint32(200))
+
+	// Small images keep their size
+	data, err = Thumbnail(testPNG(t, 40, 60))
+	assert.NoError(t, err)
+	config, err := jpeg.DecodeConfig(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 40, config.Width)
+	assert.Equal(t, 60, config.Height)
+
+	_, err = Thumbnail([]byte("%PDF-1.7"))
+	assert.ErrorIs(t, err, ErrNoThumbnail)
+
+	// Images too large to decode get none, whatever the file size
+	var header bytes.Buffer
+	assert.NoError(t, png.Encode(&header, image.NewGray(image.Rect(0, 0, 1, 1))))
+	bomb := header.Bytes()
+	bomb[16], bomb[17], bomb[18], bomb[19] = 0, 1, 0, 0 // Width 65536
+	bomb[20], bomb[21], bomb[22], bomb[23] = 0, 1, 0, 0 // Height 65536
+	binary.BigEndian.PutUint32(bomb[29:], crc32.ChecksumIEEE(bomb[12:29]))
+	config, err = png.DecodeConfig(bytes.NewReader(bomb))
+	assert.NoError(t, err)
+	assert.Equal(t, 65536, config.Width)
+	_, err = Thumbnail(bomb)
+	assert.ErrorIs(t, err, ErrNoThumbnail)
+}
+
+func TestAddAndPurge(t *testing.T) {
+	db := setupTestDB(t)
+	dir := t.TempDir()
+	store := &storage.LocalStore{Dir: dir}
+	ctx := context.Background()
+
+	var expenses []models.Expense
+	for _, description := range []string{"Dinner", "Taxi"} {
+		expense := models.Expense{UserID: 1, WorkspaceID: 1, Description: description, Amount: 1000, Date: time.Now()}
+		assert.NoError(t, db.Create(&expense).Error)
+		expenses = append(expenses, expense)
+	}
+
+	receipt := testPNG(t, 600, 800)
+	first, created, err := Add(ctx, db, store, &expenses[0], 1, `C:\Users\me\receipt.png`, receipt)
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, "receipt.png", first.FileName)
+	assert.Equal(t, "image/png", first.ContentType)
+	assert.Equal(t, int64(len(receipt)), first.Size)
+	assert.NotEmpty(t, first.ThumbnailKey)
+
+	// The same file isn't attached twice
+	again, created, err := Add(ctx, db, store, &expenses[0], 1, "copy.png", receipt)
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, first.ID, again.ID)
+
+	// Other expenses share the stored file
+	second, created, err := Add(ctx, db, store, &expenses[1], 1, "receipt.png", receipt)
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, first.StorageKey, second.StorageKey)
+	assert.Equal(t, first.ThumbnailKey, second.ThumbnailKey)
+
+	_, _, err = Add(ctx, db, store, &expenses[1], 1, "script.pdf", []byte("#!/bin/sh\nrm -rf /"))
+	assert.ErrorIs(t, err, ErrUnsupportedType)
+	_, _, err = Add(ctx, db, store, &expenses[1], 1, "empty.pdf", nil)
+	assert.ErrorIs(t, err, ErrEmpty)
+
+	// Files are deleted with their last attachment
+	stored := filepath.Join(dir, filepath.FromSlash(first.StorageKey))
+	assert.NoError(t, db.Delete(first).Error)
+	assert.NoError(t, Purge(ctx, db, store, []models.Attachment{*first}))
+	assert.FileExists(t, stored)
+
+	assert.NoError(t, db.Delete(second).Error)
+	assert.NoError(t, Purge(ctx, db, store, []models.Attachment{*second}))
+	_, err = os.Stat(stored)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	_, err = os.Stat(filepath.Join(dir, filepath.FromSlash(second.ThumbnailKey)))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+// racingStore adds an attachment while Purge deletes the first file.
+type racingStore struct {
+	storage.Store
+	once  sync.Once
+	added chan error
+	add   func() error
+}
+
+func (s *racingStore) Delete(ctx context.Context, key string) error {
+	s.once.Do(func() {
+		go func() { s.added <- s.add() }()
+		time.Sleep(50 * time.Millisecond)
+	})
+	return s.Store.Delete(ctx, key)
+}
+
+func TestPurgeWhileAdding(t *testing.T) {
+	// A file database, so both run on the same data
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.Expense{}, &models.Attachment{}))
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	expenses := []models.Expense{
+		{UserID: 1, WorkspaceID: 1, Description: "Dinner", Amount: 1000, Date: time.Now()},
+		{UserID: 1, WorkspaceID: 1, Description: "Taxi", Amount: 1000, Date: time.Now()},
+	}
+	assert.NoError(t, db.Create(&expenses).Error)
+
+	receipt := testPNG(t, 2, 2)
+	first, _, err := Add(ctx, db, &storage.LocalStore{Dir: dir}, &expenses[0], 1, "receipt.png", receipt)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Delete(first).Error)
+
+	store := &racingStore{Store: &storage.LocalStore{Dir: dir}, added: make(chan error, 1)}
+	store.add = func() error {
+		_, _, err := Add(ctx, db, store.Store, &expenses[1], 1, "receipt.png", receipt)
+		return err
+	}
+	assert.NoError(t, Purge(ctx, db, store, []models.Attachment{*first}))
+	assert.NoError(t, <-store.added)
+
+	// The attachment added meanwhile stored the file again
+	assert.FileExists(t, filepath.Join(dir, filepath.FromSlash(first.StorageKey)))
+}
@@ -0,0 +1,84 @@
+package attachments
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+)
+
+const (
+	// ThumbnailSize is the length of the longer side of thumbnails.
+	ThumbnailSize = 256
+	// maxPixels limits the images that are decoded for thumbnails. Small
+	// files can hold images that take gigabytes once decoded.
+	maxPixels = 40_000_000
+)
+
+// ErrNoThumbnail is returned for files that get no thumbnail.
+var ErrNoThumbnail = errors.New("no thumbnail for this file")
+
+// Thumbnail returns a JPEG thumbnail of a JPEG, PNG or GIF image. Other
+// files, images that can't be decoded and images of more than maxPixels
+// get none.
+func Thumbnail(data []byte) ([]byte, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > maxPixels {
+		return nil, ErrNoThumbnail
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrNoThumbnail
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(img, ThumbnailSize), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// downscale shrinks the image to fit into a square of the size, averaging
+// the pixels each target pixel covers. It draws a band of source rows at a
+// time, so only the decoded image has to fit in memory.
+func downscale(img image.Image, size int) *image.RGBA {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if w >= h && w > size {
+		dw, dh = size, max(1, h*size/w)
+	} else if h > w && h > size {
+		dw, dh = max(1, w*size/h), size
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	band := image.NewRGBA(image.Rect(0, 0, w, (h+dh-1)/dh))
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*h/dh, (dy+1)*h/dh
+		rows := image.Rect(0, 0, w, y1-y0)
+		// Transparent areas become white, JPEG has no alpha channel
+		draw.Draw(band, rows, image.White, image.Point{}, draw.Src)
+		draw.Draw(band, rows, img, image.Pt(bounds.Min.X, bounds.Min.Y+y0), draw.Over)
+
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*w/dw, (dx+1)*w/dw
+			var r, g, b, n int
+			for y := 0; y < y1-y0; y++ {
+				i := band.PixOffset(x0, y)
+				for x := x0; x < x1; x++ {
+					r += int(band.Pix[i])
+					g += int(band.Pix[i+1])
+					b += int(band.Pix[i+2])
+					i += 4
+					n++
+				}
+			}
+			o := dst.PixOffset(dx, dy)
+			dst.Pix[o], dst.Pix[o+1], dst.Pix[o+2], dst.Pix[o+3] = uint8(r/n), uint8(g/n), uint8(b/n), 255
+		}
+	}
+	return dst
+}
@@ -0,0 +1,141 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// PersonalTokenPrefix starts every personal access token, which tells them
+// apart from JWTs in the Authorization header.
+const PersonalTokenPrefix = "etp_"
+
+var (
+	ErrInvalidScope         = errors.New("invalid scope")
+	ErrInvalidExpiry        = errors.New("expiry has to be in the future")
+	ErrInvalidPersonalToken = errors.New("invalid or expired personal access token")
+)
+
+// ScopeResources are the resources scopes are granted for. A scope is a
+// resource with read, write or * for both, e.g. expenses:read.
+var ScopeResources = []string{
+	"expenses", "income", "budgets", "categories", "tags", "rules", "recurring",
+	"reports", "rates", "workspaces", "settings",
+}
+
+// ParseScopes checks the scopes and returns them without duplicates.
+func ParseScopes(scopes []string) (models.Scopes, error) {
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidScope)
+	}
+
+	seen := make(map[string]bool, len(scopes))
+	parsed := make(models.Scopes, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		resource, access, ok := strings.Cut(scope, ":")
+		if !ok || !isScopeResource(resource) || (access != "read" && access != "write" && access != "*") {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			parsed = append(parsed, scope)
+		}
+	}
+	return parsed, nil
+}
+
+// AllowsScope reports whether the scopes grant reading or writing the
+// resource. Writing doesn't imply reading, that takes both or resource:*.
+func AllowsScope(scopes []string, resource string, write bool) bool {
+	access := "read"
+	if write {
+		access = "write"
+	}
+	for _, scope := range scopes {
+		if scope == resource+":"+access || scope == resource+":*" {
+			return true
+		}
+	}
+	return false
+}
+
+// CreatePersonalToken creates a token for the user. The token is returned
+// only here, the record keeps its hash.
+func CreatePersonalToken(db *gorm.DB, userID uint, name string, scopes []string, expiresAt *time.Time) (string, *models.PersonalAccessToken, error) {
+	parsed, err := ParseScopes(scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return "", nil, ErrInvalidExpiry
+	}
+
+	secret, err := randomHex(32)
+	if err != nil {
+		return "", nil, err
+	}
+	token := PersonalTokenPrefix + secret
+
+	record := &models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:len(PersonalTokenPrefix)+8],
+		TokenHash: hashToken(token),
+		Scopes:    parsed,
+		ExpiresAt: expiresAt,
+	}
+	if err := db.Create(record).Error; err != nil {
+		return "", nil, err
+	}
+	return token, record, nil
+}
+
+// ValidatePersonalToken returns the record of an unexpired token and notes
+// that it was used.
+func ValidatePersonalToken(db *gorm.DB, token string) (*models.PersonalAccessToken, error) {
+	var record models.PersonalAccessToken
+	if err := db.Where("token_hash = ?", hashToken(token)).First(&record).Error; err != nil {
+		return nil, ErrInvalidPersonalToken
+	}
+	now := time.Now()
+	if record.ExpiresAt != nil && !record.ExpiresAt.After(now) {
+		return nil, ErrInvalidPersonalToken
+	}
+	var users int64
+	if err := db.Model(&models.User{}).Where("id = ?", record.UserID).Count(&users).Error; err != nil {
+		return nil, err
+	}
+	if users == 0 {
+		return nil, ErrInvalidPersonalToken
+	}
+
+	// Scripts may call often, the time of use doesn't need to be exact
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) > time.Minute {
+		if err := db.Model(&record).Update("last_used_at", now).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &record, nil
+}
+
+// RevokePersonalTokens deletes all personal access tokens of the user and
+// returns how many there were.
+func RevokePersonalTokens(db *gorm.DB, userID uint) (int64, error) {
+	result := db.Where("user_id = ?", userID).Delete(&models.PersonalAccessToken{})
+	return result.RowsAffected, result.Error
+}
+
+func isScopeResource(resource string) bool {
+	for _, r := range ScopeResources {
+		if r == resource {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseScopes(t *testing.T) {
+	scopes, err := ParseScopes([]string{"expenses:read", "Budgets:*", "expenses:read"})
+	assert.NoError(t, err)
+	assert.Equal(t, models.Scopes{"expenses:read", "budgets:*"}, scopes)
+
+	for _, invalid := range [][]string{nil, {"expenses"}, {"expenses:delete"}, {"users:read"}, {"*"}} {
+		_, err := ParseScopes(invalid)
+		assert.ErrorIs(t, err, ErrInvalidScope, "%v", invalid)
+	}
+
+	assert.True(t, AllowsScope(scopes, "expenses", false))
+	assert.False(t, AllowsScope(scopes, "expenses", true))
+	assert.True(t, AllowsScope(scopes, "budgets", true))
+	assert.False(t, AllowsScope(scopes, "reports", false))
+}
+
+func TestPersonalToken(t *testing.T) {
+	db := setupTestDB(t)
+	user := &models.User{Email: "test@example.com", PasswordHash: "x"}
+	assert.NoError(t, db.Create(user).Error)
+
+	token, record, err := CreatePersonalToken(db, user.ID, "import script", []string{"expenses:write"}, nil)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, PersonalTokenPrefix))
+	assert.True(t, strings.HasPrefix(token, record.Prefix))
+	assert.NotContains(t, record.TokenHash, token[len(PersonalTokenPrefix):])
+
+	validated, err := ValidatePersonalToken(db, token)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, validated.UserID)
+	assert.Equal(t, models.Scopes{"expenses:write"}, validated.Scopes)
+
+	var used models.PersonalAccessToken
+	assert.NoError(t, db.First(&used, record.ID).Error)
+	assert.NotNil(t, used.LastUsedAt)
+
+	_, err = ValidatePersonalToken(db, token+"0")
+	assert.ErrorIs(t, err, ErrInvalidPersonalToken)
+
+	// Expired tokens stop working
+	past := time.Now().Add(-time.Hour)
+	_, _, err = CreatePersonalToken(db, user.ID, "expired", []string{"expenses:read"}, &past)
+	assert.ErrorIs(t, err, ErrInvalidExpiry)
+	soon := time.Now().Add(time.Hour)
+	token, record, err = CreatePersonalToken(db, user.ID, "expiring", []string{"expenses:read"}, &soon)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Model(record).Update("expires_at", past).Error)
+	_, err = ValidatePersonalToken(db, token)
+	assert.ErrorIs(t, err, ErrInvalidPersonalToken)
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// VerifyEmail activates the account the verification token was issued for.
+func VerifyEmail(db *gorm.DB, token string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		userID, err := ConsumeOneTimeToken(tx, token, models.TokenVerifyEmail)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ? AND activated_at IS NULL", userID).
+			Update("activated_at", time.Now()).Error
+	})
+}
+
+// ResetPassword sets a new password for the user the reset token was issued
+// for, ends all of the user's sessions and revokes the personal access
+// tokens, which whoever knew the old password could have created. Receiving
+// the token proves the email address, so the account is activated as well.
+func ResetPassword(db *gorm.DB, token, password string) error {
+	hashedPassword, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		userID, err := ConsumeOneTimeToken(tx, token, models.TokenResetPassword)
+		if err != nil {
+			return err
+		}
+		// The new password also lifts a lockout
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"password_hash": hashedPassword,
+			"failed_logins": 0,
+			"locked_until":  nil,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.User{}).
+			Where("id = ? AND activated_at IS NULL", userID).
+			Update("activated_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if _, err := RevokePersonalTokens(tx, userID); err != nil {
+			return err
+		}
+		return EndAllSessions(tx, userID)
+	})
+}
@@ -2,7 +2,7 @@ package auth
 
 import (
 	"errors"
-	"os"
+	"sync"
 	"time"
 
 	"expense-tracker/internal/models"
@@ -12,16 +12,11 @@ import (
 	"gorm.io/gorm"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
-
-func init() {
-	if len(jwtSecret) == 0 {
-		jwtSecret = []byte("your-secret-key") // Default secret for development
-	}
-}
+// PasswordCost is the bcrypt cost of password hashes. Tests lower it.
+var PasswordCost = 14
 
 func HashPassword(password string) (string, error) {
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), PasswordCost)
 	return string(bytes), err
 }
 
@@ -30,13 +25,25 @@ func CheckPasswordHash(password, hash string) bool {
 	return err == nil
 }
 
-func GenerateToken(userID uint) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
-	})
+// GenerateToken issues a short-lived access token for the user's current
+// session version.
+func GenerateToken(user *models.User) (string, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
 
-	return token.SignedString(jwtSecret)
+	now := time.Now()
+	return CurrentKeyring().Sign(Claims{
+		UserID:         user.ID,
+		Purpose:        accessPurpose,
+		SessionVersion: user.SessionVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+		},
+	})
 }
 
 func CreateUser(db *gorm.DB, email, password string) (*models.User, error) {
@@ -63,19 +70,44 @@ func CreateUser(db *gorm.DB, email, password string) (*models.User, error) {
 	return user, nil
 }
 
+// ErrInvalidCredentials is returned for wrong passwords, unknown and locked
+// accounts alike, so logins don't reveal which addresses are registered.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// dummyHash is compared against for unknown and locked accounts, so they
+// take as long to answer as wrong passwords.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := HashPassword("expense-tracker")
+	return []byte(hash)
+})
+
+// AuthenticateUser checks the password of the user with the email address.
+// Repeated wrong passwords lock the account, see recordFailedLogin, and
+// locked accounts refuse even the right password.
 func AuthenticateUser(db *gorm.DB, email, password string) (*models.User, error) {
 	var user models.User
 	if err := db.Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, errors.New("invalid credentials")
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return nil, ErrInvalidCredentials
 	}
 
 	if !CheckPasswordHash(password, user.PasswordHash) {
-		return nil, errors.New("invalid credentials")
+		if err := recordFailedLogin(db, &user); err != nil {
+			return nil, err
+		}
+		return nil, ErrInvalidCredentials
 	}
 
-	return &user, nil
-}
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		if err := db.Model(&user).Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil}).Error; err != nil {
+			return nil, err
+		}
+	}
 
-func GetJWTSecret() []byte {
-	return jwtSecret
+	return &user, nil
 }
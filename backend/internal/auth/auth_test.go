@@ -3,6 +3,7 @@ package auth
 import (
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"expense-tracker/internal/models"
 
@@ -18,7 +19,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("Failed to connect to test database: %v", err)
 	}
 
-	err = db.AutoMigrate(&models.User{})
+	err = db.AutoMigrate(&models.User{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.UserToken{}, &models.RecoveryCode{}, &models.UserIdentity{}, &models.OIDCState{}, &models.PersonalAccessToken{})
 	if err != nil {
 		t.Fatalf("Failed to migrate test database: %v", err)
 	}
@@ -63,9 +64,11 @@ func TestCreateUser(t *testing.T) {
 }
 
 func TestGenerateAndValidateToken(t *testing.T) {
-	userID := uint(1)
+	db := setupTestDB(t)
+	user := &models.User{Email: "test@example.com", PasswordHash: "x"}
+	assert.NoError(t, db.Create(user).Error)
 
-	token, err := GenerateToken(userID)
+	token, err := GenerateToken(user)
 	assert.NoError(t, err)
 	assert.NotEmpty(t, token)
 
@@ -76,7 +79,49 @@ func TestGenerateAndValidateToken(t *testing.T) {
 	c.Request.Header.Set("Authorization", "Bearer "+token)
 
 	// Validate the token
-	extractedUserID, err := ValidateToken(c)
+	claims, err := ValidateToken(db, c)
 	assert.NoError(t, err)
-	assert.Equal(t, userID, extractedUserID)
+	assert.Equal(t, user.ID, claims.UserID)
+
+	// Logging out revokes the token
+	assert.NoError(t, EndSession(db, claims, ""))
+	_, err = ValidateToken(db, c)
+	assert.ErrorIs(t, err, ErrRevoked)
+}
+
+func TestOneTimeToken(t *testing.T) {
+	db := setupTestDB(t)
+
+	token, err := IssueOneTimeToken(db, 1, models.TokenResetPassword, time.Hour)
+	assert.NoError(t, err)
+
+	// Tokens are bound to their purpose
+	_, err = ConsumeOneTimeToken(db, token, models.TokenVerifyEmail)
+	assert.ErrorIs(t, err, ErrInvalidOneTimeToken)
+	_, err = ParseToken(token)
+	assert.Error(t, err)
+
+	userID, err := ConsumeOneTimeToken(db, token, models.TokenResetPassword)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), userID)
+
+	// And used once
+	_, err = ConsumeOneTimeToken(db, token, models.TokenResetPassword)
+	assert.ErrorIs(t, err, ErrInvalidOneTimeToken)
+
+	// A new token replaces older ones
+	first, err := IssueOneTimeToken(db, 1, models.TokenResetPassword, time.Hour)
+	assert.NoError(t, err)
+	_, err = IssueOneTimeToken(db, 1, models.TokenResetPassword, time.Hour)
+	assert.NoError(t, err)
+	_, err = ConsumeOneTimeToken(db, first, models.TokenResetPassword)
+	assert.ErrorIs(t, err, ErrInvalidOneTimeToken)
+
+	expired, err := IssueOneTimeToken(db, 2, models.TokenVerifyEmail, -time.Minute)
+	assert.NoError(t, err)
+	_, err = ConsumeOneTimeToken(db, expired, models.TokenVerifyEmail)
+	assert.ErrorIs(t, err, ErrInvalidOneTimeToken)
+
+	_, err = ConsumeOneTimeToken(db, token+"x", models.TokenResetPassword)
+	assert.ErrorIs(t, err, ErrInvalidOneTimeToken)
 }
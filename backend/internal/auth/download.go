@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DownloadTokenTTL is how long a download URL of an attachment works.
+const DownloadTokenTTL = 15 * time.Minute
+
+var ErrInvalidDownloadToken = errors.New("invalid or expired download link")
+
+type downloadClaims struct {
+	AttachmentID uint   `json:"attachment_id"`
+	Thumbnail    bool   `json:"thumbnail,omitempty"`
+	Purpose      string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// IssueDownloadToken returns a token that authorizes downloading the
+// attachment, or its thumbnail, for DownloadTokenTTL. Browsers can't send
+// the Authorization header for links and images, so download URLs carry
+// the token instead.
+func IssueDownloadToken(attachmentID uint, thumbnail bool) (string, error) {
+	return CurrentKeyring().Sign(downloadClaims{
+		AttachmentID: attachmentID,
+		Thumbnail:    thumbnail,
+		Purpose:      "attachment",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(DownloadTokenTTL)),
+		},
+	})
+}
+
+// ParseDownloadToken returns the attachment a download token was issued
+// for, and whether it is for the thumbnail.
+func ParseDownloadToken(downloadToken string) (uint, bool, error) {
+	claims := &downloadClaims{}
+	token, err := jwt.ParseWithClaims(downloadToken, claims, CurrentKeyring().Keyfunc)
+	if err != nil || !token.Valid || claims.Purpose != "attachment" || claims.ExpiresAt == nil || claims.AttachmentID == 0 {
+		return 0, false, ErrInvalidDownloadToken
+	}
+	return claims.AttachmentID, claims.Thumbnail, nil
+}
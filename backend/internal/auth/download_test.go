@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"testing"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadToken(t *testing.T) {
+	token, err := IssueDownloadToken(7, true)
+	assert.NoError(t, err)
+	id, thumbnail, err := ParseDownloadToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(7), id)
+	assert.True(t, thumbnail)
+
+	// Tokens of other purposes don't authorize downloads, and download
+	// tokens don't authorize API requests
+	user := &models.User{ID: 7}
+	mfaToken, _ := IssueMFAToken(user)
+	_, _, err = ParseDownloadToken(mfaToken)
+	assert.ErrorIs(t, err, ErrInvalidDownloadToken)
+	accessToken, _ := GenerateToken(user)
+	_, _, err = ParseDownloadToken(accessToken)
+	assert.ErrorIs(t, err, ErrInvalidDownloadToken)
+	_, err = ParseToken(token)
+	assert.Error(t, err)
+
+	_, _, err = ParseDownloadToken(token + "x")
+	assert.ErrorIs(t, err, ErrInvalidDownloadToken)
+}
@@ -0,0 +1,252 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultSecret signs tokens when no keys are configured. It is public, so it
+// may only be used in development.
+const DefaultSecret = "your-secret-key"
+
+// SigningKey is a key of the keyring. Keys without a private key only verify
+// tokens, e.g. keys that were rotated out.
+type SigningKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	signing interface{} // []byte for HMAC, else a crypto.Signer
+	verify  interface{} // []byte for HMAC, else a public key
+}
+
+// Keyring signs tokens with its current key and verifies them with any of its
+// keys, picked by the kid header. Rotating keys means adding a new current key
+// and keeping the previous ones until the tokens they signed expired.
+type Keyring struct {
+	current  *SigningKey
+	keys     map[string]*SigningKey
+	legacy   *SigningKey // Verifies tokens issued before they had a kid
+	insecure bool
+}
+
+var (
+	keyringMu sync.RWMutex
+	keyring   = mustDefaultKeyring()
+)
+
+func mustDefaultKeyring() *Keyring {
+	k, err := NewKeyring("", nil)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+// NewKeyring builds a keyring from PEM key files and an HMAC secret. The first
+// file holding a private key signs, all others only verify. The secret signs
+// only without key files, otherwise it verifies the tokens it signed before.
+// Without either the keyring signs with DefaultSecret and is insecure. Key IDs
+// are the file names without extension.
+func NewKeyring(secret string, keyFiles []string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string]*SigningKey)}
+
+	for _, file := range keyFiles {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		key, err := ParseSigningKey(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		if err := k.add(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if secret == "" && k.current == nil {
+		secret = DefaultSecret
+		k.insecure = true
+	}
+	if secret != "" {
+		k.insecure = k.insecure || secret == DefaultSecret
+		sum := sha256.Sum256([]byte(secret))
+		key := &SigningKey{
+			ID:      "hs256-" + hex.EncodeToString(sum[:4]),
+			Method:  jwt.SigningMethodHS256,
+			signing: []byte(secret),
+			verify:  []byte(secret),
+		}
+		if err := k.add(key); err != nil {
+			return nil, err
+		}
+		k.legacy = key
+	}
+
+	if k.current == nil {
+		return nil, errors.New("no key to sign tokens with")
+	}
+	return k, nil
+}
+
+func (k *Keyring) add(key *SigningKey) error {
+	if _, ok := k.keys[key.ID]; ok {
+		return fmt.Errorf("duplicate key ID %q", key.ID)
+	}
+	k.keys[key.ID] = key
+	if k.current == nil && key.signing != nil {
+		k.current = key
+	}
+	return nil
+}
+
+// Insecure reports whether the keyring signs with the well-known
+// DefaultSecret or still accepts tokens signed with it.
+func (k *Keyring) Insecure() bool {
+	return k.insecure
+}
+
+// Sign signs the claims with the current key.
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.current.Method, claims)
+	token.Header["kid"] = k.current.ID
+	return token.SignedString(k.current.signing)
+}
+
+// Keyfunc returns the key that verifies the token, for jwt.Parse. The token
+// has to be signed with the algorithm of its key.
+func (k *Keyring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	key := k.legacy
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = k.keys[kid]
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key: %v", token.Header["kid"])
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return key.verify, nil
+}
+
+// JWKS returns the public keys as a JSON Web Key Set. HMAC secrets are never
+// part of it.
+func (k *Keyring) JWKS() map[string]interface{} {
+	keys := []map[string]string{}
+	for _, key := range k.keys {
+		if jwk := publicJWK(key); jwk != nil {
+			keys = append(keys, jwk)
+		}
+	}
+	// Map order is random, the set shouldn't change between requests
+	sort.Slice(keys, func(i, j int) bool { return keys[i]["kid"] < keys[j]["kid"] })
+	return map[string]interface{}{"keys": keys}
+}
+
+// SetKeyring replaces the keyring tokens are signed and verified with.
+func SetKeyring(k *Keyring) {
+	keyringMu.Lock()
+	defer keyringMu.Unlock()
+	keyring = k
+}
+
+// CurrentKeyring returns the keyring tokens are signed and verified with.
+func CurrentKeyring() *Keyring {
+	keyringMu.RLock()
+	defer keyringMu.RUnlock()
+	return keyring
+}
+
+// ParseSigningKey parses a PEM encoded RSA, Ed25519 or P-256 private key, or a
+// public key that only verifies.
+func ParseSigningKey(id string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: id}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.signing = signer
+		parsed = signer.Public()
+	}
+	key.verify = parsed
+
+	switch public := parsed.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys need at least 2048 bits")
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	case *ecdsa.PublicKey:
+		if public.Curve != elliptic.P256() {
+			return nil, errors.New("only P-256 elliptic curve keys are supported")
+		}
+		key.Method = jwt.SigningMethodES256
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	return key, nil
+}
+
+func publicJWK(key *SigningKey) map[string]string {
+	encode := base64.RawURLEncoding.EncodeToString
+	jwk := map[string]string{"kid": key.ID, "use": "sig", "alg": key.Method.Alg()}
+	switch public := key.verify.(type) {
+	case *rsa.PublicKey:
+		jwk["kty"] = "RSA"
+		jwk["n"] = encode(public.N.Bytes())
+		jwk["e"] = encode(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk["kty"] = "OKP"
+		jwk["crv"] = "Ed25519"
+		jwk["x"] = encode(public)
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		jwk["kty"] = "EC"
+		jwk["crv"] = "P-256"
+		jwk["x"] = encode(public.X.FillBytes(make([]byte, size)))
+		jwk["y"] = encode(public.Y.FillBytes(make([]byte, size)))
+	default:
+		return nil
+	}
+	return jwk
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeKey(t *testing.T, dir, name string, key interface{}) string {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	assert.NoError(t, err)
+	file := filepath.Join(dir, name+".pem")
+	assert.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	return file
+}
+
+func useKeyring(t *testing.T, k *Keyring) {
+	previous := CurrentKeyring()
+	SetKeyring(k)
+	t.Cleanup(func() { SetKeyring(previous) })
+}
+
+func TestDefaultKeyringIsInsecure(t *testing.T) {
+	k, err := NewKeyring("", nil)
+	assert.NoError(t, err)
+	assert.True(t, k.Insecure())
+
+	k, err = NewKeyring("a-real-secret", nil)
+	assert.NoError(t, err)
+	assert.False(t, k.Insecure())
+	assert.Empty(t, k.JWKS()["keys"])
+}
+
+func TestKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	oldFile := writeKey(t, dir, "2026-04", rsaKey)
+	newFile := writeKey(t, dir, "2026-10", edKey)
+	user := &models.User{ID: 1}
+
+	// Tokens of the HMAC secret that was used before
+	legacy, err := NewKeyring("old-secret", nil)
+	assert.NoError(t, err)
+	useKeyring(t, legacy)
+	hmacToken, err := GenerateToken(user)
+	assert.NoError(t, err)
+	withoutKid := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID:           1,
+		Purpose:          accessPurpose,
+		RegisteredClaims: jwt.RegisteredClaims{ID: "x", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	noKidToken, err := withoutKid.SignedString([]byte("old-secret"))
+	assert.NoError(t, err)
+
+	// and of the RSA key
+	k, err := NewKeyring("old-secret", []string{oldFile})
+	assert.NoError(t, err)
+	useKeyring(t, k)
+	rsaToken, err := GenerateToken(user)
+	assert.NoError(t, err)
+	parsed, _, _ := jwt.NewParser().ParseUnverified(rsaToken, &Claims{})
+	assert.Equal(t, "RS256", parsed.Method.Alg())
+	assert.Equal(t, "2026-04", parsed.Header["kid"])
+
+	// After rotating, new tokens are signed with EdDSA and old ones still verify
+	k, err = NewKeyring("old-secret", []string{newFile, oldFile})
+	assert.NoError(t, err)
+	useKeyring(t, k)
+	edToken, err := GenerateToken(user)
+	assert.NoError(t, err)
+	parsed, _, _ = jwt.NewParser().ParseUnverified(edToken, &Claims{})
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+
+	for _, token := range []string{hmacToken, noKidToken, rsaToken, edToken} {
+		claims, err := ParseToken(token)
+		assert.NoError(t, err)
+		if assert.NotNil(t, claims) {
+			assert.Equal(t, uint(1), claims.UserID)
+		}
+	}
+
+	// Dropping a key stops its tokens
+	k, err = NewKeyring("", []string{newFile})
+	assert.NoError(t, err)
+	useKeyring(t, k)
+	_, err = ParseToken(rsaToken)
+	assert.Error(t, err)
+	_, err = ParseToken(hmacToken)
+	assert.Error(t, err)
+	_, err = ParseToken(edToken)
+	assert.NoError(t, err)
+
+	// The set holds the public keys only
+	k, _ = NewKeyring("old-secret", []string{newFile, oldFile})
+	keys := k.JWKS()["keys"].([]map[string]string)
+	assert.Len(t, keys, 2)
+	assert.Equal(t, "2026-04", keys[0]["kid"])
+	assert.Equal(t, "RSA", keys[0]["kty"])
+	assert.Equal(t, "OKP", keys[1]["kty"])
+	assert.NotContains(t, keys[0], "d")
+}
+
+func TestKeyringRejectsAlgorithmConfusion(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	k, err := NewKeyring("", []string{writeKey(t, dir, "rsa", rsaKey)})
+	assert.NoError(t, err)
+	useKeyring(t, k)
+
+	// An HMAC token claiming the RSA key must not verify with its public key
+	public, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		UserID:           1,
+		RegisteredClaims: jwt.RegisteredClaims{ID: "x", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+	})
+	forged.Header["kid"] = "rsa"
+	token, err := forged.SignedString(public)
+	assert.NoError(t, err)
+	_, err = ParseToken(token)
+	assert.Error(t, err)
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"fmt"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// LockoutThreshold is the number of wrong passwords in a row that lock
+	// an account.
+	LockoutThreshold = 5
+	// LockoutBase is how long the first lockout lasts, every further wrong
+	// password doubles it up to LockoutMax.
+	LockoutBase = time.Minute
+	LockoutMax  = time.Hour
+)
+
+// AccountLockedError is returned for second factor codes of an account that is
+// locked after too many wrong passwords or codes. Password logins to locked
+// accounts fail with ErrInvalidCredentials instead.
+type AccountLockedError struct {
+	Until time.Time
+}
+
+func (e *AccountLockedError) Error() string {
+	return fmt.Sprintf("account locked until %s", e.Until.UTC().Format(time.RFC3339))
+}
+
+// lockoutDuration is how long an account is locked after the number of
+// wrong passwords in a row.
+func lockoutDuration(failures int) time.Duration {
+	if failures < LockoutThreshold {
+		return 0
+	}
+	duration := LockoutBase
+	for i := LockoutThreshold; i < failures && duration < LockoutMax; i++ {
+		duration *= 2
+	}
+	if duration > LockoutMax {
+		duration = LockoutMax
+	}
+	return duration
+}
+
+// recordFailedLogin counts a wrong password and locks the account once there
+// were LockoutThreshold in a row.
+func recordFailedLogin(db *gorm.DB, user *models.User) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).UpdateColumn("failed_logins", gorm.Expr("failed_logins + 1")).Error; err != nil {
+			return err
+		}
+		var failures int
+		if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Select("failed_logins").Scan(&failures).Error; err != nil {
+			return err
+		}
+		user.FailedLogins = failures
+
+		if duration := lockoutDuration(failures); duration > 0 {
+			until := time.Now().Add(duration)
+			user.LockedUntil = &until
+			return tx.Model(user).UpdateColumn("locked_until", until).Error
+		}
+		return nil
+	})
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	assert.Equal(t, time.Duration(0), lockoutDuration(LockoutThreshold-1))
+	assert.Equal(t, LockoutBase, lockoutDuration(LockoutThreshold))
+	assert.Equal(t, 2*LockoutBase, lockoutDuration(LockoutThreshold+1))
+	assert.Equal(t, 4*LockoutBase, lockoutDuration(LockoutThreshold+2))
+	assert.Equal(t, LockoutMax, lockoutDuration(LockoutThreshold+100))
+}
+
+func TestAccountLockout(t *testing.T) {
+	db := setupTestDB(t)
+	hash, _ := HashPassword("password123")
+	user := &models.User{Email: "test@example.com", PasswordHash: hash}
+	assert.NoError(t, db.Create(user).Error)
+
+	for i := 0; i < LockoutThreshold; i++ {
+		_, err := AuthenticateUser(db, user.Email, "wrong")
+		assert.ErrorIs(t, err, ErrInvalidCredentials)
+	}
+
+	// Locked accounts refuse even the right password, answering like unknown
+	// accounts do
+	_, err := AuthenticateUser(db, user.Email, "password123")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	_, err = AuthenticateUser(db, "nobody@example.com", "password123")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+	assert.NoError(t, db.First(user, user.ID).Error)
+	assert.WithinDuration(t, time.Now().Add(LockoutBase), *user.LockedUntil, 5*time.Second)
+
+	// Once the lock expired, a login resets the count
+	assert.NoError(t, db.Model(user).Update("locked_until", time.Now().Add(-time.Second)).Error)
+	_, err = AuthenticateUser(db, user.Email, "password123")
+	assert.NoError(t, err)
+	var reset models.User
+	assert.NoError(t, db.First(&reset, user.ID).Error)
+	assert.Zero(t, reset.FailedLogins)
+	assert.Nil(t, reset.LockedUntil)
+}
@@ -0,0 +1,246 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/totp"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MFATokenTTL is how long the second step of a login can take.
+	MFATokenTTL = 5 * time.Minute
+	// RecoveryCodeCount is the number of recovery codes a user gets.
+	RecoveryCodeCount = 10
+	// TOTPIssuer names the app in authenticator apps.
+	TOTPIssuer = "Expense Tracker"
+)
+
+var (
+	ErrInvalidMFAToken = errors.New("invalid or expired login")
+	ErrInvalidCode     = errors.New("invalid code")
+	ErrTOTPEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled  = errors.New("two-factor authentication is not enabled")
+)
+
+type mfaClaims struct {
+	UserID         uint   `json:"user_id"`
+	Purpose        string `json:"purpose"`
+	SessionVersion int    `json:"sv"`
+	jwt.RegisteredClaims
+}
+
+// IssueMFAToken returns a token that proves the user passed the first step
+// of the login, the password, and is valid for MFATokenTTL.
+func IssueMFAToken(user *models.User) (string, error) {
+	return CurrentKeyring().Sign(mfaClaims{
+		UserID:         user.ID,
+		Purpose:        "mfa",
+		SessionVersion: user.SessionVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(MFATokenTTL)),
+		},
+	})
+}
+
+// parseMFAToken verifies an MFA token and returns its claims.
+func parseMFAToken(mfaToken string) (*mfaClaims, error) {
+	claims := &mfaClaims{}
+	token, err := jwt.ParseWithClaims(mfaToken, claims, CurrentKeyring().Keyfunc)
+	if err != nil || !token.Valid || claims.Purpose != "mfa" || claims.ExpiresAt == nil {
+		return nil, ErrInvalidMFAToken
+	}
+	return claims, nil
+}
+
+// MFATokenUser returns the user an MFA token was issued to, or 0 if the token
+// is invalid. Rate limits of the second step go by it.
+func MFATokenUser(mfaToken string) uint {
+	claims, err := parseMFAToken(mfaToken)
+	if err != nil {
+		return 0
+	}
+	return claims.UserID
+}
+
+// CompleteLogin is the second step of a login. It checks the TOTP or
+// recovery code for the user of the MFA token and returns the user. Wrong
+// codes count towards the lockout of the account like wrong passwords.
+func CompleteLogin(db *gorm.DB, mfaToken, code string) (*models.User, error) {
+	claims, err := parseMFAToken(mfaToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var user models.User
+	if err := db.First(&user, claims.UserID).Error; err != nil || user.SessionVersion != claims.SessionVersion {
+		return nil, ErrInvalidMFAToken
+	}
+	if user.LockedUntil != nil && time.Now().Before(*user.LockedUntil) {
+		return nil, &AccountLockedError{Until: *user.LockedUntil}
+	}
+
+	if err := VerifySecondFactor(db, user.ID, code); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			if err := recordFailedLogin(db, &user); err != nil {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		if err := db.Model(&user).Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil}).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &user, nil
+}
+
+// VerifySecondFactor checks a TOTP code or an unused recovery code of the
+// user. Both can only be used once.
+func VerifySecondFactor(db *gorm.DB, userID uint, code string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.TOTPEnabledAt == nil {
+			return ErrTOTPNotEnabled
+		}
+
+		if step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+			return tx.Model(&user).Update("totp_last_step", step).Error
+		}
+
+		result := tx.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashRecoveryCode(code)).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidCode
+		}
+		return nil
+	})
+}
+
+// BeginTOTP creates a new TOTP secret for the user and returns it along
+// with its otpauth URI. It is used once a code of it enabled it.
+func BeginTOTP(db *gorm.DB, user *models.User) (string, string, error) {
+	if user.TOTPEnabledAt != nil {
+		return "", "", ErrTOTPEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := db.Model(user).Update("totp_secret", secret).Error; err != nil {
+		return "", "", err
+	}
+	return secret, totp.URI(secret, TOTPIssuer, user.Email), nil
+}
+
+// EnableTOTP turns two-factor authentication on once the user entered a
+// code of the secret from BeginTOTP, and returns new recovery codes.
+func EnableTOTP(db *gorm.DB, userID uint, code string) ([]string, error) {
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, userID).Error; err != nil {
+			return err
+		}
+		if user.TOTPEnabledAt != nil {
+			return ErrTOTPEnabled
+		}
+		if user.TOTPSecret == "" {
+			return ErrTOTPNotEnabled
+		}
+
+		step, ok := totp.Validate(user.TOTPSecret, code, time.Now(), 0)
+		if !ok {
+			return ErrInvalidCode
+		}
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"totp_enabled_at": time.Now(),
+			"totp_last_step":  step,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// DisableTOTP turns two-factor authentication off after checking a code.
+func DisableTOTP(db *gorm.DB, userID uint, code string) error {
+	if err := VerifySecondFactor(db, userID, code); err != nil {
+		return err
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the user after
+// checking a code.
+func RegenerateRecoveryCodes(db *gorm.DB, userID uint, code string) ([]string, error) {
+	if err := VerifySecondFactor(db, userID, code); err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, RecoveryCodeCount)
+	records := make([]models.RecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		raw, err := randomHex(6)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = raw[:6] + "-" + raw[6:]
+		records[i] = models.RecoveryCode{UserID: userID, CodeHash: hashRecoveryCode(codes[i])}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode hashes a recovery code for storage, ignoring case and
+// the dash users may or may not type.
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hashToken(normalized)
+}
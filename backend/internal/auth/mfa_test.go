@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/totp"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTOTP(t *testing.T) {
+	db := setupTestDB(t)
+	user := &models.User{Email: "test@example.com", PasswordHash: "x"}
+	assert.NoError(t, db.Create(user).Error)
+
+	secret, uri, err := BeginTOTP(db, user)
+	assert.NoError(t, err)
+	assert.Contains(t, uri, "secret="+secret)
+
+	// Codes are only checked once enabled
+	assert.ErrorIs(t, VerifySecondFactor(db, user.ID, "000000"), ErrTOTPNotEnabled)
+
+	_, err = EnableTOTP(db, user.ID, "000000")
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	// The code that enabled it can't be used again
+	now := time.Now()
+	code, _ := totp.Code(secret, totp.Step(now))
+	codes, err := EnableTOTP(db, user.ID, code)
+	assert.NoError(t, err)
+	assert.Len(t, codes, RecoveryCodeCount)
+	assert.ErrorIs(t, VerifySecondFactor(db, user.ID, code), ErrInvalidCode)
+
+	next, _ := totp.Code(secret, totp.Step(now)+1)
+	assert.NoError(t, VerifySecondFactor(db, user.ID, next))
+
+	// Recovery codes are stored hashed and used once
+	var stored models.RecoveryCode
+	assert.NoError(t, db.First(&stored).Error)
+	assert.NotContains(t, codes, stored.CodeHash)
+	assert.NoError(t, VerifySecondFactor(db, user.ID, codes[0]))
+	assert.ErrorIs(t, VerifySecondFactor(db, user.ID, codes[0]), ErrInvalidCode)
+
+	assert.NoError(t, db.First(user, user.ID).Error)
+	_, _, err = BeginTOTP(db, user)
+	assert.ErrorIs(t, err, ErrTOTPEnabled)
+
+	assert.NoError(t, DisableTOTP(db, user.ID, codes[1]))
+	var disabled models.User
+	assert.NoError(t, db.First(&disabled, user.ID).Error)
+	assert.Nil(t, disabled.TOTPEnabledAt)
+	assert.Empty(t, disabled.TOTPSecret)
+}
+
+func TestCompleteLogin(t *testing.T) {
+	db := setupTestDB(t)
+	secret, _ := totp.GenerateSecret()
+	now := time.Now()
+	user := &models.User{Email: "test@example.com", PasswordHash: "x", TOTPSecret: secret, TOTPEnabledAt: &now}
+	assert.NoError(t, db.Create(user).Error)
+
+	mfaToken, err := IssueMFAToken(user)
+	assert.NoError(t, err)
+
+	_, err = CompleteLogin(db, mfaToken, "000000")
+	assert.ErrorIs(t, err, ErrInvalidCode)
+
+	code, _ := totp.Code(secret, totp.Step(now))
+	_, err = CompleteLogin(db, "forged", code)
+	assert.ErrorIs(t, err, ErrInvalidMFAToken)
+
+	loggedIn, err := CompleteLogin(db, mfaToken, code)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, loggedIn.ID)
+
+	// Access tokens don't pass as MFA tokens
+	accessToken, _ := GenerateToken(user)
+	next, _ := totp.Code(secret, totp.Step(now)+1)
+	_, err = CompleteLogin(db, accessToken, next)
+	assert.ErrorIs(t, err, ErrInvalidMFAToken)
+	assert.Equal(t, user.ID, MFATokenUser(mfaToken))
+	assert.Zero(t, MFATokenUser(accessToken))
+
+	// Wrong codes count towards the lockout, which stops right codes too
+	assert.NoError(t, db.First(user, user.ID).Error)
+	assert.Zero(t, user.FailedLogins)
+	for i := 0; i < LockoutThreshold; i++ {
+		_, err = CompleteLogin(db, mfaToken, "000000")
+		assert.ErrorIs(t, err, ErrInvalidCode)
+	}
+	_, err = CompleteLogin(db, mfaToken, next)
+	var locked *AccountLockedError
+	assert.ErrorAs(t, err, &locked)
+}
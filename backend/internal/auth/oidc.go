@@ -0,0 +1,504 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OIDCStateTTL is how long a login at an identity provider can take.
+const OIDCStateTTL = 10 * time.Minute
+
+var (
+	ErrUnknownProvider  = errors.New("unknown identity provider")
+	ErrInvalidOIDCState = errors.New("invalid or expired login state")
+	ErrEmailNotVerified = errors.New("the identity provider didn't verify the email address")
+)
+
+// OIDCProvider configures an OpenID Connect identity provider. The endpoints
+// are discovered from the issuer.
+type OIDCProvider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string   // Where the provider sends the user back to with the code
+	Scopes       []string // Defaults to openid, email and profile
+}
+
+// OIDCIdentity is the user as the provider identified them in an ID token.
+type OIDCIdentity struct {
+	Provider      string
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// OIDC logs users in with the authorization code flow and PKCE at the
+// configured providers.
+type OIDC struct {
+	providers map[string]*oidcProvider
+	client    *http.Client
+}
+
+type oidcProvider struct {
+	OIDCProvider
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]interface{}
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDC returns an OIDC client for the providers. The client defaults to
+// http.DefaultClient.
+func NewOIDC(providers []OIDCProvider, client *http.Client) *OIDC {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	o := &OIDC{providers: make(map[string]*oidcProvider, len(providers)), client: client}
+	for _, provider := range providers {
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "email", "profile"}
+		}
+		o.providers[provider.Name] = &oidcProvider{OIDCProvider: provider}
+	}
+	return o
+}
+
+// Providers returns the names of the configured providers in order.
+func (o *OIDC) Providers() []string {
+	names := make([]string, 0, len(o.providers))
+	for name := range o.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OIDCLogin is a login started at a provider. The state and nonce have to be
+// kept by the browser that started it and handed to Exchange.
+type OIDCLogin struct {
+	URL   string // Where to send the user to
+	State string
+	Nonce string
+}
+
+// AuthCodeURL starts a login at the provider. It stores the state, nonce and
+// PKCE verifier of the login and returns the URL to send the user to.
+func (o *OIDC) AuthCodeURL(ctx context.Context, db *gorm.DB, name string) (*OIDCLogin, error) {
+	provider, ok := o.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+	discovery, err := o.discover(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	state, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	verifier, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+
+	// Logins that were never finished don't need to be remembered
+	if err := db.Where("expires_at < ?", time.Now()).Delete(&models.OIDCState{}).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Create(&models.OIDCState{
+		State:        state,
+		Provider:     name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ExpiresAt:    time.Now().Add(OIDCStateTTL),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	challenge := sha256.Sum256([]byte(verifier))
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", provider.ClientID)
+	query.Set("redirect_uri", provider.RedirectURL)
+	query.Set("scope", strings.Join(provider.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return &OIDCLogin{
+		URL:   discovery.AuthorizationEndpoint + separator + query.Encode(),
+		State: state,
+		Nonce: nonce,
+	}, nil
+}
+
+// Exchange finishes a login the provider redirected back from. The nonce is
+// the one the browser kept from AuthCodeURL, so a code and state can't be
+// redeemed by anyone else. It redeems the code and verifies the ID token the
+// provider returns for it.
+func (o *OIDC) Exchange(ctx context.Context, db *gorm.DB, name, code, state, nonce string) (*OIDCIdentity, error) {
+	provider, ok := o.providers[name]
+	if !ok {
+		return nil, ErrUnknownProvider
+	}
+
+	// The state is used once, whether the exchange works out or not
+	var login models.OIDCState
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("state = ? AND provider = ? AND expires_at > ?", state, name, time.Now()).
+			First(&login).Error; err != nil {
+			return ErrInvalidOIDCState
+		}
+		return tx.Delete(&login).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(login.Nonce), []byte(nonce)) != 1 {
+		return nil, ErrInvalidOIDCState
+	}
+
+	discovery, err := o.discover(ctx, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", provider.RedirectURL)
+	form.Set("code_verifier", login.CodeVerifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := o.do(req, &tokens); err != nil {
+		return nil, fmt.Errorf("redeem code: %w", err)
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("redeem code: no ID token in response")
+	}
+
+	return o.verify(ctx, provider, discovery, tokens.IDToken, login.Nonce)
+}
+
+type idTokenClaims struct {
+	Nonce         string      `json:"nonce"`
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"` // Some providers send it as a string
+	jwt.RegisteredClaims
+}
+
+// verify checks the signature, issuer, audience, expiry and nonce of an ID
+// token and returns the identity it asserts.
+func (o *OIDC) verify(ctx context.Context, provider *oidcProvider, discovery *oidcDiscovery, idToken, nonce string) (*OIDCIdentity, error) {
+	claims := &idTokenClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return o.key(ctx, provider, discovery, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(provider.ClientID),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("verify ID token: %w", err)
+	}
+	if claims.ExpiresAt == nil || claims.Subject == "" {
+		return nil, fmt.Errorf("verify ID token: missing claims")
+	}
+	if claims.Nonce != nonce {
+		return nil, fmt.Errorf("verify ID token: nonce mismatch")
+	}
+
+	verified := claims.EmailVerified == true || claims.EmailVerified == "true"
+	return &OIDCIdentity{
+		Provider:      provider.Name,
+		Issuer:        discovery.Issuer,
+		Subject:       claims.Subject,
+		Email:         strings.TrimSpace(claims.Email),
+		EmailVerified: verified,
+	}, nil
+}
+
+// discover fetches the provider's configuration once.
+func (o *OIDC) discover(ctx context.Context, provider *oidcProvider) (*oidcDiscovery, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+	if provider.discovery != nil {
+		return provider.discovery, nil
+	}
+
+	endpoint := strings.TrimRight(provider.Issuer, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	var discovery oidcDiscovery
+	if err := o.do(req, &discovery); err != nil {
+		return nil, fmt.Errorf("discover %s: %w", provider.Name, err)
+	}
+	// The issuer has to match exactly, ID tokens are checked against it
+	if discovery.Issuer != provider.Issuer {
+		return nil, fmt.Errorf("discover %s: issuer %q doesn't match %q", provider.Name, discovery.Issuer, provider.Issuer)
+	}
+
+	provider.discovery = &discovery
+	return provider.discovery, nil
+}
+
+// key returns the provider's signing key with the ID. Unknown IDs reload the
+// keys, the provider may have rotated them.
+func (o *OIDC) key(ctx context.Context, provider *oidcProvider, discovery *oidcDiscovery, kid string) (interface{}, error) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if key, ok := provider.keys[kid]; ok {
+		return key, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, discovery.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := o.do(req, &set); err != nil {
+		return nil, fmt.Errorf("fetch keys: %w", err)
+	}
+
+	provider.keys = make(map[string]interface{}, len(set.Keys))
+	for _, raw := range set.Keys {
+		id, key, err := parseJWK(raw)
+		if err != nil {
+			// Keys of types we don't support are skipped
+			continue
+		}
+		provider.keys[id] = key
+	}
+
+	if key, ok := provider.keys[kid]; ok {
+		return key, nil
+	}
+	// Without a kid in the token, a provider with a single key means that one
+	if kid == "" && len(provider.keys) == 1 {
+		for _, key := range provider.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (o *OIDC) do(req *http.Request, v interface{}) error {
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, v)
+}
+
+// parseJWK parses an RSA or elliptic curve public key of a JWK set.
+func parseJWK(raw json.RawMessage) (string, interface{}, error) {
+	var jwk struct {
+		Kid string `json:"kid"`
+		Kty string `json:"kty"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+		Crv string `json:"crv"`
+		X   string `json:"x"`
+		Y   string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", nil, err
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return "", nil, fmt.Errorf("key %q isn't for signatures", jwk.Kid)
+	}
+
+	decode := func(value string) (*big.Int, error) {
+		b, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil {
+			return nil, err
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return "", nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return "", nil, err
+		}
+		return jwk.Kid, &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return "", nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return "", nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return "", nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return "", nil, fmt.Errorf("key %q isn't on its curve", jwk.Kid)
+		}
+		return jwk.Kid, &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// resetCredentials activates an account that was registered without proving
+// the address and removes everything its registrant could sign in with.
+func resetCredentials(tx *gorm.DB, user *models.User) error {
+	now := time.Now()
+	user.ActivatedAt = &now
+	user.PasswordHash = ""
+	user.TOTPSecret = ""
+	user.TOTPEnabledAt = nil
+	if err := tx.Model(user).Select("activated_at", "password_hash", "totp_secret", "totp_enabled_at").Updates(user).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if _, err := RevokePersonalTokens(tx, user.ID); err != nil {
+		return err
+	}
+	if err := EndAllSessions(tx, user.ID); err != nil {
+		return err
+	}
+	// Sessions of the linked account need the new session version
+	return tx.First(user, user.ID).Error
+}
+
+// LinkIdentity returns the user of the identity. Identities seen before are
+// linked by issuer and subject, new ones to the user with the same email
+// address if the provider verified it. Accounts that were never activated lose
+// their password when linked. Without such a user an account is created, it
+// has no password and logs in through the provider only.
+func LinkIdentity(db *gorm.DB, identity *OIDCIdentity) (*models.User, error) {
+	var user models.User
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var link models.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).First(&link).Error
+		if err == nil {
+			return tx.First(&user, link.UserID).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// An unverified address could belong to anyone
+		if !identity.EmailVerified || identity.Email == "" {
+			return ErrEmailNotVerified
+		}
+
+		err = tx.Where("LOWER(email) = ?", strings.ToLower(identity.Email)).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			now := time.Now()
+			user = models.User{Email: identity.Email, ActivatedAt: &now}
+			err = tx.Create(&user).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		// The provider proved the address, so the account is activated. Whoever
+		// registered it without verifying the address might not own it, so
+		// their password, second factor, sessions and tokens are dropped.
+		if user.ActivatedAt == nil {
+			if err := resetCredentials(tx, &user); err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:   user.ID,
+			Provider: identity.Provider,
+			Issuer:   identity.Issuer,
+			Subject:  identity.Subject,
+			Email:    identity.Email,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
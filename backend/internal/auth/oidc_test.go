@@ -0,0 +1,151 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"expense-tracker/internal/auth/oidctest"
+	"expense-tracker/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupTestOIDC(t *testing.T) (*OIDC, *oidctest.Server) {
+	server := oidctest.NewServer("expense-tracker", "secret")
+	t.Cleanup(server.Close)
+	oidc := NewOIDC([]OIDCProvider{{
+		Name:         "company",
+		Issuer:       server.Issuer(),
+		ClientID:     server.ClientID,
+		ClientSecret: server.ClientSecret,
+		RedirectURL:  "http://localhost:3000/auth/oidc/company/callback",
+	}}, server.Client())
+	return oidc, server
+}
+
+func TestOIDCLogin(t *testing.T) {
+	db := setupTestDB(t)
+	oidc, server := setupTestOIDC(t)
+	ctx := context.Background()
+
+	_, err := oidc.AuthCodeURL(ctx, db, "unknown")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+
+	server.SetUser(oidctest.User{Subject: "alice", Email: "Alice@example.com", EmailVerified: true})
+	login, err := oidc.AuthCodeURL(ctx, db, "company")
+	assert.NoError(t, err)
+	assert.Contains(t, login.URL, "code_challenge_method=S256")
+
+	code, state, err := server.Authorize(login.URL)
+	assert.NoError(t, err)
+	assert.Equal(t, login.State, state)
+
+	identity, err := oidc.Exchange(ctx, db, "company", code, state, login.Nonce)
+	assert.NoError(t, err)
+	assert.Equal(t, server.Issuer(), identity.Issuer)
+	assert.Equal(t, "alice", identity.Subject)
+	assert.True(t, identity.EmailVerified)
+
+	// The state is used up by the exchange
+	_, err = oidc.Exchange(ctx, db, "company", code, state, login.Nonce)
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+
+	// Codes the provider didn't issue are rejected
+	login, _ = oidc.AuthCodeURL(ctx, db, "company")
+	_, state, _ = server.Authorize(login.URL)
+	_, err = oidc.Exchange(ctx, db, "company", "wrong", state, login.Nonce)
+	assert.Error(t, err)
+
+	// So are logins started by another browser, and they are used up as well
+	login, _ = oidc.AuthCodeURL(ctx, db, "company")
+	code, state, _ = server.Authorize(login.URL)
+	_, err = oidc.Exchange(ctx, db, "company", code, state, "other")
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+	_, err = oidc.Exchange(ctx, db, "company", code, state, login.Nonce)
+	assert.ErrorIs(t, err, ErrInvalidOIDCState)
+}
+
+func TestOIDCRejectsForeignTokens(t *testing.T) {
+	oidc, server := setupTestOIDC(t)
+	ctx := context.Background()
+	provider := oidc.providers["company"]
+	discovery, err := oidc.discover(ctx, provider)
+	assert.NoError(t, err)
+
+	claims := func(audience, nonce string) jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":   server.Issuer(),
+			"sub":   "alice",
+			"aud":   audience,
+			"exp":   time.Now().Add(time.Minute).Unix(),
+			"nonce": nonce,
+		}
+	}
+
+	token, _ := server.Sign(claims("expense-tracker", "nonce"))
+	_, err = oidc.verify(ctx, provider, discovery, token, "nonce")
+	assert.NoError(t, err)
+
+	token, _ = server.Sign(claims("another-client", "nonce"))
+	_, err = oidc.verify(ctx, provider, discovery, token, "nonce")
+	assert.Error(t, err)
+
+	token, _ = server.Sign(claims("expense-tracker", "replayed"))
+	_, err = oidc.verify(ctx, provider, discovery, token, "nonce")
+	assert.Error(t, err)
+
+	// Tokens signed with HMAC are never accepted
+	unsigned := jwt.NewWithClaims(jwt.SigningMethodHS256, claims("expense-tracker", "nonce"))
+	token, _ = unsigned.SignedString([]byte("secret"))
+	_, err = oidc.verify(ctx, provider, discovery, token, "nonce")
+	assert.Error(t, err)
+}
+
+func TestLinkIdentity(t *testing.T) {
+	db := setupTestDB(t)
+	existing := &models.User{Email: "alice@example.com", PasswordHash: "x"}
+	assert.NoError(t, db.Create(existing).Error)
+
+	// Unverified addresses aren't linked to anyone
+	_, err := LinkIdentity(db, &OIDCIdentity{Provider: "company", Issuer: "https://idp", Subject: "1", Email: "alice@example.com"})
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+
+	// A verified address links to the existing account and activates it. The
+	// account was never activated, so whoever registered it loses access.
+	session, err := StartSession(db, existing)
+	assert.NoError(t, err)
+	user, err := LinkIdentity(db, &OIDCIdentity{Provider: "company", Issuer: "https://idp", Subject: "1", Email: "Alice@Example.com", EmailVerified: true})
+	assert.NoError(t, err)
+	assert.Equal(t, existing.ID, user.ID)
+	assert.NotNil(t, user.ActivatedAt)
+	assert.NoError(t, db.First(user, user.ID).Error)
+	assert.Empty(t, user.PasswordHash)
+	_, err = Refresh(db, session.RefreshToken)
+	assert.Error(t, err)
+
+	// Activated accounts keep their password
+	now := time.Now()
+	carol := &models.User{Email: "carol@example.com", PasswordHash: "x", ActivatedAt: &now}
+	assert.NoError(t, db.Create(carol).Error)
+	user, err = LinkIdentity(db, &OIDCIdentity{Provider: "company", Issuer: "https://idp", Subject: "3", Email: "carol@example.com", EmailVerified: true})
+	assert.NoError(t, err)
+	assert.NoError(t, db.First(user, user.ID).Error)
+	assert.Equal(t, "x", user.PasswordHash)
+
+	// Once linked, the subject is enough even when the address changed
+	user, err = LinkIdentity(db, &OIDCIdentity{Provider: "company", Issuer: "https://idp", Subject: "1", Email: "alice@new.example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, existing.ID, user.ID)
+
+	// Unknown verified addresses get a new account without password
+	user, err = LinkIdentity(db, &OIDCIdentity{Provider: "company", Issuer: "https://idp", Subject: "2", Email: "bob@example.com", EmailVerified: true})
+	assert.NoError(t, err)
+	assert.NotEqual(t, existing.ID, user.ID)
+	assert.Empty(t, user.PasswordHash)
+
+	var count int64
+	db.Model(&models.UserIdentity{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// How long tokens mailed to users are valid.
+const (
+	VerifyEmailTTL   = 48 * time.Hour
+	ResetPasswordTTL = time.Hour
+)
+
+// ErrInvalidOneTimeToken is returned for one-time tokens that are forged,
+// expired, meant for something else or used already.
+var ErrInvalidOneTimeToken = errors.New("invalid or expired token")
+
+type oneTimeClaims struct {
+	UserID  uint   `json:"user_id"`
+	Purpose string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// IssueOneTimeToken creates a signed token for the purpose that can be used
+// once. Earlier tokens of the user for the same purpose become invalid.
+func IssueOneTimeToken(db *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return "", err
+	}
+	expiresAt := time.Now().Add(ttl)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ?", userID, purpose).Delete(&models.UserToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserToken{ID: id, UserID: userID, Purpose: purpose, ExpiresAt: expiresAt}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return CurrentKeyring().Sign(oneTimeClaims{
+		UserID:  userID,
+		Purpose: purpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        id,
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	})
+}
+
+// ConsumeOneTimeToken verifies a token issued for the purpose, marks it as
+// used and returns the user it was issued to. It should run in the
+// transaction that acts on the token, so the token stays valid if that fails.
+func ConsumeOneTimeToken(tx *gorm.DB, tokenString, purpose string) (uint, error) {
+	claims := &oneTimeClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, CurrentKeyring().Keyfunc)
+	if err != nil || !token.Valid || claims.Purpose != purpose || claims.ExpiresAt == nil {
+		return 0, ErrInvalidOneTimeToken
+	}
+
+	var record models.UserToken
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND user_id = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", claims.ID, claims.UserID, purpose, time.Now()).
+		First(&record).Error; err != nil {
+		return 0, ErrInvalidOneTimeToken
+	}
+	if err := tx.Model(&record).Update("used_at", time.Now()).Error; err != nil {
+		return 0, err
+	}
+
+	return record.UserID, nil
+}
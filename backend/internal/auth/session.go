@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+
+	// RefreshGracePeriod is how long a refresh token can still be used after
+	// it was exchanged, for clients that lost the response or refresh from
+	// several tabs at once.
+	RefreshGracePeriod = 30 * time.Second
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token was already used")
+)
+
+// Session is an access token along with the refresh token that renews it.
+type Session struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"` // Seconds until the access token expires
+}
+
+// StartSession logs the user in with a new family of refresh tokens.
+func StartSession(db *gorm.DB, user *models.User) (*Session, error) {
+	familyID, err := randomHex(16)
+	if err != nil {
+		return nil, err
+	}
+	return issueSession(db, user, familyID)
+}
+
+// Refresh exchanges a refresh token for a new session of the same family.
+// Each refresh token can be used once, presenting it again after
+// RefreshGracePeriod revokes its whole family and returns
+// ErrRefreshTokenReused.
+func Refresh(db *gorm.DB, refreshToken string) (*Session, error) {
+	var session *Session
+	reused := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var token models.RefreshToken
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", hashToken(refreshToken)).
+			First(&token).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		inGracePeriod := token.UsedAt != nil && time.Since(*token.UsedAt) < RefreshGracePeriod
+		if token.RevokedAt != nil || (token.UsedAt != nil && !inGracePeriod) {
+			// Either the legitimate client or an attacker holds a newer token
+			// of the family, there's no telling which, so both lose it. The
+			// revocation is committed, the error is returned afterwards.
+			reused = token.RevokedAt == nil
+			return revokeFamily(tx, token.FamilyID)
+		}
+		if time.Now().After(token.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		var user models.User
+		if err := tx.First(&user, token.UserID).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		// A token reused within the grace period keeps its first use, so the
+		// period isn't extended by using it over and over
+		if token.UsedAt == nil {
+			if err := tx.Model(&token).Update("used_at", time.Now()).Error; err != nil {
+				return err
+			}
+		}
+
+		var err error
+		session, err = issueSession(tx, &user, token.FamilyID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		if reused {
+			return nil, ErrRefreshTokenReused
+		}
+		return nil, ErrInvalidRefreshToken
+	}
+	return session, nil
+}
+
+// EndSession logs out of one session. It revokes the access token and the
+// family of the refresh token, if one is given.
+func EndSession(db *gorm.DB, claims *Claims, refreshToken string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if refreshToken != "" {
+			var token models.RefreshToken
+			err := tx.Where("token_hash = ? AND user_id = ?", hashToken(refreshToken), claims.UserID).First(&token).Error
+			if err == nil {
+				if err := revokeFamily(tx, token.FamilyID); err != nil {
+					return err
+				}
+			} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+		}
+
+		// Tokens that expired don't need to be remembered any longer
+		if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.RevokedToken{ID: claims.ID, ExpiresAt: claims.ExpiresAt.Time}).Error
+	})
+}
+
+// EndAllSessions logs the user out everywhere. Raising the session version
+// revokes all access tokens, the refresh tokens are revoked as well.
+func EndAllSessions(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			UpdateColumn("session_version", gorm.Expr("session_version + 1")).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ? AND expires_at < ?", userID, time.Now()).Delete(&models.RefreshToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+func issueSession(db *gorm.DB, user *models.User, familyID string) (*Session, error) {
+	accessToken, err := GenerateToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	refreshToken := base64.RawURLEncoding.EncodeToString(raw)
+
+	if err := db.Create(&models.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(AccessTokenTTL / time.Second),
+	}, nil
+}
+
+func revokeFamily(tx *gorm.DB, familyID string) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// hashToken hashes a refresh token for storage. The tokens are random, so a
+// plain hash without salt can't be reversed.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefresh(t *testing.T) {
+	db := setupTestDB(t)
+	user := &models.User{Email: "test@example.com", PasswordHash: "x"}
+	assert.NoError(t, db.Create(user).Error)
+
+	session, err := StartSession(db, user)
+	assert.NoError(t, err)
+
+	// The stored token is hashed
+	var stored models.RefreshToken
+	assert.NoError(t, db.First(&stored).Error)
+	assert.NotEqual(t, session.RefreshToken, stored.TokenHash)
+
+	renewed, err := Refresh(db, session.RefreshToken)
+	assert.NoError(t, err)
+	assert.NotEqual(t, session.RefreshToken, renewed.RefreshToken)
+
+	// Right after the exchange the old token still works, e.g. for a client
+	// that lost the response
+	again, err := Refresh(db, session.RefreshToken)
+	assert.NoError(t, err)
+	assert.NotEqual(t, renewed.RefreshToken, again.RefreshToken)
+
+	// Using it again later revokes the renewed ones as well
+	db.Model(&models.RefreshToken{}).Where("used_at IS NOT NULL").Update("used_at", time.Now().Add(-RefreshGracePeriod))
+	_, err = Refresh(db, session.RefreshToken)
+	assert.ErrorIs(t, err, ErrRefreshTokenReused)
+	_, err = Refresh(db, renewed.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, err = Refresh(db, again.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	_, err = Refresh(db, "unknown")
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestRefreshExpired(t *testing.T) {
+	db := setupTestDB(t)
+	user := &models.User{Email: "test@example.com", PasswordHash: "x"}
+	assert.NoError(t, db.Create(user).Error)
+
+	session, err := StartSession(db, user)
+	assert.NoError(t, err)
+	db.Model(&models.RefreshToken{}).Where("user_id = ?", user.ID).Update("expires_at", time.Now().Add(-time.Hour))
+
+	_, err = Refresh(db, session.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestEndAllSessions(t *testing.T) {
+	db := setupTestDB(t)
+	user := &models.User{Email: "test@example.com", PasswordHash: "x"}
+	assert.NoError(t, db.Create(user).Error)
+
+	phone, err := StartSession(db, user)
+	assert.NoError(t, err)
+	laptop, err := StartSession(db, user)
+	assert.NoError(t, err)
+
+	assert.NoError(t, EndAllSessions(db, user.ID))
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/", nil)
+	c.Request.Header.Set("Authorization", "Bearer "+phone.AccessToken)
+	_, err = ValidateToken(db, c)
+	assert.ErrorIs(t, err, ErrRevoked)
+
+	_, err = Refresh(db, laptop.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	// New sessions work again
+	assert.NoError(t, db.First(user, user.ID).Error)
+	session, err := StartSession(db, user)
+	assert.NoError(t, err)
+	c.Request.Header.Set("Authorization", "Bearer "+session.AccessToken)
+	_, err = ValidateToken(db, c)
+	assert.NoError(t, err)
+}
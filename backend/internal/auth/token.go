@@ -1,38 +1,89 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
+	"expense-tracker/internal/models"
+
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
 )
 
-func ValidateToken(c *gin.Context) (uint, error) {
+// ErrRevoked is returned for access tokens that were revoked by logging out.
+var ErrRevoked = errors.New("token has been revoked")
+
+// accessPurpose marks access tokens. Tokens mailed to users, MFA and download
+// tokens are signed with the same keys but carry other purposes.
+const accessPurpose = "access"
+
+// Claims are the claims of an access token. The session version has to match
+// the user's, raising it revokes all access tokens issued before.
+type Claims struct {
+	UserID         uint   `json:"user_id"`
+	Purpose        string `json:"purpose"`
+	SessionVersion int    `json:"sv"`
+	jwt.RegisteredClaims
+}
+
+// ParseToken verifies the signature and expiry of an access token and
+// returns its claims. Tokens issued for other purposes are rejected.
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, CurrentKeyring().Keyfunc)
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid || claims.Purpose != accessPurpose || claims.UserID == 0 || claims.ID == "" || claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("invalid token claims")
+	}
+	return claims, nil
+}
+
+// BearerToken returns the token of the request's Authorization header.
+func BearerToken(c *gin.Context) (string, error) {
 	authHeader := c.GetHeader("Authorization")
 	if authHeader == "" {
-		return 0, fmt.Errorf("authorization header required")
+		return "", fmt.Errorf("authorization header required")
 	}
 
 	bearerToken := strings.Split(authHeader, " ")
 	if len(bearerToken) != 2 || strings.ToLower(bearerToken[0]) != "bearer" {
-		return 0, fmt.Errorf("invalid authorization header format")
+		return "", fmt.Errorf("invalid authorization header format")
 	}
+	return bearerToken[1], nil
+}
 
-	token, err := jwt.Parse(bearerToken[1], func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return GetJWTSecret(), nil
-	})
+// ValidateToken validates the bearer token of the request and checks that it
+// was neither revoked nor issued before the user's sessions were ended.
+func ValidateToken(db *gorm.DB, c *gin.Context) (*Claims, error) {
+	token, err := BearerToken(c)
+	if err != nil {
+		return nil, err
+	}
 
+	claims, err := ParseToken(token)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		return uint(claims["user_id"].(float64)), nil
+	var user models.User
+	if err := db.Select("id", "session_version").First(&user, claims.UserID).Error; err != nil {
+		return nil, ErrRevoked
+	}
+	if user.SessionVersion != claims.SessionVersion {
+		return nil, ErrRevoked
+	}
+
+	var revoked int64
+	if err := db.Model(&models.RevokedToken{}).Where("id = ?", claims.ID).Count(&revoked).Error; err != nil {
+		return nil, err
+	}
+	if revoked > 0 {
+		return nil, ErrRevoked
 	}
 
-	return 0, fmt.Errorf("invalid token claims")
+	return claims, nil
 }
@@ -0,0 +1,143 @@
+package budgets
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOverAssigned  = errors.New("budgets are assigned more than the month's income")
+	ErrUnknownBudget = errors.New("budget not found in this month")
+)
+
+// Assignment is the amount a budget is assigned in its month.
+type Assignment struct {
+	BudgetID uint         `json:"budget_id"`
+	Name     string       `json:"name"`
+	Assigned models.Money `json:"assigned"`
+}
+
+// Plan shows how the income of a month is assigned to its budgets. Amounts
+// carried over from earlier months were assigned then and don't count.
+type Plan struct {
+	Month     string       `json:"month"`
+	ZeroBased bool         `json:"zero_based"`
+	Income    models.Money `json:"income"`
+	Assigned  models.Money `json:"assigned"`
+	ToAssign  models.Money `json:"to_assign"` // Income not assigned yet, negative if budgets got more
+	Budgets   []Assignment `json:"budgets"`
+}
+
+// GetPlan returns how the workspace's income of month is assigned.
+func GetPlan(db *gorm.DB, workspaceID uint, month string) (*Plan, error) {
+	start, err := time.Parse(monthLayout, month)
+	if err != nil {
+		return nil, fmt.Errorf("invalid month %q: %v", month, err)
+	}
+
+	zero, err := zeroBased(db, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{Month: month, ZeroBased: zero, Budgets: []Assignment{}}
+	if err := db.Model(&models.Income{}).
+		Select("CAST(COALESCE(SUM(base_amount), 0) AS BIGINT)").
+		Where("workspace_id = ? AND date >= ? AND date < ?", workspaceID, start, start.AddDate(0, 1, 0)).
+		Scan(&plan.Income).Error; err != nil {
+		return nil, err
+	}
+
+	if err := db.Model(&models.Budget{}).
+		Select("id AS budget_id, name, amount AS assigned").
+		Where("workspace_id = ? AND month = ?", workspaceID, month).
+		Order("name, id").
+		Scan(&plan.Budgets).Error; err != nil {
+		return nil, err
+	}
+	for _, budget := range plan.Budgets {
+		plan.Assigned += budget.Assigned
+	}
+	plan.ToAssign = plan.Income - plan.Assigned
+
+	return plan, nil
+}
+
+// zeroBased reports whether the workspace uses zero-based budgeting. Deleted
+// workspaces don't.
+func zeroBased(db *gorm.DB, workspaceID uint) (bool, error) {
+	var flags []bool
+	if err := db.Model(&models.Workspace{}).Where("id = ?", workspaceID).Pluck("zero_based", &flags).Error; err != nil {
+		return false, err
+	}
+	return len(flags) > 0 && flags[0], nil
+}
+
+// CheckAssigned returns ErrOverAssigned if the workspace is zero-based, its
+// budgets of month are assigned more than the month's income and a change
+// added increase to the assigned total. Changes that don't add to it pass,
+// so budgets stay editable after the income of their month was lowered. Run
+// it in the transaction that changed the budgets, after the change.
+func CheckAssigned(tx *gorm.DB, workspaceID uint, month string, increase models.Money) error {
+	if increase <= 0 {
+		return nil
+	}
+	plan, err := GetPlan(tx, workspaceID, month)
+	if err != nil {
+		return err
+	}
+	if plan.ZeroBased && plan.ToAssign < 0 {
+		return ErrOverAssigned
+	}
+	return nil
+}
+
+// Assign sets the amounts of the workspace's budgets of month, by budget ID,
+// and returns the resulting plan. In zero-based workspaces the budgets can't
+// be assigned more than the month's income, unless the change lowers the
+// assigned total.
+func Assign(db *gorm.DB, workspaceID uint, month string, amounts map[uint]models.Money) (*Plan, error) {
+	var plan *Plan
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var list []models.Budget
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("workspace_id = ? AND month = ?", workspaceID, month).
+			Find(&list).Error; err != nil {
+			return err
+		}
+		assigned := make(map[uint]models.Money, len(list))
+		for _, budget := range list {
+			assigned[budget.ID] = budget.Amount
+		}
+
+		var increase models.Money
+		for id, amount := range amounts {
+			previous, ok := assigned[id]
+			if !ok {
+				return fmt.Errorf("%w: %d", ErrUnknownBudget, id)
+			}
+			if err := tx.Model(&models.Budget{}).Where("id = ?", id).Update("amount", amount).Error; err != nil {
+				return err
+			}
+			increase += amount - previous
+		}
+
+		if err := CheckAssigned(tx, workspaceID, month, increase); err != nil {
+			return err
+		}
+		var err error
+		plan, err = GetPlan(tx, workspaceID, month)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
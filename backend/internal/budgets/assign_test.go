@@ -0,0 +1,76 @@
+package budgets
+
+import (
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssign(t *testing.T) {
+	db := setupTestDB(t)
+
+	workspace := models.Workspace{Name: "Home", ZeroBased: true}
+	assert.NoError(t, db.Create(&workspace).Error)
+	groceries := models.Budget{UserID: 1, WorkspaceID: workspace.ID, Name: "Groceries", Amount: 50000, Month: "2024-01",
+		RollOverAmount: 30000, RolloverMode: models.RolloverCarry}
+	rent := models.Budget{UserID: 1, WorkspaceID: workspace.ID, Name: "Rent", Amount: 100000, Month: "2024-01"}
+	assert.NoError(t, db.Create(&groceries).Error)
+	assert.NoError(t, db.Create(&rent).Error)
+	assert.NoError(t, db.Create(&[]models.Income{
+		{UserID: 1, WorkspaceID: workspace.ID, Description: "Salary", Amount: 200000, Currency: "EUR", BaseAmount: 200000,
+			BaseCurrency: "EUR", Date: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)},
+		{UserID: 1, WorkspaceID: workspace.ID, Description: "Salary", Amount: 200000, Currency: "EUR", BaseAmount: 200000,
+			BaseCurrency: "EUR", Date: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}).Error)
+
+	plan, err := GetPlan(db, workspace.ID, "2024-01")
+	assert.NoError(t, err)
+	assert.True(t, plan.ZeroBased)
+	assert.Equal(t, models.Money(200000), plan.Income)
+	assert.Equal(t, models.Money(150000), plan.Assigned)
+	assert.Equal(t, models.Money(50000), plan.ToAssign)
+	assert.Len(t, plan.Budgets, 2)
+	assert.NoError(t, CheckAssigned(db, workspace.ID, "2024-01", 50000))
+
+	plan, err = Assign(db, workspace.ID, "2024-01", map[uint]models.Money{groceries.ID: 100000})
+	assert.NoError(t, err)
+	assert.Equal(t, models.Money(0), plan.ToAssign)
+
+	// More than the income can't be assigned, nothing is changed
+	_, err = Assign(db, workspace.ID, "2024-01", map[uint]models.Money{rent.ID: 100001})
+	assert.ErrorIs(t, err, ErrOverAssigned)
+	assert.NoError(t, db.First(&rent, rent.ID).Error)
+	assert.Equal(t, models.Money(100000), rent.Amount)
+
+	_, err = Assign(db, workspace.ID, "2024-02", map[uint]models.Money{rent.ID: 1})
+	assert.ErrorIs(t, err, ErrUnknownBudget)
+
+	// Rolled over budgets keep their balance but start out unassigned
+	created, err := Rollover(db, workspace.ID, "2024-02")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, created)
+	plan, err = GetPlan(db, workspace.ID, "2024-02")
+	assert.NoError(t, err)
+	assert.Equal(t, models.Money(0), plan.Assigned)
+	assert.Equal(t, models.Money(200000), plan.ToAssign)
+	var february models.Budget
+	assert.NoError(t, db.Where("month = ? AND name = ?", "2024-02", "Groceries").First(&february).Error)
+	assert.Equal(t, models.Money(70000), february.CarriedAmount)
+
+	// After the income was lowered, budgets can still be lowered but not raised
+	assert.NoError(t, db.Model(&models.Income{}).Where("date < ?", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)).
+		Update("base_amount", 100000).Error)
+	plan, err = Assign(db, workspace.ID, "2024-01", map[uint]models.Money{rent.ID: 50000, groceries.ID: 100001})
+	assert.NoError(t, err)
+	assert.Equal(t, models.Money(-50001), plan.ToAssign)
+	_, err = Assign(db, workspace.ID, "2024-01", map[uint]models.Money{groceries.ID: 100002})
+	assert.ErrorIs(t, err, ErrOverAssigned)
+
+	// Without zero-based budgeting budgets can be assigned more than the income
+	assert.NoError(t, db.Model(&workspace).Update("zero_based", false).Error)
+	_, err = Assign(db, workspace.ID, "2024-01", map[uint]models.Money{rent.ID: 500000})
+	assert.NoError(t, err)
+}
@@ -0,0 +1,48 @@
+package budgets
+
+import (
+	"time"
+
+	"expense-tracker/internal/currency"
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Rebase converts the assigned and carried amounts of the workspace's budgets
+// from one currency into another at the rates of the last day of their month.
+// Run it in the transaction that changes the workspace's base currency; the
+// spent totals follow the expenses through Reconcile.
+func Rebase(tx *gorm.DB, workspaceID uint, from, to string) error {
+	if from == to {
+		return nil
+	}
+
+	var list []models.Budget
+	if err := tx.Where("workspace_id = ?", workspaceID).Find(&list).Error; err != nil {
+		return err
+	}
+	for _, budget := range list {
+		start, err := time.Parse(monthLayout, budget.Month)
+		if err != nil {
+			return err
+		}
+		date := start.AddDate(0, 1, -1)
+
+		amount, err := currency.Convert(tx, budget.Amount, from, to, date)
+		if err != nil {
+			return err
+		}
+		carried, err := currency.Convert(tx, budget.CarriedAmount, from, to, date)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&budget).UpdateColumns(map[string]interface{}{
+			"amount":         amount,
+			"carried_amount": carried,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
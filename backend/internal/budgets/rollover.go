@@ -0,0 +1,228 @@
+package budgets
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const monthLayout = "2006-01"
+
+// CurrentMonth returns the month budgets are currently booked against.
+func CurrentMonth() string {
+	return time.Now().Format(monthLayout)
+}
+
+// NextMonth returns the month following month, both in "2006-01" format.
+func NextMonth(month string) (string, error) {
+	t, err := time.Parse(monthLayout, month)
+	if err != nil {
+		return "", fmt.Errorf("invalid month %q: %v", month, err)
+	}
+	return t.AddDate(0, 1, 0).Format(monthLayout), nil
+}
+
+// PreviousMonth returns the month preceding month, both in "2006-01" format.
+func PreviousMonth(month string) (string, error) {
+	t, err := time.Parse(monthLayout, month)
+	if err != nil {
+		return "", fmt.Errorf("invalid month %q: %v", month, err)
+	}
+	return t.AddDate(0, -1, 0).Format(monthLayout), nil
+}
+
+// Rollover clones the budgets of the month before month into month for the
+// given workspace. Budgets that were already rolled over are skipped, so calling
+// it repeatedly is safe. It returns the number of budgets created. Budgets of
+// zero-based workspaces start out unassigned, their amounts are assigned
+// from the new month's income.
+func Rollover(db *gorm.DB, workspaceID uint, month string) (int, error) {
+	prev, err := PreviousMonth(month)
+	if err != nil {
+		return 0, err
+	}
+
+	zero, err := zeroBased(db, workspaceID)
+	if err != nil {
+		return 0, err
+	}
+
+	var sources []models.Budget
+	if err := db.Where("workspace_id = ? AND month = ?", workspaceID, prev).Find(&sources).Error; err != nil {
+		return 0, err
+	}
+
+	created := 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, source := range sources {
+			// Don't clone a budget twice, and leave budgets alone that a
+			// member already created for the new month by hand.
+			var count int64
+			if err := tx.Unscoped().Model(&models.Budget{}).
+				Where("source_budget_id = ? OR (workspace_id = ? AND month = ? AND name = ? AND deleted_at IS NULL)",
+					source.ID, workspaceID, month, source.Name).
+				Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				continue
+			}
+
+			budget := next(source, month, zero)
+			// The unique index on source_budget_id keeps concurrent runs
+			// (e.g. several server replicas) from cloning the same budget.
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&budget)
+			if result.Error != nil {
+				return result.Error
+			}
+			created += int(result.RowsAffected)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return created, nil
+}
+
+// CatchUp rolls the workspace's budgets forward month by month, starting
+// with the earliest month that has budgets which weren't rolled over yet and
+// ending with through. Budgets created by hand for a later month don't hide
+// the months before them.
+func CatchUp(db *gorm.DB, workspaceID uint, through string) (int, error) {
+	if _, err := time.Parse(monthLayout, through); err != nil {
+		return 0, fmt.Errorf("invalid month %q: %v", through, err)
+	}
+
+	var months []string
+	if err := db.Model(&models.Budget{}).
+		Where("workspace_id = ? AND month < ?", workspaceID, through).
+		Distinct("month").
+		Order("month").
+		Pluck("month", &months).Error; err != nil {
+		return 0, err
+	}
+
+	start := ""
+	for _, month := range months {
+		pending, err := rolloverPending(db, workspaceID, month)
+		if err != nil {
+			return 0, err
+		}
+		if pending {
+			start = month
+			break
+		}
+	}
+	if start == "" {
+		return 0, nil
+	}
+
+	total := 0
+	month := start
+	for month < through {
+		var err error
+		if month, err = NextMonth(month); err != nil {
+			return total, err
+		}
+		created, err := Rollover(db, workspaceID, month)
+		if err != nil {
+			return total, err
+		}
+		total += created
+	}
+
+	return total, nil
+}
+
+// rolloverPending reports whether the workspace has budgets in month that
+// Rollover would still clone into the following month.
+func rolloverPending(db *gorm.DB, workspaceID uint, month string) (bool, error) {
+	next, err := NextMonth(month)
+	if err != nil {
+		return false, err
+	}
+
+	var count int64
+	err = db.Model(&models.Budget{}).
+		Where("workspace_id = ? AND month = ?", workspaceID, month).
+		Where("NOT EXISTS (SELECT 1 FROM budgets clones WHERE clones.source_budget_id = budgets.id)").
+		Where(`NOT EXISTS (SELECT 1 FROM budgets others WHERE others.workspace_id = budgets.workspace_id
+			AND others.month = ? AND others.name = budgets.name AND others.deleted_at IS NULL)`, next).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// CatchUpAll runs CatchUp for every workspace that has budgets.
+func CatchUpAll(db *gorm.DB, through string) (int, error) {
+	var workspaceIDs []uint
+	if err := db.Model(&models.Budget{}).Distinct("workspace_id").Pluck("workspace_id", &workspaceIDs).Error; err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, workspaceID := range workspaceIDs {
+		created, err := CatchUp(db, workspaceID, through)
+		if err != nil {
+			return total, fmt.Errorf("rollover for workspace %d: %v", workspaceID, err)
+		}
+		total += created
+	}
+
+	return total, nil
+}
+
+// RunScheduler rolls budgets into the current month once on start and then
+// on every tick of interval until ctx is cancelled.
+func RunScheduler(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		created, err := CatchUpAll(db, CurrentMonth())
+		if err != nil {
+			log.Printf("Budget rollover failed: %v", err)
+		} else if created > 0 {
+			log.Printf("Budget rollover created %d budgets", created)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// next builds the budget for month from the previous month's source budget.
+// Zero-based budgets keep their carried balance but aren't assigned an
+// amount yet.
+func next(source models.Budget, month string, zeroBased bool) models.Budget {
+	budget := models.Budget{
+		UserID:         source.UserID,
+		WorkspaceID:    source.WorkspaceID,
+		Name:           source.Name,
+		Amount:         source.Amount,
+		Month:          month,
+		RolloverMode:   source.RolloverMode,
+		SourceBudgetID: &source.ID,
+	}
+
+	if source.RolloverMode == models.RolloverCarry {
+		// Remaining balance is positive, an overspent budget carries a
+		// negative balance into the next month.
+		budget.CarriedAmount = source.Amount + source.CarriedAmount - source.RollOverAmount
+	}
+	if zeroBased {
+		budget.Amount = 0
+	}
+
+	return budget
+}
@@ -0,0 +1,148 @@
+package budgets
+
+import (
+	"testing"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Workspace{}, &models.Budget{}, &models.Expense{}, &models.Income{}, &models.ExchangeRate{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+func TestNextMonth(t *testing.T) {
+	tests := []struct {
+		month string
+		want  string
+	}{
+		{month: "2024-01", want: "2024-02"},
+		{month: "2024-12", want: "2025-01"},
+	}
+
+	for _, tt := range tests {
+		got, err := NextMonth(tt.month)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.want, got)
+	}
+
+	_, err := NextMonth("January")
+	assert.Error(t, err)
+}
+
+func TestRollover(t *testing.T) {
+	db := setupTestDB(t)
+
+	budgets := []models.Budget{
+		{UserID: 1, WorkspaceID: 1, Name: "Groceries", Amount: 50000, Month: "2024-01", RollOverAmount: 42000, RolloverMode: models.RolloverCarry},
+		{UserID: 1, WorkspaceID: 1, Name: "Fun", Amount: 10000, Month: "2024-01", RollOverAmount: 15000, RolloverMode: models.RolloverCarry},
+		{UserID: 1, WorkspaceID: 1, Name: "Rent", Amount: 100000, Month: "2024-01", RollOverAmount: 100000, RolloverMode: models.RolloverReset},
+		{UserID: 2, WorkspaceID: 2, Name: "Groceries", Amount: 30000, Month: "2024-01"},
+	}
+	assert.NoError(t, db.Create(&budgets).Error)
+
+	created, err := Rollover(db, 1, "2024-02")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, created)
+
+	var rolled []models.Budget
+	assert.NoError(t, db.Where("workspace_id = ? AND month = ?", 1, "2024-02").Order("id").Find(&rolled).Error)
+	assert.Len(t, rolled, 3)
+
+	assert.Equal(t, "Groceries", rolled[0].Name)
+	assert.Equal(t, models.Money(50000), rolled[0].Amount)
+	assert.Equal(t, models.Money(8000), rolled[0].CarriedAmount)
+	assert.Equal(t, models.Money(0), rolled[0].RollOverAmount)
+	assert.Equal(t, budgets[0].ID, *rolled[0].SourceBudgetID)
+
+	assert.Equal(t, models.Money(-5000), rolled[1].CarriedAmount)
+	assert.Equal(t, models.Money(0), rolled[2].CarriedAmount)
+	assert.Equal(t, models.RolloverReset, rolled[2].RolloverMode)
+
+	// Running again must not create duplicates
+	created, err = Rollover(db, 1, "2024-02")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created)
+
+	// A deleted rolled-over budget is not recreated
+	assert.NoError(t, db.Delete(&rolled[1]).Error)
+	created, err = Rollover(db, 1, "2024-02")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created)
+}
+
+func TestRolloverSkipsManuallyCreatedBudgets(t *testing.T) {
+	db := setupTestDB(t)
+
+	assert.NoError(t, db.Create(&[]models.Budget{
+		{UserID: 1, WorkspaceID: 1, Name: "Groceries", Amount: 50000, Month: "2024-01"},
+		{UserID: 1, WorkspaceID: 1, Name: "Groceries", Amount: 60000, Month: "2024-02"},
+	}).Error)
+
+	created, err := Rollover(db, 1, "2024-02")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created)
+}
+
+func TestCatchUp(t *testing.T) {
+	db := setupTestDB(t)
+
+	assert.NoError(t, db.Create(&models.Budget{
+		UserID: 1, WorkspaceID: 1, Name: "Groceries", Amount: 50000, Month: "2024-01", RollOverAmount: 40000, RolloverMode: models.RolloverCarry,
+	}).Error)
+
+	created, err := CatchUp(db, 1, "2024-04")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, created)
+
+	var april models.Budget
+	assert.NoError(t, db.Where("workspace_id = ? AND month = ?", 1, "2024-04").First(&april).Error)
+	// 100 left in January, nothing spent in February and March
+	assert.Equal(t, models.Money(110000), april.CarriedAmount)
+
+	created, err = CatchUpAll(db, "2024-04")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created)
+}
+
+func TestCatchUpWithGap(t *testing.T) {
+	db := setupTestDB(t)
+
+	assert.NoError(t, db.Create(&[]models.Budget{
+		{UserID: 1, WorkspaceID: 1, Name: "Groceries", Amount: 50000, Month: "2024-01", RolloverMode: models.RolloverReset},
+		// Created by hand ahead of the rollover
+		{UserID: 1, WorkspaceID: 1, Name: "Vacation", Amount: 100000, Month: "2024-03", RolloverMode: models.RolloverReset},
+	}).Error)
+
+	created, err := CatchUp(db, 1, "2024-04")
+	assert.NoError(t, err)
+	// Groceries for February, March and April, Vacation for April
+	assert.Equal(t, 4, created)
+
+	var names []string
+	assert.NoError(t, db.Model(&models.Budget{}).Where("month = ?", "2024-02").Pluck("name", &names).Error)
+	assert.Equal(t, []string{"Groceries"}, names)
+	assert.NoError(t, db.Model(&models.Budget{}).Where("month = ?", "2024-04").Order("name").Pluck("name", &names).Error)
+	assert.Equal(t, []string{"Groceries", "Vacation"}, names)
+
+	// Everything is rolled over, nothing is left to start from
+	pending, err := rolloverPending(db, 1, "2024-01")
+	assert.NoError(t, err)
+	assert.False(t, pending)
+	created, err = CatchUp(db, 1, "2024-04")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created)
+}
@@ -0,0 +1,157 @@
+package budgets
+
+import (
+	"errors"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Correction describes a budget whose stored spent total did not match the
+// sum of its expenses.
+type Correction struct {
+	BudgetID uint         `json:"budget_id"`
+	Name     string       `json:"name"`
+	Month    string       `json:"month"`
+	Stored   models.Money `json:"stored"`
+	Actual   models.Money `json:"actual"`
+}
+
+// Lookup returns the ID of the workspace's budget with the name in month, or
+// nil if the workspace has no such budget.
+func Lookup(db *gorm.DB, workspaceID uint, name, month string) (*uint, error) {
+	var budget models.Budget
+	err := db.Select("id").
+		Where("workspace_id = ? AND name = ? AND month = ?", workspaceID, name, month).
+		First(&budget).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &budget.ID, nil
+}
+
+// Book adds the expense's amount in the base currency to the spent total of
+// its budget. If the budget was already rolled over, the balances carried
+// into the following months are updated as well. It has to run in the same
+// transaction that stores the expense.
+func Book(tx *gorm.DB, expense *models.Expense) error {
+	return addSpent(tx, expense.BudgetID, expense.BaseAmount)
+}
+
+// Unbook removes the expense's amount in the base currency from the spent
+// total of its budget. It has to run in the same transaction that changes or
+// deletes the expense.
+func Unbook(tx *gorm.DB, expense *models.Expense) error {
+	return addSpent(tx, expense.BudgetID, -expense.BaseAmount)
+}
+
+// addSpent changes the spent total in a single UPDATE, so concurrent
+// requests can't overwrite each other's changes.
+func addSpent(tx *gorm.DB, budgetID *uint, delta models.Money) error {
+	if budgetID == nil || delta == 0 {
+		return nil
+	}
+
+	if err := tx.Model(&models.Budget{}).
+		Where("id = ?", *budgetID).
+		Update("roll_over_amount", gorm.Expr("roll_over_amount + ?", delta)).Error; err != nil {
+		return err
+	}
+	return carryForward(tx, *budgetID, -delta)
+}
+
+// carryForward passes a change of a budget's remaining balance on to the
+// budgets it was rolled over into, month by month for as long as they carry
+// their balance.
+func carryForward(tx *gorm.DB, budgetID uint, delta models.Money) error {
+	for delta != 0 {
+		var source models.Budget
+		if err := tx.Select("id, rollover_mode").Where("id = ?", budgetID).Find(&source).Error; err != nil {
+			return err
+		}
+		if source.RolloverMode != models.RolloverCarry {
+			return nil
+		}
+
+		var clones []models.Budget
+		if err := tx.Select("id").Where("source_budget_id = ?", budgetID).Find(&clones).Error; err != nil {
+			return err
+		}
+		if len(clones) == 0 {
+			return nil
+		}
+		if err := tx.Model(&models.Budget{}).
+			Where("id = ?", clones[0].ID).
+			Update("carried_amount", gorm.Expr("carried_amount + ?", delta)).Error; err != nil {
+			return err
+		}
+		budgetID = clones[0].ID
+	}
+	return nil
+}
+
+// Reconcile recomputes the spent totals of all budgets of the workspace from
+// their expenses and repairs the ones that drifted. It returns the corrections
+// that were made.
+func Reconcile(db *gorm.DB, workspaceID uint) ([]Correction, error) {
+	corrections := []Correction{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var budgets []models.Budget
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("workspace_id = ?", workspaceID).
+			Order("month, id").
+			Find(&budgets).Error; err != nil {
+			return err
+		}
+
+		var sums []struct {
+			BudgetID uint
+			Total    models.Money
+		}
+		if err := tx.Model(&models.Expense{}).
+			Select("budget_id, COALESCE(SUM(base_amount), 0) AS total").
+			Where("budget_id IN (?)", tx.Model(&models.Budget{}).Select("id").Where("workspace_id = ?", workspaceID)).
+			Group("budget_id").
+			Scan(&sums).Error; err != nil {
+			return err
+		}
+
+		actual := make(map[uint]models.Money, len(sums))
+		for _, sum := range sums {
+			actual[sum.BudgetID] = sum.Total
+		}
+
+		for _, budget := range budgets {
+			stored := budget.RollOverAmount
+			if stored == actual[budget.ID] {
+				continue
+			}
+
+			if err := tx.Model(&budget).Update("roll_over_amount", actual[budget.ID]).Error; err != nil {
+				return err
+			}
+			if err := carryForward(tx, budget.ID, stored-actual[budget.ID]); err != nil {
+				return err
+			}
+			corrections = append(corrections, Correction{
+				BudgetID: budget.ID,
+				Name:     budget.Name,
+				Month:    budget.Month,
+				Stored:   stored,
+				Actual:   actual[budget.ID],
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return corrections, nil
+}
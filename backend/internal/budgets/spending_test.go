@@ -0,0 +1,109 @@
+package budgets
+
+import (
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBookAndUnbook(t *testing.T) {
+	db := setupTestDB(t)
+
+	budget := models.Budget{UserID: 1, WorkspaceID: 1, Name: "Groceries", Amount: 50000, Month: "2024-01"}
+	assert.NoError(t, db.Create(&budget).Error)
+
+	expense := models.Expense{UserID: 1, WorkspaceID: 1, BudgetID: &budget.ID, Amount: 1999, BaseAmount: 1999, Description: "Market", Date: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)}
+	assert.NoError(t, Book(db, &expense))
+	assert.NoError(t, Book(db, &expense))
+	assert.NoError(t, Unbook(db, &expense))
+
+	assert.NoError(t, db.First(&budget, budget.ID).Error)
+	assert.Equal(t, models.Money(1999), budget.RollOverAmount)
+
+	// Expenses without a budget are ignored
+	assert.NoError(t, Book(db, &models.Expense{Amount: 100}))
+}
+
+func TestBookIntoRolledOverMonth(t *testing.T) {
+	db := setupTestDB(t)
+
+	budget := models.Budget{UserID: 1, WorkspaceID: 1, Name: "Groceries", Amount: 50000, Month: "2024-01", RolloverMode: models.RolloverCarry}
+	assert.NoError(t, db.Create(&budget).Error)
+	_, err := CatchUp(db, 1, "2024-03")
+	assert.NoError(t, err)
+
+	// A late January expense lowers the balance carried into February and
+	// on into March
+	expense := models.Expense{UserID: 1, WorkspaceID: 1, BudgetID: &budget.ID, Amount: 2000, BaseAmount: 2000, Description: "Market", Date: time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC)}
+	assert.NoError(t, Book(db, &expense))
+
+	carried := func(month string) models.Money {
+		var b models.Budget
+		assert.NoError(t, db.Where("month = ?", month).First(&b).Error)
+		return b.CarriedAmount
+	}
+	assert.Equal(t, models.Money(48000), carried("2024-02"))
+	assert.Equal(t, models.Money(98000), carried("2024-03"))
+
+	// Budgets that reset don't pass it on
+	assert.NoError(t, db.Model(&models.Budget{}).Where("month = ?", "2024-02").Update("rollover_mode", models.RolloverReset).Error)
+	assert.NoError(t, Unbook(db, &expense))
+	assert.Equal(t, models.Money(50000), carried("2024-02"))
+	assert.Equal(t, models.Money(98000), carried("2024-03"))
+
+	// Reconciling corrects the carried balances along with the spent totals
+	assert.NoError(t, addSpent(db, &budget.ID, 1000))
+	assert.Equal(t, models.Money(49000), carried("2024-02"))
+	_, err = Reconcile(db, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, models.Money(50000), carried("2024-02"))
+}
+
+func TestReconcile(t *testing.T) {
+	db := setupTestDB(t)
+
+	budgets := []models.Budget{
+		{UserID: 1, WorkspaceID: 1, Name: "Groceries", Amount: 50000, Month: "2024-01", RollOverAmount: 12345},
+		{UserID: 1, WorkspaceID: 1, Name: "Rent", Amount: 100000, Month: "2024-01", RollOverAmount: 100000},
+		{UserID: 1, WorkspaceID: 1, Name: "Fun", Amount: 10000, Month: "2024-01", RollOverAmount: 500},
+		{UserID: 2, WorkspaceID: 2, Name: "Groceries", Amount: 50000, Month: "2024-01", RollOverAmount: 999},
+	}
+	assert.NoError(t, db.Create(&budgets).Error)
+
+	date := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	expenses := []models.Expense{
+		{UserID: 1, WorkspaceID: 1, BudgetID: &budgets[0].ID, Amount: 2000, BaseAmount: 2000, Description: "Market", Date: date},
+		{UserID: 1, WorkspaceID: 1, BudgetID: &budgets[0].ID, Amount: 3000, BaseAmount: 3000, Description: "Market", Date: date},
+		{UserID: 1, WorkspaceID: 1, BudgetID: &budgets[1].ID, Amount: 100000, BaseAmount: 100000, Description: "Rent", Date: date},
+		{UserID: 1, WorkspaceID: 1, Amount: 700, BaseAmount: 700, Description: "Unbudgeted", Date: date},
+	}
+	assert.NoError(t, db.Create(&expenses).Error)
+
+	// Deleted expenses don't count
+	deleted := models.Expense{UserID: 1, WorkspaceID: 1, BudgetID: &budgets[0].ID, Amount: 4000, BaseAmount: 4000, Description: "Refunded", Date: date}
+	assert.NoError(t, db.Create(&deleted).Error)
+	assert.NoError(t, db.Delete(&deleted).Error)
+
+	corrections, err := Reconcile(db, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []Correction{
+		{BudgetID: budgets[0].ID, Name: "Groceries", Month: "2024-01", Stored: 12345, Actual: 5000},
+		{BudgetID: budgets[2].ID, Name: "Fun", Month: "2024-01", Stored: 500, Actual: 0},
+	}, corrections)
+
+	var groceries models.Budget
+	assert.NoError(t, db.First(&groceries, budgets[0].ID).Error)
+	assert.Equal(t, models.Money(5000), groceries.RollOverAmount)
+
+	// Other users' budgets are untouched
+	var other models.Budget
+	assert.NoError(t, db.First(&other, budgets[3].ID).Error)
+	assert.Equal(t, models.Money(999), other.RollOverAmount)
+
+	corrections, err = Reconcile(db, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, corrections)
+}
@@ -0,0 +1,143 @@
+package categories
+
+import (
+	"errors"
+	"strings"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrNotFound = errors.New("category not found")
+	ErrCycle    = errors.New("a category can't be its own ancestor")
+)
+
+// Descendants returns the ID of the category and the IDs of all categories
+// below it.
+func Descendants(db *gorm.DB, workspaceID, categoryID uint) ([]uint, error) {
+	var categories []models.Category
+	if err := db.Select("id", "parent_id").Where("workspace_id = ?", workspaceID).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint][]uint)
+	found := false
+	for _, category := range categories {
+		if category.ID == categoryID {
+			found = true
+		}
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category.ID)
+		}
+	}
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	ids := []uint{categoryID}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+
+	return ids, nil
+}
+
+// CheckParent verifies that parentID is a category of the workspace and that
+// making it the parent of categoryID doesn't create a cycle. A categoryID of
+// zero stands for a category that doesn't exist yet.
+func CheckParent(db *gorm.DB, workspaceID, categoryID uint, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+
+	if categoryID != 0 {
+		descendants, err := Descendants(db, workspaceID, categoryID)
+		if err != nil {
+			return err
+		}
+		for _, id := range descendants {
+			if id == *parentID {
+				return ErrCycle
+			}
+		}
+	}
+
+	var count int64
+	if err := db.Model(&models.Category{}).Where("id = ? AND workspace_id = ?", *parentID, workspaceID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Tree nests the categories below their parents and returns the roots.
+func Tree(categories []models.Category) []models.Category {
+	children := make(map[uint][]models.Category)
+	for _, category := range categories {
+		if category.ParentID != nil {
+			children[*category.ParentID] = append(children[*category.ParentID], category)
+		}
+	}
+
+	var build func(category models.Category) models.Category
+	build = func(category models.Category) models.Category {
+		for _, child := range children[category.ID] {
+			category.Children = append(category.Children, build(child))
+		}
+		return category
+	}
+
+	known := make(map[uint]bool, len(categories))
+	for _, category := range categories {
+		known[category.ID] = true
+	}
+
+	roots := []models.Category{}
+	for _, category := range categories {
+		if category.ParentID == nil || !known[*category.ParentID] {
+			roots = append(roots, build(category))
+		}
+	}
+	return roots
+}
+
+// ResolveTags returns the workspace's tags with the given names, creating the
+// ones that don't exist yet on behalf of the user. Names are trimmed and
+// duplicates ignored.
+func ResolveTags(db *gorm.DB, workspaceID, userID uint, names []string) ([]models.Tag, error) {
+	seen := make(map[string]bool, len(names))
+	tags := make([]models.Tag, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		tags = append(tags, models.Tag{UserID: userID, WorkspaceID: workspaceID, Name: name})
+	}
+	if len(tags) == 0 {
+		return tags, nil
+	}
+
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	// Tags that already existed weren't inserted and have no ID yet
+	names = make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	tags = tags[:0]
+	if err := db.Where("workspace_id = ? AND name IN ?", workspaceID, names).Order("name").Find(&tags).Error; err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
@@ -0,0 +1,105 @@
+package categories
+
+import (
+	"testing"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Category{}, &models.Tag{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+// createTree creates Home > Utilities > Power and Food in workspace 1.
+func createTree(t *testing.T, db *gorm.DB) (home, utilities, power, food models.Category) {
+	home = models.Category{UserID: 1, WorkspaceID: 1, Name: "Home"}
+	food = models.Category{UserID: 1, WorkspaceID: 1, Name: "Food"}
+	assert.NoError(t, db.Create(&home).Error)
+	assert.NoError(t, db.Create(&food).Error)
+	utilities = models.Category{UserID: 1, WorkspaceID: 1, Name: "Utilities", ParentID: &home.ID}
+	assert.NoError(t, db.Create(&utilities).Error)
+	power = models.Category{UserID: 1, WorkspaceID: 1, Name: "Power", ParentID: &utilities.ID}
+	assert.NoError(t, db.Create(&power).Error)
+	return
+}
+
+func TestDescendants(t *testing.T) {
+	db := setupTestDB(t)
+	home, utilities, power, food := createTree(t, db)
+
+	ids, err := Descendants(db, 1, home.ID)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []uint{home.ID, utilities.ID, power.ID}, ids)
+
+	ids, err = Descendants(db, 1, food.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint{food.ID}, ids)
+
+	_, err = Descendants(db, 2, home.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCheckParent(t *testing.T) {
+	db := setupTestDB(t)
+	home, utilities, power, food := createTree(t, db)
+
+	assert.NoError(t, CheckParent(db, 1, 0, &home.ID))
+	assert.NoError(t, CheckParent(db, 1, utilities.ID, &food.ID))
+	assert.NoError(t, CheckParent(db, 1, power.ID, nil))
+	assert.ErrorIs(t, CheckParent(db, 1, home.ID, &power.ID), ErrCycle)
+	assert.ErrorIs(t, CheckParent(db, 1, home.ID, &home.ID), ErrCycle)
+	assert.ErrorIs(t, CheckParent(db, 2, 0, &home.ID), ErrNotFound)
+}
+
+func TestTree(t *testing.T) {
+	db := setupTestDB(t)
+	createTree(t, db)
+
+	var list []models.Category
+	assert.NoError(t, db.Order("name").Find(&list).Error)
+
+	roots := Tree(list)
+	assert.Len(t, roots, 2)
+	assert.Equal(t, "Food", roots[0].Name)
+	assert.Equal(t, "Home", roots[1].Name)
+	assert.Equal(t, "Utilities", roots[1].Children[0].Name)
+	assert.Equal(t, "Power", roots[1].Children[0].Children[0].Name)
+}
+
+func TestResolveTags(t *testing.T) {
+	db := setupTestDB(t)
+
+	tags, err := ResolveTags(db, 1, 1, []string{"travel", " work ", "travel", ""})
+	assert.NoError(t, err)
+	assert.Len(t, tags, 2)
+
+	// Members of a workspace share its tags
+	again, err := ResolveTags(db, 1, 2, []string{"work", "new"})
+	assert.NoError(t, err)
+	assert.Len(t, again, 2)
+	assert.Equal(t, "new", again[0].Name)
+	assert.Equal(t, tags[1].ID, again[1].ID)
+
+	// Tags are per workspace
+	other, err := ResolveTags(db, 2, 1, []string{"work"})
+	assert.NoError(t, err)
+	assert.NotEqual(t, tags[1].ID, other[0].ID)
+
+	var count int64
+	db.Model(&models.Tag{}).Count(&count)
+	assert.Equal(t, int64(4), count)
+}
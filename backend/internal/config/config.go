@@ -1,15 +1,103 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/auth"
+	"expense-tracker/internal/mail"
+	"expense-tracker/internal/storage"
+)
 
 type Config struct {
-	Port string
+	AppEnv            string // development, test or production
+	Port              string
+	RolloverInterval  time.Duration
+	RecurringInterval time.Duration
+	ExchangeRatesFile string
+	AppURL            string // Base URL of the frontend, used for links in emails
+	RequireActivation bool   // Block logins until the email address is verified
+	Mail              mail.Config
+	OIDC              []auth.OIDCProvider // Identity providers users can log in with
+	JWTSecret         string              // HMAC secret, signs tokens only without JWTKeys
+	JWTKeys           []string            // PEM key files, the first private key signs tokens
+	RateLimitStore    string              // memory, or postgres to share rate limits between servers
+	TrustedProxies    []string            // Proxies whose X-Forwarded-For is trusted for the client IP
+	AdminEmails       []string            // Verified accounts that may change the exchange rates shared by all workspaces
+	AutoMigrate       bool                // Apply pending migrations on start instead of refusing to start
+	Storage           storage.Config      // Where attachments of expenses are stored
+	MaxAttachmentSize int64               // Largest file that can be attached, in bytes
+}
+
+// Development reports whether the server runs in development or tests, where
+// insecure defaults are fine. It has to be enabled explicitly through APP_ENV.
+func (c Config) Development() bool {
+	return c.AppEnv == "development" || c.AppEnv == "test"
 }
 
 func Load() Config {
+	appURL := getEnvWithDefault("APP_URL", "http://localhost:3000")
 	return Config{
-		Port: getEnvWithDefault("PORT", "8080"),
+		AppEnv:            strings.ToLower(getEnvWithDefault("APP_ENV", "production")),
+		Port:              getEnvWithDefault("PORT", "8080"),
+		RolloverInterval:  getDurationWithDefault("ROLLOVER_INTERVAL", time.Hour),
+		RecurringInterval: getDurationWithDefault("RECURRING_INTERVAL", time.Hour),
+		ExchangeRatesFile: os.Getenv("EXCHANGE_RATES_FILE"),
+		AppURL:            appURL,
+		RequireActivation: getBoolWithDefault("REQUIRE_ACTIVATION", false),
+		Mail: mail.Config{
+			Driver:   getEnvWithDefault("MAIL_DRIVER", "log"),
+			From:     getEnvWithDefault("MAIL_FROM", "noreply@localhost"),
+			Dir:      os.Getenv("MAIL_DIR"),
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     getEnvWithDefault("SMTP_PORT", "587"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		},
+		OIDC:           loadOIDCProviders(appURL),
+		JWTSecret:      os.Getenv("JWT_SECRET"),
+		JWTKeys:        splitList(os.Getenv("JWT_KEYS")),
+		RateLimitStore: getEnvWithDefault("RATE_LIMIT_STORE", "memory"),
+		TrustedProxies: splitList(os.Getenv("TRUSTED_PROXIES")),
+		AdminEmails:    splitList(os.Getenv("ADMIN_EMAILS")),
+		AutoMigrate:    getBoolWithDefault("AUTO_MIGRATE", true),
+		Storage: storage.Config{
+			Driver:    getEnvWithDefault("STORAGE_DRIVER", "local"),
+			Dir:       getEnvWithDefault("STORAGE_DIR", "uploads"),
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    getEnvWithDefault("S3_REGION", "us-east-1"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+			PathStyle: getBoolWithDefault("S3_PATH_STYLE", true),
+		},
+		MaxAttachmentSize: getInt64WithDefault("MAX_ATTACHMENT_SIZE", 10<<20),
+	}
+}
+
+// loadOIDCProviders reads the providers listed in OIDC_PROVIDERS. Each one is
+// configured with OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and
+// optionally _REDIRECT_URL and _SCOPES.
+func loadOIDCProviders(appURL string) []auth.OIDCProvider {
+	var providers []auth.OIDCProvider
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		providers = append(providers, auth.OIDCProvider{
+			Name:         name,
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  getEnvWithDefault(prefix+"REDIRECT_URL", strings.TrimRight(appURL, "/")+"/auth/oidc/"+name+"/callback"),
+			Scopes:       strings.Fields(strings.ReplaceAll(os.Getenv(prefix+"SCOPES"), ",", " ")),
+		})
 	}
+	return providers
 }
 
 func getEnvWithDefault(key, defaultValue string) string {
@@ -18,3 +106,35 @@ func getEnvWithDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getDurationWithDefault(key string, defaultValue time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+func getBoolWithDefault(key string, defaultValue bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return defaultValue
+}
+
+func getInt64WithDefault(key string, defaultValue int64) int64 {
+	if value, err := strconv.ParseInt(os.Getenv(key), 10, 64); err == nil && value > 0 {
+		return value
+	}
+	return defaultValue
+}
+
+// splitList splits a comma separated list, leaving out empty entries.
+func splitList(value string) []string {
+	var list []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
@@ -58,3 +58,50 @@ func TestGetEnvWithDefault(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadOIDCProviders(t *testing.T) {
+	t.Setenv("OIDC_PROVIDERS", "company, azure-ad")
+	t.Setenv("OIDC_COMPANY_ISSUER", "https://idp.example.com")
+	t.Setenv("OIDC_COMPANY_CLIENT_ID", "expense-tracker")
+	t.Setenv("OIDC_AZURE_AD_SCOPES", "openid,email")
+
+	providers := loadOIDCProviders("https://expenses.example.com/")
+	if len(providers) != 2 {
+		t.Fatalf("Expected 2 providers, got %d", len(providers))
+	}
+	if providers[0].Issuer != "https://idp.example.com" || providers[0].ClientID != "expense-tracker" {
+		t.Errorf("Unexpected provider %+v", providers[0])
+	}
+	if providers[0].RedirectURL != "https://expenses.example.com/auth/oidc/company/callback" {
+		t.Errorf("Unexpected redirect URL %s", providers[0].RedirectURL)
+	}
+	if providers[1].Name != "azure-ad" || len(providers[1].Scopes) != 2 {
+		t.Errorf("Unexpected provider %+v", providers[1])
+	}
+}
+
+func TestLoadDefaultsToProduction(t *testing.T) {
+	t.Setenv("APP_ENV", "")
+
+	// Insecure defaults need development to be enabled explicitly
+	if Load().Development() {
+		t.Errorf("Servers should default to production")
+	}
+	t.Setenv("APP_ENV", "development")
+	if !Load().Development() {
+		t.Errorf("APP_ENV=development should be development")
+	}
+}
+
+func TestLoadJWTKeys(t *testing.T) {
+	t.Setenv("APP_ENV", "Production")
+	t.Setenv("JWT_KEYS", "keys/new.pem, keys/old.pem,")
+
+	config := Load()
+	if config.Development() {
+		t.Errorf("Production shouldn't be development")
+	}
+	if len(config.JWTKeys) != 2 || config.JWTKeys[0] != "keys/new.pem" || config.JWTKeys[1] != "keys/old.pem" {
+		t.Errorf("Unexpected JWT keys %v", config.JWTKeys)
+	}
+}
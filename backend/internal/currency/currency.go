@@ -0,0 +1,194 @@
+package currency
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// NoRateError is returned when no exchange rate is known for a currency at
+// or before the requested date.
+type NoRateError struct {
+	Currency string
+	Date     time.Time
+}
+
+func (e *NoRateError) Error() string {
+	return fmt.Sprintf("no exchange rate for %s on or before %s", e.Currency, e.Date.Format("2006-01-02"))
+}
+
+// Normalize upper-cases a currency code and checks that it consists of three
+// letters as defined by ISO 4217.
+func Normalize(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", fmt.Errorf("invalid currency code %q", code)
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", fmt.Errorf("invalid currency code %q", code)
+		}
+	}
+	return code, nil
+}
+
+// Rate returns the number of units of currency one unit of the reference
+// currency was worth on date, using the latest known rate on or before it.
+func Rate(db *gorm.DB, currency string, date time.Time) (float64, error) {
+	if currency == models.ReferenceCurrency {
+		return 1, nil
+	}
+
+	var rate models.ExchangeRate
+	err := db.Where("currency = ? AND date <= ?", currency, date).
+		Order("date DESC").
+		First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, &NoRateError{Currency: currency, Date: date}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return rate.Rate, nil
+}
+
+// Convert converts amount from one currency to another at the rates of date.
+// The result is rounded to the nearest minor unit.
+func Convert(db *gorm.DB, amount models.Money, from, to string, date time.Time) (models.Money, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	fromRate, err := Rate(db, from, date)
+	if err != nil {
+		return 0, err
+	}
+	toRate, err := Rate(db, to, date)
+	if err != nil {
+		return 0, err
+	}
+
+	// A single multiplication followed by rounding, so no error accumulates
+	// in the stored amount.
+	return models.Money(math.Round(float64(amount) * toRate / fromRate)), nil
+}
+
+// ApplyBaseAmount converts the expense's amount into the base currency of its
+// workspace at the expense's date and stores it as the expense's base amount.
+func ApplyBaseAmount(db *gorm.DB, expense *models.Expense) error {
+	var workspace models.Workspace
+	if err := db.Select("id", "base_currency").First(&workspace, expense.WorkspaceID).Error; err != nil {
+		return err
+	}
+
+	return convertExpense(db, expense, workspace.BaseCurrency)
+}
+
+func convertExpense(db *gorm.DB, expense *models.Expense, baseCurrency string) error {
+	if expense.Currency == "" {
+		expense.Currency = baseCurrency
+	}
+
+	baseAmount, err := Convert(db, expense.Amount, expense.Currency, baseCurrency, expense.Date)
+	if err != nil {
+		return err
+	}
+
+	expense.BaseAmount = baseAmount
+	expense.BaseCurrency = baseCurrency
+	return nil
+}
+
+// ApplyIncomeBaseAmount converts the income's amount into the base currency
+// of its workspace at the income's date, like ApplyBaseAmount does for
+// expenses.
+func ApplyIncomeBaseAmount(db *gorm.DB, income *models.Income) error {
+	var workspace models.Workspace
+	if err := db.Select("id", "base_currency").First(&workspace, income.WorkspaceID).Error; err != nil {
+		return err
+	}
+
+	return convertIncome(db, income, workspace.BaseCurrency)
+}
+
+func convertIncome(db *gorm.DB, income *models.Income, baseCurrency string) error {
+	if income.Currency == "" {
+		income.Currency = baseCurrency
+	}
+
+	baseAmount, err := Convert(db, income.Amount, income.Currency, baseCurrency, income.Date)
+	if err != nil {
+		return err
+	}
+
+	income.BaseAmount = baseAmount
+	income.BaseCurrency = baseCurrency
+	return nil
+}
+
+// Store inserts the rates, replacing known rates of the same currency and
+// date.
+func Store(db *gorm.DB, rates []models.ExchangeRate) error {
+	if len(rates) == 0 {
+		return nil
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).CreateInBatches(rates, 500).Error
+}
+
+// Rebase converts all expenses and income of the workspace into the
+// workspace's current base currency again, e.g. after the base currency was
+// changed.
+func Rebase(db *gorm.DB, workspaceID uint) error {
+	var workspace models.Workspace
+	if err := db.Select("id", "base_currency").First(&workspace, workspaceID).Error; err != nil {
+		return err
+	}
+
+	var incomes []models.Income
+	if err := db.Where("workspace_id = ?", workspaceID).FindInBatches(&incomes, 500, func(_ *gorm.DB, _ int) error {
+		for i := range incomes {
+			if err := convertIncome(db, &incomes[i], workspace.BaseCurrency); err != nil {
+				return err
+			}
+			if err := db.Model(&incomes[i]).
+				UpdateColumns(map[string]interface{}{
+					"base_amount":   incomes[i].BaseAmount,
+					"base_currency": incomes[i].BaseCurrency,
+				}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error; err != nil {
+		return err
+	}
+
+	var expenses []models.Expense
+	return db.Where("workspace_id = ?", workspaceID).FindInBatches(&expenses, 500, func(_ *gorm.DB, _ int) error {
+		for i := range expenses {
+			if err := convertExpense(db, &expenses[i], workspace.BaseCurrency); err != nil {
+				return err
+			}
+			if err := db.Model(&expenses[i]).
+				UpdateColumns(map[string]interface{}{
+					"base_amount":   expenses[i].BaseAmount,
+					"base_currency": expenses[i].BaseCurrency,
+				}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+}
@@ -0,0 +1,147 @@
+package currency
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Workspace{}, &models.Expense{}, &models.Income{}, &models.ExchangeRate{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+func date(value string) time.Time {
+	d, _ := time.Parse("2006-01-02", value)
+	return d
+}
+
+const ecbXML = `<?xml version="1.0" encoding="UTF-8"?>
+<gesmes:Envelope xmlns:gesmes="http://www.gesmes.org/xml/2002-08-01" xmlns="http://www.ecb.int/vocabulary/2002-08-01/eurofxref">
+	<gesmes:subject>Reference rates</gesmes:subject>
+	<Cube>
+		<Cube time="2024-01-03">
+			<Cube currency="USD" rate="1.0919"/>
+			<Cube currency="JPY" rate="155.52"/>
+		</Cube>
+		<Cube time="2024-01-02">
+			<Cube currency="USD" rate="1.0956"/>
+			<Cube currency="JPY" rate="155.65"/>
+		</Cube>
+	</Cube>
+</gesmes:Envelope>`
+
+const ecbCSV = `Date,USD,JPY,BGN,
+2024-01-03,1.0919,155.52,N/A,
+2024-01-02,1.0956,155.65,1.9558,
+`
+
+func TestParseECB(t *testing.T) {
+	rates, err := ParseECB(strings.NewReader(ecbXML))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 4)
+	assert.Equal(t, models.ExchangeRate{Currency: "USD", Date: date("2024-01-03"), Rate: 1.0919}, rates[0])
+
+	rates, err = ParseECB(strings.NewReader(ecbCSV))
+	assert.NoError(t, err)
+	assert.Len(t, rates, 5)
+	assert.Equal(t, models.ExchangeRate{Currency: "JPY", Date: date("2024-01-02"), Rate: 155.65}, rates[3])
+
+	_, err = ParseECB(strings.NewReader("Currency,Rate\nUSD,1.1\n"))
+	assert.Error(t, err)
+}
+
+func TestConvert(t *testing.T) {
+	db := setupTestDB(t)
+
+	rates, err := ParseECB(strings.NewReader(ecbXML))
+	assert.NoError(t, err)
+	assert.NoError(t, Store(db, rates))
+
+	// Storing again replaces the rates instead of failing
+	assert.NoError(t, Store(db, rates))
+
+	tests := []struct {
+		name   string
+		amount models.Money
+		from   string
+		to     string
+		date   string
+		want   models.Money
+	}{
+		{name: "same currency", amount: 1234, from: "USD", to: "USD", date: "2023-01-01", want: 1234},
+		{name: "to reference", amount: 10956, from: "USD", to: "EUR", date: "2024-01-02", want: 10000},
+		{name: "from reference", amount: 10000, from: "EUR", to: "USD", date: "2024-01-03", want: 10919},
+		{name: "cross rate", amount: 10000, from: "USD", to: "JPY", date: "2024-01-03", want: 1424306},
+		{name: "uses latest earlier rate", amount: 10000, from: "EUR", to: "USD", date: "2024-01-06", want: 10919},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Convert(db, tt.amount, tt.from, tt.to, date(tt.date))
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	_, err = Convert(db, 100, "USD", "EUR", date("2023-12-31"))
+	var noRate *NoRateError
+	assert.True(t, errors.As(err, &noRate))
+	assert.Equal(t, "USD", noRate.Currency)
+}
+
+func TestNormalize(t *testing.T) {
+	code, err := Normalize(" usd ")
+	assert.NoError(t, err)
+	assert.Equal(t, "USD", code)
+
+	_, err = Normalize("US")
+	assert.Error(t, err)
+	_, err = Normalize("U$D")
+	assert.Error(t, err)
+}
+
+func TestRebase(t *testing.T) {
+	db := setupTestDB(t)
+	assert.NoError(t, Store(db, []models.ExchangeRate{{Currency: "USD", Date: date("2024-01-02"), Rate: 1.1}}))
+
+	workspace := models.Workspace{Name: "Home", BaseCurrency: "EUR"}
+	assert.NoError(t, db.Create(&workspace).Error)
+
+	expense := models.Expense{UserID: 1, WorkspaceID: workspace.ID, Amount: 1100, Currency: "USD", Description: "Taxi", Date: date("2024-01-05")}
+	assert.NoError(t, ApplyBaseAmount(db, &expense))
+	assert.Equal(t, models.Money(1000), expense.BaseAmount)
+	assert.NoError(t, db.Create(&expense).Error)
+
+	income := models.Income{UserID: 1, WorkspaceID: workspace.ID, Amount: 220000, Description: "Salary", Date: date("2024-01-05")}
+	assert.NoError(t, ApplyIncomeBaseAmount(db, &income))
+	assert.Equal(t, "EUR", income.Currency)
+	assert.Equal(t, models.Money(220000), income.BaseAmount)
+	assert.NoError(t, db.Create(&income).Error)
+
+	assert.NoError(t, db.Model(&workspace).Update("base_currency", "USD").Error)
+	assert.NoError(t, Rebase(db, workspace.ID))
+
+	assert.NoError(t, db.First(&expense, expense.ID).Error)
+	assert.Equal(t, models.Money(1100), expense.BaseAmount)
+	assert.Equal(t, "USD", expense.BaseCurrency)
+	assert.NoError(t, db.First(&income, income.ID).Error)
+	assert.Equal(t, models.Money(242000), income.BaseAmount)
+	assert.Equal(t, "USD", income.BaseCurrency)
+}
@@ -0,0 +1,146 @@
+package currency
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ecbEnvelope matches the XML published by the ECB, e.g.
+// https://www.ecb.europa.eu/stats/eurofxref/eurofxref-hist.xml
+type ecbEnvelope struct {
+	Days []struct {
+		Time  string `xml:"time,attr"`
+		Rates []struct {
+			Currency string `xml:"currency,attr"`
+			Rate     string `xml:"rate,attr"`
+		} `xml:"Cube"`
+	} `xml:"Cube>Cube"`
+}
+
+// ParseECB reads reference rates in the ECB's XML or CSV format. The format
+// is detected from the content.
+func ParseECB(r io.Reader) ([]models.ExchangeRate, error) {
+	br := bufio.NewReader(r)
+	start, err := br.Peek(64)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(bytes.TrimPrefix(start, []byte("\xef\xbb\xbf"))), []byte("<")) {
+		return parseECBXML(br)
+	}
+	return parseECBCSV(br)
+}
+
+func parseECBXML(r io.Reader) ([]models.ExchangeRate, error) {
+	var envelope ecbEnvelope
+	if err := xml.NewDecoder(r).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("invalid ECB XML: %v", err)
+	}
+
+	var rates []models.ExchangeRate
+	for _, day := range envelope.Days {
+		date, err := time.Parse("2006-01-02", day.Time)
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", day.Time)
+		}
+		for _, entry := range day.Rates {
+			rate, err := parseRate(entry.Currency, entry.Rate, date)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, rate)
+		}
+	}
+
+	return rates, nil
+}
+
+// parseECBCSV reads the ECB's CSV layout, one row per day with a column per
+// currency: "Date,USD,JPY,..." followed by "2024-01-02,1.0956,155.65,...".
+func parseECBCSV(r io.Reader) ([]models.ExchangeRate, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid ECB CSV: %v", err)
+	}
+	if len(header) < 2 || !strings.EqualFold(strings.TrimPrefix(header[0], "\ufeff"), "date") {
+		return nil, fmt.Errorf("invalid ECB CSV: first column must be Date")
+	}
+
+	var rates []models.ExchangeRate
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid ECB CSV: %v", err)
+		}
+
+		date, err := time.Parse("2006-01-02", strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, fmt.Errorf("invalid date %q", record[0])
+		}
+
+		for i := 1; i < len(record) && i < len(header); i++ {
+			value := strings.TrimSpace(record[i])
+			// The ECB marks days without a rate as N/A and ends lines with a comma
+			if value == "" || value == "N/A" || strings.TrimSpace(header[i]) == "" {
+				continue
+			}
+			rate, err := parseRate(header[i], value, date)
+			if err != nil {
+				return nil, err
+			}
+			rates = append(rates, rate)
+		}
+	}
+
+	return rates, nil
+}
+
+func parseRate(code, value string, date time.Time) (models.ExchangeRate, error) {
+	currency, err := Normalize(code)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+
+	rate, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || rate <= 0 {
+		return models.ExchangeRate{}, fmt.Errorf("invalid rate %q for %s", value, currency)
+	}
+
+	return models.ExchangeRate{Currency: currency, Date: date, Rate: rate}, nil
+}
+
+// LoadFile stores the rates of an ECB XML or CSV file.
+func LoadFile(db *gorm.DB, path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	rates, err := ParseECB(f)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(rates), Store(db, rates)
+}
@@ -0,0 +1,18 @@
+package database
+
+import (
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// backfillBaseAmounts fills the base amount of expenses created before
+// expenses had a currency. Those were always in the user's base currency.
+func backfillBaseAmounts(db *gorm.DB) error {
+	return db.Model(&models.Expense{}).
+		Where("base_currency IS NULL OR base_currency = ''").
+		UpdateColumns(map[string]interface{}{
+			"base_amount":   gorm.Expr("amount"),
+			"base_currency": gorm.Expr("currency"),
+		}).Error
+}
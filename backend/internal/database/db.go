@@ -2,41 +2,34 @@ package database
 
 import (
 	"fmt"
-	"log"
 	"os"
 
-	"expense-tracker/internal/models"
-
 	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+// InitDB connects to the database selected by DB_DRIVER, postgres by default
+// or sqlite for an embedded database file. The schema is set up by the
+// migrations, see NewMigrator.
 func InitDB() (*gorm.DB, error) {
-	// Get database connection details from environment variables
-	host := os.Getenv("DB_HOST")
-	if host == "" {
-		host = "localhost"
-	}
-
-	port := os.Getenv("DB_PORT")
-	if port == "" {
-		port = "5432"
-	}
-
-	user := os.Getenv("DB_USER")
-	if user == "" {
-		user = "postgres"
-	}
-
-	password := os.Getenv("DB_PASSWORD")
-	if password == "" {
-		password = "postgres"
+	switch driver := getEnvWithDefault("DB_DRIVER", "postgres"); driver {
+	case "postgres":
+		return openPostgres()
+	case "sqlite":
+		return OpenSQLite(getEnvWithDefault("DB_PATH", "expense_tracker.db"))
+	default:
+		return nil, fmt.Errorf("unknown database driver %q", driver)
 	}
+}
 
-	dbname := os.Getenv("DB_NAME")
-	if dbname == "" {
-		dbname = "expense_tracker"
-	}
+func openPostgres() (*gorm.DB, error) {
+	// Get database connection details from environment variables
+	host := getEnvWithDefault("DB_HOST", "localhost")
+	port := getEnvWithDefault("DB_PORT", "5432")
+	user := getEnvWithDefault("DB_USER", "postgres")
+	password := getEnvWithDefault("DB_PASSWORD", "postgres")
+	dbname := getEnvWithDefault("DB_NAME", "expense_tracker")
 
 	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		host, port, user, password, dbname)
@@ -46,12 +39,26 @@ func InitDB() (*gorm.DB, error) {
 		return nil, fmt.Errorf("failed to connect to database: %v", err)
 	}
 
-	// Auto-migrate the schema - TODO(cbeneke): Handle schema changes in a ArgoCD pre-sync hook
-	err = db.AutoMigrate(&models.User{}, &models.Budget{}, &models.Expense{})
+	return db, nil
+}
+
+// OpenSQLite opens the SQLite database file at path. The write-ahead log lets
+// requests read while another one writes, and transactions take the write
+// lock right away, so that concurrent ones wait for each other instead of
+// failing when they start to write.
+func OpenSQLite(path string) (*gorm.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on&_txlock=immediate", path)
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	if err != nil {
-		log.Printf("Failed to migrate database: %v", err)
-		return nil, err
+		return nil, fmt.Errorf("failed to open database: %v", err)
 	}
 
 	return db, nil
 }
+
+func getEnvWithDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
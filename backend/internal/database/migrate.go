@@ -0,0 +1,39 @@
+package database
+
+import (
+	"embed"
+	"fmt"
+
+	"expense-tracker/internal/migrations"
+	"expense-tracker/internal/search"
+
+	"gorm.io/gorm"
+)
+
+// sqlMigrations holds the schema migrations of each supported database,
+// in a directory named after the gorm dialector.
+//
+//go:embed migrations
+var sqlMigrations embed.FS
+
+// dataMigrations are the migrations written in Go. They share the version
+// numbers with the SQL migrations and run in between them in order.
+var dataMigrations = []migrations.Migration{
+	{Version: 2, Name: "money_to_minor_units", Up: migrateMoneyToMinorUnits},
+	{Version: 3, Name: "backfill_base_amounts", Up: backfillBaseAmounts},
+	{Version: 4, Name: "backfill_workspaces", Up: backfillWorkspaces},
+	// The FTS5 index of SQLite, PostgreSQL's index is created by 0006_expense_search
+	{Version: 7, Name: "search_index", Up: search.CreateIndex, Down: search.DropIndex},
+	{Version: 10, Name: "search_index_deleted_budgets", Up: search.IndexDeletedBudgets, Down: search.UnindexDeletedBudgets},
+}
+
+// NewMigrator returns a migrator with the schema and data migrations for the
+// database.
+func NewMigrator(db *gorm.DB) (*migrations.Migrator, error) {
+	dialect := db.Dialector.Name()
+	schema, err := migrations.FromSQL(sqlMigrations, "migrations/"+dialect)
+	if err != nil {
+		return nil, fmt.Errorf("no migrations for %s databases: %v", dialect, err)
+	}
+	return migrations.New(db, append(schema, dataMigrations...))
+}
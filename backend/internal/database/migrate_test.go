@@ -0,0 +1,49 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"expense-tracker/internal/migrations"
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrations(t *testing.T) {
+	// Every dialect has the same schema migrations
+	postgres, err := migrations.FromSQL(sqlMigrations, "migrations/postgres")
+	assert.NoError(t, err)
+	sqlite, err := migrations.FromSQL(sqlMigrations, "migrations/sqlite")
+	assert.NoError(t, err)
+	versions := func(list []migrations.Migration) map[int64]string {
+		names := make(map[int64]string)
+		for _, m := range list {
+			names[m.Version] = m.Name
+		}
+		return names
+	}
+	assert.Equal(t, versions(postgres), versions(sqlite))
+
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	assert.NoError(t, err)
+	migrator, err := NewMigrator(db)
+	assert.NoError(t, err)
+
+	applied, err := migrator.Up()
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(sqlite)+len(dataMigrations))
+
+	var mode string
+	assert.NoError(t, db.Raw("PRAGMA journal_mode").Scan(&mode).Error)
+	assert.Equal(t, "wal", mode)
+
+	user := models.User{Email: "test@example.com", PasswordHash: "hash"}
+	assert.NoError(t, db.Create(&user).Error)
+	assert.Equal(t, "EUR", user.BaseCurrency)
+
+	// Reverting everything leaves an empty database
+	_, err = migrator.Down(len(applied))
+	assert.NoError(t, err)
+	assert.False(t, db.Migrator().HasTable("users"))
+}
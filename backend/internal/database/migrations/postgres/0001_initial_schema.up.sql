@@ -0,0 +1,379 @@
+-- The schema as AutoMigrate created it before migrations were versioned.
+-- Databases created by earlier releases already have some of the tables,
+-- so everything is created only if it doesn't exist, and columns that were
+-- added to existing tables over time are added if they are missing.
+
+CREATE TABLE IF NOT EXISTS users (
+    id bigserial,
+    email text NOT NULL,
+    password_hash text NOT NULL,
+    base_currency varchar(3) NOT NULL DEFAULT 'EUR',
+    session_version bigint NOT NULL DEFAULT 0,
+    totp_secret text,
+    totp_enabled_at timestamptz,
+    totp_last_step bigint NOT NULL DEFAULT 0,
+    failed_logins bigint NOT NULL DEFAULT 0,
+    locked_until timestamptz,
+    created_at timestamptz,
+    activated_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT uni_users_email UNIQUE (email)
+);
+ALTER TABLE users ADD COLUMN IF NOT EXISTS base_currency varchar(3) NOT NULL DEFAULT 'EUR';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS session_version bigint NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret text;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled_at timestamptz;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step bigint NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_logins bigint NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until timestamptz;
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE IF NOT EXISTS budgets (
+    id bigserial,
+    user_id bigint NOT NULL,
+    workspace_id bigint,
+    name text NOT NULL,
+    amount bigint NOT NULL,
+    month text NOT NULL,
+    roll_over_amount bigint,
+    rollover_mode text NOT NULL DEFAULT 'reset',
+    carried_amount bigint,
+    source_budget_id bigint,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_budgets_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+ALTER TABLE budgets ADD COLUMN IF NOT EXISTS workspace_id bigint;
+ALTER TABLE budgets ADD COLUMN IF NOT EXISTS rollover_mode text NOT NULL DEFAULT 'reset';
+ALTER TABLE budgets ADD COLUMN IF NOT EXISTS carried_amount bigint;
+ALTER TABLE budgets ADD COLUMN IF NOT EXISTS source_budget_id bigint;
+CREATE INDEX IF NOT EXISTS idx_budgets_deleted_at ON budgets (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_budgets_source_budget_id ON budgets (source_budget_id);
+CREATE INDEX IF NOT EXISTS idx_budgets_workspace_id ON budgets (workspace_id);
+
+CREATE TABLE IF NOT EXISTS categories (
+    id bigserial,
+    user_id bigint NOT NULL,
+    workspace_id bigint,
+    parent_id bigint,
+    name text NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_categories_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_categories_children FOREIGN KEY (parent_id) REFERENCES categories(id)
+);
+ALTER TABLE categories ADD COLUMN IF NOT EXISTS workspace_id bigint;
+CREATE INDEX IF NOT EXISTS idx_categories_deleted_at ON categories (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories (parent_id);
+CREATE INDEX IF NOT EXISTS idx_categories_workspace_id ON categories (workspace_id);
+CREATE INDEX IF NOT EXISTS idx_categories_user_id ON categories (user_id);
+
+CREATE TABLE IF NOT EXISTS expenses (
+    id bigserial,
+    user_id bigint NOT NULL,
+    workspace_id bigint,
+    budget_id bigint,
+    category_id bigint,
+    amount bigint NOT NULL,
+    currency varchar(3) NOT NULL DEFAULT 'EUR',
+    base_amount bigint NOT NULL DEFAULT 0,
+    base_currency varchar(3),
+    description text NOT NULL,
+    date timestamptz NOT NULL,
+    external_id text,
+    recurring_expense_id bigint,
+    paid_by_id bigint,
+    split_method text,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_expenses_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_expenses_budget FOREIGN KEY (budget_id) REFERENCES budgets(id),
+    CONSTRAINT fk_expenses_category FOREIGN KEY (category_id) REFERENCES categories(id)
+);
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS workspace_id bigint;
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS category_id bigint;
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS currency varchar(3) NOT NULL DEFAULT 'EUR';
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS base_amount bigint NOT NULL DEFAULT 0;
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS base_currency varchar(3);
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS external_id text;
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS recurring_expense_id bigint;
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS paid_by_id bigint;
+ALTER TABLE expenses ADD COLUMN IF NOT EXISTS split_method text;
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_expenses_category') THEN
+        ALTER TABLE expenses ADD CONSTRAINT fk_expenses_category FOREIGN KEY (category_id) REFERENCES categories(id);
+    END IF;
+END $$;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_expenses_recurring_date ON expenses (recurring_expense_id, date);
+CREATE INDEX IF NOT EXISTS idx_expenses_category_id ON expenses (category_id);
+CREATE INDEX IF NOT EXISTS idx_expenses_workspace_id ON expenses (workspace_id);
+CREATE INDEX IF NOT EXISTS idx_expenses_deleted_at ON expenses (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_expenses_external_id ON expenses (external_id);
+
+CREATE TABLE IF NOT EXISTS tags (
+    id bigserial,
+    user_id bigint NOT NULL,
+    workspace_id bigint,
+    name text NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_tags_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+ALTER TABLE tags ADD COLUMN IF NOT EXISTS workspace_id bigint;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_tags_workspace_name ON tags (workspace_id, name);
+
+CREATE TABLE IF NOT EXISTS expense_tags (
+    expense_id bigint,
+    tag_id bigint,
+    PRIMARY KEY (expense_id, tag_id),
+    CONSTRAINT fk_expense_tags_expense FOREIGN KEY (expense_id) REFERENCES expenses(id),
+    CONSTRAINT fk_expense_tags_tag FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+CREATE TABLE IF NOT EXISTS exchange_rates (
+    id bigserial,
+    currency varchar(3) NOT NULL,
+    date timestamptz NOT NULL,
+    rate decimal NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_exchange_rates_currency_date ON exchange_rates (currency, date);
+
+CREATE TABLE IF NOT EXISTS rules (
+    id bigserial,
+    user_id bigint NOT NULL,
+    workspace_id bigint,
+    name text NOT NULL,
+    priority bigint NOT NULL DEFAULT 0,
+    enabled boolean NOT NULL,
+    description_pattern text,
+    min_amount bigint,
+    max_amount bigint,
+    budget_name text,
+    category_id bigint,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_rules_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_rules_category FOREIGN KEY (category_id) REFERENCES categories(id)
+);
+ALTER TABLE rules ADD COLUMN IF NOT EXISTS workspace_id bigint;
+CREATE INDEX IF NOT EXISTS idx_rules_user_id ON rules (user_id);
+CREATE INDEX IF NOT EXISTS idx_rules_deleted_at ON rules (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_rules_category_id ON rules (category_id);
+CREATE INDEX IF NOT EXISTS idx_rules_workspace_id ON rules (workspace_id);
+
+CREATE TABLE IF NOT EXISTS rule_tags (
+    rule_id bigint,
+    tag_id bigint,
+    PRIMARY KEY (rule_id, tag_id),
+    CONSTRAINT fk_rule_tags_rule FOREIGN KEY (rule_id) REFERENCES rules(id),
+    CONSTRAINT fk_rule_tags_tag FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+CREATE TABLE IF NOT EXISTS recurring_expenses (
+    id bigserial,
+    user_id bigint NOT NULL,
+    workspace_id bigint,
+    description text NOT NULL,
+    amount bigint NOT NULL,
+    currency varchar(3) NOT NULL DEFAULT 'EUR',
+    budget_name text,
+    category_id bigint,
+    frequency text NOT NULL,
+    interval bigint NOT NULL DEFAULT 1,
+    day_of_month bigint,
+    weekday bigint,
+    month bigint,
+    start_date timestamptz NOT NULL,
+    end_date timestamptz,
+    paused boolean NOT NULL DEFAULT false,
+    next_date timestamptz NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_recurring_expenses_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_recurring_expenses_category FOREIGN KEY (category_id) REFERENCES categories(id)
+);
+ALTER TABLE recurring_expenses ADD COLUMN IF NOT EXISTS workspace_id bigint;
+CREATE INDEX IF NOT EXISTS idx_recurring_expenses_deleted_at ON recurring_expenses (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_recurring_expenses_next_date ON recurring_expenses (next_date);
+CREATE INDEX IF NOT EXISTS idx_recurring_expenses_category_id ON recurring_expenses (category_id);
+CREATE INDEX IF NOT EXISTS idx_recurring_expenses_workspace_id ON recurring_expenses (workspace_id);
+CREATE INDEX IF NOT EXISTS idx_recurring_expenses_user_id ON recurring_expenses (user_id);
+
+CREATE TABLE IF NOT EXISTS workspaces (
+    id bigserial,
+    name text NOT NULL,
+    base_currency varchar(3) NOT NULL DEFAULT 'EUR',
+    personal_user_id bigint,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_workspaces_deleted_at ON workspaces (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_workspaces_personal_user_id ON workspaces (personal_user_id);
+
+CREATE TABLE IF NOT EXISTS workspace_members (
+    workspace_id bigint,
+    user_id bigint,
+    role text NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    PRIMARY KEY (workspace_id, user_id),
+    CONSTRAINT fk_workspace_members_workspace FOREIGN KEY (workspace_id) REFERENCES workspaces(id),
+    CONSTRAINT fk_workspace_members_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_workspace_members_user_id ON workspace_members (user_id);
+
+CREATE TABLE IF NOT EXISTS workspace_invitations (
+    id bigserial,
+    workspace_id bigint NOT NULL,
+    email text NOT NULL,
+    role text NOT NULL,
+    invited_by_id bigint NOT NULL,
+    expires_at timestamptz NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_workspace_invitations_workspace FOREIGN KEY (workspace_id) REFERENCES workspaces(id)
+);
+CREATE INDEX IF NOT EXISTS idx_workspace_invitations_email ON workspace_invitations (email);
+CREATE INDEX IF NOT EXISTS idx_workspace_invitations_workspace_id ON workspace_invitations (workspace_id);
+
+CREATE TABLE IF NOT EXISTS expense_splits (
+    id bigserial,
+    expense_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    weight bigint NOT NULL,
+    amount bigint NOT NULL,
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_expense_splits_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_expenses_splits FOREIGN KEY (expense_id) REFERENCES expenses(id)
+);
+CREATE INDEX IF NOT EXISTS idx_expense_splits_user_id ON expense_splits (user_id);
+CREATE INDEX IF NOT EXISTS idx_expense_splits_expense_id ON expense_splits (expense_id);
+
+CREATE TABLE IF NOT EXISTS settlements (
+    id bigserial,
+    workspace_id bigint NOT NULL,
+    from_user_id bigint NOT NULL,
+    to_user_id bigint NOT NULL,
+    amount bigint NOT NULL,
+    currency varchar(3) NOT NULL,
+    base_amount bigint NOT NULL,
+    base_currency varchar(3) NOT NULL,
+    date timestamptz NOT NULL,
+    note text,
+    created_by_id bigint NOT NULL,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_settlements_deleted_at ON settlements (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_settlements_workspace_id ON settlements (workspace_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id bigserial,
+    user_id bigint NOT NULL,
+    family_id varchar(32) NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    id varchar(32),
+    expires_at timestamptz NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id varchar(32),
+    user_id bigint NOT NULL,
+    purpose varchar(20) NOT NULL,
+    expires_at timestamptz NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id bigserial,
+    user_id bigint NOT NULL,
+    code_hash varchar(64) NOT NULL,
+    used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE INDEX IF NOT EXISTS idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE IF NOT EXISTS user_identities (
+    id bigserial,
+    user_id bigint NOT NULL,
+    provider text NOT NULL,
+    issuer text NOT NULL,
+    subject text NOT NULL,
+    email text,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_user_identities_issuer_subject ON user_identities (issuer, subject);
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
+
+CREATE TABLE IF NOT EXISTS oidc_states (
+    state varchar(64),
+    provider text NOT NULL,
+    nonce text NOT NULL,
+    code_verifier text NOT NULL,
+    expires_at timestamptz NOT NULL,
+    PRIMARY KEY (state)
+);
+CREATE INDEX IF NOT EXISTS idx_oidc_states_expires_at ON oidc_states (expires_at);
+
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+    id bigserial,
+    user_id bigint NOT NULL,
+    name text NOT NULL,
+    prefix varchar(16) NOT NULL,
+    token_hash varchar(64) NOT NULL,
+    scopes text NOT NULL,
+    expires_at timestamptz,
+    last_used_at timestamptz,
+    created_at timestamptz,
+    PRIMARY KEY (id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_personal_access_tokens_token_hash ON personal_access_tokens (token_hash);
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key varchar(255),
+    tokens double precision NOT NULL,
+    updated_at timestamptz NOT NULL,
+    full_at timestamptz NOT NULL,
+    PRIMARY KEY (key)
+);
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_full_at ON rate_limit_buckets (full_at);
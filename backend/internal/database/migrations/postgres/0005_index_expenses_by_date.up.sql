@@ -0,0 +1,2 @@
+-- Pages of expenses are read in the order of their date and ID
+CREATE INDEX idx_expenses_workspace_date ON expenses (workspace_id, date, id);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_budgets_name_search;
+DROP INDEX IF EXISTS idx_expenses_description_trgm;
+DROP INDEX IF EXISTS idx_expenses_search_vector;
+ALTER TABLE expenses DROP COLUMN search_vector;
+ALTER TABLE expenses DROP COLUMN notes;
@@ -0,0 +1,14 @@
+-- Expenses get notes, and descriptions and notes a full-text index. Budget
+-- names are searched through an index of their own. Trigram indexes let
+-- searches find misspelled descriptions.
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE expenses ADD COLUMN notes text NOT NULL DEFAULT '';
+ALTER TABLE expenses ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('simple', description), 'A') ||
+    setweight(to_tsvector('simple', notes), 'B')
+) STORED;
+
+CREATE INDEX idx_expenses_search_vector ON expenses USING GIN (search_vector);
+CREATE INDEX idx_expenses_description_trgm ON expenses USING GIN (description gin_trgm_ops);
+CREATE INDEX idx_budgets_name_search ON budgets USING GIN (to_tsvector('simple', name));
@@ -0,0 +1,20 @@
+-- Receipts and documents of expenses. The files are kept in the storage,
+-- keyed by their SHA-256 hash.
+CREATE TABLE attachments (
+    id bigserial,
+    expense_id bigint NOT NULL,
+    workspace_id bigint NOT NULL,
+    user_id bigint NOT NULL,
+    file_name text NOT NULL,
+    content_type text NOT NULL,
+    size bigint NOT NULL,
+    sha256 varchar(64) NOT NULL,
+    storage_key text NOT NULL,
+    thumbnail_key text NOT NULL DEFAULT '',
+    created_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_expenses_attachments FOREIGN KEY (expense_id) REFERENCES expenses(id)
+);
+CREATE INDEX idx_attachments_expense_id ON attachments (expense_id);
+CREATE INDEX idx_attachments_workspace_id ON attachments (workspace_id);
+CREATE INDEX idx_attachments_sha256 ON attachments (sha256);
@@ -0,0 +1,26 @@
+-- Income of workspaces, and recurring income like salaries as recurring
+-- expenses of type income. Zero-based workspaces assign a month's income to
+-- its budgets.
+CREATE TABLE incomes (
+    id bigserial,
+    user_id bigint NOT NULL,
+    workspace_id bigint NOT NULL,
+    amount bigint NOT NULL,
+    currency varchar(3) NOT NULL,
+    base_amount bigint NOT NULL DEFAULT 0,
+    base_currency varchar(3),
+    description text NOT NULL,
+    date timestamptz NOT NULL,
+    recurring_expense_id bigint,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    PRIMARY KEY (id),
+    CONSTRAINT fk_incomes_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_incomes_workspace_date ON incomes (workspace_id, date);
+CREATE UNIQUE INDEX idx_incomes_recurring_date ON incomes (recurring_expense_id, date);
+CREATE INDEX idx_incomes_deleted_at ON incomes (deleted_at);
+
+ALTER TABLE recurring_expenses ADD COLUMN type text NOT NULL DEFAULT 'expense';
+ALTER TABLE workspaces ADD COLUMN zero_based boolean NOT NULL DEFAULT false;
@@ -0,0 +1,331 @@
+-- The initial schema, matching 0001_initial_schema of PostgreSQL. SQLite
+-- databases were always created by migrations, so none of it exists yet.
+
+CREATE TABLE users (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    email text NOT NULL,
+    password_hash text NOT NULL,
+    base_currency text NOT NULL DEFAULT 'EUR',
+    session_version integer NOT NULL DEFAULT 0,
+    totp_secret text,
+    totp_enabled_at datetime,
+    totp_last_step integer NOT NULL DEFAULT 0,
+    failed_logins integer NOT NULL DEFAULT 0,
+    locked_until datetime,
+    created_at datetime,
+    activated_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    CONSTRAINT uni_users_email UNIQUE (email)
+);
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+CREATE TABLE budgets (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    workspace_id integer,
+    name text NOT NULL,
+    amount integer NOT NULL,
+    month text NOT NULL,
+    roll_over_amount integer,
+    rollover_mode text NOT NULL DEFAULT 'reset',
+    carried_amount integer,
+    source_budget_id integer,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    CONSTRAINT fk_budgets_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_budgets_deleted_at ON budgets (deleted_at);
+CREATE UNIQUE INDEX idx_budgets_source_budget_id ON budgets (source_budget_id);
+CREATE INDEX idx_budgets_workspace_id ON budgets (workspace_id);
+
+CREATE TABLE categories (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    workspace_id integer,
+    parent_id integer,
+    name text NOT NULL,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    CONSTRAINT fk_categories_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_categories_children FOREIGN KEY (parent_id) REFERENCES categories(id)
+);
+CREATE INDEX idx_categories_deleted_at ON categories (deleted_at);
+CREATE INDEX idx_categories_parent_id ON categories (parent_id);
+CREATE INDEX idx_categories_workspace_id ON categories (workspace_id);
+CREATE INDEX idx_categories_user_id ON categories (user_id);
+
+CREATE TABLE expenses (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    workspace_id integer,
+    budget_id integer,
+    category_id integer,
+    amount integer NOT NULL,
+    currency text NOT NULL DEFAULT 'EUR',
+    base_amount integer NOT NULL DEFAULT 0,
+    base_currency text,
+    description text NOT NULL,
+    date datetime NOT NULL,
+    external_id text,
+    recurring_expense_id integer,
+    paid_by_id integer,
+    split_method text,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    CONSTRAINT fk_expenses_category FOREIGN KEY (category_id) REFERENCES categories(id),
+    CONSTRAINT fk_expenses_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_expenses_budget FOREIGN KEY (budget_id) REFERENCES budgets(id)
+);
+CREATE INDEX idx_expenses_workspace_id ON expenses (workspace_id);
+CREATE INDEX idx_expenses_deleted_at ON expenses (deleted_at);
+CREATE INDEX idx_expenses_external_id ON expenses (external_id);
+CREATE UNIQUE INDEX idx_expenses_recurring_date ON expenses (recurring_expense_id, date);
+CREATE INDEX idx_expenses_category_id ON expenses (category_id);
+
+CREATE TABLE tags (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    workspace_id integer,
+    name text NOT NULL,
+    created_at datetime,
+    CONSTRAINT fk_tags_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE UNIQUE INDEX idx_tags_workspace_name ON tags (workspace_id, name);
+
+CREATE TABLE expense_tags (
+    expense_id integer,
+    tag_id integer,
+    PRIMARY KEY (expense_id,tag_id),
+    CONSTRAINT fk_expense_tags_expense FOREIGN KEY (expense_id) REFERENCES expenses(id),
+    CONSTRAINT fk_expense_tags_tag FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+CREATE TABLE exchange_rates (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    currency text NOT NULL,
+    date datetime NOT NULL,
+    rate real NOT NULL,
+    created_at datetime,
+    updated_at datetime
+);
+CREATE UNIQUE INDEX idx_exchange_rates_currency_date ON exchange_rates (currency, date);
+
+CREATE TABLE rules (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    workspace_id integer,
+    name text NOT NULL,
+    priority integer NOT NULL DEFAULT 0,
+    enabled boolean NOT NULL,
+    description_pattern text,
+    min_amount integer,
+    max_amount integer,
+    budget_name text,
+    category_id integer,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    CONSTRAINT fk_rules_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_rules_category FOREIGN KEY (category_id) REFERENCES categories(id)
+);
+CREATE INDEX idx_rules_deleted_at ON rules (deleted_at);
+CREATE INDEX idx_rules_category_id ON rules (category_id);
+CREATE INDEX idx_rules_workspace_id ON rules (workspace_id);
+CREATE INDEX idx_rules_user_id ON rules (user_id);
+
+CREATE TABLE rule_tags (
+    rule_id integer,
+    tag_id integer,
+    PRIMARY KEY (rule_id,tag_id),
+    CONSTRAINT fk_rule_tags_rule FOREIGN KEY (rule_id) REFERENCES rules(id),
+    CONSTRAINT fk_rule_tags_tag FOREIGN KEY (tag_id) REFERENCES tags(id)
+);
+
+CREATE TABLE recurring_expenses (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    workspace_id integer,
+    description text NOT NULL,
+    amount integer NOT NULL,
+    currency text NOT NULL DEFAULT 'EUR',
+    budget_name text,
+    category_id integer,
+    frequency text NOT NULL,
+    interval integer NOT NULL DEFAULT 1,
+    day_of_month integer,
+    weekday integer,
+    month integer,
+    start_date datetime NOT NULL,
+    end_date datetime,
+    paused boolean NOT NULL DEFAULT false,
+    next_date datetime NOT NULL,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    CONSTRAINT fk_recurring_expenses_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_recurring_expenses_category FOREIGN KEY (category_id) REFERENCES categories(id)
+);
+CREATE INDEX idx_recurring_expenses_next_date ON recurring_expenses (next_date);
+CREATE INDEX idx_recurring_expenses_category_id ON recurring_expenses (category_id);
+CREATE INDEX idx_recurring_expenses_workspace_id ON recurring_expenses (workspace_id);
+CREATE INDEX idx_recurring_expenses_user_id ON recurring_expenses (user_id);
+CREATE INDEX idx_recurring_expenses_deleted_at ON recurring_expenses (deleted_at);
+
+CREATE TABLE workspaces (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name text NOT NULL,
+    base_currency text NOT NULL DEFAULT 'EUR',
+    personal_user_id integer,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime
+);
+CREATE INDEX idx_workspaces_deleted_at ON workspaces (deleted_at);
+CREATE UNIQUE INDEX idx_workspaces_personal_user_id ON workspaces (personal_user_id);
+
+CREATE TABLE workspace_members (
+    workspace_id integer,
+    user_id integer,
+    role text NOT NULL,
+    created_at datetime,
+    updated_at datetime,
+    PRIMARY KEY (workspace_id,user_id),
+    CONSTRAINT fk_workspace_members_workspace FOREIGN KEY (workspace_id) REFERENCES workspaces(id),
+    CONSTRAINT fk_workspace_members_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_workspace_members_user_id ON workspace_members (user_id);
+
+CREATE TABLE workspace_invitations (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    workspace_id integer NOT NULL,
+    email text NOT NULL,
+    role text NOT NULL,
+    invited_by_id integer NOT NULL,
+    expires_at datetime NOT NULL,
+    created_at datetime,
+    CONSTRAINT fk_workspace_invitations_workspace FOREIGN KEY (workspace_id) REFERENCES workspaces(id)
+);
+CREATE INDEX idx_workspace_invitations_email ON workspace_invitations (email);
+CREATE INDEX idx_workspace_invitations_workspace_id ON workspace_invitations (workspace_id);
+
+CREATE TABLE expense_splits (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    expense_id integer NOT NULL,
+    user_id integer NOT NULL,
+    weight integer NOT NULL,
+    amount integer NOT NULL,
+    created_at datetime,
+    CONSTRAINT fk_expense_splits_user FOREIGN KEY (user_id) REFERENCES users(id),
+    CONSTRAINT fk_expenses_splits FOREIGN KEY (expense_id) REFERENCES expenses(id)
+);
+CREATE INDEX idx_expense_splits_user_id ON expense_splits (user_id);
+CREATE INDEX idx_expense_splits_expense_id ON expense_splits (expense_id);
+
+CREATE TABLE settlements (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    workspace_id integer NOT NULL,
+    from_user_id integer NOT NULL,
+    to_user_id integer NOT NULL,
+    amount integer NOT NULL,
+    currency text NOT NULL,
+    base_amount integer NOT NULL,
+    base_currency text NOT NULL,
+    date datetime NOT NULL,
+    note text,
+    created_by_id integer NOT NULL,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime
+);
+CREATE INDEX idx_settlements_deleted_at ON settlements (deleted_at);
+CREATE INDEX idx_settlements_workspace_id ON settlements (workspace_id);
+
+CREATE TABLE refresh_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    family_id text NOT NULL,
+    token_hash text NOT NULL,
+    expires_at datetime NOT NULL,
+    used_at datetime,
+    revoked_at datetime,
+    created_at datetime
+);
+CREATE UNIQUE INDEX idx_refresh_tokens_token_hash ON refresh_tokens (token_hash);
+CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id);
+CREATE INDEX idx_refresh_tokens_user_id ON refresh_tokens (user_id);
+
+CREATE TABLE revoked_tokens (
+    id text,
+    expires_at datetime NOT NULL,
+    PRIMARY KEY (id)
+);
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+
+CREATE TABLE user_tokens (
+    id text,
+    user_id integer NOT NULL,
+    purpose text NOT NULL,
+    expires_at datetime NOT NULL,
+    used_at datetime,
+    created_at datetime,
+    PRIMARY KEY (id)
+);
+CREATE INDEX idx_user_tokens_user_id ON user_tokens (user_id);
+
+CREATE TABLE recovery_codes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    code_hash text NOT NULL,
+    used_at datetime,
+    created_at datetime
+);
+CREATE INDEX idx_recovery_codes_user_id ON recovery_codes (user_id);
+
+CREATE TABLE user_identities (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    provider text NOT NULL,
+    issuer text NOT NULL,
+    subject text NOT NULL,
+    email text,
+    created_at datetime
+);
+CREATE UNIQUE INDEX idx_user_identities_issuer_subject ON user_identities (issuer, subject);
+CREATE INDEX idx_user_identities_user_id ON user_identities (user_id);
+
+CREATE TABLE oidc_states (
+    state text,
+    provider text NOT NULL,
+    nonce text NOT NULL,
+    code_verifier text NOT NULL,
+    expires_at datetime NOT NULL,
+    PRIMARY KEY (state)
+);
+CREATE INDEX idx_oidc_states_expires_at ON oidc_states (expires_at);
+
+CREATE TABLE personal_access_tokens (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    token_hash text NOT NULL,
+    scopes text NOT NULL,
+    expires_at datetime,
+    last_used_at datetime,
+    created_at datetime
+);
+CREATE UNIQUE INDEX idx_personal_access_tokens_token_hash ON personal_access_tokens (token_hash);
+CREATE INDEX idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
+
+CREATE TABLE rate_limit_buckets (
+    key text,
+    tokens real NOT NULL,
+    updated_at datetime NOT NULL,
+    full_at datetime NOT NULL,
+    PRIMARY KEY (key)
+);
+CREATE INDEX idx_rate_limit_buckets_full_at ON rate_limit_buckets (full_at);
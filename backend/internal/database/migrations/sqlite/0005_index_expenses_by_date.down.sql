@@ -0,0 +1 @@
+DROP INDEX idx_expenses_workspace_date;
@@ -0,0 +1,3 @@
+-- Expenses get notes. The full-text index needs FTS5, which not every build
+-- has, so it is created by the search_index migration.
+ALTER TABLE expenses ADD COLUMN notes text NOT NULL DEFAULT '';
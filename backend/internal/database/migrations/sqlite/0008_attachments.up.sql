@@ -0,0 +1,19 @@
+-- Receipts and documents of expenses. The files are kept in the storage,
+-- keyed by their SHA-256 hash.
+CREATE TABLE attachments (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    expense_id integer NOT NULL,
+    workspace_id integer NOT NULL,
+    user_id integer NOT NULL,
+    file_name text NOT NULL,
+    content_type text NOT NULL,
+    size integer NOT NULL,
+    sha256 text NOT NULL,
+    storage_key text NOT NULL,
+    thumbnail_key text NOT NULL DEFAULT '',
+    created_at datetime,
+    CONSTRAINT fk_expenses_attachments FOREIGN KEY (expense_id) REFERENCES expenses(id)
+);
+CREATE INDEX idx_attachments_expense_id ON attachments (expense_id);
+CREATE INDEX idx_attachments_workspace_id ON attachments (workspace_id);
+CREATE INDEX idx_attachments_sha256 ON attachments (sha256);
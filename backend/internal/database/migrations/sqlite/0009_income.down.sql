@@ -0,0 +1,3 @@
+ALTER TABLE workspaces DROP COLUMN zero_based;
+ALTER TABLE recurring_expenses DROP COLUMN type;
+DROP TABLE incomes;
@@ -0,0 +1,25 @@
+-- Income of workspaces, and recurring income like salaries as recurring
+-- expenses of type income. Zero-based workspaces assign a month's income to
+-- its budgets.
+CREATE TABLE incomes (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    user_id integer NOT NULL,
+    workspace_id integer NOT NULL,
+    amount integer NOT NULL,
+    currency text NOT NULL,
+    base_amount integer NOT NULL DEFAULT 0,
+    base_currency text,
+    description text NOT NULL,
+    date datetime NOT NULL,
+    recurring_expense_id integer,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    CONSTRAINT fk_incomes_user FOREIGN KEY (user_id) REFERENCES users(id)
+);
+CREATE INDEX idx_incomes_workspace_date ON incomes (workspace_id, date);
+CREATE UNIQUE INDEX idx_incomes_recurring_date ON incomes (recurring_expense_id, date);
+CREATE INDEX idx_incomes_deleted_at ON incomes (deleted_at);
+
+ALTER TABLE recurring_expenses ADD COLUMN type text NOT NULL DEFAULT 'expense';
+ALTER TABLE workspaces ADD COLUMN zero_based boolean NOT NULL DEFAULT false;
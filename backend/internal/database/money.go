@@ -0,0 +1,58 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// moneyColumns lists all columns that hold monetary amounts. They used to be
+// stored as floating point numbers in major units and are now integers in
+// minor units (cents).
+var moneyColumns = map[string][]string{
+	"budgets":  {"amount", "roll_over_amount", "carried_amount"},
+	"expenses": {"amount"},
+}
+
+// migrateMoneyToMinorUnits converts existing floating point money columns to
+// integer minor units. Databases created by earlier releases may still have
+// them, columns that are already integers are left untouched.
+func migrateMoneyToMinorUnits(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for table, columns := range moneyColumns {
+			if !tx.Migrator().HasTable(table) {
+				continue
+			}
+
+			columnTypes, err := tx.Migrator().ColumnTypes(table)
+			if err != nil {
+				return err
+			}
+
+			for _, columnType := range columnTypes {
+				if !slices.Contains(columns, columnType.Name()) || !isDecimalType(columnType.DatabaseTypeName()) {
+					continue
+				}
+
+				log.Printf("Converting %s.%s to minor units", table, columnType.Name())
+				stmt := fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN %s TYPE bigint USING round(%s * 100)::bigint`,
+					table, columnType.Name(), columnType.Name())
+				if err := tx.Exec(stmt).Error; err != nil {
+					return fmt.Errorf("failed to convert %s.%s: %v", table, columnType.Name(), err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func isDecimalType(typeName string) bool {
+	switch strings.ToLower(typeName) {
+	case "numeric", "decimal", "float4", "float8", "real", "double precision":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/workspaces"
+
+	"gorm.io/gorm"
+)
+
+// workspaceTables lists the tables whose rows belong to a workspace. They
+// used to belong to a user.
+var workspaceTables = []string{"budgets", "expenses", "categories", "tags", "rules", "recurring_expenses"}
+
+// backfillWorkspaces moves rows created before workspaces existed into the
+// personal workspace of the user they belong to. Rows that already have a
+// workspace are left untouched.
+func backfillWorkspaces(db *gorm.DB) error {
+	for _, table := range workspaceTables {
+		var userIDs []uint
+		if err := db.Table(table).
+			Where("workspace_id IS NULL OR workspace_id = 0").
+			Distinct("user_id").
+			Pluck("user_id", &userIDs).Error; err != nil {
+			return err
+		}
+
+		for _, userID := range userIDs {
+			workspace, err := workspaces.Personal(db, userID)
+			if err != nil {
+				return fmt.Errorf("personal workspace of user %d: %v", userID, err)
+			}
+			if err := db.Table(table).
+				Where("user_id = ? AND (workspace_id IS NULL OR workspace_id = 0)", userID).
+				Update("workspace_id", workspace.ID).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	// Tag names used to be unique per user, now they are unique per workspace
+	if db.Migrator().HasIndex(&models.Tag{}, "idx_tags_user_name") {
+		return db.Migrator().DropIndex(&models.Tag{}, "idx_tags_user_name")
+	}
+	return nil
+}
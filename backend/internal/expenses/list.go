@@ -0,0 +1,210 @@
+// Package expenses lists the expenses of a workspace page by page.
+package expenses
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/workspaces"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidSort   = errors.New("invalid sort, use date, amount, -date or -amount")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Filter selects expenses. Zero values don't filter.
+type Filter struct {
+	From        time.Time     // First day
+	To          time.Time     // Last day, inclusive
+	MinAmount   *models.Money // In the workspace's base currency
+	MaxAmount   *models.Money // In the workspace's base currency
+	BudgetID    *uint
+	Unbudgeted  bool     // Only expenses without a budget
+	CategoryIDs []uint   // Any of the categories
+	Description string   // Part of the description, ignoring case
+	Tags        []string // All of the tags
+}
+
+// Apply adds the conditions of the filter to a query on the expenses of the
+// workspace.
+func (f Filter) Apply(db *gorm.DB, workspaceID uint) *gorm.DB {
+	query := db.Model(&models.Expense{}).Scopes(workspaces.Scope(workspaceID))
+	if !f.From.IsZero() {
+		query = query.Where("expenses.date >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		query = query.Where("expenses.date < ?", f.To.AddDate(0, 0, 1))
+	}
+	if f.MinAmount != nil {
+		query = query.Where("expenses.base_amount >= ?", *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		query = query.Where("expenses.base_amount <= ?", *f.MaxAmount)
+	}
+	if f.Unbudgeted {
+		query = query.Where("expenses.budget_id IS NULL")
+	} else if f.BudgetID != nil {
+		query = query.Where("expenses.budget_id = ?", *f.BudgetID)
+	}
+	if f.CategoryIDs != nil {
+		query = query.Where("expenses.category_id IN ?", f.CategoryIDs)
+	}
+	if f.Description != "" {
+		query = query.Where(`LOWER(expenses.description) LIKE ? ESCAPE '\'`, "%"+EscapeLike(strings.ToLower(f.Description))+"%")
+	}
+	for _, tag := range f.Tags {
+		query = query.Where("expenses.id IN (?)", db.Table("expense_tags").
+			Select("expense_tags.expense_id").
+			Joins("JOIN tags ON tags.id = expense_tags.tag_id").
+			Where("tags.workspace_id = ? AND tags.name = ?", workspaceID, tag))
+	}
+	return query
+}
+
+// EscapeLike escapes the wildcards of a LIKE pattern, for use with
+// ESCAPE '\'.
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// Sort orders expenses by date or amount, and by ID for expenses with the
+// same value.
+type Sort struct {
+	Field string // date or amount
+	Desc  bool
+}
+
+// ParseSort parses a sort like "date" or "-amount", where the minus sorts in
+// descending order. The default is the newest expenses first.
+func ParseSort(s string) (Sort, error) {
+	if s == "" {
+		return Sort{Field: "date", Desc: true}, nil
+	}
+	sort := Sort{Field: strings.TrimPrefix(s, "-"), Desc: strings.HasPrefix(s, "-")}
+	if sort.Field != "date" && sort.Field != "amount" {
+		return Sort{}, ErrInvalidSort
+	}
+	return sort, nil
+}
+
+func (s Sort) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+func (s Sort) column() string {
+	if s.Field == "amount" {
+		return "expenses.base_amount"
+	}
+	return "expenses.date"
+}
+
+func (s Sort) value(c cursor) interface{} {
+	if s.Field == "amount" {
+		return c.Amount
+	}
+	return c.Date
+}
+
+// cursor points at the last expense of a page. The next page starts after it,
+// so expenses created or deleted in between don't shift the pages.
+type cursor struct {
+	Sort   string       `json:"s"`
+	ID     uint         `json:"id"`
+	Date   time.Time    `json:"d"`
+	Amount models.Money `json:"a"`
+}
+
+func (c cursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string, sort Sort) (cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || json.Unmarshal(data, &c) != nil || c.Sort != sort.String() {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Page is a page of expenses along with the number of all expenses that
+// match the filter.
+type Page struct {
+	Expenses   []models.Expense `json:"expenses"`
+	Total      int64            `json:"total"`
+	NextCursor string           `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// List returns the page of up to limit expenses that starts after the
+// cursor, or the first page without one.
+func List(db *gorm.DB, workspaceID uint, filter Filter, sort Sort, after string, limit int) (Page, error) {
+	page := Page{Expenses: []models.Expense{}}
+	if err := filter.Apply(db, workspaceID).Count(&page.Total).Error; err != nil {
+		return Page{}, err
+	}
+
+	query := filter.Apply(db, workspaceID)
+
+	if after != "" {
+		c, err := decodeCursor(after, sort)
+		if err != nil {
+			return Page{}, err
+		}
+		op := ">"
+		if sort.Desc {
+			op = "<"
+		}
+		column := sort.column()
+		query = query.Where("("+column+" "+op+" ?) OR ("+column+" = ? AND expenses.id "+op+" ?)",
+			sort.value(c), sort.value(c), c.ID)
+	}
+
+	// One more than the limit tells whether there is a next page
+	if err := Preload(query).
+		Scopes(orderBy(sort)).
+		Limit(limit + 1).
+		Find(&page.Expenses).Error; err != nil {
+		return Page{}, err
+	}
+	if len(page.Expenses) > limit {
+		page.Expenses = page.Expenses[:limit]
+		last := page.Expenses[limit-1]
+		page.NextCursor = cursor{Sort: sort.String(), ID: last.ID, Date: last.Date, Amount: last.BaseAmount}.encode()
+	}
+	return page, nil
+}
+
+// All returns all expenses that match the filter.
+func All(db *gorm.DB, workspaceID uint, filter Filter, sort Sort) ([]models.Expense, error) {
+	expenses := []models.Expense{}
+	err := Preload(filter.Apply(db, workspaceID)).
+		Scopes(orderBy(sort)).
+		Find(&expenses).Error
+	return expenses, err
+}
+
+// Preload loads the associations expenses are listed with.
+func Preload(db *gorm.DB) *gorm.DB {
+	return db.Preload("Budget").Preload("Category").Preload("Tags").Preload("Splits").Preload("Attachments")
+}
+
+func orderBy(sort Sort) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		direction := " ASC"
+		if sort.Desc {
+			direction = " DESC"
+		}
+		return db.Order(sort.column() + direction).Order("expenses.id" + direction)
+	}
+}
@@ -0,0 +1,147 @@
+package expenses
+
+import (
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Budget{}, &models.Category{}, &models.Tag{}, &models.Expense{}, &models.ExpenseSplit{}, &models.Attachment{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+// createExpenses creates expenses in workspace 1, some of them on the same
+// day, and one in workspace 2.
+func createExpenses(t *testing.T, db *gorm.DB) {
+	budget := models.Budget{UserID: 1, WorkspaceID: 1, Name: "Food", Amount: 50000, Month: "2024-01"}
+	assert.NoError(t, db.Create(&budget).Error)
+
+	day := func(d int) time.Time { return time.Date(2024, 1, d, 0, 0, 0, 0, time.UTC) }
+	for _, e := range []models.Expense{
+		{Description: "Groceries", BaseAmount: 4250, Date: day(3), BudgetID: &budget.ID},
+		{Description: "Rent", BaseAmount: 90000, Date: day(1)},
+		{Description: "Coffee", BaseAmount: 350, Date: day(3)},
+		{Description: "100% juice", BaseAmount: 299, Date: day(3), BudgetID: &budget.ID},
+		{Description: "Cinema", BaseAmount: 1200, Date: day(20)},
+	} {
+		e.UserID, e.WorkspaceID, e.Amount = 1, 1, e.BaseAmount
+		assert.NoError(t, db.Create(&e).Error)
+	}
+	assert.NoError(t, db.Create(&models.Expense{UserID: 2, WorkspaceID: 2, Description: "Other", Amount: 100, BaseAmount: 100, Date: day(3)}).Error)
+}
+
+func descriptions(list []models.Expense) []string {
+	result := []string{}
+	for _, e := range list {
+		result = append(result, e.Description)
+	}
+	return result
+}
+
+func TestListPages(t *testing.T) {
+	db := setupTestDB(t)
+	createExpenses(t, db)
+
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		// Expenses of the same day are ordered by ID
+		{sort: "", want: []string{"Cinema", "100% juice", "Coffee", "Groceries", "Rent"}},
+		{sort: "date", want: []string{"Rent", "Groceries", "Coffee", "100% juice", "Cinema"}},
+		{sort: "-amount", want: []string{"Rent", "Groceries", "Cinema", "Coffee", "100% juice"}},
+		{sort: "amount", want: []string{"100% juice", "Coffee", "Cinema", "Groceries", "Rent"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			sort, err := ParseSort(tt.sort)
+			assert.NoError(t, err)
+
+			// Pages of two split the expenses of the same day
+			var got []string
+			cursor := ""
+			for pages := 0; pages < 5; pages++ {
+				page, err := List(db, 1, Filter{}, sort, cursor, 2)
+				assert.NoError(t, err)
+				assert.Equal(t, int64(5), page.Total)
+				got = append(got, descriptions(page.Expenses)...)
+				if cursor = page.NextCursor; cursor == "" {
+					break
+				}
+			}
+			assert.Equal(t, tt.want, got)
+
+			all, err := All(db, 1, Filter{}, sort)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, descriptions(all))
+		})
+	}
+}
+
+func TestListRejectsInvalidCursors(t *testing.T) {
+	db := setupTestDB(t)
+	createExpenses(t, db)
+
+	byDate, _ := ParseSort("-date")
+	byAmount, _ := ParseSort("amount")
+	page, err := List(db, 1, Filter{}, byDate, "", 2)
+	assert.NoError(t, err)
+
+	// A cursor only continues the sort it was created for
+	_, err = List(db, 1, Filter{}, byAmount, page.NextCursor, 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+	_, err = List(db, 1, Filter{}, byDate, "not a cursor", 2)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = ParseSort("description")
+	assert.ErrorIs(t, err, ErrInvalidSort)
+}
+
+func TestFilter(t *testing.T) {
+	db := setupTestDB(t)
+	createExpenses(t, db)
+
+	amount := func(m models.Money) *models.Money { return &m }
+	budgetID := uint(1)
+	tests := []struct {
+		name   string
+		filter Filter
+		want   []string
+	}{
+		{name: "date range", filter: Filter{From: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+			want: []string{"100% juice", "Coffee", "Groceries"}},
+		{name: "amount range", filter: Filter{MinAmount: amount(350), MaxAmount: amount(4250)}, want: []string{"Cinema", "Coffee", "Groceries"}},
+		{name: "budget", filter: Filter{BudgetID: &budgetID}, want: []string{"100% juice", "Groceries"}},
+		{name: "unbudgeted", filter: Filter{Unbudgeted: true}, want: []string{"Cinema", "Coffee", "Rent"}},
+		{name: "description ignores case", filter: Filter{Description: "CINE"}, want: []string{"Cinema"}},
+		{name: "description wildcards are literal", filter: Filter{Description: "0%"}, want: []string{"100% juice"}},
+		{name: "nothing", filter: Filter{Description: "_"}, want: []string{}},
+	}
+
+	sort, _ := ParseSort("-date")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := List(db, 1, tt.filter, sort, "", 10)
+			assert.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, descriptions(page.Expenses))
+			assert.Equal(t, int64(len(tt.want)), page.Total)
+			assert.Empty(t, page.NextCursor)
+		})
+	}
+}
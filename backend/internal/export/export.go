@@ -0,0 +1,178 @@
+package export
+
+import (
+	"strings"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// flushEvery is the number of records after which the output is flushed, so
+// large exports reach the client while they are still being read.
+const flushEvery = 500
+
+// ExpenseColumns is the column schema of exported expenses.
+var ExpenseColumns = []string{
+	"id",
+	"date",
+	"description",
+	"amount",
+	"currency",
+	"base_amount",
+	"base_currency",
+	"budget_id",
+	"budget_name",
+	"category_id",
+	"category_name",
+	"tags",
+}
+
+// BudgetColumns is the column schema of exported budgets.
+var BudgetColumns = []string{
+	"id",
+	"month",
+	"name",
+	"amount",
+	"spent",
+	"carried_amount",
+	"rollover_mode",
+}
+
+// Range limits an export to the days from From up to and including To. Zero
+// values leave the range open on that side.
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// Expenses streams the workspace's expenses within the range to w, ordered by
+// date. Rows are read one by one instead of loading all of them at once.
+func Expenses(db *gorm.DB, workspaceID uint, r Range, w Writer) error {
+	// Deleted budgets and categories are left out as if the expense had none
+	query := db.Model(&models.Expense{}).
+		Select(`expenses.id, expenses.date, expenses.description, expenses.amount, expenses.currency,
+			expenses.base_amount, expenses.base_currency, budgets.id, budgets.name,
+			categories.id, categories.name, `+tagsOf(db)).
+		Joins("LEFT JOIN budgets ON budgets.id = expenses.budget_id AND budgets.deleted_at IS NULL").
+		Joins("LEFT JOIN categories ON categories.id = expenses.category_id AND categories.deleted_at IS NULL").
+		Where("expenses.workspace_id = ?", workspaceID).
+		Order("expenses.date, expenses.id")
+	if !r.From.IsZero() {
+		query = query.Where("expenses.date >= ?", r.From)
+	}
+	if !r.To.IsZero() {
+		query = query.Where("expenses.date < ?", r.To.AddDate(0, 0, 1))
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var (
+			id                       uint
+			date                     time.Time
+			description              string
+			amount, baseAmount       models.Money
+			currency, baseCurrency   string
+			budgetID, categoryID     *uint
+			budgetName, categoryName *string
+			tagNames                 *string
+		)
+		if err := rows.Scan(&id, &date, &description, &amount, &currency, &baseAmount, &baseCurrency,
+			&budgetID, &budgetName, &categoryID, &categoryName, &tagNames); err != nil {
+			return err
+		}
+
+		tags := []string{}
+		if tagNames != nil {
+			tags = strings.Split(*tagNames, tagSeparator)
+		}
+
+		if err := w.Write(id, date, description, amount, currency, baseAmount, baseCurrency,
+			budgetID, budgetName, categoryID, categoryName, tags); err != nil {
+			return err
+		}
+
+		if count++; count%flushEvery == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// tagSeparator separates the aggregated tag names of an expense. Tags are
+// free-form, the control character can't be typed into a name.
+const tagSeparator = "\x1f"
+
+// tagsOf returns the SQL expression aggregating the names of the expense's
+// tags in alphabetical order, in the dialect of db.
+func tagsOf(db *gorm.DB) string {
+	if db.Dialector.Name() == "sqlite" {
+		return `(SELECT group_concat(name, char(31)) FROM (SELECT tags.name FROM expense_tags
+			JOIN tags ON tags.id = expense_tags.tag_id
+			WHERE expense_tags.expense_id = expenses.id ORDER BY tags.name))`
+	}
+	return `(SELECT string_agg(tags.name, chr(31) ORDER BY tags.name) FROM expense_tags
+		JOIN tags ON tags.id = expense_tags.tag_id
+		WHERE expense_tags.expense_id = expenses.id)`
+}
+
+// Budgets streams the workspace's budgets of the months within the range to w,
+// ordered by month.
+func Budgets(db *gorm.DB, workspaceID uint, r Range, w Writer) error {
+	query := db.Model(&models.Budget{}).
+		Select("id, month, name, amount, roll_over_amount, carried_amount, rollover_mode").
+		Where("workspace_id = ?", workspaceID).
+		Order("month, name, id")
+	if !r.From.IsZero() {
+		query = query.Where("month >= ?", r.From.Format("2006-01"))
+	}
+	if !r.To.IsZero() {
+		query = query.Where("month <= ?", r.To.Format("2006-01"))
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		var (
+			id                     uint
+			month, name, mode      string
+			amount, spent, carried models.Money
+		)
+		if err := rows.Scan(&id, &month, &name, &amount, &spent, &carried, &mode); err != nil {
+			return err
+		}
+
+		if err := w.Write(id, month, name, amount, spent, carried, mode); err != nil {
+			return err
+		}
+
+		if count++; count%flushEvery == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,141 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Budget{}, &models.Expense{}, &models.Category{}, &models.Tag{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+func seed(t *testing.T, db *gorm.DB) {
+	budget := models.Budget{UserID: 1, WorkspaceID: 1, Name: "Groceries", Amount: 50000, Month: "2024-01", RollOverAmount: 1250, RolloverMode: models.RolloverReset}
+	assert.NoError(t, db.Create(&budget).Error)
+	category := models.Category{UserID: 1, WorkspaceID: 1, Name: "Food"}
+	assert.NoError(t, db.Create(&category).Error)
+
+	tags := []models.Tag{{UserID: 1, WorkspaceID: 1, Name: "weekly"}, {UserID: 1, WorkspaceID: 1, Name: "organic"}}
+	assert.NoError(t, db.Create(&tags).Error)
+
+	assert.NoError(t, db.Create(&[]models.Expense{
+		{UserID: 1, WorkspaceID: 1, BudgetID: &budget.ID, CategoryID: &category.ID, Amount: 1250, Currency: "EUR", BaseAmount: 1250, BaseCurrency: "EUR",
+			Description: "Market, organic", Date: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC), Tags: tags},
+		{UserID: 1, WorkspaceID: 1, Amount: 999, Currency: "USD", BaseAmount: 900, BaseCurrency: "EUR",
+			Description: "Book", Date: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{UserID: 2, WorkspaceID: 2, Amount: 100, Currency: "EUR", BaseAmount: 100, BaseCurrency: "EUR",
+			Description: "Other user", Date: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+	}).Error)
+}
+
+func TestExportExpensesCSV(t *testing.T) {
+	db := setupTestDB(t)
+	seed(t, db)
+
+	var out bytes.Buffer
+	w, err := NewWriter(&out, FormatCSV, ExpenseColumns)
+	assert.NoError(t, err)
+	assert.NoError(t, Expenses(db, 1, Range{}, w))
+
+	assert.Equal(t, strings.Join([]string{
+		"id,date,description,amount,currency,base_amount,base_currency,budget_id,budget_name,category_id,category_name,tags",
+		`1,2024-01-03,"Market, organic",12.50,EUR,12.50,EUR,1,Groceries,1,Food,organic;weekly`,
+		"2,2024-02-01,Book,9.99,USD,9.00,EUR,,,,,",
+		"",
+	}, "\n"), out.String())
+}
+
+func TestExportExpensesNDJSON(t *testing.T) {
+	db := setupTestDB(t)
+	seed(t, db)
+
+	var out bytes.Buffer
+	w, err := NewWriter(&out, FormatNDJSON, ExpenseColumns)
+	assert.NoError(t, err)
+	assert.NoError(t, Expenses(db, 1, Range{To: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)}, w))
+
+	assert.Equal(t, `{"id":1,"date":"2024-01-03","description":"Market, organic","amount":12.50,"currency":"EUR",`+
+		`"base_amount":12.50,"base_currency":"EUR","budget_id":1,"budget_name":"Groceries","category_id":1,"category_name":"Food","tags":["organic","weekly"]}`+"\n",
+		out.String())
+}
+
+func TestExportBudgets(t *testing.T) {
+	db := setupTestDB(t)
+	seed(t, db)
+
+	var out bytes.Buffer
+	w, err := NewWriter(&out, FormatCSV, BudgetColumns)
+	assert.NoError(t, err)
+	assert.NoError(t, Budgets(db, 1, Range{From: time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)}, w))
+
+	assert.Equal(t, "id,month,name,amount,spent,carried_amount,rollover_mode\n1,2024-01,Groceries,500.00,12.50,0.00,reset\n", out.String())
+}
+
+func TestExportLeavesOutDeletedBudgetsAndCategories(t *testing.T) {
+	db := setupTestDB(t)
+	seed(t, db)
+	assert.NoError(t, db.Delete(&models.Budget{}, 1).Error)
+	assert.NoError(t, db.Delete(&models.Category{}, 1).Error)
+
+	var out bytes.Buffer
+	w, err := NewWriter(&out, FormatCSV, ExpenseColumns)
+	assert.NoError(t, err)
+	assert.NoError(t, Expenses(db, 1, Range{To: time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC)}, w))
+	assert.Contains(t, out.String(), `1,2024-01-03,"Market, organic",12.50,EUR,12.50,EUR,,,,,organic;weekly`)
+
+	out.Reset()
+	w, err = NewWriter(&out, FormatCSV, BudgetColumns)
+	assert.NoError(t, err)
+	assert.NoError(t, Budgets(db, 1, Range{}, w))
+	assert.Equal(t, "id,month,name,amount,spent,carried_amount,rollover_mode\n", out.String())
+}
+
+func TestExportEscapesFormulas(t *testing.T) {
+	db := setupTestDB(t)
+	assert.NoError(t, db.Create(&[]models.Expense{
+		{UserID: 1, WorkspaceID: 1, Amount: -500, Currency: "EUR", BaseAmount: -500, BaseCurrency: "EUR",
+			Description: "=HYPERLINK(\"https://example.com\")", Date: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		{UserID: 1, WorkspaceID: 1, Amount: 100, Currency: "EUR", BaseAmount: 100, BaseCurrency: "EUR",
+			Description: "@SUM(A1)", Date: time.Date(2024, 1, 4, 0, 0, 0, 0, time.UTC)},
+	}).Error)
+
+	var out bytes.Buffer
+	w, err := NewWriter(&out, FormatCSV, ExpenseColumns)
+	assert.NoError(t, err)
+	assert.NoError(t, Expenses(db, 1, Range{}, w))
+
+	// Negative amounts stay numbers
+	lines := strings.Split(out.String(), "\n")
+	assert.Equal(t, `1,2024-01-03,"'=HYPERLINK(""https://example.com"")",-5.00,EUR,-5.00,EUR,,,,,`, lines[1])
+	assert.Equal(t, "2,2024-01-04,'@SUM(A1),1.00,EUR,1.00,EUR,,,,,", lines[2])
+
+	// NDJSON isn't opened by spreadsheets and stays as it is
+	out.Reset()
+	w, err = NewWriter(&out, FormatNDJSON, ExpenseColumns)
+	assert.NoError(t, err)
+	assert.NoError(t, Expenses(db, 1, Range{}, w))
+	assert.Contains(t, out.String(), `"description":"@SUM(A1)"`)
+}
+
+func TestNewWriterRejectsUnknownFormat(t *testing.T) {
+	_, err := NewWriter(&bytes.Buffer{}, "xml", ExpenseColumns)
+	assert.Error(t, err)
+}
@@ -0,0 +1,171 @@
+package export
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/models"
+)
+
+// Version is the version of the export column schema. It changes whenever
+// columns are renamed, removed or reordered; new columns are only appended.
+const Version = "1"
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// Writer writes records with a fixed set of columns.
+type Writer interface {
+	// Write writes one record, values have to match the columns in order.
+	Write(values ...interface{}) error
+	// Flush writes any buffered data to the underlying writer.
+	Flush() error
+}
+
+// NewWriter creates a writer for the format. CSV output starts with a header
+// row naming the columns, NDJSON output has one object per line with the
+// columns as keys.
+func NewWriter(w io.Writer, format string, columns []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(columns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{out: w, writer: cw, record: make([]string, len(columns))}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{out: w, writer: bufio.NewWriter(w), columns: columns}, nil
+	}
+	return nil, fmt.Errorf("unsupported export format %q", format)
+}
+
+// ContentType returns the MIME type of the format.
+func ContentType(format string) string {
+	if format == FormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+type csvWriter struct {
+	out    io.Writer
+	writer *csv.Writer
+	record []string
+}
+
+func (w *csvWriter) Write(values ...interface{}) error {
+	for i := range w.record {
+		w.record[i] = formatValue(values[i])
+	}
+	return w.writer.Write(w.record)
+}
+
+func (w *csvWriter) Flush() error {
+	w.writer.Flush()
+	if err := w.writer.Error(); err != nil {
+		return err
+	}
+	flush(w.out)
+	return nil
+}
+
+type ndjsonWriter struct {
+	out     io.Writer
+	writer  *bufio.Writer
+	columns []string
+	line    bytes.Buffer
+}
+
+// Write encodes the record by hand to keep the keys in column order.
+func (w *ndjsonWriter) Write(values ...interface{}) error {
+	w.line.Reset()
+	w.line.WriteByte('{')
+	for i, column := range w.columns {
+		if i > 0 {
+			w.line.WriteByte(',')
+		}
+		key, _ := json.Marshal(column)
+		w.line.Write(key)
+		w.line.WriteByte(':')
+
+		value, err := json.Marshal(jsonValue(values[i]))
+		if err != nil {
+			return err
+		}
+		w.line.Write(value)
+	}
+	w.line.WriteString("}\n")
+
+	_, err := w.writer.Write(w.line.Bytes())
+	return err
+}
+
+func (w *ndjsonWriter) Flush() error {
+	if err := w.writer.Flush(); err != nil {
+		return err
+	}
+	flush(w.out)
+	return nil
+}
+
+// flush pushes buffered data of w to the client if w is a streaming HTTP
+// response.
+func flush(w io.Writer) {
+	if f, ok := w.(interface{ Flush() }); ok {
+		f.Flush()
+	}
+}
+
+// formatValue formats a value for CSV, NULLs become empty cells and lists are
+// separated by semicolons.
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return escapeFormula(v)
+	case *string:
+		if v == nil {
+			return ""
+		}
+		return escapeFormula(*v)
+	case []string:
+		return escapeFormula(strings.Join(v, ";"))
+	case *uint:
+		if v == nil {
+			return ""
+		}
+		return fmt.Sprint(*v)
+	case time.Time:
+		return v.Format("2006-01-02")
+	case models.Money:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// escapeFormula prefixes text that spreadsheets would run as a formula with a
+// quote, so opening an export can't run formulas hidden in descriptions or
+// names. Numbers are formatted by us and never escaped.
+func escapeFormula(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func jsonValue(value interface{}) interface{} {
+	if t, ok := value.(time.Time); ok {
+		return t.Format("2006-01-02")
+	}
+	return value
+}
@@ -0,0 +1,119 @@
+package importer
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// camtDocument covers the parts of an ISO 20022 camt.053 bank to customer
+// statement that are needed to read the bookings. Element names are the
+// same in all versions of the message.
+type camtDocument struct {
+	Statements []struct {
+		Entries []camtEntry `xml:"Ntry"`
+	} `xml:"BkToCstmrStmt>Stmt"`
+}
+
+type camtEntry struct {
+	Amount struct {
+		Value    string `xml:",chardata"`
+		Currency string `xml:"Ccy,attr"`
+	} `xml:"Amt"`
+	CreditDebit string `xml:"CdtDbtInd"`
+	Status      struct {
+		Value string `xml:",chardata"`
+		Code  string `xml:"Cd"` // Since version 8 of the message
+	} `xml:"Sts"`
+	BookingDate camtDate `xml:"BookgDt"`
+	ValueDate   camtDate `xml:"ValDt"`
+	Reference   string   `xml:"AcctSvcrRef"`
+	Info        string   `xml:"AddtlNtryInf"`
+	Details     []struct {
+		Reference   string   `xml:"Refs>EndToEndId"`
+		Creditor    string   `xml:"RltdPties>Cdtr>Nm"`
+		CreditorPty string   `xml:"RltdPties>Cdtr>Pty>Nm"`
+		Remittance  []string `xml:"RmtInf>Ustrd"`
+	} `xml:"NtryDtls>TxDtls"`
+}
+
+type camtDate struct {
+	Date     string `xml:"Dt"`
+	DateTime string `xml:"DtTm"`
+}
+
+func (d camtDate) parse() (time.Time, bool) {
+	if d.Date != "" {
+		t, err := time.Parse("2006-01-02", d.Date)
+		return t, err == nil
+	}
+	if len(d.DateTime) >= 10 {
+		t, err := time.Parse("2006-01-02", d.DateTime[:10])
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// ParseCAMT053 reads the booked debit entries of an ISO 20022 camt.053 XML
+// statement.
+func ParseCAMT053(r io.Reader) ([]Transaction, error) {
+	var document camtDocument
+	if err := xml.NewDecoder(r).Decode(&document); err != nil {
+		return nil, fmt.Errorf("invalid camt.053: %v", err)
+	}
+
+	var transactions []Transaction
+	for _, statement := range document.Statements {
+		for _, entry := range statement.Entries {
+			if entry.CreditDebit != "DBIT" {
+				continue // Incoming payment
+			}
+			// Pending entries may still change, only booked ones are imported
+			if status := strings.TrimSpace(entry.Status.Value + entry.Status.Code); status != "" && status != "BOOK" {
+				continue
+			}
+
+			date, ok := entry.BookingDate.parse()
+			if !ok {
+				if date, ok = entry.ValueDate.parse(); !ok {
+					return nil, fmt.Errorf("invalid camt.053: entry %q has no date", entry.Reference)
+				}
+			}
+
+			amount, err := parseAmount(entry.Amount.Value, ".")
+			if err != nil || amount <= 0 {
+				return nil, fmt.Errorf("invalid camt.053: invalid amount %q", entry.Amount.Value)
+			}
+
+			transactions = append(transactions, Transaction{
+				Date:        date,
+				Amount:      amount,
+				Currency:    strings.ToUpper(entry.Amount.Currency),
+				Description: camtDescription(entry),
+				ExternalID:  entry.Reference,
+			})
+		}
+	}
+
+	return transactions, nil
+}
+
+// camtDescription combines the creditor and the remittance information, the
+// closest thing to a description a bank statement has.
+func camtDescription(entry camtEntry) string {
+	var parts []string
+	for _, details := range entry.Details {
+		if details.Creditor != "" {
+			parts = append(parts, details.Creditor)
+		} else if details.CreditorPty != "" {
+			parts = append(parts, details.CreditorPty)
+		}
+		parts = append(parts, details.Remittance...)
+	}
+	if len(parts) == 0 && entry.Info != "" {
+		parts = append(parts, entry.Info)
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
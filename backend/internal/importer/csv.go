@@ -0,0 +1,131 @@
+package importer
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CSVMapping describes how the columns of a bank's CSV export map to
+// transactions. Columns are referenced by their header names.
+type CSVMapping struct {
+	Date        string `json:"date"`
+	Amount      string `json:"amount"`
+	Description string `json:"description"`
+	Currency    string `json:"currency,omitempty"`
+	ID          string `json:"id,omitempty"`
+
+	DateFormat       string `json:"date_format,omitempty"`       // Go layout, defaults to 2006-01-02
+	Delimiter        string `json:"delimiter,omitempty"`         // Defaults to a comma
+	DecimalSeparator string `json:"decimal_separator,omitempty"` // "." (default) or ","
+	// DebitsPositive is set for exports that list outgoing payments as
+	// positive and incoming payments as negative amounts.
+	DebitsPositive bool `json:"debits_positive,omitempty"`
+}
+
+// ParseCSV reads transactions from a CSV file with a header row.
+func ParseCSV(r io.Reader, mapping CSVMapping) ([]Transaction, error) {
+	if mapping.Date == "" || mapping.Amount == "" || mapping.Description == "" {
+		return nil, fmt.Errorf("the CSV mapping needs date, amount and description columns")
+	}
+	if mapping.DateFormat == "" {
+		mapping.DateFormat = "2006-01-02"
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if mapping.Delimiter != "" {
+		delimiter, size := utf8.DecodeRuneInString(mapping.Delimiter)
+		if size != len(mapping.Delimiter) {
+			return nil, fmt.Errorf("the delimiter has to be a single character")
+		}
+		reader.Comma = delimiter
+	}
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %v", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+
+	index := func(name string) (int, error) {
+		if name == "" {
+			return -1, nil
+		}
+		i, ok := columns[name]
+		if !ok {
+			return 0, fmt.Errorf("column %q not found", name)
+		}
+		return i, nil
+	}
+
+	var dateCol, amountCol, descriptionCol, currencyCol, idCol int
+	for _, c := range []struct {
+		target *int
+		name   string
+	}{
+		{&dateCol, mapping.Date},
+		{&amountCol, mapping.Amount},
+		{&descriptionCol, mapping.Description},
+		{&currencyCol, mapping.Currency},
+		{&idCol, mapping.ID},
+	} {
+		if *c.target, err = index(c.name); err != nil {
+			return nil, err
+		}
+	}
+
+	field := func(record []string, i int) string {
+		if i < 0 || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var transactions []Transaction
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %v", err)
+		}
+		if len(record) == 1 && strings.TrimSpace(record[0]) == "" {
+			continue
+		}
+
+		date, err := time.Parse(mapping.DateFormat, field(record, dateCol))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid date %q", line, field(record, dateCol))
+		}
+
+		amount, err := parseAmount(field(record, amountCol), mapping.DecimalSeparator)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid amount %q", line, field(record, amountCol))
+		}
+		if !mapping.DebitsPositive {
+			amount = -amount
+		}
+		if amount <= 0 {
+			continue // Incoming payment
+		}
+
+		transactions = append(transactions, Transaction{
+			Date:        date,
+			Amount:      amount,
+			Currency:    strings.ToUpper(field(record, currencyCol)),
+			Description: field(record, descriptionCol),
+			ExternalID:  field(record, idCol),
+		})
+	}
+
+	return transactions, nil
+}
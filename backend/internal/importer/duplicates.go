@@ -0,0 +1,181 @@
+package importer
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// duplicateWindow is how many days apart an imported booking and an
+	// existing expense may be dated, banks often book card payments later.
+	duplicateWindow = 3
+	// duplicateThreshold is the score from which a candidate is flagged.
+	duplicateThreshold = 0.5
+	// sameDayBonus is added to the description similarity for bookings on
+	// the same day. It alone reaches the threshold, as hand-written
+	// descriptions rarely resemble the bank's.
+	sameDayBonus = 0.5
+)
+
+// Candidate is an imported transaction as shown in the preview, together
+// with the result of the duplicate detection.
+type Candidate struct {
+	Index       int          `json:"index"`
+	Date        string       `json:"date"`
+	Amount      models.Money `json:"amount"`
+	Currency    string       `json:"currency,omitempty"`
+	Description string       `json:"description"`
+	ExternalID  string       `json:"external_id,omitempty"`
+	Duplicate   bool         `json:"duplicate"`
+	DuplicateOf *uint        `json:"duplicate_of,omitempty"` // Matching expense, unset for repeats within the file
+	Score       float64      `json:"score,omitempty"`
+}
+
+// Preview turns transactions into candidates and flags the ones that are
+// likely already recorded as expenses of the workspace. A candidate is a
+// duplicate if it has the same bank ID as an expense or an earlier row of
+// the file, or if an expense has the same amount and either the same date or
+// a date at most a few days apart and a similar description.
+func Preview(db *gorm.DB, workspaceID uint, transactions []Transaction) ([]Candidate, error) {
+	candidates := make([]Candidate, 0, len(transactions))
+	if len(transactions) == 0 {
+		return candidates, nil
+	}
+
+	from, to := transactions[0].Date, transactions[0].Date
+	for _, transaction := range transactions {
+		if transaction.Date.Before(from) {
+			from = transaction.Date
+		}
+		if transaction.Date.After(to) {
+			to = transaction.Date
+		}
+	}
+
+	var existing []models.Expense
+	if err := db.Select("id", "date", "amount", "currency", "description", "external_id").
+		Where("workspace_id = ? AND date >= ? AND date < ?", workspaceID,
+			from.AddDate(0, 0, -duplicateWindow), to.AddDate(0, 0, duplicateWindow+1)).
+		Find(&existing).Error; err != nil {
+		return nil, err
+	}
+
+	var externalIDs []string
+	for _, transaction := range transactions {
+		if transaction.ExternalID != "" {
+			externalIDs = append(externalIDs, transaction.ExternalID)
+		}
+	}
+	byExternalID := map[string]uint{}
+	if len(externalIDs) > 0 {
+		var known []models.Expense
+		if err := db.Select("id", "external_id").
+			Where("workspace_id = ? AND external_id IN ?", workspaceID, externalIDs).
+			Find(&known).Error; err != nil {
+			return nil, err
+		}
+		for _, expense := range known {
+			byExternalID[expense.ExternalID] = expense.ID
+		}
+	}
+
+	seen := map[string]bool{}
+	for i, transaction := range transactions {
+		candidate := Candidate{
+			Index:       i,
+			Date:        transaction.Date.Format("2006-01-02"),
+			Amount:      transaction.Amount,
+			Currency:    transaction.Currency,
+			Description: transaction.Description,
+			ExternalID:  transaction.ExternalID,
+		}
+
+		if id, ok := byExternalID[transaction.ExternalID]; ok && transaction.ExternalID != "" {
+			candidate.Duplicate, candidate.DuplicateOf, candidate.Score = true, &id, 1
+		} else if transaction.ExternalID != "" && seen[transaction.ExternalID] {
+			candidate.Duplicate, candidate.Score = true, 1
+		} else if match, score := bestMatch(transaction, existing); score >= duplicateThreshold {
+			candidate.Duplicate, candidate.DuplicateOf, candidate.Score = true, &match.ID, score
+		}
+		seen[transaction.ExternalID] = true
+
+		candidates = append(candidates, candidate)
+	}
+
+	return candidates, nil
+}
+
+// bestMatch returns the expense that most likely records the transaction.
+func bestMatch(transaction Transaction, expenses []models.Expense) (models.Expense, float64) {
+	var (
+		best  models.Expense
+		score float64
+	)
+	for _, expense := range expenses {
+		if expense.Amount != transaction.Amount {
+			continue
+		}
+		if transaction.Currency != "" && expense.Currency != "" && transaction.Currency != expense.Currency {
+			continue
+		}
+
+		days := expense.Date.Sub(transaction.Date).Hours() / 24
+		if days < -duplicateWindow || days > duplicateWindow {
+			continue
+		}
+
+		s := Similarity(transaction.Description, expense.Description)
+		if sameDay(expense.Date, transaction.Date) {
+			s += sameDayBonus
+		}
+		if s > 1 {
+			s = 1
+		}
+		if s > score {
+			best, score = expense, s
+		}
+	}
+	return best, score
+}
+
+func sameDay(a, b time.Time) bool {
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
+
+// Similarity compares two descriptions by their character trigrams. It
+// returns a value between 0 (nothing in common) and 1 (same text), ignoring
+// case, punctuation and word order to some degree.
+func Similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+
+	common := 0
+	for trigram := range ta {
+		if tb[trigram] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+func trigrams(s string) map[string]bool {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	result := map[string]bool{}
+	for _, word := range words {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			result[string(padded[i:i+3])] = true
+		}
+	}
+	return result
+}
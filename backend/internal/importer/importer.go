@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/models"
+)
+
+// Supported file formats.
+const (
+	FormatCSV     = "csv"
+	FormatOFX     = "ofx" // Also covers QFX, which is OFX with Quicken extensions
+	FormatCAMT053 = "camt053"
+)
+
+// Transaction is a booking read from a bank file. Only outgoing payments
+// become transactions, incoming payments are skipped.
+type Transaction struct {
+	Date        time.Time
+	Amount      models.Money // Always positive
+	Currency    string       // Empty if the file doesn't name one
+	Description string
+	ExternalID  string // The bank's ID of the booking, if any
+}
+
+// Parse reads the transactions of a bank file. An empty format detects it
+// from the content. The mapping is only used for CSV files.
+func Parse(r io.Reader, format string, mapping CSVMapping) ([]Transaction, string, error) {
+	br := bufio.NewReader(r)
+	if format == "" || format == "auto" {
+		start, err := br.Peek(4096)
+		if err != nil && err != io.EOF {
+			return nil, "", err
+		}
+		format = Detect(start)
+	}
+
+	var (
+		transactions []Transaction
+		err          error
+	)
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		format = FormatCSV
+		transactions, err = ParseCSV(br, mapping)
+	case FormatOFX, "qfx":
+		format = FormatOFX
+		transactions, err = ParseOFX(br)
+	case FormatCAMT053, "camt":
+		format = FormatCAMT053
+		transactions, err = ParseCAMT053(br)
+	default:
+		return nil, "", fmt.Errorf("unsupported import format %q", format)
+	}
+
+	return transactions, format, err
+}
+
+// Detect guesses the format of a bank file from its first bytes.
+func Detect(start []byte) string {
+	upper := bytes.ToUpper(start)
+	switch {
+	case bytes.Contains(upper, []byte("OFXHEADER")) || bytes.Contains(upper, []byte("<OFX>")):
+		return FormatOFX
+	case bytes.Contains(start, []byte("camt.053")) || bytes.Contains(start, []byte("BkToCstmrStmt")):
+		return FormatCAMT053
+	}
+	return FormatCSV
+}
+
+// parseAmount parses amounts as written by banks, with either a dot or a
+// comma as decimal separator and optional thousands separators.
+func parseAmount(value string, decimalSeparator string) (models.Money, error) {
+	value = strings.TrimSpace(value)
+	value = strings.NewReplacer(" ", "", "\u00a0", "", "'", "").Replace(value)
+
+	if decimalSeparator == "," {
+		value = strings.ReplaceAll(value, ".", "")
+		value = strings.ReplaceAll(value, ",", ".")
+	} else {
+		value = strings.ReplaceAll(value, ",", "")
+	}
+
+	// Some banks write negative amounts as "(12.34)" or "12.34-"
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		value = "-" + strings.Trim(value, "()")
+	}
+	if strings.HasSuffix(value, "-") {
+		value = "-" + strings.TrimSuffix(value, "-")
+	}
+
+	return models.ParseMoney(value)
+}
@@ -0,0 +1,198 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Expense{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+func date(value string) time.Time {
+	d, _ := time.Parse("2006-01-02", value)
+	return d
+}
+
+const sampleCSV = `Buchungstag;Verwendungszweck;Betrag;Währung;Referenz
+05.01.2024;REWE SAGT DANKE 4711;-1.234,56;EUR;A1
+06.01.2024;Gehalt Januar;2.500,00;EUR;A2
+07.01.2024;"Spotify; Premium";-9,99;EUR;A3
+`
+
+func TestParseCSV(t *testing.T) {
+	transactions, format, err := Parse(strings.NewReader(sampleCSV), "", CSVMapping{
+		Date:             "Buchungstag",
+		Amount:           "Betrag",
+		Description:      "Verwendungszweck",
+		Currency:         "Währung",
+		ID:               "Referenz",
+		DateFormat:       "02.01.2006",
+		Delimiter:        ";",
+		DecimalSeparator: ",",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, FormatCSV, format)
+	assert.Equal(t, []Transaction{
+		{Date: date("2024-01-05"), Amount: 123456, Currency: "EUR", Description: "REWE SAGT DANKE 4711", ExternalID: "A1"},
+		{Date: date("2024-01-07"), Amount: 999, Currency: "EUR", Description: "Spotify; Premium", ExternalID: "A3"},
+	}, transactions)
+
+	_, err = ParseCSV(strings.NewReader(sampleCSV), CSVMapping{Date: "Date", Amount: "Betrag", Description: "Verwendungszweck", Delimiter: ";"})
+	assert.Error(t, err)
+}
+
+const sampleOFX = `OFXHEADER:100
+DATA:OFXSGML
+VERSION:102
+
+<OFX>
+<BANKMSGSRSV1><STMTTRNRS><STMTRS>
+<CURDEF>USD
+<BANKTRANLIST>
+<STMTTRN>
+<TRNTYPE>DEBIT
+<DTPOSTED>20240105120000[-5:EST]
+<TRNAMT>-42.50
+<FITID>2024010501
+<NAME>WHOLE FOODS &amp; CO
+<MEMO>Card 1234
+</STMTTRN>
+<STMTTRN>
+<TRNTYPE>CREDIT
+<DTPOSTED>20240106
+<TRNAMT>1000.00
+<FITID>2024010601
+<NAME>PAYROLL
+</STMTTRN>
+</BANKTRANLIST>
+</STMTRS></STMTTRNRS></BANKMSGSRSV1>
+</OFX>
+`
+
+const sampleOFX2 = `<?xml version="1.0" encoding="UTF-8"?>
+<?OFX OFXHEADER="200" VERSION="220"?>
+<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><CURDEF>EUR</CURDEF><BANKTRANLIST>
+<STMTTRN><TRNTYPE>POS</TRNTYPE><DTPOSTED>20240201</DTPOSTED><TRNAMT>-3.20</TRNAMT><FITID>X9</FITID><NAME>Bakery</NAME></STMTTRN>
+</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>
+`
+
+func TestParseOFX(t *testing.T) {
+	transactions, format, err := Parse(strings.NewReader(sampleOFX), "", CSVMapping{})
+	assert.NoError(t, err)
+	assert.Equal(t, FormatOFX, format)
+	assert.Equal(t, []Transaction{
+		{Date: date("2024-01-05"), Amount: 4250, Currency: "USD", Description: "WHOLE FOODS & CO Card 1234", ExternalID: "2024010501"},
+	}, transactions)
+
+	transactions, _, err = Parse(strings.NewReader(sampleOFX2), "qfx", CSVMapping{})
+	assert.NoError(t, err)
+	assert.Equal(t, []Transaction{
+		{Date: date("2024-02-01"), Amount: 320, Currency: "EUR", Description: "Bakery", ExternalID: "X9"},
+	}, transactions)
+}
+
+const sampleCAMT = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:camt.053.001.02">
+<BkToCstmrStmt><Stmt>
+	<Ntry>
+		<Amt Ccy="EUR">59.90</Amt>
+		<CdtDbtInd>DBIT</CdtDbtInd>
+		<Sts>BOOK</Sts>
+		<BookgDt><Dt>2024-03-01</Dt></BookgDt>
+		<ValDt><Dt>2024-03-02</Dt></ValDt>
+		<AcctSvcrRef>REF-1</AcctSvcrRef>
+		<NtryDtls><TxDtls>
+			<RltdPties><Cdtr><Nm>Stadtwerke</Nm></Cdtr></RltdPties>
+			<RmtInf><Ustrd>Abschlag   März</Ustrd></RmtInf>
+		</TxDtls></NtryDtls>
+	</Ntry>
+	<Ntry>
+		<Amt Ccy="EUR">10.00</Amt>
+		<CdtDbtInd>DBIT</CdtDbtInd>
+		<Sts><Cd>PDNG</Cd></Sts>
+		<BookgDt><DtTm>2024-03-03T10:00:00</DtTm></BookgDt>
+	</Ntry>
+	<Ntry>
+		<Amt Ccy="EUR">2000.00</Amt>
+		<CdtDbtInd>CRDT</CdtDbtInd>
+		<Sts>BOOK</Sts>
+		<BookgDt><Dt>2024-03-01</Dt></BookgDt>
+	</Ntry>
+</Stmt></BkToCstmrStmt>
+</Document>
+`
+
+func TestParseCAMT053(t *testing.T) {
+	transactions, format, err := Parse(strings.NewReader(sampleCAMT), "", CSVMapping{})
+	assert.NoError(t, err)
+	assert.Equal(t, FormatCAMT053, format)
+	assert.Equal(t, []Transaction{
+		{Date: date("2024-03-01"), Amount: 5990, Currency: "EUR", Description: "Stadtwerke Abschlag März", ExternalID: "REF-1"},
+	}, transactions)
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, Similarity("REWE Markt", "rewe markt!"))
+	assert.Greater(t, Similarity("REWE SAGT DANKE 4711", "Rewe"), 0.2)
+	assert.Equal(t, 0.0, Similarity("Rent", "Groceries"))
+	assert.Equal(t, 0.0, Similarity("", "Groceries"))
+}
+
+func TestPreview(t *testing.T) {
+	db := setupTestDB(t)
+
+	existing := []models.Expense{
+		{UserID: 1, WorkspaceID: 1, Amount: 4250, Currency: "USD", Description: "Whole Foods", Date: date("2024-01-04")},
+		{UserID: 1, WorkspaceID: 1, Amount: 999, Currency: "EUR", Description: "Music", Date: date("2024-01-07")},
+		{UserID: 1, WorkspaceID: 1, Amount: 1500, Currency: "EUR", Description: "Bakery", Date: date("2024-01-08"), ExternalID: "B1"},
+		{UserID: 2, WorkspaceID: 2, Amount: 700, Currency: "EUR", Description: "Cinema", Date: date("2024-01-07")},
+	}
+	assert.NoError(t, db.Create(&existing).Error)
+
+	candidates, err := Preview(db, 1, []Transaction{
+		{Date: date("2024-01-05"), Amount: 4250, Currency: "USD", Description: "WHOLE FOODS MARKET #123"},
+		{Date: date("2024-01-07"), Amount: 999, Currency: "EUR", Description: "Spotify"},
+		{Date: date("2024-01-09"), Amount: 1600, Currency: "EUR", Description: "Bakery", ExternalID: "B1"},
+		{Date: date("2024-01-07"), Amount: 700, Currency: "EUR", Description: "Cinema"},
+		{Date: date("2024-01-20"), Amount: 4250, Currency: "USD", Description: "Whole Foods"},
+		{Date: date("2024-01-21"), Amount: 100, Currency: "EUR", Description: "Kiosk", ExternalID: "K1"},
+		{Date: date("2024-01-21"), Amount: 100, Currency: "EUR", Description: "Kiosk", ExternalID: "K1"},
+	})
+	assert.NoError(t, err)
+	assert.Len(t, candidates, 7)
+
+	// Similar description within a few days
+	assert.True(t, candidates[0].Duplicate)
+	assert.Equal(t, existing[0].ID, *candidates[0].DuplicateOf)
+	// Same amount on the same day
+	assert.True(t, candidates[1].Duplicate)
+	// Same bank ID
+	assert.True(t, candidates[2].Duplicate)
+	assert.Equal(t, existing[2].ID, *candidates[2].DuplicateOf)
+	// Other users' expenses don't count
+	assert.False(t, candidates[3].Duplicate)
+	// Too far apart
+	assert.False(t, candidates[4].Duplicate)
+	// Repeated within the file
+	assert.False(t, candidates[5].Duplicate)
+	assert.True(t, candidates[6].Duplicate)
+	assert.Nil(t, candidates[6].DuplicateOf)
+}
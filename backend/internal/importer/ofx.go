@@ -0,0 +1,108 @@
+package importer
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"time"
+)
+
+// ParseOFX reads transactions from an OFX or QFX file. Both the SGML based
+// OFX 1.x, where leaf elements aren't closed, and the XML based OFX 2.x are
+// supported.
+func ParseOFX(r io.Reader) ([]Transaction, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	content := string(data)
+
+	start := strings.Index(strings.ToUpper(content), "<OFX>")
+	if start < 0 {
+		return nil, fmt.Errorf("invalid OFX: no <OFX> element")
+	}
+	content = content[start:]
+
+	var (
+		transactions []Transaction
+		currency     string
+		current      map[string]string // Fields of the STMTTRN being read
+	)
+
+	for len(content) > 0 {
+		open := strings.IndexByte(content, '<')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(content[open:], '>')
+		if end < 0 {
+			return nil, fmt.Errorf("invalid OFX: unterminated element")
+		}
+		tag := strings.ToUpper(strings.TrimSpace(content[open+1 : open+end]))
+		content = content[open+end+1:]
+
+		next := strings.IndexByte(content, '<')
+		if next < 0 {
+			next = len(content)
+		}
+		value := html.UnescapeString(strings.TrimSpace(content[:next]))
+
+		switch {
+		case tag == "STMTTRN":
+			current = map[string]string{}
+		case tag == "/STMTTRN":
+			if current == nil {
+				continue
+			}
+			transaction, ok, err := ofxTransaction(current, currency)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				transactions = append(transactions, transaction)
+			}
+			current = nil
+		case tag == "CURDEF":
+			currency = strings.ToUpper(value)
+		case strings.HasPrefix(tag, "/"):
+			// Closing tags of leaf elements only appear in OFX 2.x
+		case current != nil && value != "":
+			current[tag] = value
+		}
+	}
+
+	return transactions, nil
+}
+
+func ofxTransaction(fields map[string]string, currency string) (Transaction, bool, error) {
+	posted := fields["DTPOSTED"]
+	if len(posted) < 8 {
+		return Transaction{}, false, fmt.Errorf("invalid OFX: transaction %q has no valid DTPOSTED", fields["FITID"])
+	}
+	date, err := time.Parse("20060102", posted[:8])
+	if err != nil {
+		return Transaction{}, false, fmt.Errorf("invalid OFX: invalid date %q", posted)
+	}
+
+	amount, err := parseAmount(fields["TRNAMT"], ".")
+	if err != nil {
+		return Transaction{}, false, fmt.Errorf("invalid OFX: invalid amount %q", fields["TRNAMT"])
+	}
+	if amount >= 0 {
+		return Transaction{}, false, nil // Incoming payment
+	}
+
+	description := fields["NAME"]
+	if memo := fields["MEMO"]; memo != "" && memo != description {
+		description = strings.TrimSpace(description + " " + memo)
+	}
+
+	return Transaction{
+		Date:        date,
+		Amount:      -amount,
+		Currency:    currency,
+		Description: description,
+		ExternalID:  fields["FITID"],
+	}, true, nil
+}
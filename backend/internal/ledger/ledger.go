@@ -0,0 +1,199 @@
+package ledger
+
+import (
+	"sort"
+
+	"expense-tracker/internal/currency"
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// Balance is what a user paid for others and owes to others in a workspace,
+// in its base currency. A positive net amount is owed to the user, a negative
+// one the user owes.
+type Balance struct {
+	UserID uint         `json:"user_id"`
+	Net    models.Money `json:"net"`
+}
+
+// Transfer is a payment that settles debts.
+type Transfer struct {
+	FromUserID uint         `json:"from_user_id"`
+	ToUserID   uint         `json:"to_user_id"`
+	Amount     models.Money `json:"amount"`
+}
+
+// Debts returns what each user owes to each other user in the workspace from
+// split expenses and settlements, netted per pair of users.
+func Debts(db *gorm.DB, workspaceID uint) ([]Transfer, error) {
+	// owed[debtor][creditor] is the amount the debtor owes the creditor
+	owed := make(map[[2]uint]models.Money)
+	add := func(debtor, creditor uint, amount models.Money) {
+		if debtor == creditor || amount == 0 {
+			return
+		}
+		if debtor > creditor {
+			owed[[2]uint{creditor, debtor}] -= amount
+		} else {
+			owed[[2]uint{debtor, creditor}] += amount
+		}
+	}
+
+	var shares []struct {
+		UserID   uint
+		PaidByID uint
+		Amount   models.Money
+	}
+	if err := db.Model(&models.ExpenseSplit{}).
+		Select("expense_splits.user_id, expenses.paid_by_id, CAST(SUM(expense_splits.amount) AS BIGINT) AS amount").
+		Joins("JOIN expenses ON expenses.id = expense_splits.expense_id AND expenses.deleted_at IS NULL").
+		Where("expenses.workspace_id = ? AND expenses.paid_by_id IS NOT NULL", workspaceID).
+		Group("expense_splits.user_id, expenses.paid_by_id").
+		Scan(&shares).Error; err != nil {
+		return nil, err
+	}
+	for _, share := range shares {
+		add(share.UserID, share.PaidByID, share.Amount)
+	}
+
+	var payments []struct {
+		FromUserID uint
+		ToUserID   uint
+		Amount     models.Money
+	}
+	if err := db.Model(&models.Settlement{}).
+		Select("from_user_id, to_user_id, CAST(SUM(base_amount) AS BIGINT) AS amount").
+		Where("workspace_id = ?", workspaceID).
+		Group("from_user_id, to_user_id").
+		Scan(&payments).Error; err != nil {
+		return nil, err
+	}
+	for _, payment := range payments {
+		// Paying a creditor reduces the debt like a debt in the other direction
+		add(payment.ToUserID, payment.FromUserID, payment.Amount)
+	}
+
+	debts := []Transfer{}
+	for pair, amount := range owed {
+		switch {
+		case amount > 0:
+			debts = append(debts, Transfer{FromUserID: pair[0], ToUserID: pair[1], Amount: amount})
+		case amount < 0:
+			debts = append(debts, Transfer{FromUserID: pair[1], ToUserID: pair[0], Amount: -amount})
+		}
+	}
+	sortTransfers(debts)
+	return debts, nil
+}
+
+// Balances returns the net balance of every user with open debts or claims,
+// ordered by user.
+func Balances(debts []Transfer) []Balance {
+	net := make(map[uint]models.Money)
+	for _, debt := range debts {
+		net[debt.FromUserID] -= debt.Amount
+		net[debt.ToUserID] += debt.Amount
+	}
+
+	balances := []Balance{}
+	for userID, amount := range net {
+		if amount != 0 {
+			balances = append(balances, Balance{UserID: userID, Net: amount})
+		}
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].UserID < balances[j].UserID })
+	return balances
+}
+
+// Simplify returns transfers that settle the balances with few payments. The
+// user owing the most repeatedly pays the user owed the most, which takes at
+// most one transfer less than there are users with a balance.
+func Simplify(balances []Balance) []Transfer {
+	var debtors, creditors []Balance
+	for _, balance := range balances {
+		switch {
+		case balance.Net < 0:
+			debtors = append(debtors, Balance{UserID: balance.UserID, Net: -balance.Net})
+		case balance.Net > 0:
+			creditors = append(creditors, balance)
+		}
+	}
+
+	byAmount := func(list []Balance) {
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].Net != list[j].Net {
+				return list[i].Net > list[j].Net
+			}
+			return list[i].UserID < list[j].UserID
+		})
+	}
+
+	transfers := []Transfer{}
+	for len(debtors) > 0 && len(creditors) > 0 {
+		byAmount(debtors)
+		byAmount(creditors)
+
+		amount := min(debtors[0].Net, creditors[0].Net)
+		transfers = append(transfers, Transfer{FromUserID: debtors[0].UserID, ToUserID: creditors[0].UserID, Amount: amount})
+
+		debtors[0].Net -= amount
+		creditors[0].Net -= amount
+		if debtors[0].Net == 0 {
+			debtors = debtors[1:]
+		}
+		if creditors[0].Net == 0 {
+			creditors = creditors[1:]
+		}
+	}
+	return transfers
+}
+
+// Rebase converts the settlements and divides the split expenses of the
+// workspace again after its base currency changed. Expenses have to be
+// converted already.
+func Rebase(tx *gorm.DB, workspaceID uint) error {
+	var workspace models.Workspace
+	if err := tx.Select("id", "base_currency").First(&workspace, workspaceID).Error; err != nil {
+		return err
+	}
+
+	var settlements []models.Settlement
+	if err := tx.Where("workspace_id = ?", workspaceID).Find(&settlements).Error; err != nil {
+		return err
+	}
+	for _, settlement := range settlements {
+		baseAmount, err := currency.Convert(tx, settlement.Amount, settlement.Currency, workspace.BaseCurrency, settlement.Date)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&settlement).UpdateColumns(map[string]interface{}{
+			"base_amount":   baseAmount,
+			"base_currency": workspace.BaseCurrency,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	var expenses []models.Expense
+	if err := tx.Select("id", "base_amount").
+		Where("workspace_id = ? AND split_method <> ''", workspaceID).
+		Find(&expenses).Error; err != nil {
+		return err
+	}
+	for i := range expenses {
+		if err := Reapportion(tx, &expenses[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortTransfers(transfers []Transfer) {
+	sort.Slice(transfers, func(i, j int) bool {
+		if transfers[i].FromUserID != transfers[j].FromUserID {
+			return transfers[i].FromUserID < transfers[j].FromUserID
+		}
+		return transfers[i].ToUserID < transfers[j].ToUserID
+	})
+}
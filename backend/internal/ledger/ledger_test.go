@@ -0,0 +1,156 @@
+package ledger
+
+import (
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Workspace{}, &models.WorkspaceMember{}, &models.Expense{}, &models.ExpenseSplit{}, &models.Settlement{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+func money(value string) *models.Money {
+	m := models.MustParseMoney(value)
+	return &m
+}
+
+func percent(value float64) *float64 {
+	return &value
+}
+
+func TestWeights(t *testing.T) {
+	amount := models.MustParseMoney("30.00")
+
+	weights, err := Weights(Split{Method: models.SplitEqual, Shares: []Share{{UserID: 1}, {UserID: 2}}}, amount)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1, 1}, weights)
+
+	weights, err = Weights(Split{Method: models.SplitExact, Shares: []Share{{UserID: 1, Amount: money("10.00")}, {UserID: 2, Amount: money("20.00")}}}, amount)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{1000, 2000}, weights)
+
+	weights, err = Weights(Split{Method: models.SplitPercent, Shares: []Share{{UserID: 1, Percent: percent(33.3333)}, {UserID: 2, Percent: percent(66.6667)}}}, amount)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{333333, 666667}, weights)
+
+	_, err = Weights(Split{Method: models.SplitExact, Shares: []Share{{UserID: 1, Amount: money("10.00")}}}, amount)
+	assert.ErrorIs(t, err, ErrInvalidSplit)
+
+	_, err = Weights(Split{Method: models.SplitPercent, Shares: []Share{{UserID: 1, Percent: percent(50)}, {UserID: 2, Percent: percent(40)}}}, amount)
+	assert.ErrorIs(t, err, ErrInvalidSplit)
+
+	_, err = Weights(Split{Method: models.SplitEqual, Shares: []Share{{UserID: 1}, {UserID: 1}}}, amount)
+	assert.ErrorIs(t, err, ErrInvalidSplit)
+
+	_, err = Weights(Split{Method: models.SplitEqual}, amount)
+	assert.ErrorIs(t, err, ErrInvalidSplit)
+}
+
+func TestApportion(t *testing.T) {
+	// Left over cents go to the earlier parts
+	assert.Equal(t, []models.Money{34, 33, 33}, Apportion(100, []int64{1, 1, 1}))
+	assert.Equal(t, []models.Money{-34, -33, -33}, Apportion(-100, []int64{1, 1, 1}))
+	// And to the largest remainders first
+	assert.Equal(t, []models.Money{33, 67}, Apportion(100, []int64{1, 2}))
+	assert.Equal(t, []models.Money{0, 0}, Apportion(0, []int64{1, 1}))
+
+	parts := Apportion(models.MustParseMoney("1000000000.01"), []int64{333333, 333333, 333334})
+	var sum models.Money
+	for _, part := range parts {
+		sum += part
+	}
+	assert.Equal(t, models.MustParseMoney("1000000000.01"), sum)
+}
+
+func TestSimplify(t *testing.T) {
+	// 1 owes 2 and 2 owes 3 the same amount, so 1 pays 3 directly
+	debts := []Transfer{{FromUserID: 1, ToUserID: 2, Amount: 500}, {FromUserID: 2, ToUserID: 3, Amount: 500}}
+	balances := Balances(debts)
+	assert.Equal(t, []Balance{{UserID: 1, Net: -500}, {UserID: 3, Net: 500}}, balances)
+	assert.Equal(t, []Transfer{{FromUserID: 1, ToUserID: 3, Amount: 500}}, Simplify(balances))
+
+	balances = []Balance{{UserID: 1, Net: -300}, {UserID: 2, Net: -100}, {UserID: 3, Net: 250}, {UserID: 4, Net: 150}}
+	assert.Equal(t, []Transfer{
+		{FromUserID: 1, ToUserID: 3, Amount: 250},
+		{FromUserID: 2, ToUserID: 4, Amount: 100},
+		{FromUserID: 1, ToUserID: 4, Amount: 50},
+	}, Simplify(balances))
+
+	assert.Empty(t, Simplify(nil))
+}
+
+func TestDebts(t *testing.T) {
+	db := setupTestDB(t)
+	workspace := models.Workspace{Name: "Household", BaseCurrency: "USD"}
+	assert.NoError(t, db.Create(&workspace).Error)
+	for _, id := range []uint{1, 2, 3} {
+		assert.NoError(t, db.Create(&models.User{ID: id, Email: string(rune('a'+id)) + "@example.com", PasswordHash: "x"}).Error)
+		assert.NoError(t, db.Create(&models.WorkspaceMember{WorkspaceID: workspace.ID, UserID: id, Role: models.RoleEditor}).Error)
+	}
+
+	create := func(userID uint, amount string, split Split) *models.Expense {
+		expense := models.Expense{
+			UserID: userID, WorkspaceID: workspace.ID, Description: "Shared", Date: time.Now(),
+			Amount: models.MustParseMoney(amount), Currency: "USD", BaseAmount: models.MustParseMoney(amount), BaseCurrency: "USD",
+		}
+		assert.NoError(t, db.Create(&expense).Error)
+		assert.NoError(t, Assign(db, &expense, split))
+		return &expense
+	}
+
+	equal := Split{Method: models.SplitEqual, Shares: []Share{{UserID: 1}, {UserID: 2}, {UserID: 3}}}
+	create(1, "90.00", equal)
+	taxi := create(2, "30.00", equal)
+
+	debts, err := Debts(db, workspace.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []Transfer{
+		{FromUserID: 2, ToUserID: 1, Amount: models.MustParseMoney("20.00")},
+		{FromUserID: 3, ToUserID: 1, Amount: models.MustParseMoney("30.00")},
+		{FromUserID: 3, ToUserID: 2, Amount: models.MustParseMoney("10.00")},
+	}, debts)
+
+	// Simplified, user 3 pays everything to user 1
+	assert.Equal(t, []Transfer{
+		{FromUserID: 3, ToUserID: 1, Amount: models.MustParseMoney("40.00")},
+		{FromUserID: 2, ToUserID: 1, Amount: models.MustParseMoney("10.00")},
+	}, Simplify(Balances(debts)))
+
+	// Deleted expenses and settlements reduce the debts
+	assert.NoError(t, db.Delete(taxi).Error)
+	assert.NoError(t, db.Create(&models.Settlement{
+		WorkspaceID: workspace.ID, FromUserID: 3, ToUserID: 1, Amount: models.MustParseMoney("30.00"), Currency: "USD",
+		BaseAmount: models.MustParseMoney("30.00"), BaseCurrency: "USD", Date: time.Now(), CreatedByID: 3,
+	}).Error)
+
+	debts, err = Debts(db, workspace.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []Transfer{{FromUserID: 2, ToUserID: 1, Amount: models.MustParseMoney("30.00")}}, debts)
+}
+
+func TestAssignRejectsNonMembers(t *testing.T) {
+	db := setupTestDB(t)
+	workspace := models.Workspace{Name: "Household", BaseCurrency: "USD"}
+	assert.NoError(t, db.Create(&workspace).Error)
+	assert.NoError(t, db.Create(&models.WorkspaceMember{WorkspaceID: workspace.ID, UserID: 1, Role: models.RoleOwner}).Error)
+
+	expense := models.Expense{UserID: 1, WorkspaceID: workspace.ID, Amount: 1000, BaseAmount: 1000}
+	err := Assign(db, &expense, Split{Method: models.SplitEqual, Shares: []Share{{UserID: 1}, {UserID: 2}}})
+	assert.ErrorIs(t, err, ErrInvalidSplit)
+}
@@ -0,0 +1,232 @@
+package ledger
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidSplit is wrapped by all errors about splits that don't add up.
+var ErrInvalidSplit = errors.New("invalid split")
+
+// Share is the part of a split expense one user pays. Amount is used by
+// exact splits, Percent by percentage splits.
+type Share struct {
+	UserID  uint          `json:"user_id" binding:"required"`
+	Amount  *models.Money `json:"amount"`
+	Percent *float64      `json:"percent"`
+}
+
+// Split describes how an expense is split between users. PaidByID defaults
+// to the user who created the expense. Updating an expense with a split
+// without shares removes its split.
+type Split struct {
+	Method   string  `json:"method" binding:"omitempty,oneof=equal exact percent"`
+	PaidByID *uint   `json:"paid_by_id"`
+	Shares   []Share `json:"shares" binding:"dive"`
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidSplit, fmt.Sprintf(format, args...))
+}
+
+// Weights returns the weight of each share of a split of amount, the
+// expense's amount in its own currency.
+func Weights(split Split, amount models.Money) ([]int64, error) {
+	if len(split.Shares) == 0 {
+		return nil, invalid("at least one share is required")
+	}
+
+	seen := make(map[uint]bool, len(split.Shares))
+	weights := make([]int64, len(split.Shares))
+	var total int64
+	for i, share := range split.Shares {
+		if seen[share.UserID] {
+			return nil, invalid("user %d has more than one share", share.UserID)
+		}
+		seen[share.UserID] = true
+
+		switch split.Method {
+		case models.SplitEqual:
+			weights[i] = 1
+		case models.SplitExact:
+			if share.Amount == nil {
+				return nil, invalid("share of user %d needs an amount", share.UserID)
+			}
+			weights[i] = int64(*share.Amount)
+		case models.SplitPercent:
+			if share.Percent == nil {
+				return nil, invalid("share of user %d needs a percentage", share.UserID)
+			}
+			// Percentages with up to four decimals are kept exactly
+			weights[i] = int64(math.Round(*share.Percent * 10000))
+		default:
+			return nil, invalid("unknown method %q", split.Method)
+		}
+		if weights[i] < 0 || (weights[i] == 0 && amount != 0 && split.Method != models.SplitExact) {
+			return nil, invalid("share of user %d must be positive", share.UserID)
+		}
+		total += weights[i]
+	}
+
+	switch {
+	case split.Method == models.SplitExact && total != int64(amount):
+		return nil, invalid("shares add up to %s instead of %s", models.Money(total), amount)
+	case split.Method == models.SplitPercent && total != 100*10000:
+		return nil, invalid("percentages add up to %g instead of 100", float64(total)/10000)
+	}
+	return weights, nil
+}
+
+// Apportion divides total into parts proportional to weights. The parts add
+// up to total exactly, cents left over by rounding go to the parts with the
+// largest remainders, ties to the earlier ones.
+func Apportion(total models.Money, weights []int64) []models.Money {
+	parts := make([]models.Money, len(weights))
+	var sum int64
+	for _, w := range weights {
+		sum += w
+	}
+	if sum == 0 {
+		return parts
+	}
+
+	negative := total < 0
+	if negative {
+		total = -total
+	}
+
+	remainders := make([]*big.Int, len(weights))
+	var assigned int64
+	for i, w := range weights {
+		// total * w can exceed int64, so compute with big integers
+		quotient, remainder := new(big.Int).QuoRem(
+			new(big.Int).Mul(big.NewInt(int64(total)), big.NewInt(w)), big.NewInt(sum), new(big.Int))
+		parts[i] = models.Money(quotient.Int64())
+		remainders[i] = remainder
+		assigned += quotient.Int64()
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]].Cmp(remainders[order[b]]) > 0
+	})
+	for i := int64(0); i < int64(total)-assigned; i++ {
+		parts[order[i]]++
+	}
+
+	if negative {
+		for i := range parts {
+			parts[i] = -parts[i]
+		}
+	}
+	return parts
+}
+
+// Assign splits the expense between the users of the split, replacing any
+// earlier split. The users have to be members of the expense's workspace.
+// It has to run in a transaction after the expense was stored.
+func Assign(tx *gorm.DB, expense *models.Expense, split Split) error {
+	weights, err := Weights(split, expense.Amount)
+	if err != nil {
+		return err
+	}
+
+	paidBy := expense.UserID
+	if split.PaidByID != nil {
+		paidBy = *split.PaidByID
+	}
+
+	userIDs := []uint{paidBy}
+	for _, share := range split.Shares {
+		userIDs = append(userIDs, share.UserID)
+	}
+	var members []uint
+	if err := tx.Model(&models.WorkspaceMember{}).
+		Where("workspace_id = ? AND user_id IN ?", expense.WorkspaceID, userIDs).
+		Pluck("user_id", &members).Error; err != nil {
+		return err
+	}
+	known := make(map[uint]bool, len(members))
+	for _, id := range members {
+		known[id] = true
+	}
+	for _, id := range userIDs {
+		if !known[id] {
+			return invalid("user %d is not a member of the workspace", id)
+		}
+	}
+
+	if err := Unassign(tx, expense); err != nil {
+		return err
+	}
+
+	amounts := Apportion(expense.BaseAmount, weights)
+	splits := make([]models.ExpenseSplit, len(split.Shares))
+	for i, share := range split.Shares {
+		splits[i] = models.ExpenseSplit{ExpenseID: expense.ID, UserID: share.UserID, Weight: weights[i], Amount: amounts[i]}
+	}
+	if err := tx.Create(&splits).Error; err != nil {
+		return err
+	}
+
+	expense.PaidByID = &paidBy
+	expense.SplitMethod = split.Method
+	expense.Splits = splits
+	return tx.Model(expense).UpdateColumns(map[string]interface{}{
+		"paid_by_id":   paidBy,
+		"split_method": split.Method,
+	}).Error
+}
+
+// Unassign removes the split of the expense, if any.
+func Unassign(tx *gorm.DB, expense *models.Expense) error {
+	if err := tx.Where("expense_id = ?", expense.ID).Delete(&models.ExpenseSplit{}).Error; err != nil {
+		return err
+	}
+	expense.PaidByID = nil
+	expense.SplitMethod = ""
+	expense.Splits = nil
+	return tx.Model(expense).UpdateColumns(map[string]interface{}{
+		"paid_by_id":   nil,
+		"split_method": "",
+	}).Error
+}
+
+// Reapportion divides the base amount of a split expense between its splits
+// again, e.g. after the amount or the base currency changed. An exact split
+// whose amount changed is no longer exact and becomes proportional.
+func Reapportion(tx *gorm.DB, expense *models.Expense) error {
+	var splits []models.ExpenseSplit
+	if err := tx.Where("expense_id = ?", expense.ID).Order("id").Find(&splits).Error; err != nil {
+		return err
+	}
+	if len(splits) == 0 {
+		return nil
+	}
+
+	weights := make([]int64, len(splits))
+	for i, split := range splits {
+		weights[i] = split.Weight
+	}
+	for i, amount := range Apportion(expense.BaseAmount, weights) {
+		if splits[i].Amount == amount {
+			continue
+		}
+		splits[i].Amount = amount
+		if err := tx.Model(&splits[i]).Update("amount", amount).Error; err != nil {
+			return err
+		}
+	}
+	expense.Splits = splits
+	return nil
+}
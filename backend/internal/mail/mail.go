@@ -0,0 +1,123 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"mime"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails.
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Config selects and configures a mailer.
+type Config struct {
+	Driver   string // smtp, file or log
+	From     string
+	Dir      string // Directory of the file mailer
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// New returns the mailer the config selects, the log mailer by default.
+func New(cfg Config) (Mailer, error) {
+	switch cfg.Driver {
+	case "smtp":
+		if cfg.Host == "" {
+			return nil, fmt.Errorf("SMTP host required")
+		}
+		return &SMTPMailer{Host: cfg.Host, Port: cfg.Port, Username: cfg.Username, Password: cfg.Password, From: cfg.From}, nil
+	case "file":
+		if cfg.Dir == "" {
+			return nil, fmt.Errorf("mail directory required")
+		}
+		return &FileMailer{Dir: cfg.Dir, From: cfg.From}, nil
+	case "", "log":
+		return &LogMailer{From: cfg.From}, nil
+	default:
+		return nil, fmt.Errorf("unknown mail driver %q", cfg.Driver)
+	}
+}
+
+// SMTPMailer sends emails through an SMTP server. It authenticates if a
+// username is set, net/smtp only does so over TLS or to localhost.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	port := m.Port
+	if port == "" {
+		port = "587"
+	}
+	return smtp.SendMail(m.Host+":"+port, auth, m.From, []string{msg.To}, Format(m.From, msg))
+}
+
+// FileMailer writes each email to a file in Dir, for local development and
+// tests.
+type FileMailer struct {
+	Dir  string
+	From string
+
+	count atomic.Int64
+}
+
+func (m *FileMailer) Send(msg Message) error {
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%03d.eml", time.Now().Format("20060102-150405"), m.count.Add(1))
+	return os.WriteFile(filepath.Join(m.Dir, name), Format(m.From, msg), 0o600)
+}
+
+// LogMailer writes emails to the log instead of sending them.
+type LogMailer struct {
+	From string
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("Mail to %s: %s\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
+
+// Format formats the message as an RFC 5322 email.
+func Format(from string, msg Message) []byte {
+	var buf bytes.Buffer
+	// Line breaks in headers would start headers of their own
+	header := strings.NewReplacer("\r", "", "\n", "")
+	fmt.Fprintf(&buf, "From: %s\r\n", header.Replace(from))
+	fmt.Fprintf(&buf, "To: %s\r\n", header.Replace(msg.To))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", header.Replace(msg.Subject)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("\r\n")
+	buf.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return buf.Bytes()
+}
@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	mailer, err := New(Config{})
+	assert.NoError(t, err)
+	assert.IsType(t, &LogMailer{}, mailer)
+
+	mailer, err = New(Config{Driver: "smtp", Host: "mail.example.com"})
+	assert.NoError(t, err)
+	assert.IsType(t, &SMTPMailer{}, mailer)
+
+	_, err = New(Config{Driver: "smtp"})
+	assert.Error(t, err)
+
+	_, err = New(Config{Driver: "pigeon"})
+	assert.Error(t, err)
+}
+
+func TestFormat(t *testing.T) {
+	email := string(Format("noreply@example.com", Message{To: "user@example.com", Subject: "Grüezi", Body: "Line one\nLine two"}))
+
+	assert.Contains(t, email, "From: noreply@example.com\r\n")
+	assert.Contains(t, email, "To: user@example.com\r\n")
+	assert.Contains(t, email, "Subject: =?utf-8?q?Gr=C3=BCezi?=\r\n")
+	assert.True(t, strings.HasSuffix(email, "\r\n\r\nLine one\r\nLine two"))
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := t.TempDir()
+	mailer := &FileMailer{Dir: dir, From: "noreply@example.com"}
+
+	assert.NoError(t, mailer.Send(Message{To: "a@example.com", Subject: "First", Body: "1"}))
+	assert.NoError(t, mailer.Send(Message{To: "b@example.com", Subject: "Second", Body: "2"}))
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	data, err := os.ReadFile(files[1])
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "To: b@example.com")
+}
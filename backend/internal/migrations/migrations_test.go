@@ -0,0 +1,149 @@
+package migrations
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	return db
+}
+
+var testFS = fstest.MapFS{
+	"sql/0001_create_notes.up.sql":   {Data: []byte("CREATE TABLE notes (id INTEGER PRIMARY KEY, body TEXT NOT NULL);")},
+	"sql/0001_create_notes.down.sql": {Data: []byte("DROP TABLE notes;")},
+	"sql/0003_add_title.up.sql":      {Data: []byte("ALTER TABLE notes ADD COLUMN title TEXT;")},
+	"sql/0003_add_title.down.sql":    {Data: []byte("ALTER TABLE notes DROP COLUMN title;")},
+	"sql/README.md":                  {Data: []byte("not a migration")},
+}
+
+func testMigrations(t *testing.T) []Migration {
+	list, err := FromSQL(testFS, "sql")
+	if err != nil {
+		t.Fatalf("Failed to read migrations: %v", err)
+	}
+	return append(list, Migration{
+		Version: 2,
+		Name:    "seed_notes",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("INSERT INTO notes (body) VALUES ('first'), ('second')").Error
+		},
+	})
+}
+
+func TestUpAndDown(t *testing.T) {
+	db := setupTestDB(t)
+	migrator, err := New(db, testMigrations(t))
+	assert.NoError(t, err)
+
+	pending, err := migrator.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 3)
+
+	applied, err := migrator.Up()
+	assert.NoError(t, err)
+	if assert.Len(t, applied, 3) {
+		assert.Equal(t, []int64{1, 2, 3}, []int64{applied[0].Version, applied[1].Version, applied[2].Version})
+	}
+	assert.True(t, db.Migrator().HasColumn("notes", "title"))
+
+	var count int64
+	db.Table("notes").Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	// Applied migrations are not applied again
+	applied, err = migrator.Up()
+	assert.NoError(t, err)
+	assert.Empty(t, applied)
+
+	statuses, err := migrator.Status()
+	assert.NoError(t, err)
+	for _, s := range statuses {
+		assert.NotNil(t, s.AppliedAt, s.Name)
+	}
+
+	// Data migrations have nothing to revert, they only stop being applied
+	reverted, err := migrator.Down(2)
+	assert.NoError(t, err)
+	if assert.Len(t, reverted, 2) {
+		assert.Equal(t, "add_title", reverted[0].Name)
+		assert.Equal(t, "seed_notes", reverted[1].Name)
+	}
+	assert.False(t, db.Migrator().HasColumn("notes", "title"))
+	db.Table("notes").Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	pending, err = migrator.Pending()
+	assert.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	reverted, err = migrator.Down(5)
+	assert.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, db.Migrator().HasTable("notes"))
+}
+
+func TestFailedMigrationIsRolledBack(t *testing.T) {
+	db := setupTestDB(t)
+	migrator, err := New(db, append(testMigrations(t), Migration{
+		Version: 4,
+		Name:    "broken",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.Exec("INSERT INTO notes (body) VALUES ('third')").Error; err != nil {
+				return err
+			}
+			return errors.New("boom")
+		},
+	}))
+	assert.NoError(t, err)
+
+	applied, err := migrator.Up()
+	assert.ErrorContains(t, err, "0004_broken")
+	assert.Len(t, applied, 3)
+
+	var count int64
+	db.Table("notes").Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	pending, err := migrator.Pending()
+	assert.NoError(t, err)
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, int64(4), pending[0].Version)
+	}
+}
+
+func TestUnknownMigration(t *testing.T) {
+	db := setupTestDB(t)
+	migrator, err := New(db, testMigrations(t))
+	assert.NoError(t, err)
+	_, err = migrator.Up()
+	assert.NoError(t, err)
+
+	// An older release doesn't know the migrations of newer ones
+	older, err := New(db, testMigrations(t)[:1])
+	assert.NoError(t, err)
+	_, err = older.Up()
+	assert.ErrorIs(t, err, ErrUnknownMigration)
+}
+
+func TestInvalidMigrations(t *testing.T) {
+	_, err := FromSQL(fstest.MapFS{
+		"sql/0001_create_notes.up.sql": {Data: []byte("CREATE TABLE notes (id INTEGER);")},
+	}, "sql")
+	assert.Error(t, err)
+
+	_, err = New(setupTestDB(t), []Migration{
+		{Version: 1, Name: "one", Up: func(*gorm.DB) error { return nil }},
+		{Version: 1, Name: "other", Up: func(*gorm.DB) error { return nil }},
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Attachment is a receipt or document of an expense. Files are stored under
+// their content hash, so attachments of the same file share one stored
+// object.
+type Attachment struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	ExpenseID    uint      `gorm:"not null;index" json:"expense_id"`
+	WorkspaceID  uint      `gorm:"not null;index" json:"workspace_id"`
+	UserID       uint      `gorm:"not null" json:"user_id"` // User who uploaded the file
+	FileName     string    `gorm:"not null" json:"file_name"`
+	ContentType  string    `gorm:"not null" json:"content_type"`
+	Size         int64     `gorm:"not null" json:"size"`
+	SHA256       string    `gorm:"column:sha256;size:64;not null;index" json:"sha256"`
+	StorageKey   string    `gorm:"not null" json:"-"`
+	ThumbnailKey string    `gorm:"not null;default:''" json:"-"` // Empty for files without a thumbnail
+	CreatedAt    time.Time `json:"created_at"`
+	URL          string    `gorm:"-" json:"url,omitempty"`           // Signed download URL, set in responses
+	ThumbnailURL string    `gorm:"-" json:"thumbnail_url,omitempty"` // Signed download URL of the thumbnail
+}
@@ -6,13 +6,23 @@ import (
 	"gorm.io/gorm"
 )
 
+// Rollover modes decide how a budget is carried into the next month.
+const (
+	RolloverReset = "reset" // Start the next month with the plain budget amount
+	RolloverCarry = "carry" // Carry the remaining (or overspent) balance forward
+)
+
 type Budget struct {
 	ID             uint           `gorm:"primaryKey" json:"id"`
-	UserID         uint           `gorm:"not null" json:"user_id"`
+	UserID         uint           `gorm:"not null" json:"user_id"` // User who created the budget
+	WorkspaceID    uint           `gorm:"index" json:"workspace_id"`
 	Name           string         `gorm:"not null" json:"name"`
-	Amount         float64        `gorm:"not null" json:"amount"`
+	Amount         Money          `gorm:"not null" json:"amount"`
 	Month          string         `gorm:"not null" json:"month"` // Format: "2024-01"
-	RollOverAmount float64        `json:"roll_over_amount"`
+	RollOverAmount Money          `json:"roll_over_amount"`      // Amount spent in this month
+	RolloverMode   string         `gorm:"not null;default:reset" json:"rollover_mode"`
+	CarriedAmount  Money          `json:"carried_amount"`                                // Balance carried over from the previous month
+	SourceBudgetID *uint          `gorm:"uniqueIndex" json:"source_budget_id,omitempty"` // Budget this one was rolled over from
 	CreatedAt      time.Time      `json:"created_at"`
 	UpdatedAt      time.Time      `json:"updated_at"`
 	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Category groups expenses independently of the month, unlike budgets.
+// Categories form a hierarchy through their parent.
+type Category struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	UserID      uint           `gorm:"not null;index" json:"user_id"`
+	WorkspaceID uint           `gorm:"index" json:"workspace_id"`
+	ParentID    *uint          `gorm:"index" json:"parent_id"`
+	Name        string         `gorm:"not null" json:"name"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	User        User           `gorm:"foreignKey:UserID" json:"-"`
+	Children    []Category     `gorm:"foreignKey:ParentID" json:"children,omitempty"`
+}
+
+// Tag is a free-form label, an expense can have any number of tags.
+type Tag struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	UserID      uint      `gorm:"not null" json:"user_id"`
+	WorkspaceID uint      `gorm:"uniqueIndex:idx_tags_workspace_name" json:"workspace_id"`
+	Name        string    `gorm:"not null;uniqueIndex:idx_tags_workspace_name" json:"name"`
+	CreatedAt   time.Time `json:"created_at"`
+	User        User      `gorm:"foreignKey:UserID" json:"-"`
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+)
+
+// ReferenceCurrency is the currency all exchange rates are quoted against,
+// following the ECB reference rates.
+const ReferenceCurrency = "EUR"
+
+// ExchangeRate is the number of units of Currency one unit of the
+// ReferenceCurrency was worth on Date.
+type ExchangeRate struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Currency  string    `gorm:"size:3;not null;uniqueIndex:idx_exchange_rates_currency_date" json:"currency"`
+	Date      time.Time `gorm:"not null;uniqueIndex:idx_exchange_rates_currency_date" json:"date"`
+	Rate      float64   `gorm:"not null" json:"rate"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -7,15 +7,29 @@ import (
 )
 
 type Expense struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	UserID      uint           `gorm:"not null" json:"user_id"`
-	BudgetID    *uint          `json:"budget_id"`
-	Amount      float64        `gorm:"not null" json:"amount"`
-	Description string         `gorm:"not null" json:"description"`
-	Date        time.Time      `gorm:"not null" json:"date"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
-	User        User           `gorm:"foreignKey:UserID" json:"-"`
-	Budget      *Budget        `gorm:"foreignKey:BudgetID" json:"budget,omitempty"`
+	ID                 uint           `gorm:"primaryKey" json:"id"`
+	UserID             uint           `gorm:"not null" json:"user_id"` // User who created the expense
+	WorkspaceID        uint           `gorm:"index" json:"workspace_id"`
+	BudgetID           *uint          `json:"budget_id"`
+	CategoryID         *uint          `gorm:"index" json:"category_id"`
+	Amount             Money          `gorm:"not null" json:"amount"`
+	Currency           string         `gorm:"size:3;not null;default:EUR" json:"currency"`
+	BaseAmount         Money          `gorm:"not null;default:0" json:"base_amount"` // Amount converted to the workspace's base currency
+	BaseCurrency       string         `gorm:"size:3" json:"base_currency"`
+	Description        string         `gorm:"not null" json:"description"`
+	Notes              string         `gorm:"not null;default:''" json:"notes"`
+	Date               time.Time      `gorm:"not null;uniqueIndex:idx_expenses_recurring_date,priority:2" json:"date"`
+	ExternalID         string         `gorm:"index" json:"external_id,omitempty"`                                                       // ID of the booking at the bank, set for imported expenses
+	RecurringExpenseID *uint          `gorm:"uniqueIndex:idx_expenses_recurring_date,priority:1" json:"recurring_expense_id,omitempty"` // Set for occurrences of a recurring expense, one per date
+	PaidByID           *uint          `json:"paid_by_id,omitempty"`                                                                     // User who paid a split expense
+	SplitMethod        string         `json:"split_method,omitempty"`                                                                   // Set if the expense is split between users
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
+	User               User           `gorm:"foreignKey:UserID" json:"-"`
+	Budget             *Budget        `gorm:"foreignKey:BudgetID" json:"budget,omitempty"`
+	Category           *Category      `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+	Tags               []Tag          `gorm:"many2many:expense_tags" json:"tags,omitempty"`
+	Splits             []ExpenseSplit `gorm:"foreignKey:ExpenseID" json:"splits,omitempty"`
+	Attachments        []Attachment   `gorm:"foreignKey:ExpenseID" json:"attachments,omitempty"`
 }
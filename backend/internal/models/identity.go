@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// UserIdentity links a user to an account at an OpenID Connect provider.
+type UserIdentity struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Provider  string    `gorm:"not null" json:"provider"`
+	Issuer    string    `gorm:"not null;uniqueIndex:idx_user_identities_issuer_subject" json:"issuer"`
+	Subject   string    `gorm:"not null;uniqueIndex:idx_user_identities_issuer_subject" json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCState is a login at an OpenID Connect provider in progress. It is
+// looked up by the state parameter when the provider redirects back.
+type OIDCState struct {
+	State        string    `gorm:"primaryKey;size:64"`
+	Provider     string    `gorm:"not null"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"` // PKCE verifier of the code challenge sent to the provider
+	ExpiresAt    time.Time `gorm:"not null;index"`
+}
+
+func (OIDCState) TableName() string {
+	return "oidc_states"
+}
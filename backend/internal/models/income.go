@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Types of recurring transactions.
+const (
+	TypeExpense = "expense"
+	TypeIncome  = "income"
+)
+
+// Income is money a workspace receives, e.g. a salary. In zero-based
+// workspaces the income of a month is what its budgets can be assigned.
+type Income struct {
+	ID                 uint           `gorm:"primaryKey" json:"id"`
+	UserID             uint           `gorm:"not null" json:"user_id"` // User who recorded the income
+	WorkspaceID        uint           `gorm:"not null;index:idx_incomes_workspace_date,priority:1" json:"workspace_id"`
+	Amount             Money          `gorm:"not null" json:"amount"`
+	Currency           string         `gorm:"size:3;not null" json:"currency"`
+	BaseAmount         Money          `gorm:"not null;default:0" json:"base_amount"` // Amount converted to the workspace's base currency
+	BaseCurrency       string         `gorm:"size:3" json:"base_currency"`
+	Description        string         `gorm:"not null" json:"description"`
+	Date               time.Time      `gorm:"not null;index:idx_incomes_workspace_date,priority:2;uniqueIndex:idx_incomes_recurring_date,priority:2" json:"date"`
+	RecurringExpenseID *uint          `gorm:"uniqueIndex:idx_incomes_recurring_date,priority:1" json:"recurring_expense_id,omitempty"` // Set for occurrences of a recurring income, one per date
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
+	User               User           `gorm:"foreignKey:UserID" json:"-"`
+}
@@ -0,0 +1,173 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MinorUnits is the number of minor units (cents) in one major unit.
+const MinorUnits = 100
+
+// Money is an exact monetary amount stored in minor units (cents).
+//
+// In JSON it is written as a decimal number with two fraction digits
+// (e.g. 12.5 is written as 12.50), so the API looks the same as when amounts
+// were plain floats. Both numbers and numeric strings are accepted as input.
+type Money int64
+
+var errInvalidMoney = errors.New("invalid monetary amount")
+
+// ParseMoney parses a decimal string such as "12.34" or "-0.5" without going
+// through float64. More than two fraction digits are rounded half away from
+// zero.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, errInvalidMoney
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" {
+		return 0, errInvalidMoney
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+	if !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, errInvalidMoney
+	}
+
+	units, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil || units > math.MaxInt64/MinorUnits-1 {
+		return 0, errInvalidMoney
+	}
+
+	// Two fraction digits are kept, the third decides the rounding
+	padded := fracPart + "000"
+	cents, _ := strconv.ParseInt(padded[:2], 10, 64)
+	if padded[2] >= '5' {
+		cents++
+	}
+
+	m := Money(units*MinorUnits + cents)
+	if negative {
+		m = -m
+	}
+	return m, nil
+}
+
+// MustParseMoney is like ParseMoney but panics on invalid input. It is meant
+// for constants and tests.
+func MustParseMoney(s string) Money {
+	m, err := ParseMoney(s)
+	if err != nil {
+		panic(fmt.Sprintf("models: invalid money %q", s))
+	}
+	return m
+}
+
+// Float returns the amount in major units. It is only meant for display and
+// ratios, never for further arithmetic on amounts.
+func (m Money) Float() float64 {
+	return float64(m) / MinorUnits
+}
+
+// String formats the amount as a decimal with two fraction digits.
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/MinorUnits, v%MinorUnits)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	if len(data) > 1 && data[0] == '"' {
+		unquoted, err := strconv.Unquote(string(data))
+		if err != nil {
+			return errInvalidMoney
+		}
+		data = []byte(unquoted)
+	}
+
+	s := string(data)
+	// JSON numbers may use an exponent, e.g. 1e3 or 1.5E-1
+	if strings.ContainsAny(s, "eE") {
+		var err error
+		if s, err = expandExponent(s); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := ParseMoney(s)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// expandExponent rewrites a number in scientific notation as a plain decimal.
+func expandExponent(s string) (string, error) {
+	mantissa, exp, _ := strings.Cut(strings.ToLower(s), "e")
+	shift, err := strconv.Atoi(exp)
+	if err != nil || shift > 18 || shift < -18 {
+		return "", errInvalidMoney
+	}
+
+	sign := ""
+	if strings.HasPrefix(mantissa, "-") || strings.HasPrefix(mantissa, "+") {
+		if mantissa[0] == '-' {
+			sign = "-"
+		}
+		mantissa = mantissa[1:]
+	}
+
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	digits := intPart + fracPart
+	point := len(intPart) + shift
+	if !isDigits(digits) || digits == "" {
+		return "", errInvalidMoney
+	}
+
+	switch {
+	case point <= 0:
+		return sign + "0." + strings.Repeat("0", -point) + digits, nil
+	case point >= len(digits):
+		return sign + digits + strings.Repeat("0", point-len(digits)), nil
+	default:
+		return sign + digits[:point] + "." + digits[point:], nil
+	}
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Money
+		wantErr bool
+	}{
+		{input: "12.34", want: 1234},
+		{input: "12.3", want: 1230},
+		{input: "12", want: 1200},
+		{input: ".5", want: 50},
+		{input: "-0.01", want: -1},
+		{input: "0.005", want: 1},
+		{input: "0.30000000000000004", want: 30},
+		{input: "499.995", want: 50000},
+		{input: "", wantErr: true},
+		{input: "abc", wantErr: true},
+		{input: "1.2.3", wantErr: true},
+		{input: "-", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseMoney(tt.input)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	assert.Equal(t, "12.34", Money(1234).String())
+	assert.Equal(t, "0.05", Money(5).String())
+	assert.Equal(t, "-0.50", Money(-50).String())
+	assert.Equal(t, "0.00", Money(0).String())
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var input struct {
+		Number   Money `json:"number"`
+		String   Money `json:"string"`
+		Exponent Money `json:"exponent"`
+	}
+	err := json.Unmarshal([]byte(`{"number": 19.99, "string": "5.5", "exponent": 1.5e2}`), &input)
+	assert.NoError(t, err)
+	assert.Equal(t, Money(1999), input.Number)
+	assert.Equal(t, Money(550), input.String)
+	assert.Equal(t, Money(15000), input.Exponent)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"number": "invalid"}`), &input))
+
+	// Repeated additions stay exact
+	var total Money
+	for i := 0; i < 10; i++ {
+		total += MustParseMoney("0.10")
+	}
+	output, err := json.Marshal(map[string]Money{"total": total})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"total": 1.00}`, string(output))
+}
@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// RateLimitBucket is the token bucket of a rate limited key, for servers that
+// share their rate limits through the database.
+type RateLimitBucket struct {
+	Key       string    `gorm:"primaryKey;size:255"`
+	Tokens    float64   `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null"`
+	FullAt    time.Time `gorm:"not null;index"` // The bucket can be deleted from then on
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Frequencies of recurring expenses.
+const (
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+	FrequencyYearly  = "yearly"
+)
+
+// RecurringExpense is an expense that repeats on a schedule, e.g. rent or a
+// subscription. Its occurrences are created as expenses once they are due.
+// Recurring income, e.g. a salary, is a recurring expense of TypeIncome
+// whose occurrences are created as income.
+type RecurringExpense struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	UserID      uint   `gorm:"not null;index" json:"user_id"`
+	WorkspaceID uint   `gorm:"index" json:"workspace_id"`
+	Type        string `gorm:"not null;default:expense" json:"type"` // TypeExpense or TypeIncome
+	Description string `gorm:"not null" json:"description"`
+	Amount      Money  `gorm:"not null" json:"amount"`
+	Currency    string `gorm:"size:3;not null;default:EUR" json:"currency"`
+	BudgetName  string `json:"budget_name"` // Resolved in the month of each occurrence
+	CategoryID  *uint  `gorm:"index" json:"category_id"`
+
+	// Schedule, repeating every Interval weeks, months or years from StartDate
+	Frequency  string     `gorm:"not null" json:"frequency"`
+	Interval   int        `gorm:"not null;default:1" json:"interval"`
+	DayOfMonth int        `json:"day_of_month"` // Monthly and yearly, -1 is the last day of the month
+	Weekday    *int       `json:"weekday"`      // Weekly, 0 is Sunday
+	Month      int        `json:"month"`        // Yearly, 1 is January
+	StartDate  time.Time  `gorm:"not null" json:"start_date"`
+	EndDate    *time.Time `json:"end_date"` // Last day an occurrence may fall on
+
+	Paused   bool      `gorm:"not null;default:false" json:"paused"`
+	NextDate time.Time `gorm:"not null;index" json:"next_date"` // Next occurrence that wasn't created or skipped yet
+
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	User      User           `gorm:"foreignKey:UserID" json:"-"`
+	Category  *Category      `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+}
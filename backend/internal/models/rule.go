@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Rule assigns a budget, category and tags to expenses it matches. Rules are
+// evaluated in order of their priority, lower values first.
+type Rule struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	UserID      uint   `gorm:"not null;index" json:"user_id"`
+	WorkspaceID uint   `gorm:"index" json:"workspace_id"`
+	Name        string `gorm:"not null" json:"name"`
+	Priority    int    `gorm:"not null;default:0" json:"priority"`
+	Enabled     bool   `gorm:"not null" json:"enabled"`
+
+	// Conditions, all of the set ones have to match
+	DescriptionPattern string `json:"description_pattern"` // Case-insensitive regular expression
+	MinAmount          *Money `json:"min_amount"`          // In the workspace's base currency, inclusive
+	MaxAmount          *Money `json:"max_amount"`          // In the workspace's base currency, inclusive
+
+	// Actions. Budgets exist per month, so the budget is referenced by name
+	// and resolved in the month of the expense.
+	BudgetName string `json:"budget_name"`
+	CategoryID *uint  `gorm:"index" json:"category_id"`
+	Tags       []Tag  `gorm:"many2many:rule_tags" json:"tags"`
+
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	User      User           `gorm:"foreignKey:UserID" json:"-"`
+	Category  *Category      `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+}
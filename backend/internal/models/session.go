@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// RefreshToken is a single-use token that renews a session. Every refresh
+// replaces it by a new token of the same family, so reusing a replaced token
+// gives away that it was stolen and revokes the whole family.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey"`
+	UserID    uint       `gorm:"not null;index"`
+	FamilyID  string     `gorm:"size:32;not null;index"` // Shared by all tokens descending from one login
+	TokenHash string     `gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time // Set once the token was exchanged for a new one
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// RevokedToken is an access token that was revoked before it expired, e.g. by
+// logging out. It can be forgotten once the token expired.
+type RevokedToken struct {
+	ID        string    `gorm:"primaryKey;size:32"` // The token's jti claim
+	ExpiresAt time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Methods of splitting an expense between users.
+const (
+	SplitEqual   = "equal"   // Everyone pays the same share
+	SplitExact   = "exact"   // Everyone pays a given amount in the expense's currency
+	SplitPercent = "percent" // Everyone pays a percentage
+)
+
+// ExpenseSplit is the share of an expense a user owes to the user who paid
+// it.
+type ExpenseSplit struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ExpenseID uint      `gorm:"not null;index" json:"expense_id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Weight    int64     `gorm:"not null" json:"-"`      // Share of the expense relative to the other splits, kept to apportion changed amounts
+	Amount    Money     `gorm:"not null" json:"amount"` // In the base currency of the expense
+	CreatedAt time.Time `json:"created_at"`
+	User      User      `gorm:"foreignKey:UserID" json:"-"`
+}
+
+// Settlement is a payment between members of a workspace that settles debts
+// from split expenses.
+type Settlement struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	WorkspaceID  uint           `gorm:"not null;index" json:"workspace_id"`
+	FromUserID   uint           `gorm:"not null" json:"from_user_id"`
+	ToUserID     uint           `gorm:"not null" json:"to_user_id"`
+	Amount       Money          `gorm:"not null" json:"amount"`
+	Currency     string         `gorm:"size:3;not null" json:"currency"`
+	BaseAmount   Money          `gorm:"not null" json:"base_amount"` // Amount converted to the workspace's base currency
+	BaseCurrency string         `gorm:"size:3;not null" json:"base_currency"`
+	Date         time.Time      `gorm:"not null" json:"date"`
+	Note         string         `json:"note"`
+	CreatedByID  uint           `gorm:"not null" json:"created_by_id"`
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -7,11 +7,28 @@ import (
 )
 
 type User struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	Email        string         `gorm:"unique;not null" json:"email"`
-	PasswordHash string         `gorm:"not null" json:"-"`
-	CreatedAt    time.Time      `json:"created_at"`
-	ActivatedAt  *time.Time     `json:"activated_at,omitempty"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Email          string         `gorm:"unique;not null" json:"email"`
+	PasswordHash   string         `gorm:"not null" json:"-"`
+	BaseCurrency   string         `gorm:"size:3;not null;default:EUR" json:"base_currency"`
+	SessionVersion int            `gorm:"not null;default:0" json:"-"` // Raised to invalidate all access tokens of the user
+	TOTPSecret     string         `json:"-"`                           // Set during enrollment, in use once TOTPEnabledAt is set
+	TOTPEnabledAt  *time.Time     `json:"totp_enabled_at,omitempty"`
+	TOTPLastStep   int64          `gorm:"not null;default:0" json:"-"` // Time step of the last accepted code, codes can't be replayed
+	FailedLogins   int            `gorm:"not null;default:0" json:"-"` // Wrong passwords since the last login
+	LockedUntil    *time.Time     `json:"-"`
+	CreatedAt      time.Time      `json:"created_at"`
+	ActivatedAt    *time.Time     `json:"activated_at,omitempty"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// RecoveryCode is a one-time code that replaces a TOTP code when the
+// authenticator is lost.
+type RecoveryCode struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"not null;index"`
+	CodeHash  string `gorm:"size:64;not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Purposes of one-time tokens mailed to users.
+const (
+	TokenVerifyEmail   = "verify_email"
+	TokenResetPassword = "reset_password"
+)
+
+// UserToken records a one-time token mailed to a user, so it can be used
+// only once. The token itself is signed and carries this record's ID.
+type UserToken struct {
+	ID        string    `gorm:"primaryKey;size:32"`
+	UserID    uint      `gorm:"not null;index"`
+	Purpose   string    `gorm:"size:20;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
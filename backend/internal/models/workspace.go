@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Roles of workspace members, each one includes the rights of the ones
+// below it.
+const (
+	RoleOwner  = "owner"  // Manages the workspace, its members and settings
+	RoleEditor = "editor" // Creates and changes budgets, expenses and the like
+	RoleViewer = "viewer" // Only reads
+)
+
+// Workspace holds budgets, expenses and everything belonging to them, shared
+// by its members. Every user has a personal workspace that is used when a
+// request doesn't name one.
+type Workspace struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Name           string         `gorm:"not null" json:"name"`
+	BaseCurrency   string         `gorm:"size:3;not null;default:EUR" json:"base_currency"` // Currency budgets are kept in
+	PersonalUserID *uint          `gorm:"uniqueIndex" json:"personal_user_id,omitempty"`    // Set for the personal workspace of a user
+	ZeroBased      bool           `gorm:"not null;default:false" json:"zero_based"`         // Budgets can only be assigned the income of their month
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+}
+
+// WorkspaceMember grants a user a role in a workspace.
+type WorkspaceMember struct {
+	WorkspaceID uint      `gorm:"primaryKey" json:"workspace_id"`
+	UserID      uint      `gorm:"primaryKey;index" json:"user_id"`
+	Role        string    `gorm:"not null" json:"role"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Workspace   Workspace `gorm:"foreignKey:WorkspaceID" json:"-"`
+	User        User      `gorm:"foreignKey:UserID" json:"user"`
+}
+
+// WorkspaceInvitation invites the user with an email address to join a
+// workspace with a role.
+type WorkspaceInvitation struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	WorkspaceID uint      `gorm:"not null;index" json:"workspace_id"`
+	Email       string    `gorm:"not null;index" json:"email"`
+	Role        string    `gorm:"not null" json:"role"`
+	InvitedByID uint      `gorm:"not null" json:"invited_by_id"`
+	ExpiresAt   time.Time `gorm:"not null" json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+	Workspace   Workspace `gorm:"foreignKey:WorkspaceID" json:"workspace"`
+}
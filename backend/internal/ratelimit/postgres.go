@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// sweepEvery is how often full buckets are deleted from the database.
+const sweepEvery = time.Minute
+
+// PostgresStore keeps the buckets in the database, so that servers behind a
+// load balancer share them.
+type PostgresStore struct {
+	DB *gorm.DB
+
+	mu    sync.Mutex
+	swept time.Time
+}
+
+func (s *PostgresStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	var allowed bool
+	var retryAfter time.Duration
+	now := time.Now()
+
+	if err := s.sweep(ctx, now); err != nil {
+		return false, 0, err
+	}
+
+	// Only the bucket of the key is locked, so concurrent requests wait for
+	// each other at most per key and can't deadlock
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RateLimitBucket{
+			Key: key, Tokens: float64(limit.Burst), UpdatedAt: now, FullAt: now,
+		}).Error; err != nil {
+			return err
+		}
+
+		var b models.RateLimitBucket
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("key = ?", key).First(&b).Error; err != nil {
+			return err
+		}
+		var tokens float64
+		tokens, allowed, retryAfter = take(b.Tokens, b.UpdatedAt, now, limit)
+		return tx.Model(&b).Updates(map[string]interface{}{
+			"tokens":     tokens,
+			"updated_at": now,
+			"full_at":    fullAt(tokens, now, limit),
+		}).Error
+	})
+	return allowed, retryAfter, err
+}
+
+// sweep forgets full buckets, taking from one recreates it. It runs at most
+// once per sweepEvery on each server, in a statement of its own.
+func (s *PostgresStore) sweep(ctx context.Context, now time.Time) error {
+	s.mu.Lock()
+	if now.Sub(s.swept) < sweepEvery {
+		s.mu.Unlock()
+		return nil
+	}
+	s.swept = now
+	s.mu.Unlock()
+
+	return s.DB.WithContext(ctx).Where("full_at <= ?", now).Delete(&models.RateLimitBucket{}).Error
+}
@@ -0,0 +1,99 @@
+// Package ratelimit limits how often something may happen with token
+// buckets. Each key has a bucket of Limit.Burst tokens that refills by one
+// token every Limit.Every, and every request takes a token.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Limit is the size and refill rate of a bucket.
+type Limit struct {
+	Burst int
+	Every time.Duration
+}
+
+// Store keeps the buckets. Take takes a token from the bucket of the key and
+// reports whether there was one, and if not, how long until there is.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error)
+}
+
+// New returns the store of the driver, memory or postgres.
+func New(driver string, db *gorm.DB) (Store, error) {
+	switch driver {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "postgres":
+		return &PostgresStore{DB: db}, nil
+	default:
+		return nil, fmt.Errorf("unknown rate limit store %q", driver)
+	}
+}
+
+// take refills a bucket with tokens at updated and takes a token at now. It
+// returns the tokens left, whether one was taken, and the wait for the next.
+func take(tokens float64, updated, now time.Time, limit Limit) (float64, bool, time.Duration) {
+	elapsed := now.Sub(updated)
+	if elapsed > 0 {
+		tokens = math.Min(float64(limit.Burst), tokens+float64(elapsed)/float64(limit.Every))
+	}
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	return tokens, false, time.Duration((1 - tokens) * float64(limit.Every))
+}
+
+// fullAt is when a bucket with the tokens is full again. Buckets that are
+// full don't need to be kept, a missing bucket is a full one.
+func fullAt(tokens float64, now time.Time, limit Limit) time.Time {
+	return now.Add(time.Duration((float64(limit.Burst) - tokens) * float64(limit.Every)))
+}
+
+// MemoryStore keeps the buckets in memory, for a single server.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	swept   time.Time
+	now     func() time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+	full    time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.swept) > time.Minute {
+		for k, b := range s.buckets {
+			if !b.full.After(now) {
+				delete(s.buckets, k)
+			}
+		}
+		s.swept = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updated: now}
+		s.buckets[key] = b
+	}
+	tokens, allowed, retryAfter := take(b.tokens, b.updated, now, limit)
+	b.tokens, b.updated, b.full = tokens, now, fullAt(tokens, now, limit)
+	return allowed, retryAfter, nil
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"expense-tracker/internal/database"
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	limit := Limit{Burst: 3, Every: 10 * time.Second}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		allowed, _, err := store.Take(ctx, "a", limit)
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	allowed, retryAfter, _ := store.Take(ctx, "a", limit)
+	assert.False(t, allowed)
+	assert.Equal(t, 10*time.Second, retryAfter)
+
+	// Other keys have their own bucket
+	allowed, _, _ = store.Take(ctx, "b", limit)
+	assert.True(t, allowed)
+
+	// One token is back after the interval
+	now = now.Add(4 * time.Second)
+	_, retryAfter, _ = store.Take(ctx, "a", limit)
+	assert.Equal(t, 6*time.Second, retryAfter)
+	now = now.Add(6 * time.Second)
+	allowed, _, _ = store.Take(ctx, "a", limit)
+	assert.True(t, allowed)
+	allowed, _, _ = store.Take(ctx, "a", limit)
+	assert.False(t, allowed)
+
+	// Full buckets are swept
+	now = now.Add(time.Hour)
+	store.Take(ctx, "c", limit)
+	assert.Len(t, store.buckets, 1)
+}
+
+func TestPostgresStore(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.RateLimitBucket{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	store := &PostgresStore{DB: db}
+	limit := Limit{Burst: 2, Every: time.Hour}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		allowed, _, err := store.Take(ctx, "a", limit)
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+	}
+	allowed, retryAfter, err := store.Take(ctx, "a", limit)
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+	assert.InDelta(t, time.Hour.Seconds(), retryAfter.Seconds(), 5)
+
+	var bucket models.RateLimitBucket
+	assert.NoError(t, db.First(&bucket, "key = ?", "a").Error)
+	assert.True(t, bucket.FullAt.After(time.Now().Add(time.Hour)))
+}
+
+// TestPostgresStoreConcurrent takes from one bucket at once from many
+// requests, on PostgreSQL with TEST_DB_DRIVER=postgres and the connection in
+// TEST_DATABASE_DSN.
+func TestPostgresStoreConcurrent(t *testing.T) {
+	var db *gorm.DB
+	var err error
+	if os.Getenv("TEST_DB_DRIVER") == "postgres" {
+		db, err = gorm.Open(postgres.Open(os.Getenv("TEST_DATABASE_DSN")), &gorm.Config{})
+	} else {
+		db, err = database.OpenSQLite(filepath.Join(t.TempDir(), "test.db"))
+	}
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.RateLimitBucket{}); err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	store := &PostgresStore{DB: db}
+	limit := Limit{Burst: 5, Every: time.Hour}
+	key := fmt.Sprintf("concurrent-%d", time.Now().UnixNano())
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			allowed, _, err := store.Take(context.Background(), key, limit)
+			assert.NoError(t, err)
+			if allowed {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, limit.Burst, taken)
+	db.Where("key = ?", key).Delete(&models.RateLimitBucket{})
+}
+
+func TestNew(t *testing.T) {
+	_, err := New("redis", nil)
+	assert.Error(t, err)
+	store, err := New("", nil)
+	assert.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, store)
+}
@@ -0,0 +1,221 @@
+package recurring
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"expense-tracker/internal/budgets"
+	"expense-tracker/internal/categories"
+	"expense-tracker/internal/currency"
+	"expense-tracker/internal/models"
+	"expense-tracker/internal/rules"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Today returns the current date at midnight UTC, the date occurrences are
+// created through.
+func Today() time.Time {
+	return day(time.Now())
+}
+
+// Materialize creates the occurrences of the recurring expense that are due
+// on or before through as expenses, or income, and advances its next date
+// past them.
+// Each occurrence is booked against the budget of its month. All
+// occurrences are created in one transaction, if one fails (e.g. for a
+// missing exchange rate) none are and the next run tries again. It returns
+// the number of expenses created.
+func Materialize(db *gorm.DB, id uint, through time.Time) (int, error) {
+	created := 0
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The lock keeps concurrent runs (e.g. several server replicas) from
+		// creating the same occurrences.
+		var r models.RecurringExpense
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&r, id).Error; err != nil {
+			return err
+		}
+		if r.Paused {
+			return nil
+		}
+
+		engine, err := rules.Load(tx, r.WorkspaceID)
+		if err != nil {
+			return err
+		}
+
+		start := r.NextDate
+		for !r.NextDate.After(through) && !Ended(&r, r.NextDate) {
+			ok, err := createOccurrence(tx, &r, r.NextDate, engine)
+			if err != nil {
+				return err
+			}
+			if ok {
+				created++
+			}
+			r.NextDate = Next(&r, r.NextDate)
+		}
+		if r.NextDate.Equal(start) {
+			return nil
+		}
+
+		return tx.Model(&r).Update("next_date", r.NextDate).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return created, nil
+}
+
+// createOccurrence creates the expense of the occurrence on date, unless it
+// already exists. Occurrences the user deleted aren't created again.
+func createOccurrence(tx *gorm.DB, r *models.RecurringExpense, date time.Time, engine *rules.Engine) (bool, error) {
+	if r.Type == models.TypeIncome {
+		return createIncome(tx, r, date)
+	}
+
+	var count int64
+	if err := tx.Unscoped().Model(&models.Expense{}).
+		Where("recurring_expense_id = ? AND date = ?", r.ID, date).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	expense := models.Expense{
+		UserID:             r.UserID,
+		WorkspaceID:        r.WorkspaceID,
+		CategoryID:         r.CategoryID,
+		Amount:             r.Amount,
+		Currency:           r.Currency,
+		Description:        r.Description,
+		Date:               date,
+		RecurringExpenseID: &r.ID,
+	}
+	if err := currency.ApplyBaseAmount(tx, &expense); err != nil {
+		return false, err
+	}
+
+	if r.BudgetName != "" {
+		// The budget rollover may not have reached the month yet
+		month := date.Format("2006-01")
+		if _, err := budgets.CatchUp(tx, r.WorkspaceID, month); err != nil {
+			return false, err
+		}
+		budgetID, err := budgets.Lookup(tx, r.WorkspaceID, r.BudgetName, month)
+		if err != nil {
+			return false, err
+		}
+		expense.BudgetID = budgetID
+	}
+
+	tagNames, err := engine.Apply(tx, &expense, nil)
+	if err != nil {
+		return false, err
+	}
+	if expense.Tags, err = categories.ResolveTags(tx, r.WorkspaceID, r.UserID, tagNames); err != nil {
+		return false, err
+	}
+
+	if err := tx.Create(&expense).Error; err != nil {
+		return false, err
+	}
+	return true, budgets.Book(tx, &expense)
+}
+
+// createIncome creates the income of the occurrence on date of a recurring
+// income, unless it already exists.
+func createIncome(tx *gorm.DB, r *models.RecurringExpense, date time.Time) (bool, error) {
+	var count int64
+	if err := tx.Unscoped().Model(&models.Income{}).
+		Where("recurring_expense_id = ? AND date = ?", r.ID, date).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	income := models.Income{
+		UserID:             r.UserID,
+		WorkspaceID:        r.WorkspaceID,
+		Amount:             r.Amount,
+		Currency:           r.Currency,
+		Description:        r.Description,
+		Date:               date,
+		RecurringExpenseID: &r.ID,
+	}
+	if err := currency.ApplyIncomeBaseAmount(tx, &income); err != nil {
+		return false, err
+	}
+	return true, tx.Create(&income).Error
+}
+
+// MaterializeAll runs Materialize for every recurring expense that isn't
+// paused and has occurrences due on or before through. A failing recurring
+// expense doesn't keep the others from being materialized.
+func MaterializeAll(db *gorm.DB, through time.Time) (int, error) {
+	var ids []uint
+	if err := db.Model(&models.RecurringExpense{}).
+		Where("paused = ? AND next_date <= ? AND (end_date IS NULL OR next_date <= end_date)", false, through).
+		Order("id").
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	total := 0
+	for _, id := range ids {
+		created, err := Materialize(db, id, through)
+		if err != nil {
+			log.Printf("Failed to materialize recurring expense %d: %v", id, err)
+			continue
+		}
+		total += created
+	}
+
+	return total, nil
+}
+
+// Skip skips the next occurrence of the recurring expense without creating
+// an expense for it.
+func Skip(r *models.RecurringExpense) {
+	r.NextDate = Next(r, r.NextDate)
+}
+
+// Resume unpauses the recurring expense. Occurrences that fell into the
+// pause are not created, the next one is the first on or after today.
+func Resume(r *models.RecurringExpense) {
+	r.Paused = false
+	if today := Today(); r.NextDate.Before(today) {
+		r.NextDate = NextOnOrAfter(r, today)
+	}
+}
+
+// RunScheduler materializes due occurrences once on start and then on every
+// tick of interval until ctx is cancelled. Occurrences missed while the
+// server was down are created on the first run.
+func RunScheduler(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		created, err := MaterializeAll(db, Today())
+		if err != nil {
+			log.Printf("Recurring expenses failed: %v", err)
+		} else if created > 0 {
+			log.Printf("Created %d recurring expenses", created)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
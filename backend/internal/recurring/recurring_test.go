@@ -0,0 +1,245 @@
+package recurring
+
+import (
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Budget{}, &models.Expense{}, &models.ExchangeRate{},
+		&models.Category{}, &models.Tag{}, &models.Rule{}, &models.RecurringExpense{}, &models.Workspace{}, &models.Income{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+func date(value string) time.Time {
+	d, _ := time.Parse("2006-01-02", value)
+	return d
+}
+
+func occurrences(r *models.RecurringExpense, count int) []string {
+	var dates []string
+	for next := r.NextDate; len(dates) < count; next = Next(r, next) {
+		dates = append(dates, next.Format("2006-01-02"))
+	}
+	return dates
+}
+
+func TestSchedule(t *testing.T) {
+	weekday := int(time.Friday)
+
+	tests := []struct {
+		name  string
+		r     models.RecurringExpense
+		rrule string
+		want  []string
+	}{
+		{
+			name: "monthly on the start date's day",
+			r:    models.RecurringExpense{Frequency: models.FrequencyMonthly, StartDate: date("2024-01-31")},
+			want: []string{"2024-01-31", "2024-02-29", "2024-03-31", "2024-04-30"},
+		},
+		{
+			name: "monthly on the last day",
+			r:    models.RecurringExpense{Frequency: models.FrequencyMonthly, DayOfMonth: -1, StartDate: date("2024-02-10")},
+			want: []string{"2024-02-29", "2024-03-31", "2024-04-30"},
+		},
+		{
+			name: "every three months on a day before the start",
+			r:    models.RecurringExpense{Frequency: models.FrequencyMonthly, Interval: 3, DayOfMonth: 1, StartDate: date("2024-01-15")},
+			want: []string{"2024-04-01", "2024-07-01", "2024-10-01"},
+		},
+		{
+			name: "weekly on a weekday",
+			r:    models.RecurringExpense{Frequency: models.FrequencyWeekly, Weekday: &weekday, StartDate: date("2024-01-01")},
+			want: []string{"2024-01-05", "2024-01-12", "2024-01-19"},
+		},
+		{
+			name: "yearly on a leap day",
+			r:    models.RecurringExpense{Frequency: models.FrequencyYearly, StartDate: date("2024-02-29")},
+			want: []string{"2024-02-29", "2025-02-28", "2026-02-28", "2027-02-28", "2028-02-29"},
+		},
+		{
+			name:  "RRULE every other week on Monday",
+			r:     models.RecurringExpense{StartDate: date("2024-01-03")},
+			rrule: "RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=MO",
+			want:  []string{"2024-01-08", "2024-01-22", "2024-02-05"},
+		},
+		{
+			name:  "RRULE yearly in a month",
+			r:     models.RecurringExpense{StartDate: date("2024-06-01")},
+			rrule: "FREQ=YEARLY;BYMONTH=3;BYMONTHDAY=15",
+			want:  []string{"2025-03-15", "2026-03-15"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := tt.r
+			if tt.rrule != "" {
+				assert.NoError(t, ApplyRRule(&r, tt.rrule))
+			}
+			assert.NoError(t, Normalize(&r))
+			assert.Equal(t, tt.want, occurrences(&r, len(tt.want)))
+		})
+	}
+}
+
+func TestScheduleErrors(t *testing.T) {
+	assert.Error(t, ApplyRRule(&models.RecurringExpense{}, "FREQ=DAILY"))
+	assert.Error(t, ApplyRRule(&models.RecurringExpense{}, "FREQ=MONTHLY;COUNT=3"))
+	assert.Error(t, ApplyRRule(&models.RecurringExpense{}, "INTERVAL=2"))
+
+	assert.Error(t, Normalize(&models.RecurringExpense{Frequency: "daily", StartDate: date("2024-01-01")}))
+	assert.Error(t, Normalize(&models.RecurringExpense{Frequency: models.FrequencyMonthly, DayOfMonth: 32, StartDate: date("2024-01-01")}))
+
+	end := date("2023-12-31")
+	assert.Error(t, Normalize(&models.RecurringExpense{Frequency: models.FrequencyMonthly, StartDate: date("2024-01-01"), EndDate: &end}))
+
+	// UNTIL ends the schedule
+	var r models.RecurringExpense
+	assert.NoError(t, ApplyRRule(&r, "FREQ=MONTHLY;UNTIL=20240301T000000Z"))
+	assert.Equal(t, date("2024-03-01"), *r.EndDate)
+}
+
+func TestMaterialize(t *testing.T) {
+	db := setupTestDB(t)
+
+	workspace := models.Workspace{Name: "Home", BaseCurrency: "EUR"}
+	db.Create(&workspace)
+	january := models.Budget{UserID: 1, WorkspaceID: workspace.ID, Name: "Rent", Amount: 100000, Month: "2024-01"}
+	db.Create(&january)
+
+	end := date("2024-03-31")
+	r := models.RecurringExpense{
+		UserID:      1,
+		WorkspaceID: workspace.ID,
+		Description: "Rent",
+		Amount:      80000,
+		Currency:    "EUR",
+		BudgetName:  "Rent",
+		Frequency:   models.FrequencyMonthly,
+		StartDate:   date("2024-01-01"),
+		EndDate:     &end,
+	}
+	assert.NoError(t, Normalize(&r))
+	db.Create(&r)
+
+	// Catch up on the first two months
+	created, err := Materialize(db, r.ID, date("2024-02-15"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, created)
+
+	// Running again doesn't create duplicates
+	created, err = MaterializeAll(db, date("2024-02-15"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created)
+
+	var expenses []models.Expense
+	db.Order("date").Find(&expenses)
+	assert.Len(t, expenses, 2)
+	assert.Equal(t, january.ID, *expenses[0].BudgetID)
+	assert.Equal(t, models.Money(80000), expenses[0].BaseAmount)
+
+	// The budget was rolled into February to book the occurrence there
+	var february models.Budget
+	assert.NoError(t, db.Where("month = ? AND name = ?", "2024-02", "Rent").First(&february).Error)
+	assert.Equal(t, february.ID, *expenses[1].BudgetID)
+	assert.Equal(t, models.Money(80000), february.RollOverAmount)
+
+	// A deleted occurrence isn't created again, even if the next date is reset
+	db.Delete(&expenses[1])
+	db.Model(&r).Update("next_date", date("2024-02-01"))
+
+	// The end date stops the schedule
+	created, err = MaterializeAll(db, date("2024-06-30"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, created)
+
+	db.First(&r, r.ID)
+	assert.Equal(t, date("2024-04-01"), r.NextDate)
+}
+
+func TestMaterializeIncome(t *testing.T) {
+	db := setupTestDB(t)
+
+	workspace := models.Workspace{Name: "Home", BaseCurrency: "EUR"}
+	db.Create(&workspace)
+
+	salary := models.RecurringExpense{
+		UserID:      1,
+		WorkspaceID: workspace.ID,
+		Type:        models.TypeIncome,
+		Description: "Salary",
+		Amount:      300000,
+		Currency:    "EUR",
+		Frequency:   models.FrequencyMonthly,
+		DayOfMonth:  -1,
+		StartDate:   date("2024-01-01"),
+	}
+	assert.NoError(t, Normalize(&salary))
+	db.Create(&salary)
+
+	created, err := MaterializeAll(db, date("2024-03-15"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, created)
+
+	// Occurrences are income, not expenses
+	var income []models.Income
+	db.Order("date").Find(&income)
+	assert.Len(t, income, 2)
+	assert.Equal(t, date("2024-02-29"), income[1].Date)
+	assert.Equal(t, models.Money(300000), income[1].BaseAmount)
+	assert.Equal(t, salary.ID, *income[1].RecurringExpenseID)
+	var expenses int64
+	db.Model(&models.Expense{}).Count(&expenses)
+	assert.Equal(t, int64(0), expenses)
+
+	// A deleted occurrence isn't created again
+	db.Delete(&income[1])
+	db.Model(&salary).Update("next_date", date("2024-02-29"))
+	created, err = Materialize(db, salary.ID, date("2024-03-15"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created)
+}
+
+func TestSkipPauseResume(t *testing.T) {
+	db := setupTestDB(t)
+
+	workspace := models.Workspace{Name: "Home", BaseCurrency: "EUR"}
+	db.Create(&workspace)
+
+	r := models.RecurringExpense{UserID: 1, WorkspaceID: workspace.ID, Description: "Gym", Amount: 3000, Currency: "EUR",
+		Frequency: models.FrequencyWeekly, StartDate: date("2024-01-01")}
+	assert.NoError(t, Normalize(&r))
+
+	Skip(&r)
+	assert.Equal(t, date("2024-01-08"), r.NextDate)
+
+	r.Paused = true
+	db.Create(&r)
+
+	created, err := MaterializeAll(db, date("2024-02-01"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, created)
+
+	// Resuming doesn't create the occurrences missed during the pause
+	Resume(&r)
+	assert.False(t, r.Paused)
+	assert.False(t, r.NextDate.Before(Today()))
+	assert.Equal(t, r.StartDate.Weekday(), r.NextDate.Weekday())
+}
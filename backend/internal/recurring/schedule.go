@@ -0,0 +1,198 @@
+package recurring
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/models"
+)
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// ApplyRRule sets the schedule of the recurring expense from an iCalendar
+// RRULE (RFC 5545). Only a subset is supported: FREQ of WEEKLY, MONTHLY or
+// YEARLY, INTERVAL, a single BYDAY weekday, a single BYMONTHDAY (-1 for the
+// last day), a single BYMONTH and UNTIL.
+func ApplyRRule(r *models.RecurringExpense, rrule string) error {
+	rrule = strings.TrimPrefix(strings.TrimSpace(rrule), "RRULE:")
+
+	for _, part := range strings.Split(rrule, ";") {
+		key, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("invalid RRULE part %q", part)
+		}
+
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			switch strings.ToUpper(value) {
+			case "WEEKLY":
+				r.Frequency = models.FrequencyWeekly
+			case "MONTHLY":
+				r.Frequency = models.FrequencyMonthly
+			case "YEARLY":
+				r.Frequency = models.FrequencyYearly
+			default:
+				return fmt.Errorf("unsupported RRULE frequency %q", value)
+			}
+		case "INTERVAL":
+			r.Interval, err = strconv.Atoi(value)
+		case "BYMONTHDAY":
+			r.DayOfMonth, err = strconv.Atoi(value)
+		case "BYMONTH":
+			r.Month, err = strconv.Atoi(value)
+		case "BYDAY":
+			weekday, ok := weekdays[strings.ToUpper(value)]
+			if !ok {
+				return fmt.Errorf("unsupported RRULE weekday %q", value)
+			}
+			wd := int(weekday)
+			r.Weekday = &wd
+		case "UNTIL":
+			var until time.Time
+			if until, err = time.Parse("20060102", value[:min(len(value), 8)]); err == nil {
+				r.EndDate = &until
+			}
+		case "WKST":
+			// Irrelevant with a single weekday
+		default:
+			return fmt.Errorf("unsupported RRULE part %q", key)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid RRULE value %q for %s", value, key)
+		}
+	}
+
+	if r.Frequency == "" {
+		return errors.New("RRULE needs a FREQ")
+	}
+	return nil
+}
+
+// Normalize validates the schedule of the recurring expense, derives the
+// fields that weren't set from its start date and sets the first occurrence
+// on or after its start date as the next date.
+func Normalize(r *models.RecurringExpense) error {
+	r.StartDate = day(r.StartDate)
+	if r.Interval == 0 {
+		r.Interval = 1
+	}
+	if r.Interval < 1 {
+		return errors.New("interval must be positive")
+	}
+	if r.EndDate != nil {
+		end := day(*r.EndDate)
+		if end.Before(r.StartDate) {
+			return errors.New("end date must not be before the start date")
+		}
+		r.EndDate = &end
+	}
+
+	switch r.Frequency {
+	case models.FrequencyWeekly:
+		if r.Weekday == nil {
+			weekday := int(r.StartDate.Weekday())
+			r.Weekday = &weekday
+		}
+		if *r.Weekday < 0 || *r.Weekday > 6 {
+			return errors.New("weekday must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	case models.FrequencyMonthly, models.FrequencyYearly:
+		if r.DayOfMonth == 0 {
+			r.DayOfMonth = r.StartDate.Day()
+		}
+		if r.DayOfMonth < -1 || r.DayOfMonth > 31 {
+			return errors.New("day of month must be between 1 and 31, or -1 for the last day")
+		}
+		if r.Frequency == models.FrequencyYearly {
+			if r.Month == 0 {
+				r.Month = int(r.StartDate.Month())
+			}
+			if r.Month < 1 || r.Month > 12 {
+				return errors.New("month must be between 1 and 12")
+			}
+		}
+	default:
+		return fmt.Errorf("frequency must be %s, %s or %s", models.FrequencyWeekly, models.FrequencyMonthly, models.FrequencyYearly)
+	}
+
+	r.NextDate = First(r)
+	return nil
+}
+
+// First returns the first occurrence on or after the start date.
+func First(r *models.RecurringExpense) time.Time {
+	start := r.StartDate
+
+	switch r.Frequency {
+	case models.FrequencyWeekly:
+		offset := (*r.Weekday - int(start.Weekday()) + 7) % 7
+		return start.AddDate(0, 0, offset)
+	case models.FrequencyMonthly:
+		first := onDay(start.Year(), start.Month(), r.DayOfMonth)
+		if first.Before(start) {
+			first = onDay(start.Year(), start.Month()+time.Month(r.Interval), r.DayOfMonth)
+		}
+		return first
+	default:
+		first := onDay(start.Year(), time.Month(r.Month), r.DayOfMonth)
+		if first.Before(start) {
+			first = onDay(start.Year()+r.Interval, time.Month(r.Month), r.DayOfMonth)
+		}
+		return first
+	}
+}
+
+// Next returns the occurrence following the occurrence on date.
+func Next(r *models.RecurringExpense, date time.Time) time.Time {
+	switch r.Frequency {
+	case models.FrequencyWeekly:
+		return date.AddDate(0, 0, 7*r.Interval)
+	case models.FrequencyMonthly:
+		return onDay(date.Year(), date.Month()+time.Month(r.Interval), r.DayOfMonth)
+	default:
+		return onDay(date.Year()+r.Interval, time.Month(r.Month), r.DayOfMonth)
+	}
+}
+
+// NextOnOrAfter returns the first occurrence on or after date.
+func NextOnOrAfter(r *models.RecurringExpense, date time.Time) time.Time {
+	next := First(r)
+	for next.Before(day(date)) {
+		next = Next(r, next)
+	}
+	return next
+}
+
+// Ended reports whether date lies after the end date of the recurring expense.
+func Ended(r *models.RecurringExpense, date time.Time) bool {
+	return r.EndDate != nil && date.After(*r.EndDate)
+}
+
+// onDay returns the given day of the month, limited to the month's last day.
+// A day of -1 stands for the last day.
+func onDay(year int, month time.Month, dayOfMonth int) time.Time {
+	// Normalize month overflows first, e.g. month 13
+	first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	last := first.AddDate(0, 1, -1).Day()
+	if dayOfMonth == -1 || dayOfMonth > last {
+		dayOfMonth = last
+	}
+	return first.AddDate(0, 0, dayOfMonth-1)
+}
+
+// day truncates t to midnight UTC of its date.
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,346 @@
+package reports
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const monthLayout = "2006-01"
+
+// Amounts in reports are in the workspace's base currency, like budgets.
+
+// BudgetSpend is the amount spent against a budget in a month.
+type BudgetSpend struct {
+	Month      string       `json:"month"`
+	BudgetID   *uint        `json:"budget_id"` // Nil for expenses without a budget
+	BudgetName string       `json:"budget_name"`
+	Spent      models.Money `json:"spent"`
+	Count      int          `json:"count"`
+}
+
+// MonthTotal is the amount spent in a month and its change to the month
+// before.
+type MonthTotal struct {
+	Month         string       `json:"month"`
+	Spent         models.Money `json:"spent"`
+	Change        models.Money `json:"change"`
+	ChangePercent *float64     `json:"change_percent"` // Nil if nothing was spent the month before
+}
+
+// BudgetVariance compares a budget with the expenses booked against it.
+type BudgetVariance struct {
+	BudgetID    uint         `json:"budget_id"`
+	BudgetName  string       `json:"budget_name"`
+	Budgeted    models.Money `json:"budgeted"` // Amount plus the amount carried over
+	Actual      models.Money `json:"actual"`
+	Variance    models.Money `json:"variance"` // Negative if the budget is overspent
+	PercentUsed *float64     `json:"percent_used"`
+}
+
+// DescriptionTotal is the amount spent on expenses with the same description,
+// e.g. at the same merchant.
+type DescriptionTotal struct {
+	Description string       `json:"description"`
+	Count       int          `json:"count"`
+	Spent       models.Money `json:"spent"`
+}
+
+// BurnRate is the average daily spending of a month and the total it leads to
+// by the end of the month.
+type BurnRate struct {
+	Month        string       `json:"month"`
+	Spent        models.Money `json:"spent"`
+	Budgeted     models.Money `json:"budgeted"`
+	DaysElapsed  int          `json:"days_elapsed"`
+	DaysInMonth  int          `json:"days_in_month"`
+	DailyAverage models.Money `json:"daily_average"`
+	Projected    models.Money `json:"projected"`
+}
+
+// MonthCashFlow is the income and spending of a month and what of the income
+// was saved.
+type MonthCashFlow struct {
+	Month       string       `json:"month"`
+	Income      models.Money `json:"income"`
+	Expenses    models.Money `json:"expenses"`
+	Net         models.Money `json:"net"`          // Income minus expenses, negative if more was spent
+	SavingsRate *float64     `json:"savings_rate"` // Net as a percentage of income, nil without income
+}
+
+// CashFlow is the cash flow of each month of a range and of all of them.
+type CashFlow struct {
+	Months      []MonthCashFlow `json:"months"`
+	Income      models.Money    `json:"income"`
+	Expenses    models.Money    `json:"expenses"`
+	Net         models.Money    `json:"net"`
+	SavingsRate *float64        `json:"savings_rate"`
+}
+
+// MonthRange returns the first day of from and the first day after to, both
+// given in "2006-01" format.
+func MonthRange(from, to string) (time.Time, time.Time, error) {
+	start, err := time.Parse(monthLayout, from)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid month %q", from)
+	}
+	end, err := time.Parse(monthLayout, to)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid month %q", to)
+	}
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("month %s is before %s", to, from)
+	}
+	return start, end.AddDate(0, 1, 0), nil
+}
+
+// monthOf returns the SQL expression formatting the date column as
+// "2006-01" in the dialect of db.
+func monthOf(db *gorm.DB, column string) string {
+	if db.Dialector.Name() == "sqlite" {
+		return "strftime('%Y-%m', " + column + ")"
+	}
+	return "to_char(" + column + ", 'YYYY-MM')"
+}
+
+// sum is the SQL expression summing the base amounts of expenses, cast so it
+// scans into models.Money on every database.
+const sum = "CAST(COALESCE(SUM(expenses.base_amount), 0) AS BIGINT)"
+
+// SpendByBudget returns the amount spent per budget and month for the months
+// from through to. Expenses without a budget are grouped by the month of
+// their date.
+func SpendByBudget(db *gorm.DB, workspaceID uint, from, to string) ([]BudgetSpend, error) {
+	start, end, err := MonthRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	month := monthOf(db, "expenses.date")
+	result := []BudgetSpend{}
+	err = db.Model(&models.Expense{}).
+		Select("COALESCE(budgets.month, "+month+") AS month, expenses.budget_id, COALESCE(budgets.name, '') AS budget_name, "+
+			sum+" AS spent, COUNT(*) AS count").
+		Joins("LEFT JOIN budgets ON budgets.id = expenses.budget_id").
+		Where("expenses.workspace_id = ? AND expenses.date >= ? AND expenses.date < ?", workspaceID, start, end).
+		Group("COALESCE(budgets.month, " + month + "), expenses.budget_id, budgets.name").
+		Order("month, budget_name").
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Trend returns the amount spent in each of the count months ending with
+// through, including months without expenses.
+func Trend(db *gorm.DB, workspaceID uint, through string, count int) ([]MonthTotal, error) {
+	end, err := time.Parse(monthLayout, through)
+	if err != nil {
+		return nil, fmt.Errorf("invalid month %q", through)
+	}
+	if count < 1 {
+		return nil, fmt.Errorf("the number of months must be positive")
+	}
+	// One month more to compute the change of the first one
+	start := end.AddDate(0, -count, 0)
+
+	var rows []struct {
+		Month string
+		Spent models.Money
+	}
+	month := monthOf(db, "expenses.date")
+	if err := db.Model(&models.Expense{}).
+		Select(month+" AS month, "+sum+" AS spent").
+		Where("expenses.workspace_id = ? AND expenses.date >= ? AND expenses.date < ?", workspaceID, start, end.AddDate(0, 1, 0)).
+		Group(month).
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	spent := make(map[string]models.Money, len(rows))
+	for _, row := range rows {
+		spent[row.Month] = row.Spent
+	}
+
+	result := make([]MonthTotal, 0, count)
+	previous := spent[start.Format(monthLayout)]
+	for m := start.AddDate(0, 1, 0); !m.After(end); m = m.AddDate(0, 1, 0) {
+		total := MonthTotal{Month: m.Format(monthLayout), Spent: spent[m.Format(monthLayout)]}
+		total.Change = total.Spent - previous
+		total.ChangePercent = percent(total.Change, previous)
+		result = append(result, total)
+		previous = total.Spent
+	}
+
+	return result, nil
+}
+
+// BudgetVsActual compares the workspace's budgets of month with the expenses
+// booked against them.
+func BudgetVsActual(db *gorm.DB, workspaceID uint, month string) ([]BudgetVariance, error) {
+	if _, err := time.Parse(monthLayout, month); err != nil {
+		return nil, fmt.Errorf("invalid month %q", month)
+	}
+
+	var rows []struct {
+		BudgetID   uint
+		BudgetName string
+		Budgeted   models.Money
+		Actual     models.Money
+	}
+	if err := db.Model(&models.Budget{}).
+		Select("budgets.id AS budget_id, budgets.name AS budget_name, "+
+			"budgets.amount + budgets.carried_amount AS budgeted, "+sum+" AS actual").
+		Joins("LEFT JOIN expenses ON expenses.budget_id = budgets.id AND expenses.deleted_at IS NULL").
+		Where("budgets.workspace_id = ? AND budgets.month = ?", workspaceID, month).
+		Group("budgets.id, budgets.name, budgets.amount, budgets.carried_amount").
+		Order("budgets.name, budgets.id").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	result := make([]BudgetVariance, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, BudgetVariance{
+			BudgetID:    row.BudgetID,
+			BudgetName:  row.BudgetName,
+			Budgeted:    row.Budgeted,
+			Actual:      row.Actual,
+			Variance:    row.Budgeted - row.Actual,
+			PercentUsed: percent(row.Actual, row.Budgeted),
+		})
+	}
+
+	return result, nil
+}
+
+// TopDescriptions returns the descriptions the most was spent on in the
+// months from through to. Descriptions are compared case-insensitively.
+func TopDescriptions(db *gorm.DB, workspaceID uint, from, to string, limit int) ([]DescriptionTotal, error) {
+	start, end, err := MonthRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []DescriptionTotal{}
+	err = db.Model(&models.Expense{}).
+		Select("MIN(expenses.description) AS description, COUNT(*) AS count, "+sum+" AS spent").
+		Where("expenses.workspace_id = ? AND expenses.date >= ? AND expenses.date < ?", workspaceID, start, end).
+		Group("LOWER(TRIM(expenses.description))").
+		Order("spent DESC, description").
+		Limit(limit).
+		Scan(&result).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetBurnRate returns the average daily spending of month up to and
+// including today and projects it onto the whole month. Past months count
+// all their days, future months none.
+func GetBurnRate(db *gorm.DB, workspaceID uint, month string, today time.Time) (*BurnRate, error) {
+	start, end, err := MonthRange(month, month)
+	if err != nil {
+		return nil, err
+	}
+
+	rate := &BurnRate{Month: month, DaysInMonth: end.AddDate(0, 0, -1).Day()}
+	if current := today.Format(monthLayout); current > month {
+		rate.DaysElapsed = rate.DaysInMonth
+	} else if current == month {
+		rate.DaysElapsed = today.Day()
+		// Expenses dated later in the month haven't been spent yet
+		end = start.AddDate(0, 0, rate.DaysElapsed)
+	}
+
+	if err := db.Model(&models.Expense{}).
+		Select(sum).
+		Where("expenses.workspace_id = ? AND expenses.date >= ? AND expenses.date < ?", workspaceID, start, end).
+		Scan(&rate.Spent).Error; err != nil {
+		return nil, err
+	}
+	if err := db.Model(&models.Budget{}).
+		Select("CAST(COALESCE(SUM(amount + carried_amount), 0) AS BIGINT)").
+		Where("workspace_id = ? AND month = ?", workspaceID, month).
+		Scan(&rate.Budgeted).Error; err != nil {
+		return nil, err
+	}
+
+	if rate.DaysElapsed > 0 {
+		rate.DailyAverage = models.Money(math.Round(float64(rate.Spent) / float64(rate.DaysElapsed)))
+		rate.Projected = models.Money(math.Round(float64(rate.Spent) * float64(rate.DaysInMonth) / float64(rate.DaysElapsed)))
+	}
+
+	return rate, nil
+}
+
+// GetCashFlow returns the income, expenses and savings of each month from
+// through to, including months without either.
+func GetCashFlow(db *gorm.DB, workspaceID uint, from, to string) (*CashFlow, error) {
+	start, end, err := MonthRange(from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	var income, spent []struct {
+		Month string
+		Total models.Money
+	}
+	month := monthOf(db, "incomes.date")
+	if err := db.Model(&models.Income{}).
+		Select(month+" AS month, CAST(COALESCE(SUM(incomes.base_amount), 0) AS BIGINT) AS total").
+		Where("incomes.workspace_id = ? AND incomes.date >= ? AND incomes.date < ?", workspaceID, start, end).
+		Group(month).
+		Scan(&income).Error; err != nil {
+		return nil, err
+	}
+	month = monthOf(db, "expenses.date")
+	if err := db.Model(&models.Expense{}).
+		Select(month+" AS month, "+sum+" AS total").
+		Where("expenses.workspace_id = ? AND expenses.date >= ? AND expenses.date < ?", workspaceID, start, end).
+		Group(month).
+		Scan(&spent).Error; err != nil {
+		return nil, err
+	}
+
+	earned := make(map[string]models.Money, len(income))
+	for _, row := range income {
+		earned[row.Month] = row.Total
+	}
+	expenses := make(map[string]models.Money, len(spent))
+	for _, row := range spent {
+		expenses[row.Month] = row.Total
+	}
+
+	result := &CashFlow{Months: []MonthCashFlow{}}
+	for m := start; m.Before(end); m = m.AddDate(0, 1, 0) {
+		flow := MonthCashFlow{Month: m.Format(monthLayout), Income: earned[m.Format(monthLayout)], Expenses: expenses[m.Format(monthLayout)]}
+		flow.Net = flow.Income - flow.Expenses
+		flow.SavingsRate = percent(flow.Net, flow.Income)
+		result.Months = append(result.Months, flow)
+		result.Income += flow.Income
+		result.Expenses += flow.Expenses
+	}
+	result.Net = result.Income - result.Expenses
+	result.SavingsRate = percent(result.Net, result.Income)
+
+	return result, nil
+}
+
+// percent returns part as a percentage of whole, rounded to one decimal, or
+// nil if whole is zero.
+func percent(part, whole models.Money) *float64 {
+	if whole == 0 {
+		return nil
+	}
+	p := math.Round(float64(part)*1000/float64(whole)) / 10
+	return &p
+}
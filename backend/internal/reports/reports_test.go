@@ -0,0 +1,200 @@
+package reports
+
+import (
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Budget{}, &models.Expense{}, &models.Income{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+func date(value string) time.Time {
+	d, _ := time.Parse("2006-01-02", value)
+	return d
+}
+
+// seed creates budgets and expenses for January and February 2024 in
+// workspace 1 and an expense in workspace 2 that must not show up.
+func seed(t *testing.T, db *gorm.DB) (models.Budget, models.Budget) {
+	groceries := models.Budget{UserID: 1, WorkspaceID: 1, Name: "Groceries", Amount: 40000, CarriedAmount: 5000, Month: "2024-01"}
+	rent := models.Budget{UserID: 1, WorkspaceID: 1, Name: "Rent", Amount: 100000, Month: "2024-01"}
+	assert.NoError(t, db.Create(&groceries).Error)
+	assert.NoError(t, db.Create(&rent).Error)
+
+	expense := func(workspaceID uint, budgetID *uint, description string, amount models.Money, day string) models.Expense {
+		return models.Expense{UserID: workspaceID, WorkspaceID: workspaceID, BudgetID: budgetID, Description: description, Amount: amount,
+			Currency: "EUR", BaseAmount: amount, BaseCurrency: "EUR", Date: date(day)}
+	}
+	expenses := []models.Expense{
+		expense(1, &groceries.ID, "REWE", 3000, "2024-01-03"),
+		expense(1, &groceries.ID, "rewe ", 2000, "2024-01-10"),
+		expense(1, &groceries.ID, "ALDI", 1500, "2024-01-11"),
+		expense(1, &rent.ID, "Rent", 100000, "2024-01-01"),
+		expense(1, nil, "Cinema", 1200, "2024-01-20"),
+		expense(1, nil, "REWE", 4000, "2024-02-02"),
+		expense(2, nil, "REWE", 99900, "2024-01-05"),
+	}
+	assert.NoError(t, db.Create(&expenses).Error)
+
+	// Deleted expenses are ignored
+	deleted := expense(1, &groceries.ID, "Deleted", 50000, "2024-01-15")
+	db.Create(&deleted)
+	db.Delete(&deleted)
+
+	return groceries, rent
+}
+
+func TestSpendByBudget(t *testing.T) {
+	db := setupTestDB(t)
+	groceries, rent := seed(t, db)
+
+	result, err := SpendByBudget(db, 1, "2024-01", "2024-02")
+	assert.NoError(t, err)
+	assert.Equal(t, []BudgetSpend{
+		{Month: "2024-01", BudgetName: "", Spent: 1200, Count: 1},
+		{Month: "2024-01", BudgetID: &groceries.ID, BudgetName: "Groceries", Spent: 6500, Count: 3},
+		{Month: "2024-01", BudgetID: &rent.ID, BudgetName: "Rent", Spent: 100000, Count: 1},
+		{Month: "2024-02", BudgetName: "", Spent: 4000, Count: 1},
+	}, result)
+
+	_, err = SpendByBudget(db, 1, "2024-02", "2024-01")
+	assert.Error(t, err)
+}
+
+func TestTrend(t *testing.T) {
+	db := setupTestDB(t)
+	seed(t, db)
+
+	result, err := Trend(db, 1, "2024-03", 3)
+	assert.NoError(t, err)
+	assert.Len(t, result, 3)
+
+	assert.Equal(t, "2024-01", result[0].Month)
+	assert.Equal(t, models.Money(107700), result[0].Spent)
+	assert.Nil(t, result[0].ChangePercent)
+
+	assert.Equal(t, "2024-02", result[1].Month)
+	assert.Equal(t, models.Money(4000-107700), result[1].Change)
+	assert.Equal(t, -96.3, *result[1].ChangePercent)
+
+	// Months without expenses are included
+	assert.Equal(t, "2024-03", result[2].Month)
+	assert.Equal(t, models.Money(0), result[2].Spent)
+}
+
+func TestBudgetVsActual(t *testing.T) {
+	db := setupTestDB(t)
+	groceries, rent := seed(t, db)
+
+	result, err := BudgetVsActual(db, 1, "2024-01")
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+
+	assert.Equal(t, groceries.ID, result[0].BudgetID)
+	assert.Equal(t, models.Money(45000), result[0].Budgeted)
+	assert.Equal(t, models.Money(6500), result[0].Actual)
+	assert.Equal(t, models.Money(38500), result[0].Variance)
+	assert.Equal(t, 14.4, *result[0].PercentUsed)
+
+	assert.Equal(t, rent.ID, result[1].BudgetID)
+	assert.Equal(t, models.Money(0), result[1].Variance)
+	assert.Equal(t, 100.0, *result[1].PercentUsed)
+
+	result, err = BudgetVsActual(db, 1, "2024-02")
+	assert.NoError(t, err)
+	assert.Empty(t, result)
+}
+
+func TestTopDescriptions(t *testing.T) {
+	db := setupTestDB(t)
+	seed(t, db)
+
+	result, err := TopDescriptions(db, 1, "2024-01", "2024-02", 2)
+	assert.NoError(t, err)
+	assert.Len(t, result, 2)
+	assert.Equal(t, DescriptionTotal{Description: "Rent", Count: 1, Spent: 100000}, result[0])
+	// Grouped regardless of case and surrounding spaces
+	assert.Equal(t, 3, result[1].Count)
+	assert.Equal(t, models.Money(9000), result[1].Spent)
+}
+
+func TestGetBurnRate(t *testing.T) {
+	db := setupTestDB(t)
+	seed(t, db)
+
+	rate, err := GetBurnRate(db, 1, "2024-01", date("2024-01-10"))
+	assert.NoError(t, err)
+	assert.Equal(t, 10, rate.DaysElapsed)
+	assert.Equal(t, 31, rate.DaysInMonth)
+	assert.Equal(t, models.Money(145000), rate.Budgeted)
+	// Expenses dated after today don't count yet
+	assert.Equal(t, models.Money(105000), rate.Spent)
+	assert.Equal(t, models.Money(10500), rate.DailyAverage)
+	assert.Equal(t, models.Money(325500), rate.Projected)
+
+	// Past months are complete, future months haven't started
+	rate, err = GetBurnRate(db, 1, "2024-02", date("2024-06-01"))
+	assert.NoError(t, err)
+	assert.Equal(t, 29, rate.DaysElapsed)
+	assert.Equal(t, models.Money(4000), rate.Projected)
+
+	rate, err = GetBurnRate(db, 1, "2024-03", date("2024-02-01"))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, rate.DaysElapsed)
+	assert.Equal(t, models.Money(0), rate.Projected)
+}
+
+func TestGetCashFlow(t *testing.T) {
+	db := setupTestDB(t)
+	seed(t, db)
+
+	income := func(workspaceID uint, amount models.Money, day string) models.Income {
+		return models.Income{UserID: workspaceID, WorkspaceID: workspaceID, Description: "Salary", Amount: amount,
+			Currency: "EUR", BaseAmount: amount, BaseCurrency: "EUR", Date: date(day)}
+	}
+	incomes := []models.Income{
+		income(1, 250000, "2024-01-31"),
+		income(1, 100000, "2024-03-01"),
+		income(2, 999900, "2024-01-31"),
+	}
+	assert.NoError(t, db.Create(&incomes).Error)
+
+	flow, err := GetCashFlow(db, 1, "2024-01", "2024-03")
+	assert.NoError(t, err)
+	if assert.Len(t, flow.Months, 3) {
+		assert.Equal(t, "2024-01", flow.Months[0].Month)
+		assert.Equal(t, models.Money(250000), flow.Months[0].Income)
+		assert.Equal(t, models.Money(107700), flow.Months[0].Expenses)
+		assert.Equal(t, models.Money(142300), flow.Months[0].Net)
+		assert.Equal(t, 56.9, *flow.Months[0].SavingsRate)
+		// Spending without income has no savings rate
+		assert.Equal(t, models.Money(-4000), flow.Months[1].Net)
+		assert.Nil(t, flow.Months[1].SavingsRate)
+		assert.Equal(t, models.Money(0), flow.Months[2].Expenses)
+		assert.Equal(t, 100.0, *flow.Months[2].SavingsRate)
+	}
+	assert.Equal(t, models.Money(350000), flow.Income)
+	assert.Equal(t, models.Money(111700), flow.Expenses)
+	assert.Equal(t, models.Money(238300), flow.Net)
+	assert.Equal(t, 68.1, *flow.SavingsRate)
+
+	_, err = GetCashFlow(db, 1, "2024-03", "2024-01")
+	assert.Error(t, err)
+}
@@ -0,0 +1,274 @@
+package rules
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"expense-tracker/internal/budgets"
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// maxPatternLength limits the size of description patterns. Go's regular
+// expressions run in linear time, so this only bounds the compiled size.
+const maxPatternLength = 500
+
+// Matcher is a rule whose conditions have been compiled.
+type Matcher struct {
+	Rule    models.Rule
+	pattern *regexp.Regexp
+}
+
+// Compile validates the rule and compiles its description pattern. A rule
+// needs at least one condition and one action.
+func Compile(rule models.Rule) (*Matcher, error) {
+	if rule.DescriptionPattern == "" && rule.MinAmount == nil && rule.MaxAmount == nil {
+		return nil, errors.New("a rule needs a description pattern or an amount range")
+	}
+	if rule.BudgetName == "" && rule.CategoryID == nil && len(rule.Tags) == 0 {
+		return nil, errors.New("a rule needs a budget, category or tags to assign")
+	}
+	if rule.MinAmount != nil && rule.MaxAmount != nil && *rule.MinAmount > *rule.MaxAmount {
+		return nil, errors.New("min_amount must not be greater than max_amount")
+	}
+
+	m := &Matcher{Rule: rule}
+	if rule.DescriptionPattern != "" {
+		if len(rule.DescriptionPattern) > maxPatternLength {
+			return nil, fmt.Errorf("description pattern must not be longer than %d characters", maxPatternLength)
+		}
+		pattern, err := regexp.Compile("(?i)" + rule.DescriptionPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid description pattern: %v", err)
+		}
+		m.pattern = pattern
+	}
+
+	return m, nil
+}
+
+// Matches reports whether the expense fulfills all conditions of the rule.
+// The amount is compared in the base currency, so the expense has to be
+// converted first.
+func (m *Matcher) Matches(expense *models.Expense) bool {
+	if m.pattern != nil && !m.pattern.MatchString(expense.Description) {
+		return false
+	}
+	if m.Rule.MinAmount != nil && expense.BaseAmount < *m.Rule.MinAmount {
+		return false
+	}
+	if m.Rule.MaxAmount != nil && expense.BaseAmount > *m.Rule.MaxAmount {
+		return false
+	}
+	return true
+}
+
+// Engine applies the enabled rules of a workspace in order of their priority.
+type Engine struct {
+	matchers []*Matcher
+}
+
+// Load returns an engine with the enabled rules of the workspace. Rules that
+// don't compile anymore are skipped.
+func Load(db *gorm.DB, workspaceID uint) (*Engine, error) {
+	var rules []models.Rule
+	if err := db.Preload("Tags").
+		Where("workspace_id = ? AND enabled = ?", workspaceID, true).
+		Order("priority, id").
+		Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	engine := &Engine{}
+	for _, rule := range rules {
+		if m, err := Compile(rule); err == nil {
+			engine.matchers = append(engine.matchers, m)
+		}
+	}
+	return engine, nil
+}
+
+// Apply assigns the budget and category of the first matching rules that
+// set them to the expense, unless the expense already has one. The tags of
+// all matching rules are added to tagNames, which is returned.
+func (e *Engine) Apply(db *gorm.DB, expense *models.Expense, tagNames []string) ([]string, error) {
+	for _, m := range e.matchers {
+		if !m.Matches(expense) {
+			continue
+		}
+
+		if expense.BudgetID == nil && m.Rule.BudgetName != "" {
+			budgetID, err := budgets.Lookup(db, expense.WorkspaceID, m.Rule.BudgetName, expense.Date.Format("2006-01"))
+			if err != nil {
+				return nil, err
+			}
+			expense.BudgetID = budgetID
+		}
+		if expense.CategoryID == nil && m.Rule.CategoryID != nil {
+			categoryID := *m.Rule.CategoryID
+			expense.CategoryID = &categoryID
+		}
+		for _, tag := range m.Rule.Tags {
+			tagNames = append(tagNames, tag.Name)
+		}
+	}
+
+	return tagNames, nil
+}
+
+// Change describes what applying a rule changes on an existing expense.
+type Change struct {
+	ExpenseID     uint      `json:"expense_id"`
+	Date          time.Time `json:"date"`
+	Description   string    `json:"description"`
+	OldBudgetID   *uint     `json:"old_budget_id"`
+	NewBudgetID   *uint     `json:"new_budget_id"`
+	OldCategoryID *uint     `json:"old_category_id"`
+	NewCategoryID *uint     `json:"new_category_id"`
+	AddedTags     []string  `json:"added_tags"`
+
+	expense models.Expense
+	tags    []models.Tag
+}
+
+// DryRun returns the changes applying the rule to the existing expenses of
+// its workspace would make, without making them. Budgets and categories that are
+// already set are only replaced if overwrite is true.
+func DryRun(db *gorm.DB, rule models.Rule, overwrite bool) ([]Change, error) {
+	m, err := Compile(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	// Budgets of the rule's name by month
+	budgetIDs := make(map[string]uint)
+	if rule.BudgetName != "" {
+		var list []models.Budget
+		if err := db.Select("id", "month").
+			Where("workspace_id = ? AND name = ?", rule.WorkspaceID, rule.BudgetName).
+			Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for _, budget := range list {
+			budgetIDs[budget.Month] = budget.ID
+		}
+	}
+
+	query := db.Preload("Tags").Where("workspace_id = ?", rule.WorkspaceID)
+	if rule.MinAmount != nil {
+		query = query.Where("base_amount >= ?", *rule.MinAmount)
+	}
+	if rule.MaxAmount != nil {
+		query = query.Where("base_amount <= ?", *rule.MaxAmount)
+	}
+
+	changes := []Change{}
+	var expenses []models.Expense
+	err = query.FindInBatches(&expenses, 500, func(_ *gorm.DB, _ int) error {
+		for _, expense := range expenses {
+			if !m.Matches(&expense) {
+				continue
+			}
+			if change, ok := plan(m, expense, budgetIDs, overwrite); ok {
+				changes = append(changes, change)
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+func plan(m *Matcher, expense models.Expense, budgetIDs map[string]uint, overwrite bool) (Change, bool) {
+	change := Change{
+		ExpenseID:     expense.ID,
+		Date:          expense.Date,
+		Description:   expense.Description,
+		OldBudgetID:   expense.BudgetID,
+		NewBudgetID:   expense.BudgetID,
+		OldCategoryID: expense.CategoryID,
+		NewCategoryID: expense.CategoryID,
+		AddedTags:     []string{},
+		expense:       expense,
+	}
+	changed := false
+
+	if budgetID, ok := budgetIDs[expense.Date.Format("2006-01")]; ok && (expense.BudgetID == nil || overwrite) {
+		if expense.BudgetID == nil || *expense.BudgetID != budgetID {
+			change.NewBudgetID = &budgetID
+			changed = true
+		}
+	}
+	if categoryID := m.Rule.CategoryID; categoryID != nil && (expense.CategoryID == nil || overwrite) {
+		if expense.CategoryID == nil || *expense.CategoryID != *categoryID {
+			change.NewCategoryID = categoryID
+			changed = true
+		}
+	}
+
+	existing := make(map[uint]bool, len(expense.Tags))
+	for _, tag := range expense.Tags {
+		existing[tag.ID] = true
+	}
+	for _, tag := range m.Rule.Tags {
+		if !existing[tag.ID] {
+			change.AddedTags = append(change.AddedTags, tag.Name)
+			change.tags = append(change.tags, tag)
+			changed = true
+		}
+	}
+
+	return change, changed
+}
+
+// ApplyToHistory applies the rule to the existing expenses of its workspace and
+// returns the changes that were made. Expenses that move to another budget
+// are rebooked. It has to run in a transaction.
+func ApplyToHistory(tx *gorm.DB, rule models.Rule, overwrite bool) ([]Change, error) {
+	changes, err := DryRun(tx, rule, overwrite)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, change := range changes {
+		expense := change.expense
+
+		if !sameID(change.OldBudgetID, change.NewBudgetID) {
+			if err := budgets.Unbook(tx, &expense); err != nil {
+				return nil, err
+			}
+			expense.BudgetID = change.NewBudgetID
+			if err := budgets.Book(tx, &expense); err != nil {
+				return nil, err
+			}
+		}
+		expense.CategoryID = change.NewCategoryID
+
+		if err := tx.Model(&expense).UpdateColumns(map[string]interface{}{
+			"budget_id":   expense.BudgetID,
+			"category_id": expense.CategoryID,
+		}).Error; err != nil {
+			return nil, err
+		}
+		if len(change.tags) > 0 {
+			if err := tx.Model(&expense).Association("Tags").Append(change.tags); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return changes, nil
+}
+
+func sameID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,167 @@
+package rules
+
+import (
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Budget{}, &models.Expense{}, &models.Category{}, &models.Tag{}, &models.Rule{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+func money(value string) *models.Money {
+	m := models.MustParseMoney(value)
+	return &m
+}
+
+func TestCompile(t *testing.T) {
+	categoryID := uint(1)
+
+	tests := []struct {
+		name    string
+		rule    models.Rule
+		wantErr bool
+	}{
+		{"pattern and budget", models.Rule{DescriptionPattern: "REWE|ALDI", BudgetName: "Groceries"}, false},
+		{"amount range and category", models.Rule{MinAmount: money("10"), MaxAmount: money("20"), CategoryID: &categoryID}, false},
+		{"no condition", models.Rule{BudgetName: "Groceries"}, true},
+		{"no action", models.Rule{DescriptionPattern: "REWE"}, true},
+		{"invalid pattern", models.Rule{DescriptionPattern: "REWE(", BudgetName: "Groceries"}, true},
+		{"inverted range", models.Rule{MinAmount: money("20"), MaxAmount: money("10"), BudgetName: "Groceries"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(tt.rule)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestMatches(t *testing.T) {
+	m, err := Compile(models.Rule{DescriptionPattern: "rewe|aldi", MaxAmount: money("100"), BudgetName: "Groceries"})
+	assert.NoError(t, err)
+
+	assert.True(t, m.Matches(&models.Expense{Description: "REWE SAGT DANKE", BaseAmount: models.MustParseMoney("42")}))
+	assert.True(t, m.Matches(&models.Expense{Description: "Aldi Süd", BaseAmount: models.MustParseMoney("100")}))
+	assert.False(t, m.Matches(&models.Expense{Description: "Aldi Süd", BaseAmount: models.MustParseMoney("100.01")}))
+	assert.False(t, m.Matches(&models.Expense{Description: "Lidl", BaseAmount: models.MustParseMoney("5")}))
+}
+
+func TestEngineApply(t *testing.T) {
+	db := setupTestDB(t)
+
+	groceries := models.Budget{UserID: 1, WorkspaceID: 1, Name: "Groceries", Amount: 50000, Month: "2024-01"}
+	db.Create(&groceries)
+	category := models.Category{UserID: 1, WorkspaceID: 1, Name: "Food"}
+	db.Create(&category)
+
+	rules := []models.Rule{
+		{UserID: 1, WorkspaceID: 1, Name: "Supermarkets", Priority: 1, Enabled: true, DescriptionPattern: "rewe|aldi", BudgetName: "Groceries",
+			Tags: []models.Tag{{UserID: 1, WorkspaceID: 1, Name: "supermarket"}}},
+		{UserID: 1, WorkspaceID: 1, Name: "Everything", Priority: 2, Enabled: true, MinAmount: money("0"), BudgetName: "Other",
+			CategoryID: &category.ID, Tags: []models.Tag{{UserID: 1, WorkspaceID: 1, Name: "auto"}}},
+		{UserID: 1, WorkspaceID: 1, Name: "Disabled", Priority: 0, Enabled: false, DescriptionPattern: "rewe", CategoryID: &category.ID},
+		{UserID: 2, WorkspaceID: 2, Name: "Other user", Priority: 0, Enabled: true, DescriptionPattern: "rewe", BudgetName: "Groceries"},
+	}
+	assert.NoError(t, db.Create(&rules).Error)
+
+	engine, err := Load(db, 1)
+	assert.NoError(t, err)
+
+	// The first matching rule with a budget of the expense's month wins
+	expense := models.Expense{UserID: 1, WorkspaceID: 1, Description: "REWE Markt", BaseAmount: 2000, Date: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)}
+	tags, err := engine.Apply(db, &expense, []string{"manual"})
+	assert.NoError(t, err)
+	assert.Equal(t, groceries.ID, *expense.BudgetID)
+	assert.Equal(t, category.ID, *expense.CategoryID)
+	assert.Equal(t, []string{"manual", "supermarket", "auto"}, tags)
+
+	// No budget of that name in February
+	expense = models.Expense{UserID: 1, WorkspaceID: 1, Description: "ALDI", BaseAmount: 2000, Date: time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)}
+	_, err = engine.Apply(db, &expense, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, expense.BudgetID)
+
+	// Explicitly set fields are kept
+	otherCategory := uint(99)
+	expense = models.Expense{UserID: 1, WorkspaceID: 1, Description: "REWE", BaseAmount: 2000, CategoryID: &otherCategory, Date: time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)}
+	_, err = engine.Apply(db, &expense, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, otherCategory, *expense.CategoryID)
+}
+
+func TestApplyToHistory(t *testing.T) {
+	db := setupTestDB(t)
+
+	groceries := models.Budget{UserID: 1, WorkspaceID: 1, Name: "Groceries", Amount: 50000, Month: "2024-01"}
+	misc := models.Budget{UserID: 1, WorkspaceID: 1, Name: "Misc", Amount: 50000, Month: "2024-01", RollOverAmount: 3000}
+	db.Create(&groceries)
+	db.Create(&misc)
+
+	date := time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC)
+	expenses := []models.Expense{
+		{UserID: 1, WorkspaceID: 1, Description: "REWE", Amount: 1000, BaseAmount: 1000, Date: date},
+		{UserID: 1, WorkspaceID: 1, Description: "ALDI", Amount: 3000, BaseAmount: 3000, Date: date, BudgetID: &misc.ID},
+		{UserID: 1, WorkspaceID: 1, Description: "Cinema", Amount: 1500, BaseAmount: 1500, Date: date},
+		{UserID: 1, WorkspaceID: 1, Description: "REWE", Amount: 500, BaseAmount: 500, Date: date.AddDate(0, 1, 0)},
+	}
+	db.Create(&expenses)
+
+	rule := models.Rule{UserID: 1, WorkspaceID: 1, Name: "Supermarkets", Enabled: true, DescriptionPattern: "rewe|aldi", BudgetName: "Groceries"}
+	db.Create(&rule)
+
+	// Only empty budgets are filled in by default
+	changes, err := DryRun(db, rule, false)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, expenses[0].ID, changes[0].ExpenseID)
+
+	changes, err = DryRun(db, rule, true)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, misc.ID, *changes[1].OldBudgetID)
+	assert.Equal(t, groceries.ID, *changes[1].NewBudgetID)
+
+	// A dry run doesn't change anything
+	db.First(&expenses[0], expenses[0].ID)
+	assert.Nil(t, expenses[0].BudgetID)
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		changes, err = ApplyToHistory(tx, rule, true)
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+
+	// The amounts moved between the budgets
+	db.First(&groceries, groceries.ID)
+	db.First(&misc, misc.ID)
+	assert.Equal(t, models.Money(4000), groceries.RollOverAmount)
+	assert.Equal(t, models.Money(0), misc.RollOverAmount)
+
+	// Applying it again changes nothing
+	changes, err = DryRun(db, rule, true)
+	assert.NoError(t, err)
+	assert.Empty(t, changes)
+}
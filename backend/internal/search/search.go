@@ -0,0 +1,162 @@
+// Package search finds expenses by the words of their description, notes and
+// budget name. PostgreSQL ranks them by a full-text index and finds misspelled
+// words by trigram similarity, SQLite uses an FTS5 index.
+package search
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+
+	"expense-tracker/internal/expenses"
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// MaxTerms is the number of words of a search that are looked for, further
+// ones are ignored.
+const MaxTerms = 8
+
+var ErrEmptyQuery = errors.New("search needs at least one word")
+
+// Result is an expense found by a search. The higher its rank, the better it
+// matches.
+type Result struct {
+	Expense models.Expense `json:"expense"`
+	Rank    float64        `json:"rank"`
+}
+
+// hit is a matching expense before it is loaded.
+type hit struct {
+	ID    uint
+	Score float64
+}
+
+// Expenses searches the workspace's expenses that match the filter for the
+// words of text and returns up to limit of them, the best matches first.
+// Expenses match any of the words, words match the beginning of longer ones.
+func Expenses(db *gorm.DB, workspaceID uint, text string, filter expenses.Filter, limit int) ([]Result, error) {
+	words := Terms(text)
+	if len(words) == 0 {
+		return nil, ErrEmptyQuery
+	}
+
+	query := filter.Apply(db, workspaceID).
+		Joins("LEFT JOIN budgets ON budgets.id = expenses.budget_id AND budgets.deleted_at IS NULL")
+
+	var hits []hit
+	var err error
+	switch {
+	case db.Dialector.Name() == "postgres":
+		hits, err = searchPostgres(query, words, limit)
+	case HasIndex(db):
+		hits, err = searchFTS(db, query, words, limit)
+	default:
+		hits, err = searchPatterns(query, words, limit)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, len(hits))
+	for i, h := range hits {
+		ids[i] = h.ID
+	}
+	var list []models.Expense
+	if err := expenses.Preload(db).Where("id IN ?", ids).Find(&list).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[uint]models.Expense, len(list))
+	for _, expense := range list {
+		byID[expense.ID] = expense
+	}
+
+	results := make([]Result, 0, len(hits))
+	for _, h := range hits {
+		if expense, ok := byID[h.ID]; ok {
+			results = append(results, Result{Expense: expense, Rank: h.Score})
+		}
+	}
+	return results, nil
+}
+
+// Terms splits the text of a search into lower case words, leaving out
+// punctuation and repeated words.
+func Terms(text string) []string {
+	var terms []string
+	seen := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if seen[word] {
+			continue
+		}
+		seen[word] = true
+		if terms = append(terms, word); len(terms) == MaxTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// searchPostgres matches the prefixes of the words against the full-text
+// index of descriptions and notes and against budget names. Descriptions
+// that are similar to the text, e.g. misspelled, match as well.
+func searchPostgres(query *gorm.DB, words []string, limit int) ([]hit, error) {
+	prefixes := make([]string, len(words))
+	for i, word := range words {
+		prefixes[i] = word + ":*"
+	}
+	tsquery := strings.Join(prefixes, " | ")
+	text := strings.Join(words, " ")
+
+	var hits []hit
+	err := query.
+		Select(`expenses.id, ts_rank(expenses.search_vector, to_tsquery('simple', ?))
+			+ COALESCE(ts_rank(to_tsvector('simple', budgets.name), to_tsquery('simple', ?)), 0) / 2
+			+ word_similarity(?, expenses.description) / 4 AS score`, tsquery, tsquery, text).
+		Where(`expenses.search_vector @@ to_tsquery('simple', ?)
+			OR to_tsvector('simple', budgets.name) @@ to_tsquery('simple', ?)
+			OR ? <% expenses.description`, tsquery, tsquery, text).
+		Order("score DESC").
+		Order("expenses.date DESC").
+		Limit(limit).
+		Scan(&hits).Error
+	return hits, err
+}
+
+// searchPatterns is used on SQLite builds without FTS5. It matches the words
+// anywhere in descriptions, notes and budget names and ranks matches in the
+// description highest.
+func searchPatterns(query *gorm.DB, words []string, limit int) ([]hit, error) {
+	var score, conditions []string
+	var scoreArgs, conditionArgs []interface{}
+	for _, word := range words {
+		pattern := "%" + expenses.EscapeLike(word) + "%"
+		for _, column := range []struct {
+			name   string
+			weight string
+		}{
+			{"expenses.description", "4"},
+			{"expenses.notes", "2"},
+			{"budgets.name", "1"},
+		} {
+			match := "LOWER(" + column.name + `) LIKE ? ESCAPE '\'`
+			score = append(score, "CASE WHEN "+match+" THEN "+column.weight+" ELSE 0 END")
+			conditions = append(conditions, match)
+			scoreArgs = append(scoreArgs, pattern)
+			conditionArgs = append(conditionArgs, pattern)
+		}
+	}
+
+	var hits []hit
+	err := query.
+		Select("expenses.id, "+strings.Join(score, " + ")+" AS score", scoreArgs...).
+		Where(strings.Join(conditions, " OR "), conditionArgs...).
+		Order("score DESC").
+		Order("expenses.date DESC").
+		Limit(limit).
+		Scan(&hits).Error
+	return hits, err
+}
@@ -0,0 +1,169 @@
+package search
+
+import (
+	"testing"
+	"time"
+
+	"expense-tracker/internal/expenses"
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupTestDB returns a database with the full-text index if the SQLite
+// driver was built with FTS5 (-tags sqlite_fts5), searches fall back to
+// pattern matching otherwise.
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Budget{}, &models.Category{}, &models.Tag{}, &models.Expense{}, &models.ExpenseSplit{}, &models.Attachment{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+	if err := CreateIndex(db); err == nil {
+		err = IndexDeletedBudgets(db)
+	}
+	if err != nil {
+		t.Fatalf("Failed to create search index: %v", err)
+	}
+
+	return db
+}
+
+func createExpenses(t *testing.T, db *gorm.DB) models.Budget {
+	budget := models.Budget{UserID: 1, WorkspaceID: 1, Name: "Health", Amount: 50000, Month: "2024-04"}
+	assert.NoError(t, db.Create(&budget).Error)
+
+	day := func(month, d int) time.Time { return time.Date(2024, time.Month(month), d, 0, 0, 0, 0, time.UTC) }
+	for _, e := range []models.Expense{
+		{Description: "Dentist Dr. Müller", Notes: "Cleaning", Date: day(4, 12), BudgetID: &budget.ID},
+		{Description: "Pharmacy", Notes: "Painkillers after the dentist", Date: day(4, 13), BudgetID: &budget.ID},
+		{Description: "Dentist", Date: day(9, 2)},
+		{Description: "Groceries", Notes: "Weekly shopping", Date: day(4, 14)},
+	} {
+		e.UserID, e.WorkspaceID, e.Amount, e.BaseAmount = 1, 1, 1000, 1000
+		assert.NoError(t, db.Create(&e).Error)
+	}
+	assert.NoError(t, db.Create(&models.Expense{UserID: 2, WorkspaceID: 2, Description: "Dentist", Date: day(4, 12)}).Error)
+	return budget
+}
+
+func descriptions(results []Result) []string {
+	list := []string{}
+	for _, result := range results {
+		list = append(list, result.Expense.Description)
+	}
+	return list
+}
+
+func TestTerms(t *testing.T) {
+	assert.Equal(t, []string{"that", "dentist", "bill", "from", "last", "spring"}, Terms("That dentist-bill, from last spring!"))
+	assert.Equal(t, []string{"müller", "42"}, Terms("Müller 42 müller"))
+	assert.Empty(t, Terms(" *:& "))
+	assert.Len(t, Terms("a b c d e f g h i j"), MaxTerms)
+}
+
+func TestSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, Similarity("dentist", "Dentist"))
+	assert.GreaterOrEqual(t, Similarity("dentst", "dentist"), similarityThreshold)
+	assert.GreaterOrEqual(t, Similarity("grocerys", "groceries"), similarityThreshold)
+	assert.Less(t, Similarity("bill", "ball"), similarityThreshold)
+	assert.Equal(t, 0.0, Similarity("dentist", "groceries"))
+}
+
+func TestSearch(t *testing.T) {
+	db := setupTestDB(t)
+	budget := createExpenses(t, db)
+
+	april := expenses.Filter{From: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), To: time.Date(2024, 4, 30, 0, 0, 0, 0, time.UTC)}
+	tests := []struct {
+		name   string
+		text   string
+		filter expenses.Filter
+		want   []string
+	}{
+		// Matches in the description rank above matches in the notes
+		{name: "ranked", text: "dentist", filter: april, want: []string{"Dentist Dr. Müller", "Pharmacy"}},
+		{name: "prefix", text: "dent", want: []string{"Dentist Dr. Müller", "Dentist", "Pharmacy"}},
+		{name: "any word", text: "that pharmacy bill from last spring", want: []string{"Pharmacy"}},
+		{name: "notes", text: "weekly", want: []string{"Groceries"}},
+		{name: "budget name", text: "health", want: []string{"Dentist Dr. Müller", "Pharmacy"}},
+		{name: "budget filter", text: "dentist", filter: expenses.Filter{BudgetID: &budget.ID}, want: []string{"Dentist Dr. Müller", "Pharmacy"}},
+		{name: "unbudgeted", text: "dentist", filter: expenses.Filter{Unbudgeted: true}, want: []string{"Dentist"}},
+		{name: "no match", text: "rent", want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := Expenses(db, 1, tt.text, tt.filter, 10)
+			assert.NoError(t, err)
+			if tt.name == "ranked" {
+				assert.Equal(t, tt.want, descriptions(results))
+				assert.Greater(t, results[0].Rank, results[1].Rank)
+			} else {
+				assert.ElementsMatch(t, tt.want, descriptions(results))
+			}
+		})
+	}
+
+	results, err := Expenses(db, 1, "dentist", expenses.Filter{}, 1)
+	assert.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	_, err = Expenses(db, 1, "?!", expenses.Filter{}, 10)
+	assert.ErrorIs(t, err, ErrEmptyQuery)
+}
+
+func TestSearchDeletedBudgets(t *testing.T) {
+	db := setupTestDB(t)
+	budget := createExpenses(t, db)
+	assert.NoError(t, db.Delete(&budget).Error)
+
+	// The names of deleted budgets don't match anymore, the expenses still do
+	results, err := Expenses(db, 1, "health", expenses.Filter{}, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, results)
+	results, err = Expenses(db, 1, "pharmacy", expenses.Filter{}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Pharmacy"}, descriptions(results))
+}
+
+func TestSearchIndex(t *testing.T) {
+	db := setupTestDB(t)
+	if !HasIndex(db) {
+		t.Skip("SQLite was built without FTS5, run the tests with -tags sqlite_fts5")
+	}
+	budget := createExpenses(t, db)
+
+	// Misspelled words find similar indexed ones
+	results, err := Expenses(db, 1, "dentst", expenses.Filter{}, 10)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"Dentist Dr. Müller", "Dentist", "Pharmacy"}, descriptions(results))
+
+	// Diacritics are ignored
+	results, err = Expenses(db, 1, "muller", expenses.Filter{}, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Dentist Dr. Müller"}, descriptions(results))
+
+	// The index follows changes of expenses and budget names
+	assert.NoError(t, db.Model(&models.Expense{}).Where("description = ?", "Groceries").Update("description", "Supermarket").Error)
+	assert.NoError(t, db.Model(&budget).Update("name", "Medical").Error)
+	assert.NoError(t, db.Unscoped().Where("description = ?", "Pharmacy").Delete(&models.Expense{}).Error)
+
+	for text, want := range map[string][]string{
+		"supermarket": {"Supermarket"},
+		"groceries":   {},
+		"medical":     {"Dentist Dr. Müller"},
+		"health":      {},
+		"painkillers": {},
+	} {
+		results, err := Expenses(db, 1, text, expenses.Filter{}, 10)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, want, descriptions(results), text)
+	}
+}
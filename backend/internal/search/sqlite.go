@@ -0,0 +1,165 @@
+package search
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+)
+
+// indexSchema creates the FTS5 index of SQLite databases. The index holds the
+// description, notes and budget name of each expense under the expense's ID,
+// triggers keep it up to date.
+const indexSchema = `
+CREATE VIRTUAL TABLE expenses_fts USING fts5(
+    description, notes, budget_name,
+    tokenize = 'unicode61 remove_diacritics 2',
+    prefix = '2 3'
+);
+CREATE VIRTUAL TABLE expenses_fts_vocab USING fts5vocab(expenses_fts, 'row');
+
+INSERT INTO expenses_fts (rowid, description, notes, budget_name)
+    SELECT expenses.id, expenses.description, expenses.notes, COALESCE(budgets.name, '')
+    FROM expenses LEFT JOIN budgets ON budgets.id = expenses.budget_id;
+
+CREATE TRIGGER expenses_fts_insert AFTER INSERT ON expenses BEGIN
+    INSERT INTO expenses_fts (rowid, description, notes, budget_name)
+    VALUES (new.id, new.description, new.notes, COALESCE((SELECT name FROM budgets WHERE id = new.budget_id), ''));
+END;
+CREATE TRIGGER expenses_fts_update AFTER UPDATE OF description, notes, budget_id ON expenses BEGIN
+    UPDATE expenses_fts
+    SET description = new.description, notes = new.notes,
+        budget_name = COALESCE((SELECT name FROM budgets WHERE id = new.budget_id), '')
+    WHERE rowid = new.id;
+END;
+CREATE TRIGGER expenses_fts_delete AFTER DELETE ON expenses BEGIN
+    DELETE FROM expenses_fts WHERE rowid = old.id;
+END;
+CREATE TRIGGER expenses_fts_budget_name AFTER UPDATE OF name ON budgets BEGIN
+    UPDATE expenses_fts SET budget_name = new.name
+    WHERE rowid IN (SELECT id FROM expenses WHERE budget_id = new.id);
+END;
+`
+
+// deletedBudgetsSchema leaves the names of deleted budgets out of the index,
+// budgets are only soft deleted.
+const deletedBudgetsSchema = `
+UPDATE expenses_fts SET budget_name = ''
+WHERE rowid IN (SELECT expenses.id FROM expenses JOIN budgets ON budgets.id = expenses.budget_id
+    WHERE budgets.deleted_at IS NOT NULL);
+
+CREATE TRIGGER expenses_fts_budget_deleted AFTER UPDATE OF deleted_at ON budgets BEGIN
+    UPDATE expenses_fts SET budget_name = CASE WHEN new.deleted_at IS NULL THEN new.name ELSE '' END
+    WHERE rowid IN (SELECT id FROM expenses WHERE budget_id = new.id);
+END;
+`
+
+const dropIndexSchema = `
+DROP TRIGGER IF EXISTS expenses_fts_budget_deleted;
+DROP TRIGGER IF EXISTS expenses_fts_budget_name;
+DROP TRIGGER IF EXISTS expenses_fts_delete;
+DROP TRIGGER IF EXISTS expenses_fts_update;
+DROP TRIGGER IF EXISTS expenses_fts_insert;
+DROP TABLE IF EXISTS expenses_fts_vocab;
+DROP TABLE IF EXISTS expenses_fts;
+`
+
+// FTS5Available reports whether SQLite was built with the FTS5 module. The
+// driver only includes it with the sqlite_fts5 build tag.
+func FTS5Available(db *gorm.DB) bool {
+	var used bool
+	err := db.Raw("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&used).Error
+	return err == nil && used
+}
+
+// CreateIndex creates the full-text index of a SQLite database built with
+// FTS5. On other databases, and without FTS5, it does nothing.
+func CreateIndex(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "sqlite" || !FTS5Available(tx) {
+		return nil
+	}
+	return tx.Exec(indexSchema).Error
+}
+
+// DropIndex drops the full-text index of a SQLite database.
+func DropIndex(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "sqlite" {
+		return nil
+	}
+	return tx.Exec(dropIndexSchema).Error
+}
+
+// IndexDeletedBudgets keeps the names of deleted budgets out of the
+// full-text index of a SQLite database. Without the index it does nothing.
+func IndexDeletedBudgets(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "sqlite" || !HasIndex(tx) {
+		return nil
+	}
+	return tx.Exec(deletedBudgetsSchema).Error
+}
+
+// UnindexDeletedBudgets reverts IndexDeletedBudgets.
+func UnindexDeletedBudgets(tx *gorm.DB) error {
+	if tx.Dialector.Name() != "sqlite" {
+		return nil
+	}
+	return tx.Exec("DROP TRIGGER IF EXISTS expenses_fts_budget_deleted").Error
+}
+
+// HasIndex reports whether the SQLite database has a full-text index.
+func HasIndex(db *gorm.DB) bool {
+	return db.Migrator().HasTable("expenses_fts")
+}
+
+// searchFTS matches the prefixes of the words against the FTS5 index, along
+// with indexed words that are similar to them, and ranks matches by BM25.
+// Matches in descriptions weigh most, matches in budget names least.
+func searchFTS(db *gorm.DB, query *gorm.DB, words []string, limit int) ([]hit, error) {
+	var match []string
+	for _, word := range words {
+		match = append(match, `"`+word+`"*`)
+		similar, err := similarTerms(db, word)
+		if err != nil {
+			return nil, err
+		}
+		for _, term := range similar {
+			match = append(match, `"`+term+`"`)
+		}
+	}
+
+	var hits []hit
+	err := query.
+		Select("expenses.id, -bm25(expenses_fts, 4.0, 2.0, 1.0) AS score").
+		Joins("JOIN expenses_fts ON expenses_fts.rowid = expenses.id").
+		Where("expenses_fts MATCH ?", strings.Join(match, " OR ")).
+		Order("score DESC").
+		Order("expenses.date DESC").
+		Limit(limit).
+		Scan(&hits).Error
+	return hits, err
+}
+
+// similarTerms returns the indexed words that are similar to the word but
+// not the same, so that misspelled words find expenses as well. Short words
+// are similar to too many others and are left out.
+func similarTerms(db *gorm.DB, word string) ([]string, error) {
+	length := utf8.RuneCountInString(word)
+	if length < minFuzzyLength {
+		return nil, nil
+	}
+
+	var candidates []string
+	if err := db.Table("expenses_fts_vocab").
+		Where("length(term) BETWEEN ? AND ?", length-2, length+2).
+		Pluck("term", &candidates).Error; err != nil {
+		return nil, err
+	}
+
+	var terms []string
+	for _, candidate := range candidates {
+		if candidate != word && Similarity(word, candidate) >= similarityThreshold {
+			terms = append(terms, candidate)
+		}
+	}
+	return terms, nil
+}
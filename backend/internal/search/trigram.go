@@ -0,0 +1,38 @@
+package search
+
+import "strings"
+
+const (
+	// similarityThreshold is the similarity from which a word counts as a
+	// misspelling of another.
+	similarityThreshold = 0.4
+	// minFuzzyLength is the length from which misspelled words are looked for.
+	minFuzzyLength = 4
+)
+
+// Similarity returns how similar two words are by the share of trigrams they
+// have in common, from 0 to 1, like similarity() of PostgreSQL's pg_trgm.
+func Similarity(a, b string) float64 {
+	ta, tb := trigrams(a), trigrams(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	common := 0
+	for trigram := range ta {
+		if tb[trigram] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(ta)+len(tb)-common)
+}
+
+// trigrams returns the sets of three consecutive characters of the word,
+// padded with two spaces in front and one at the end like pg_trgm does.
+func trigrams(word string) map[string]bool {
+	runes := []rune("  " + strings.ToLower(word) + " ")
+	set := make(map[string]bool)
+	for i := 0; i+3 <= len(runes); i++ {
+		set[string(runes[i:i+3])] = true
+	}
+	return set
+}
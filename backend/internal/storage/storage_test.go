@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	_, err := store.Get(ctx, "receipts/missing.pdf")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, store.Put(ctx, "receipts/a b.pdf", []byte("%PDF-1.4"), "application/pdf"))
+	file, err := store.Get(ctx, "receipts/a b.pdf")
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(file)
+		file.Close()
+		assert.Equal(t, "%PDF-1.4", string(data))
+	}
+
+	// Putting a key again replaces the file
+	assert.NoError(t, store.Put(ctx, "receipts/a b.pdf", []byte("%PDF-1.7"), "application/pdf"))
+	file, err = store.Get(ctx, "receipts/a b.pdf")
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(file)
+		file.Close()
+		assert.Equal(t, "%PDF-1.7", string(data))
+	}
+
+	assert.NoError(t, store.Delete(ctx, "receipts/a b.pdf"))
+	_, err = store.Get(ctx, "receipts/a b.pdf")
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, store.Delete(ctx, "receipts/a b.pdf"))
+}
+
+func TestLocalStore(t *testing.T) {
+	store := &LocalStore{Dir: t.TempDir()}
+	testStore(t, store)
+
+	err := store.Put(context.Background(), "../outside", []byte("x"), "text/plain")
+	assert.Error(t, err)
+}
+
+// fakeS3 is an in-memory S3 that checks the signature scheme of requests.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]string
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=minio/") ||
+		!strings.Contains(auth, "host;x-amz-content-sha256;x-amz-date") ||
+		r.Header.Get("X-Amz-Content-Sha256") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.EscapedPath()] = string(data)
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.EscapedPath()]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		io.WriteString(w, data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.EscapedPath())
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestS3Store(t *testing.T) {
+	fake := &fakeS3{objects: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	store, err := New(Config{
+		Driver:    "s3",
+		Endpoint:  server.URL,
+		Bucket:    "expenses",
+		AccessKey: "minio",
+		SecretKey: "minio123",
+		PathStyle: true,
+	})
+	assert.NoError(t, err)
+	testStore(t, store)
+
+	assert.NoError(t, store.Put(context.Background(), "receipts/a b.pdf", []byte("%PDF"), "application/pdf"))
+	assert.Contains(t, fake.objects, "/expenses/receipts/a%20b.pdf")
+
+	// Wrong credentials surface as errors
+	store.(*S3Store).AccessKey = "other"
+	_, err = store.Get(context.Background(), "receipts/a b.pdf")
+	assert.ErrorContains(t, err, "403")
+}
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	emptyHash := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	signV4(req, emptyHash, "AKIDEXAMPLE", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", "us-east-1", "service",
+		time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestNew(t *testing.T) {
+	_, err := New(Config{})
+	assert.Error(t, err)
+	_, err = New(Config{Driver: "s3", Endpoint: "http://localhost:9000"})
+	assert.Error(t, err)
+	_, err = New(Config{Driver: "ftp"})
+	assert.Error(t, err)
+
+	store, err := New(Config{Dir: t.TempDir()})
+	assert.NoError(t, err)
+	assert.IsType(t, &LocalStore{}, store)
+}
@@ -0,0 +1,301 @@
+package workspaces
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// InvitationTTL is how long an invitation can be accepted.
+const InvitationTTL = 14 * 24 * time.Hour
+
+var (
+	ErrNotFound   = errors.New("workspace not found")
+	ErrLastOwner  = errors.New("a workspace needs at least one owner")
+	ErrPersonal   = errors.New("a personal workspace can't be deleted")
+	ErrMember     = errors.New("user is already a member of the workspace")
+	ErrUnverified = errors.New("verify your email address to answer invitations")
+)
+
+var ranks = map[string]int{
+	models.RoleViewer: 1,
+	models.RoleEditor: 2,
+	models.RoleOwner:  3,
+}
+
+// Allows reports whether a member with role has the rights of required.
+func Allows(role, required string) bool {
+	return ranks[role] >= ranks[required] && ranks[role] > 0
+}
+
+// Scope limits a query to the records of the workspace. It qualifies the
+// column with the query's table, so it can be combined with joins.
+func Scope(workspaceID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: "workspace_id"},
+			Value:  workspaceID,
+		})
+	}
+}
+
+// Personal returns the personal workspace of the user, creating it on first
+// use. It starts with the user's base currency.
+func Personal(db *gorm.DB, userID uint) (*models.Workspace, error) {
+	var workspace models.Workspace
+	err := db.Where("personal_user_id = ?", userID).First(&workspace).Error
+	if err == nil {
+		return &workspace, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var user models.User
+	if err := db.Select("id", "base_currency").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		workspace = models.Workspace{Name: "Personal", BaseCurrency: user.BaseCurrency, PersonalUserID: &userID}
+		// Concurrent first requests of the same user create it only once
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&workspace)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return tx.Where("personal_user_id = ?", userID).First(&workspace).Error
+		}
+		return tx.Create(&models.WorkspaceMember{WorkspaceID: workspace.ID, UserID: userID, Role: models.RoleOwner}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+// Resolve returns the membership of the user in the workspace, or in the
+// user's personal workspace if workspaceID is zero. It returns ErrNotFound
+// if the user isn't a member.
+func Resolve(db *gorm.DB, userID, workspaceID uint) (*models.WorkspaceMember, error) {
+	if workspaceID == 0 {
+		workspace, err := Personal(db, userID)
+		if err != nil {
+			return nil, err
+		}
+		workspaceID = workspace.ID
+	}
+
+	var member models.WorkspaceMember
+	err := db.Joins("JOIN workspaces ON workspaces.id = workspace_members.workspace_id AND workspaces.deleted_at IS NULL").
+		Where("workspace_members.workspace_id = ? AND workspace_members.user_id = ?", workspaceID, userID).
+		First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// Create creates a workspace with the user as its owner.
+func Create(db *gorm.DB, userID uint, name, baseCurrency string) (*models.Workspace, error) {
+	workspace := models.Workspace{Name: name, BaseCurrency: baseCurrency}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&workspace).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.WorkspaceMember{WorkspaceID: workspace.ID, UserID: userID, Role: models.RoleOwner}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &workspace, nil
+}
+
+// Delete deletes a workspace that isn't a personal one, along with its
+// memberships and invitations. The data in it is kept, but no longer
+// reachable.
+func Delete(db *gorm.DB, workspace *models.Workspace) error {
+	if workspace.PersonalUserID != nil {
+		return ErrPersonal
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ?", workspace.ID).Delete(&models.WorkspaceMember{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("workspace_id = ?", workspace.ID).Delete(&models.WorkspaceInvitation{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(workspace).Error
+	})
+}
+
+// SetRole changes the role of a member. The last owner can't be demoted.
+func SetRole(db *gorm.DB, workspaceID, userID uint, role string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		member, err := lockMember(tx, workspaceID, userID)
+		if err != nil {
+			return err
+		}
+		if member.Role == models.RoleOwner && role != models.RoleOwner {
+			if err := checkOtherOwner(tx, workspaceID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Model(member).Update("role", role).Error
+	})
+}
+
+// RemoveMember removes a user from the workspace. The last owner can't be
+// removed.
+func RemoveMember(db *gorm.DB, workspaceID, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		member, err := lockMember(tx, workspaceID, userID)
+		if err != nil {
+			return err
+		}
+		if member.Role == models.RoleOwner {
+			if err := checkOtherOwner(tx, workspaceID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(member).Error
+	})
+}
+
+func lockMember(tx *gorm.DB, workspaceID, userID uint) (*models.WorkspaceMember, error) {
+	// Lock all owners, so two owners can't demote each other at once
+	var members []models.WorkspaceMember
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("workspace_id = ? AND (user_id = ? OR role = ?)", workspaceID, userID, models.RoleOwner).
+		Find(&members).Error; err != nil {
+		return nil, err
+	}
+	for i := range members {
+		if members[i].UserID == userID {
+			return &members[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func checkOtherOwner(tx *gorm.DB, workspaceID, userID uint) error {
+	var count int64
+	if err := tx.Model(&models.WorkspaceMember{}).
+		Where("workspace_id = ? AND user_id <> ? AND role = ?", workspaceID, userID, models.RoleOwner).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// Invite creates an invitation for the email address to join the workspace
+// with the role. An open invitation of the same address is replaced.
+func Invite(db *gorm.DB, workspaceID, invitedBy uint, email, role string) (*models.WorkspaceInvitation, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	invitation := models.WorkspaceInvitation{
+		WorkspaceID: workspaceID,
+		Email:       email,
+		Role:        role,
+		InvitedByID: invitedBy,
+		ExpiresAt:   time.Now().Add(InvitationTTL),
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.WorkspaceMember{}).
+			Joins("JOIN users ON users.id = workspace_members.user_id").
+			Where("workspace_members.workspace_id = ? AND LOWER(users.email) = ?", workspaceID, email).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrMember
+		}
+
+		if err := tx.Where("workspace_id = ? AND email = ?", workspaceID, email).
+			Delete(&models.WorkspaceInvitation{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+// Pending returns the invitations for the email address that haven't expired.
+func Pending(db *gorm.DB, email string) ([]models.WorkspaceInvitation, error) {
+	invitations := []models.WorkspaceInvitation{}
+	err := db.Preload("Workspace").
+		Joins("JOIN workspaces ON workspaces.id = workspace_invitations.workspace_id AND workspaces.deleted_at IS NULL").
+		Where("workspace_invitations.email = ? AND workspace_invitations.expires_at > ?", strings.ToLower(email), time.Now()).
+		Order("workspace_invitations.created_at").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+// Accept makes the user a member of the invitation's workspace if the
+// invitation is addressed to the user's email and hasn't expired. The
+// invitation is used up. Accounts that haven't verified their email get
+// ErrUnverified, anyone could have signed up with the invited address.
+func Accept(db *gorm.DB, invitationID uint, user *models.User) (*models.WorkspaceMember, error) {
+	if user.ActivatedAt == nil {
+		return nil, ErrUnverified
+	}
+	var member models.WorkspaceMember
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var invitation models.WorkspaceInvitation
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND email = ? AND expires_at > ?", invitationID, strings.ToLower(user.Email), time.Now()).
+			First(&invitation).Error; err != nil {
+			return ErrNotFound
+		}
+
+		member = models.WorkspaceMember{WorkspaceID: invitation.WorkspaceID, UserID: user.ID, Role: invitation.Role}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&member).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &member, nil
+}
+
+// Decline deletes an invitation addressed to the user's email. Like Accept
+// it requires a verified account.
+func Decline(db *gorm.DB, invitationID uint, user *models.User) error {
+	if user.ActivatedAt == nil {
+		return ErrUnverified
+	}
+	result := db.Where("id = ? AND email = ?", invitationID, strings.ToLower(user.Email)).
+		Delete(&models.WorkspaceInvitation{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package workspaces
+
+import (
+	"testing"
+	"time"
+
+	"expense-tracker/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("Failed to connect to test database: %v", err)
+	}
+
+	err = db.AutoMigrate(&models.User{}, &models.Workspace{}, &models.WorkspaceMember{}, &models.WorkspaceInvitation{})
+	if err != nil {
+		t.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	return db
+}
+
+func createUser(t *testing.T, db *gorm.DB, email string) *models.User {
+	now := time.Now()
+	user := &models.User{Email: email, PasswordHash: "x", BaseCurrency: "CHF", ActivatedAt: &now}
+	assert.NoError(t, db.Create(user).Error)
+	return user
+}
+
+func TestAllows(t *testing.T) {
+	assert.True(t, Allows(models.RoleOwner, models.RoleEditor))
+	assert.True(t, Allows(models.RoleEditor, models.RoleEditor))
+	assert.False(t, Allows(models.RoleViewer, models.RoleEditor))
+	assert.False(t, Allows("", models.RoleViewer))
+}
+
+func TestPersonal(t *testing.T) {
+	db := setupTestDB(t)
+	user := createUser(t, db, "test@example.com")
+
+	workspace, err := Personal(db, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "CHF", workspace.BaseCurrency)
+
+	again, err := Personal(db, user.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, workspace.ID, again.ID)
+
+	member, err := Resolve(db, user.ID, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, workspace.ID, member.WorkspaceID)
+	assert.Equal(t, models.RoleOwner, member.Role)
+
+	assert.ErrorIs(t, Delete(db, workspace), ErrPersonal)
+}
+
+func TestMembers(t *testing.T) {
+	db := setupTestDB(t)
+	owner := createUser(t, db, "owner@example.com")
+	partner := createUser(t, db, "partner@example.com")
+
+	workspace, err := Create(db, owner.ID, "Household", "EUR")
+	assert.NoError(t, err)
+
+	_, err = Resolve(db, partner.ID, workspace.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	invitation, err := Invite(db, workspace.ID, owner.ID, " Partner@Example.com", models.RoleEditor)
+	assert.NoError(t, err)
+	assert.Equal(t, "partner@example.com", invitation.Email)
+
+	_, err = Invite(db, workspace.ID, owner.ID, "owner@example.com", models.RoleEditor)
+	assert.ErrorIs(t, err, ErrMember)
+
+	// Invitations are only accepted by the invited address
+	_, err = Accept(db, invitation.ID, owner)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	pending, err := Pending(db, partner.Email)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, "Household", pending[0].Workspace.Name)
+
+	// Only once the address is verified
+	activated := partner.ActivatedAt
+	partner.ActivatedAt = nil
+	_, err = Accept(db, invitation.ID, partner)
+	assert.ErrorIs(t, err, ErrUnverified)
+	assert.ErrorIs(t, Decline(db, invitation.ID, partner), ErrUnverified)
+	partner.ActivatedAt = activated
+
+	member, err := Accept(db, invitation.ID, partner)
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleEditor, member.Role)
+
+	// An invitation is used up
+	_, err = Accept(db, invitation.ID, partner)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// The last owner has to stay
+	assert.ErrorIs(t, SetRole(db, workspace.ID, owner.ID, models.RoleViewer), ErrLastOwner)
+	assert.ErrorIs(t, RemoveMember(db, workspace.ID, owner.ID), ErrLastOwner)
+
+	assert.NoError(t, SetRole(db, workspace.ID, partner.ID, models.RoleOwner))
+	assert.NoError(t, RemoveMember(db, workspace.ID, owner.ID))
+
+	_, err = Resolve(db, owner.ID, workspace.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	// Deleted workspaces are no longer reachable
+	assert.NoError(t, Delete(db, workspace))
+	_, err = Resolve(db, partner.ID, workspace.ID)
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestExpiredInvitation(t *testing.T) {
+	db := setupTestDB(t)
+	owner := createUser(t, db, "owner@example.com")
+	partner := createUser(t, db, "partner@example.com")
+
+	workspace, err := Create(db, owner.ID, "Household", "EUR")
+	assert.NoError(t, err)
+
+	invitation, err := Invite(db, workspace.ID, owner.ID, partner.Email, models.RoleViewer)
+	assert.NoError(t, err)
+	db.Model(invitation).Update("expires_at", time.Now().Add(-time.Hour))
+
+	pending, err := Pending(db, partner.Email)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	_, err = Accept(db, invitation.ID, partner)
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, Decline(db, invitation.ID, partner))
+	assert.ErrorIs(t, Decline(db, invitation.ID, partner), ErrNotFound)
+}
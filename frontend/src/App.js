@@ -5,6 +5,9 @@ import CssBaseline from '@mui/material/CssBaseline';
 import Box from '@mui/material/Box';
 import Login from './pages/Login';
 import Register from './pages/Register';
+import OidcCallback from './pages/OidcCallback';
+import VerifyEmail from './pages/VerifyEmail';
+import ResetPassword from './pages/ResetPassword';
 import Dashboard from './pages/Dashboard';
 import ExpenseHistory from './pages/ExpenseHistory';
 import BudgetManagement from './pages/BudgetManagement';
@@ -30,6 +33,9 @@ const AppContent = () => {
     <Routes>
       <Route path="/login" element={<Login />} />
       <Route path="/register" element={<Register />} />
+      <Route path="/auth/oidc/:provider/callback" element={<OidcCallback />} />
+      <Route path="/verify" element={<VerifyEmail />} />
+      <Route path="/reset-password" element={<ResetPassword />} />
       <Route
         path="/"
         element={
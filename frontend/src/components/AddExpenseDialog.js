@@ -19,6 +19,7 @@ function AddExpenseDialog({ open, onClose, onExpenseAdded }) {
     amount: '',
     budget: '',
     description: '',
+    notes: '',
     date: new Date().toISOString().split('T')[0],
   });
 
@@ -114,6 +115,15 @@ function AddExpenseDialog({ open, onClose, onExpenseAdded }) {
             required
             margin="normal"
           />
+          <TextField
+            fullWidth
+            label="Notes"
+            value={formData.notes}
+            onChange={(e) => setFormData({ ...formData, notes: e.target.value })}
+            multiline
+            minRows={2}
+            margin="normal"
+          />
           <TextField
             fullWidth
             type="date"
@@ -1,4 +1,4 @@
-import React from 'react';
+import React, { useEffect, useState } from 'react';
 import { useNavigate, useLocation } from 'react-router-dom';
 import Drawer from '@mui/material/Drawer';
 import List from '@mui/material/List';
@@ -10,14 +10,39 @@ import DashboardIcon from '@mui/icons-material/Dashboard';
 import HistoryIcon from '@mui/icons-material/History';
 import AccountBalanceWalletIcon from '@mui/icons-material/AccountBalanceWallet';
 import LogoutIcon from '@mui/icons-material/Logout';
-import { Box, Typography, Divider } from '@mui/material';
-import { auth } from '../services/api';
+import { Box, Typography, Divider, MenuItem, TextField } from '@mui/material';
+import { auth, workspaces } from '../services/api';
 
 const drawerWidth = 240;
 
 function Navigation() {
   const navigate = useNavigate();
   const location = useLocation();
+  const [workspaceList, setWorkspaceList] = useState([]);
+  const [workspaceId, setWorkspaceId] = useState(workspaces.selected());
+
+  useEffect(() => {
+    workspaces.getAll()
+      .then((response) => {
+        setWorkspaceList(response.data);
+        // Fall back to the personal workspace after leaving the selected one
+        const selected = workspaces.selected();
+        if (selected && !response.data.some((workspace) => String(workspace.id) === selected)) {
+          workspaces.select('');
+          window.location.reload();
+        }
+      })
+      .catch((error) => console.error('Failed to fetch workspaces:', error));
+  }, []);
+
+  // The personal workspace comes first and needs no header
+  const handleWorkspaceChange = (event) => {
+    const id = event.target.value;
+    const personal = workspaceList.length > 0 && String(workspaceList[0].id) === id;
+    workspaces.select(personal ? '' : id);
+    setWorkspaceId(personal ? '' : id);
+    window.location.reload();
+  };
 
   const handleLogout = () => {
     auth.logout();
@@ -45,6 +70,23 @@ function Navigation() {
         <Typography variant="h6" color="primary" sx={{ fontWeight: 'bold' }}>
           Expense Tracker
         </Typography>
+        {workspaceList.length > 1 && (
+          <TextField
+            select
+            fullWidth
+            size="small"
+            label="Workspace"
+            margin="normal"
+            value={workspaceId || String(workspaceList[0].id)}
+            onChange={handleWorkspaceChange}
+          >
+            {workspaceList.map((workspace) => (
+              <MenuItem key={workspace.id} value={String(workspace.id)}>
+                {workspace.name}
+              </MenuItem>
+            ))}
+          </TextField>
+        )}
       </Box>
       <Divider />
       <List>
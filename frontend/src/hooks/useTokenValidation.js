@@ -18,6 +18,7 @@ export function useTokenValidation(interval = 60000) { // Default: check every m
       } catch (error) {
         console.error('Token validation failed:', error);
         localStorage.removeItem('token');
+        localStorage.removeItem('refresh_token');
         navigate('/login');
       }
     };
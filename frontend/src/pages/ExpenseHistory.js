@@ -2,7 +2,7 @@ import React, { useState, useEffect, useCallback } from 'react';
 import { format } from 'date-fns';
 import { expenses } from '../services/api';
 import { DataGrid } from '@mui/x-data-grid';
-import { Paper, Typography, Fab } from '@mui/material';
+import { Paper, Typography, Fab, Button, Box, TextField } from '@mui/material';
 import { Add as AddIcon } from '@mui/icons-material';
 import AddExpenseDialog from '../components/AddExpenseDialog';
 
@@ -11,17 +11,26 @@ function ExpenseHistory() {
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState(null);
   const [openAddExpense, setOpenAddExpense] = useState(false);
+  const [total, setTotal] = useState(0);
+  const [nextCursor, setNextCursor] = useState('');
+  const [search, setSearch] = useState('');
 
-  const fetchExpenses = useCallback(async () => {
+  // Expenses are loaded page by page, a cursor continues with the next page
+  const fetchExpenses = useCallback(async (cursor) => {
+    setLoading(true);
     try {
-      const response = await expenses.getAll();
-      setExpenseList(response.data);
+      const params = { description: search || undefined, cursor: cursor || undefined };
+      const response = await expenses.list(params);
+      const page = response.data;
+      setExpenseList((list) => (cursor ? [...list, ...page.expenses] : page.expenses));
+      setTotal(page.total);
+      setNextCursor(page.next_cursor || '');
       setLoading(false);
     } catch (err) {
       setError(err.message);
       setLoading(false);
     }
-  }, []);
+  }, [search]);
 
   useEffect(() => {
     fetchExpenses();
@@ -76,6 +85,12 @@ function ExpenseHistory() {
       <Typography variant="h5" gutterBottom>
         Expense History
       </Typography>
+      <TextField
+        label="Search descriptions"
+        size="small"
+        value={search}
+        onChange={(e) => setSearch(e.target.value)}
+      />
       <DataGrid
         rows={expenseList}
         columns={columns}
@@ -87,6 +102,16 @@ function ExpenseHistory() {
         }}
         sx={{ mt: 2 }}
       />
+      <Box sx={{ mt: 2, display: 'flex', alignItems: 'center', gap: 2 }}>
+        <Typography variant="body2" color="text.secondary">
+          Showing {expenseList.length} of {total} expenses
+        </Typography>
+        {nextCursor && (
+          <Button onClick={() => fetchExpenses(nextCursor)} disabled={loading}>
+            Load more
+          </Button>
+        )}
+      </Box>
       <Fab
         color="primary"
         sx={{ position: 'fixed', bottom: 24, right: 24 }}
@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react';
-import { useNavigate } from 'react-router-dom';
-import { auth } from '../services/api';
+import { useLocation, useNavigate } from 'react-router-dom';
+import { auth, storeSession } from '../services/api';
 import {
   Box,
   Paper,
@@ -14,8 +14,29 @@ import {
 
 function Login() {
   const navigate = useNavigate();
+  const location = useLocation();
   const [credentials, setCredentials] = useState({ email: '', password: '' });
   const [error, setError] = useState('');
+  // Logins at an identity provider arrive here for their second step
+  const [mfaToken, setMfaToken] = useState(location.state?.mfaToken || '');
+  const [code, setCode] = useState('');
+  const [providers, setProviders] = useState([]);
+
+  useEffect(() => {
+    auth
+      .oidcProviders()
+      .then((response) => setProviders(response.data.providers || []))
+      .catch(() => setProviders([]));
+  }, []);
+
+  const handleProviderLogin = async (provider) => {
+    try {
+      const response = await auth.oidcLogin(provider);
+      window.location.assign(response.data.url);
+    } catch (err) {
+      setError(err.response?.data?.error || 'Login failed');
+    }
+  };
 
   useEffect(() => {
     const checkToken = async () => {
@@ -35,11 +56,19 @@ function Login() {
   const handleSubmit = async (e) => {
     e.preventDefault();
     try {
-      const response = await auth.login(credentials);
-      localStorage.setItem('token', response.data.token);
+      // Accounts with two-factor authentication need a code as second step
+      const response = mfaToken
+        ? await auth.loginMfa({ mfa_token: mfaToken, code })
+        : await auth.login(credentials);
+      if (response.data.mfa_required) {
+        setMfaToken(response.data.mfa_token);
+        setError('');
+        return;
+      }
+      storeSession(response.data);
       navigate('/');
     } catch (err) {
-      setError(err.response?.data?.message || 'Login failed');
+      setError(err.response?.data?.error || 'Login failed');
     }
   };
 
@@ -63,34 +92,51 @@ function Login() {
             </Alert>
           )}
           <Box component="form" onSubmit={handleSubmit} noValidate>
-            <TextField
-              margin="normal"
-              required
-              fullWidth
-              id="email"
-              label="Email Address"
-              name="email"
-              autoComplete="email"
-              autoFocus
-              value={credentials.email}
-              onChange={(e) =>
-                setCredentials({ ...credentials, email: e.target.value })
-              }
-            />
-            <TextField
-              margin="normal"
-              required
-              fullWidth
-              name="password"
-              label="Password"
-              type="password"
-              id="password"
-              autoComplete="current-password"
-              value={credentials.password}
-              onChange={(e) =>
-                setCredentials({ ...credentials, password: e.target.value })
-              }
-            />
+            {mfaToken ? (
+              <TextField
+                margin="normal"
+                required
+                fullWidth
+                id="code"
+                label="Authenticator or Recovery Code"
+                name="code"
+                autoComplete="one-time-code"
+                autoFocus
+                value={code}
+                onChange={(e) => setCode(e.target.value)}
+              />
+            ) : (
+              <>
+                <TextField
+                  margin="normal"
+                  required
+                  fullWidth
+                  id="email"
+                  label="Email Address"
+                  name="email"
+                  autoComplete="email"
+                  autoFocus
+                  value={credentials.email}
+                  onChange={(e) =>
+                    setCredentials({ ...credentials, email: e.target.value })
+                  }
+                />
+                <TextField
+                  margin="normal"
+                  required
+                  fullWidth
+                  name="password"
+                  label="Password"
+                  type="password"
+                  id="password"
+                  autoComplete="current-password"
+                  value={credentials.password}
+                  onChange={(e) =>
+                    setCredentials({ ...credentials, password: e.target.value })
+                  }
+                />
+              </>
+            )}
             <Button
               type="submit"
               fullWidth
@@ -99,7 +145,32 @@ function Login() {
             >
               Sign In
             </Button>
+            {!mfaToken &&
+              providers.map((provider) => (
+                <Button
+                  key={provider}
+                  fullWidth
+                  variant="outlined"
+                  sx={{ mb: 1 }}
+                  onClick={() => handleProviderLogin(provider)}
+                >
+                  Sign in with {provider}
+                </Button>
+              ))}
             <Box sx={{ textAlign: 'center', mt: 2 }}>
+              {!mfaToken && (
+                <Typography variant="body2" sx={{ mb: 1 }}>
+                  <Link
+                    component="button"
+                    type="button"
+                    variant="body2"
+                    onClick={() => navigate('/reset-password')}
+                    sx={{ textDecoration: 'none' }}
+                  >
+                    Forgot password?
+                  </Link>
+                </Typography>
+              )}
               <Typography variant="body2">
                 Don't have an account?{' '}
                 <Link
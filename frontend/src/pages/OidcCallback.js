@@ -0,0 +1,58 @@
+import React, { useEffect, useRef, useState } from 'react';
+import { useNavigate, useParams, useSearchParams } from 'react-router-dom';
+import { auth, storeSession } from '../services/api';
+import { Box, Container, Alert, CircularProgress, Link } from '@mui/material';
+
+function OidcCallback() {
+  const navigate = useNavigate();
+  const { provider } = useParams();
+  const [searchParams] = useSearchParams();
+  const [error, setError] = useState('');
+  // The code can only be redeemed once, even if the effect runs twice
+  const started = useRef(false);
+
+  useEffect(() => {
+    if (started.current) return;
+    started.current = true;
+
+    const code = searchParams.get('code');
+    const state = searchParams.get('state');
+    if (!code || !state) {
+      setError(searchParams.get('error_description') || 'Login was cancelled');
+      return;
+    }
+
+    auth
+      .oidcCallback(provider, { code, state })
+      .then((response) => {
+        // The login page asks for the code of accounts with two-factor
+        // authentication
+        if (response.data.mfa_required) {
+          navigate('/login', { replace: true, state: { mfaToken: response.data.mfa_token } });
+          return;
+        }
+        storeSession(response.data);
+        navigate('/', { replace: true });
+      })
+      .catch((err) => setError(err.response?.data?.error || 'Login failed'));
+  }, [provider, searchParams, navigate]);
+
+  return (
+    <Container component="main" maxWidth="xs">
+      <Box sx={{ marginTop: 8, display: 'flex', flexDirection: 'column', alignItems: 'center' }}>
+        {error ? (
+          <Alert severity="error" sx={{ width: '100%' }}>
+            {error}{' '}
+            <Link component="button" variant="body2" onClick={() => navigate('/login')}>
+              Back to login
+            </Link>
+          </Alert>
+        ) : (
+          <CircularProgress />
+        )}
+      </Box>
+    </Container>
+  );
+}
+
+export default OidcCallback;
@@ -0,0 +1,145 @@
+import React, { useState } from 'react';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+import { auth } from '../services/api';
+import {
+  Box,
+  Paper,
+  TextField,
+  Button,
+  Typography,
+  Container,
+  Alert,
+  Link,
+} from '@mui/material';
+
+// Without a token it asks for the email to send a reset link to, with the
+// token of that link for the new password
+function ResetPassword() {
+  const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get('token');
+  const [email, setEmail] = useState('');
+  const [password, setPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [error, setError] = useState('');
+  const [message, setMessage] = useState('');
+  const [done, setDone] = useState(false);
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    setError('');
+
+    if (!token) {
+      try {
+        const response = await auth.forgotPassword(email);
+        setMessage(response.data.message);
+        setDone(true);
+      } catch (err) {
+        setError(err.response?.data?.error || 'Failed to send the email');
+      }
+      return;
+    }
+
+    if (password !== confirmPassword) {
+      setError('Passwords do not match');
+      return;
+    }
+    try {
+      await auth.resetPassword(token, password);
+      setMessage('Your password was reset, sign in with the new one.');
+      setDone(true);
+    } catch (err) {
+      setError(err.response?.data?.error || 'Failed to reset password');
+    }
+  };
+
+  return (
+    <Container component="main" maxWidth="xs">
+      <Box
+        sx={{
+          marginTop: 8,
+          display: 'flex',
+          flexDirection: 'column',
+          alignItems: 'center',
+        }}
+      >
+        <Paper elevation={3} sx={{ p: 4, width: '100%' }}>
+          <Typography component="h1" variant="h5" align="center" gutterBottom>
+            Reset Password
+          </Typography>
+          {error && (
+            <Alert severity="error" sx={{ mb: 2 }}>
+              {error}
+            </Alert>
+          )}
+          {message && (
+            <Alert severity={token ? 'success' : 'info'} sx={{ mb: 2 }}>
+              {message}
+            </Alert>
+          )}
+          {!done && (
+            <Box component="form" onSubmit={handleSubmit} noValidate>
+              {token ? (
+                <>
+                  <TextField
+                    margin="normal"
+                    required
+                    fullWidth
+                    name="password"
+                    label="New Password"
+                    type="password"
+                    id="password"
+                    autoComplete="new-password"
+                    autoFocus
+                    value={password}
+                    onChange={(e) => setPassword(e.target.value)}
+                  />
+                  <TextField
+                    margin="normal"
+                    required
+                    fullWidth
+                    name="confirmPassword"
+                    label="Confirm Password"
+                    type="password"
+                    id="confirmPassword"
+                    autoComplete="new-password"
+                    value={confirmPassword}
+                    onChange={(e) => setConfirmPassword(e.target.value)}
+                  />
+                </>
+              ) : (
+                <TextField
+                  margin="normal"
+                  required
+                  fullWidth
+                  id="email"
+                  label="Email Address"
+                  name="email"
+                  autoComplete="email"
+                  autoFocus
+                  value={email}
+                  onChange={(e) => setEmail(e.target.value)}
+                />
+              )}
+              <Button type="submit" fullWidth variant="contained" sx={{ mt: 3, mb: 2 }}>
+                {token ? 'Set Password' : 'Send Reset Link'}
+              </Button>
+            </Box>
+          )}
+          <Box sx={{ textAlign: 'center', mt: 2 }}>
+            <Link
+              component="button"
+              variant="body2"
+              onClick={() => navigate('/login')}
+              sx={{ textDecoration: 'none' }}
+            >
+              Back to login
+            </Link>
+          </Box>
+        </Paper>
+      </Box>
+    </Container>
+  );
+}
+
+export default ResetPassword;
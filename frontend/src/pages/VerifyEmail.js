@@ -0,0 +1,128 @@
+import React, { useEffect, useRef, useState } from 'react';
+import { useNavigate, useSearchParams } from 'react-router-dom';
+import { auth } from '../services/api';
+import {
+  Box,
+  Paper,
+  TextField,
+  Button,
+  Typography,
+  Container,
+  Alert,
+  CircularProgress,
+  Link,
+} from '@mui/material';
+
+// Opened from the link of the verification email, the token is in the query
+function VerifyEmail() {
+  const navigate = useNavigate();
+  const [searchParams] = useSearchParams();
+  const [status, setStatus] = useState('verifying');
+  const [error, setError] = useState('');
+  const [email, setEmail] = useState('');
+  const [message, setMessage] = useState('');
+  // A token can only be used once, even if the effect runs twice
+  const started = useRef(false);
+
+  useEffect(() => {
+    if (started.current) return;
+    started.current = true;
+
+    const token = searchParams.get('token');
+    if (!token) {
+      setStatus('failed');
+      setError('The link is incomplete');
+      return;
+    }
+
+    auth
+      .verifyEmail(token)
+      .then(() => setStatus('verified'))
+      .catch((err) => {
+        setStatus('failed');
+        setError(err.response?.data?.error || 'Verification failed');
+      });
+  }, [searchParams]);
+
+  const handleResend = async (e) => {
+    e.preventDefault();
+    try {
+      const response = await auth.resendVerification(email);
+      setMessage(response.data.message);
+      setError('');
+    } catch (err) {
+      setError(err.response?.data?.error || 'Failed to send the email');
+    }
+  };
+
+  return (
+    <Container component="main" maxWidth="xs">
+      <Box
+        sx={{
+          marginTop: 8,
+          display: 'flex',
+          flexDirection: 'column',
+          alignItems: 'center',
+        }}
+      >
+        <Paper elevation={3} sx={{ p: 4, width: '100%' }}>
+          <Typography component="h1" variant="h5" align="center" gutterBottom>
+            Verify Email
+          </Typography>
+          {status === 'verifying' && (
+            <Box sx={{ display: 'flex', justifyContent: 'center' }}>
+              <CircularProgress />
+            </Box>
+          )}
+          {status === 'verified' && (
+            <Alert severity="success" sx={{ mb: 2 }}>
+              Your email address is verified.
+            </Alert>
+          )}
+          {error && (
+            <Alert severity="error" sx={{ mb: 2 }}>
+              {error}
+            </Alert>
+          )}
+          {message && (
+            <Alert severity="info" sx={{ mb: 2 }}>
+              {message}
+            </Alert>
+          )}
+          {status === 'failed' && (
+            <Box component="form" onSubmit={handleResend} noValidate>
+              <TextField
+                margin="normal"
+                required
+                fullWidth
+                id="email"
+                label="Email Address"
+                name="email"
+                autoComplete="email"
+                value={email}
+                onChange={(e) => setEmail(e.target.value)}
+              />
+              <Button type="submit" fullWidth variant="contained" sx={{ mt: 3, mb: 2 }}>
+                Send a New Link
+              </Button>
+            </Box>
+          )}
+          {status !== 'verifying' && (
+            <Box sx={{ textAlign: 'center', mt: 2 }}>
+              <Link
+                component="button"
+                variant="body2"
+                onClick={() => navigate('/login')}
+                sx={{ textDecoration: 'none' }}
+              >
+                Back to login
+              </Link>
+            </Box>
+          )}
+        </Paper>
+      </Box>
+    </Container>
+  );
+}
+
+export default VerifyEmail;
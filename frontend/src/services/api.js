@@ -22,21 +22,95 @@ const addAuthHeader = (config) => {
     return config;
 };
 
+// Requests act on the selected workspace, or the personal one without it
+const addWorkspaceHeader = (config) => {
+    const workspaceId = localStorage.getItem('workspace_id');
+    if (workspaceId) {
+        config.headers['X-Workspace-ID'] = workspaceId;
+    }
+    return config;
+};
+
 api.interceptors.request.use(addAuthHeader);
+api.interceptors.request.use(addWorkspaceHeader);
 authApi.interceptors.request.use(addAuthHeader);
 
+export const storeSession = (session) => {
+    localStorage.setItem('token', session.token);
+    localStorage.setItem('refresh_token', session.refresh_token);
+};
+
+const clearSession = () => {
+    localStorage.removeItem('token');
+    localStorage.removeItem('refresh_token');
+    localStorage.removeItem('workspace_id');
+};
+
+// Concurrent requests that fail with an expired token share one refresh,
+// a refresh token can only be used once.
+let refreshing = null;
+
+const refreshSession = () => {
+    if (!refreshing) {
+        const refreshToken = localStorage.getItem('refresh_token');
+        refreshing = (refreshToken
+            ? axios.post('/auth/refresh', { refresh_token: refreshToken }).then((response) => storeSession(response.data))
+            : Promise.reject(new Error('No refresh token'))
+        ).finally(() => {
+            refreshing = null;
+        });
+    }
+    return refreshing;
+};
+
 export const auth = {
     login: (credentials) => authApi.post('/login', credentials),
+    loginMfa: (data) => authApi.post('/login/mfa', data),
+    oidcProviders: () => authApi.get('/oidc/providers'),
+    oidcLogin: (provider) => authApi.get(`/oidc/${provider}/login`),
+    oidcCallback: (provider, data) => authApi.post(`/oidc/${provider}/callback`, data),
     register: (userData) => authApi.post('/signup', userData),
+    verifyEmail: (token) => authApi.post('/verify', { token }),
+    resendVerification: (email) => authApi.post('/verify/resend', { email }),
+    forgotPassword: (email) => authApi.post('/forgot', { email }),
+    resetPassword: (token, password) => authApi.post('/reset', { token, password }),
     validate: () => authApi.get('/validate'),
-    logout: () => {
-        localStorage.removeItem('token');
-        window.location.href = '/login';
+    logout: async () => {
+        try {
+            await authApi.post('/logout', { refresh_token: localStorage.getItem('refresh_token') });
+        } finally {
+            clearSession();
+            window.location.href = '/login';
+        }
+    },
+    logoutAll: async () => {
+        try {
+            await authApi.post('/logout-all');
+        } finally {
+            clearSession();
+            window.location.href = '/login';
+        }
+    },
+};
+
+export const workspaces = {
+    getAll: () => api.get('/workspaces'),
+    // Empty for the personal workspace
+    selected: () => localStorage.getItem('workspace_id') || '',
+    select: (id) => {
+        if (id) {
+            localStorage.setItem('workspace_id', id);
+        } else {
+            localStorage.removeItem('workspace_id');
+        }
     },
 };
 
 export const expenses = {
     getAll: () => api.get('/expenses'),
+    // Returns a page { expenses, total, next_cursor }, pass next_cursor as
+    // cursor for the next one
+    list: (params) => api.get('/expenses', { params: { limit: 100, ...params } }),
     getById: (id) => api.get(`/expenses/${id}`),
     create: (expense) => api.post('/expenses', {
         ...expense,
@@ -44,6 +118,23 @@ export const expenses = {
     }),
     update: (id, expense) => api.put(`/expenses/${id}`, expense),
     delete: (id) => api.delete(`/expenses/${id}`),
+    // Ranked search by description, notes and budget name, takes the same
+    // filters as list
+    search: (q, params) => api.get('/search', { params: { q, ...params } }),
+};
+
+// Attachments carry url and thumbnail_url, which work in links and image
+// tags for 15 minutes
+export const attachments = {
+    getAll: (expenseId) => api.get(`/expenses/${expenseId}/attachments`),
+    upload: (expenseId, file) => {
+        const form = new FormData();
+        form.append('file', file);
+        return api.post(`/expenses/${expenseId}/attachments`, form, {
+            headers: { 'Content-Type': 'multipart/form-data' },
+        });
+    },
+    delete: (expenseId, id) => api.delete(`/expenses/${expenseId}/attachments/${id}`),
 };
 
 export const budgets = {
@@ -52,6 +143,19 @@ export const budgets = {
     create: (budget) => api.post('/budgets', budget),
     update: (id, budget) => api.put(`/budgets/${id}`, budget),
     delete: (id) => api.delete(`/budgets/${id}`),
+    getAssignments: (month) => api.get('/budgets/assignments', { params: { month } }),
+    assign: (month, assignments) => api.put('/budgets/assignments', { month, budgets: assignments }),
+};
+
+export const income = {
+    getAll: (month) => api.get('/income', { params: { month } }),
+    create: (entry) => api.post('/income', entry),
+    update: (id, entry) => api.put(`/income/${id}`, entry),
+    delete: (id) => api.delete(`/income/${id}`),
+};
+
+export const reports = {
+    cashFlow: (from, to) => api.get('/reports/cash-flow', { params: { from, to } }),
 };
 
 export const dashboard = {
@@ -84,15 +188,32 @@ export const dashboard = {
     },
 };
 
-api.interceptors.response.use(
-    (response) => response,
-    (error) => {
-        if (error.response?.status === 401) {
-            localStorage.removeItem('token');
-            window.location.href = '/login';
-        }
+// Renews an expired access token once and repeats the request, the user has
+// to log in again if that fails.
+const retryWithRefresh = (client) => async (error) => {
+    const request = error.config;
+    if (error.response?.status !== 401 || !request || request.retried) {
+        return Promise.reject(error);
+    }
+    request.retried = true;
+
+    try {
+        await refreshSession();
+    } catch (refreshError) {
+        clearSession();
+        window.location.href = '/login';
         return Promise.reject(error);
     }
-);
+    return client(request);
+};
+
+api.interceptors.response.use((response) => response, retryWithRefresh(api));
+authApi.interceptors.response.use((response) => response, (error) => {
+    // Failed logins and logouts aren't expired sessions
+    if (['/login', '/login/mfa', '/signup', '/logout'].includes(error.config?.url)) {
+        return Promise.reject(error);
+    }
+    return retryWithRefresh(authApi)(error);
+});
 
 export default api; 
\ No newline at end of file